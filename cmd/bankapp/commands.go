@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"bankapp/internal/auth"
+	"bankapp/internal/config"
+	"bankapp/internal/models"
+	"bankapp/internal/storage"
+	"bankapp/pkg/utils"
+)
+
+// defaultReencryptBatchSize - количество карт, перешифровываемых за один запрос к базе
+const defaultReencryptBatchSize = 500
+
+// runCommand выполняет служебную подкоманду вместо запуска сервера
+func runCommand(name string, args []string) error {
+	switch name {
+	case "migrate":
+		return runMigrate(args)
+	case "grant-role":
+		return runGrantRole(args)
+	case "gen-signing-key":
+		return runGenSigningKey(args)
+	case "gen-encryption-key":
+		return runGenEncryptionKey(args)
+	case "reencrypt-cards":
+		return runReencryptCards(args)
+	default:
+		return fmt.Errorf("неизвестная команда %q", name)
+	}
+}
+
+// runMigrate обрабатывает команду `bankapp migrate up|down|status`
+func runMigrate(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("использование: bankapp migrate up|down|status")
+	}
+
+	store, err := storage.OpenDBStorage(config.GetDBConfig())
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := store.MigrateUp()
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("Схема базы данных уже актуальна")
+		}
+		for _, m := range applied {
+			fmt.Printf("Применена миграция %04d_%s\n", m.Version, m.Name)
+		}
+		return nil
+
+	case "down":
+		m, ok, err := store.MigrateDown()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Println("Нет примененных миграций")
+			return nil
+		}
+		fmt.Printf("Откачена миграция %04d_%s\n", m.Version, m.Name)
+		return nil
+
+	case "status":
+		states, err := store.MigrationStatus()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, state := range states {
+			appliedAt := "не применена"
+			if state.Applied {
+				appliedAt = state.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", state.Version, state.Name, appliedAt)
+		}
+		return w.Flush()
+
+	default:
+		return fmt.Errorf("неизвестное действие %q: ожидается up, down или status", args[0])
+	}
+}
+
+// runGrantRole обрабатывает команду `bankapp grant-role <username> <role>`
+// Используется для назначения первого администратора, когда API еще некому вызвать
+func runGrantRole(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("использование: bankapp grant-role <username> <customer|operator|admin>")
+	}
+	username, role := args[0], args[1]
+	if !models.IsValidRole(role) {
+		return fmt.Errorf("неизвестная роль %q", role)
+	}
+
+	store, err := storage.NewDBStorage(config.GetDBConfig())
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	user, ok := store.GetUserByUsername(username)
+	if !ok {
+		return fmt.Errorf("пользователь %q не найден", username)
+	}
+	if user.Role == role {
+		fmt.Printf("Пользователю %s уже назначена роль %s\n", username, role)
+		return nil
+	}
+	if err := store.UpdateUserRole(user.ID, role); err != nil {
+		return err
+	}
+	// Выданные ранее токены содержат прежнюю роль, поэтому все сессии пользователя завершаются
+	if err := store.RevokeAllUserSessions(user.ID, time.Now().Truncate(time.Second).Add(time.Second)); err != nil {
+		return err
+	}
+
+	fmt.Printf("Пользователю %s назначена роль %s, его сессии завершены\n", username, role)
+	return nil
+}
+
+// runGenSigningKey обрабатывает команду `bankapp gen-signing-key <dir> [RS256|EdDSA]`
+// Создает в каталоге новый ключ подписи; kid - время создания, поэтому новый ключ
+// становится активным после перечитывания каталога, если JWT_ACTIVE_KID не задан
+func runGenSigningKey(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("использование: bankapp gen-signing-key <dir> [RS256|EdDSA]")
+	}
+	dir, alg := args[0], auth.AlgEdDSA
+	if len(args) == 2 {
+		alg = args[1]
+	}
+
+	private, err := auth.GenerateSigningKey(alg)
+	if err != nil {
+		return err
+	}
+	data, err := auth.EncodePrivateKeyPEM(private)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	kid := time.Now().UTC().Format("20060102T150405Z") + "-" + strings.ToLower(alg)
+	path := filepath.Join(dir, kid+".pem")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return err
+	}
+
+	fmt.Printf("Создан ключ подписи %s: %s\n", kid, path)
+	return nil
+}
+
+// runGenEncryptionKey обрабатывает команду `bankapp gen-encryption-key <id>`
+// Печатает элемент для ENCRYPTION_KEYS в формате id:base64
+func runGenEncryptionKey(args []string) error {
+	if len(args) != 1 || strings.ContainsAny(args[0], ":,") || args[0] == utils.LegacyKeyID {
+		return fmt.Errorf("использование: bankapp gen-encryption-key <id> (id без символов ':' и ',')")
+	}
+
+	key, err := utils.GenerateEncryptionKey()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s:%s\n", args[0], key)
+	return nil
+}
+
+// runReencryptCards обрабатывает команду `bankapp reencrypt-cards [batch-size]`
+// Перешифровывает номера всех карт и еще не показанные CVV виртуальных карт
+// активным ключом ENCRYPTION_ACTIVE_KEY_ID
+// Команда работает параллельно с запущенным сервером: сервер расшифровывает номера
+// любым ключом из ENCRYPTION_KEYS, а каждая карта обновляется отдельным условным запросом
+func runReencryptCards(args []string) error {
+	batchSize := defaultReencryptBatchSize
+	if len(args) > 1 {
+		return fmt.Errorf("использование: bankapp reencrypt-cards [batch-size]")
+	}
+	if len(args) == 1 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return fmt.Errorf("размер пакета должен быть положительным числом")
+		}
+		batchSize = n
+	}
+
+	activeKeyID, err := utils.ActiveKeyID()
+	if err != nil {
+		return err
+	}
+
+	store, err := storage.NewDBStorage(config.GetDBConfig())
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var reencrypted, skipped int
+	afterID := ""
+	for {
+		cards, err := store.ListCardsForReencryption(activeKeyID, afterID, batchSize)
+		if err != nil {
+			return err
+		}
+		if len(cards) == 0 {
+			break
+		}
+
+		for _, card := range cards {
+			afterID = card.ID
+
+			number, err := utils.DecryptField(card.EncryptedNumber, card.EncryptionKeyID, card.ID)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Карта %s пропущена: %v\n", card.ID, err)
+				skipped++
+				continue
+			}
+			encrypted, keyID, err := utils.EncryptField(number, card.ID)
+			if err != nil {
+				return err
+			}
+
+			// CVV виртуальной карты, еще не показанный владельцу, зашифрован тем же ключом
+			var encryptedCVV string
+			if card.EncryptedCVV != "" {
+				cvv, err := utils.DecryptField(card.EncryptedCVV, card.EncryptionKeyID, utils.CVVAssociatedData(card.ID))
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Карта %s пропущена: %v\n", card.ID, err)
+					skipped++
+					continue
+				}
+				encryptedCVV, _, err = utils.EncryptField(cvv, utils.CVVAssociatedData(card.ID))
+				if err != nil {
+					return err
+				}
+			}
+
+			updated, err := store.UpdateCardEncryption(card.ID, card.EncryptionKeyID, encrypted, encryptedCVV, keyID)
+			if err != nil {
+				return err
+			}
+			if updated {
+				reencrypted++
+			}
+		}
+	}
+
+	fmt.Printf("Перешифровано карт ключом %s: %d, пропущено: %d\n", activeKeyID, reencrypted, skipped)
+	if skipped > 0 {
+		return fmt.Errorf("не удалось перешифровать %d карт", skipped)
+	}
+	return nil
+}
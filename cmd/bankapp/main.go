@@ -1,52 +1,150 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"bankapp/internal/api"
+	"bankapp/internal/auth"
+	"bankapp/internal/config"
 	"bankapp/internal/services"
 	"bankapp/internal/storage"
+	"bankapp/pkg/utils"
 )
 
 func main() {
 	log.SetOutput(os.Stdout)
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 
+	// Служебные подкоманды (например, `bankapp migrate up`) выполняются вместо запуска сервера
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			log.Fatalf("Ошибка выполнения команды %s: %v", os.Args[1], err)
+		}
+		return
+	}
+
 	log.Println("Запуск Simple Bank API...")
 
-	// Инициализируем соединение с базой данных
-	if err := storage.InitStorage(); err != nil {
+	// Загружаем ключи подписи токенов и ключи шифрования данных до приема запросов
+	if err := auth.InitSigningKeys(); err != nil {
+		log.Fatalf("Не удалось загрузить ключи подписи токенов: %v", err)
+	}
+	if err := utils.InitKeyring(); err != nil {
+		log.Fatalf("Не удалось загрузить ключи шифрования: %v", err)
+	}
+
+	// Проверяем настройку источника ключевой ставки, по которой оцениваются кредиты
+	if _, err := services.NewRateProvider(); err != nil {
+		log.Fatalf("Некорректная настройка провайдера ключевой ставки: %v", err)
+	}
+	log.Printf("Провайдер ключевой ставки: %s, при его недоступности: %s", config.GetKeyRateProvider(), config.GetKeyRateFallback())
+
+	// Проверяем настройку модели скоринга заявок на кредит
+	if _, err := services.NewCreditScorer(); err != nil {
+		log.Fatalf("Некорректная настройка скоринга заявок на кредит: %v", err)
+	}
+	log.Printf("Модель скоринга заявок на кредит: %s", config.GetCreditScorer())
+
+	// Инициализируем выбранное хранилище данных
+	store, err := initStorage()
+	if err != nil {
 		log.Fatalf("Не удалось инициализировать хранилище: %v", err)
 	}
-	log.Println("Соединение с базой данных PostgreSQL установлено.")
 
-	// Настраиваем корректное закрытие соединения с базой данных при завершении работы
-	setupGracefulShutdown()
+	// Сверяем балансы счетов с проводками главной книги
+	reportLedgerDiscrepancies(store)
+
+	// Настраиваем корректное закрытие хранилища при завершении работы
+	setupGracefulShutdown(store)
 
 	// Запускаем планировщик платежей
-	services.StartPaymentScheduler()
+	services.NewPaymentScheduler(store, store, services.NewKeyRateService(store)).Start()
 	log.Println("Планировщик платежей запущен.")
 
-	r := api.SetupRouter()
+	// Снимаем удержания по картам, не списанные до истечения срока
+	services.NewHoldExpiryScheduler(store).Start()
+
+	// Удаляем ключи идемпотентности с истекшим сроком хранения
+	services.NewIdempotencyKeyScheduler(store).Start()
+
+	// Ежедневно получаем официальные курсы валют ЦБ РФ и обновляем по ним курсы конвертации
+	services.NewCurrencyRateService(store, store).Start()
+
+	// Периодически удаляем истекшие токены обновления и записи об отозванных токенах
+	startTokenCleanup(store)
+
+	r := api.SetupRouter(store)
 
 	port := "8080"
 	log.Printf("Сервер запускается на порту %s", port)
 
 	loggedRouter := api.LoggingMiddleware(r)
 
-	err := http.ListenAndServe(":"+port, loggedRouter)
-	if err != nil {
+	if err := http.ListenAndServe(":"+port, loggedRouter); err != nil {
 		log.Fatalf("Не удалось запустить сервер: %v", err)
 	}
 }
 
+// initStorage создает хранилище, выбранное переменной окружения STORAGE_BACKEND
+func initStorage() (storage.Storage, error) {
+	switch backend := config.GetStorageBackend(); backend {
+	case config.StorageBackendMemory:
+		log.Println("Используется хранилище в памяти. Данные не сохраняются между запусками.")
+		return storage.NewMemoryStorage(), nil
+	case config.StorageBackendPostgres:
+		store, err := storage.NewDBStorage(config.GetDBConfig())
+		if err != nil {
+			return nil, err
+		}
+		log.Println("Соединение с базой данных PostgreSQL установлено.")
+		return store, nil
+	default:
+		return nil, fmt.Errorf("неизвестное хранилище %q", backend)
+	}
+}
+
+// reportLedgerDiscrepancies сверяет балансы счетов с главной книгой
+// и логирует все найденные расхождения
+func reportLedgerDiscrepancies(store storage.TransactionRepository) {
+	discrepancies, err := store.ReconcileBalances()
+	if err != nil {
+		log.Printf("Не удалось сверить балансы с главной книгой: %v", err)
+		return
+	}
+
+	for _, d := range discrepancies {
+		log.Printf("Расхождение баланса счета %s: в счете %s, по проводкам %s",
+			d.AccountID, d.StoredBalance.String(), d.LedgerBalance.String())
+	}
+	log.Printf("Сверка с главной книгой завершена, расхождений: %d", len(discrepancies))
+}
+
+// startTokenCleanup раз в час удаляет истекшие токены из хранилища
+func startTokenCleanup(store storage.TokenRepository) {
+	ticker := time.NewTicker(time.Hour)
+	go func() {
+		for range ticker.C {
+			purged, err := store.PurgeExpiredTokens(time.Now())
+			if err != nil {
+				log.Printf("Не удалось удалить истекшие токены: %v", err)
+				continue
+			}
+			if purged > 0 {
+				log.Printf("Удалено истекших токенов: %d", purged)
+			}
+		}
+	}()
+}
+
 // setupGracefulShutdown настраивает корректное завершение работы приложения
 // при получении сигналов SIGINT или SIGTERM
-func setupGracefulShutdown() {
+func setupGracefulShutdown(store storage.Storage) {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
@@ -54,10 +152,10 @@ func setupGracefulShutdown() {
 		<-c
 		log.Println("Получен сигнал завершения, закрываем соединения...")
 
-		if err := storage.CloseStorage(); err != nil {
-			log.Printf("Ошибка при закрытии соединения с базой данных: %v", err)
+		if err := store.Close(); err != nil {
+			log.Printf("Ошибка при закрытии хранилища: %v", err)
 		} else {
-			log.Println("Соединение с базой данных закрыто успешно")
+			log.Println("Хранилище закрыто успешно")
 		}
 
 		log.Println("Завершение работы приложения")
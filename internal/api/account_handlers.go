@@ -2,21 +2,24 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/shopspring/decimal"
 
+	"bankapp/internal/config"
 	"bankapp/internal/models"
 	"bankapp/internal/storage"
 	"bankapp/pkg/utils"
 )
 
 // CreateAccountHandler обрабатывает реквесты к счету
-func CreateAccountHandler(w http.ResponseWriter, r *http.Request) {
+func (a *API) CreateAccountHandler(w http.ResponseWriter, r *http.Request) {
 	var req models.CreateAccountRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid request payload")
@@ -28,30 +31,86 @@ func CreateAccountHandler(w http.ResponseWriter, r *http.Request) {
 		respondError(w, http.StatusBadRequest, "UserID is required")
 		return
 	}
+	if !requireSelf(w, r, req.UserID) {
+		return
+	}
 
-	account := models.Account{
-		ID:        utils.CreateUniqueIdentifier(),
-		UserID:    req.UserID,
-		Number:    utils.GenerateBankAccountNumber(),
-		Balance:   decimal.Zero,
-		CreatedAt: time.Now(),
+	accountType := req.Type
+	if accountType == "" {
+		accountType = models.AccountTypeCurrent
+	}
+	balancePrefix, ok := models.AccountBalancePrefix(accountType)
+	if !ok {
+		respondError(w, http.StatusBadRequest, "Account type must be current or savings")
+		return
 	}
 
-	if err := storage.CreateBankAccount(account); err != nil {
+	currency := strings.ToUpper(req.Currency)
+	if currency == "" {
+		currency = models.CurrencyRUB
+	}
+	if !models.IsSupportedCurrency(currency) {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported account currency %q", req.Currency))
+		return
+	}
+
+	account, err := a.openAccount(req.UserID, accountType, currency, balancePrefix)
+	if err != nil {
 		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to create account: %v", err))
 		return
 	}
 
-	log.Printf("Account created: %s for user %s", account.Number, account.UserID)
+	log.Printf("Account created: %s (%s) for user %s", account.Number, account.Currency, account.UserID)
 	respondJSON(w, http.StatusCreated, account)
 }
 
 // GetUserAccountsHandler достает все счета пользователя
-func GetUserAccountsHandler(w http.ResponseWriter, r *http.Request) {
+func (a *API) GetUserAccountsHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID := vars["userId"]
+	if !requireSelf(w, r, userID) {
+		return
+	}
 
-	accounts := storage.GetUserAccounts(userID)
+	accounts := a.accounts.GetUserAccounts(userID)
 	log.Printf("Fetched %d accounts for user %s", len(accounts), userID)
 	respondJSON(w, http.StatusOK, accounts)
 }
+
+// maxAccountNumberAttempts ограничивает число попыток открытия счета, если сгенерированный номер уже занят
+const maxAccountNumberAttempts = 5
+
+// openAccount открывает счет типа accountType в валюте currency с номером на балансовом счете balancePrefix
+// Контрольная цифра номера рассчитывается по БИК банка; если номер уже занят, он генерируется заново
+func (a *API) openAccount(userID, accountType, currency, balancePrefix string) (models.Account, error) {
+	currencyCode, ok := models.CurrencyNumericCode(currency)
+	if !ok {
+		return models.Account{}, fmt.Errorf("unsupported currency %q", currency)
+	}
+
+	bic := config.GetBankBIC()
+	for attempt := 1; ; attempt++ {
+		number, err := utils.GenerateBankAccountNumber(balancePrefix, currencyCode, bic)
+		if err != nil {
+			return models.Account{}, fmt.Errorf("generating account number: %w", err)
+		}
+
+		account := models.Account{
+			ID:        utils.CreateUniqueIdentifier(),
+			UserID:    userID,
+			Number:    number,
+			Type:      accountType,
+			Currency:  currency,
+			Balance:   decimal.Zero,
+			Status:    models.AccountStatusActive,
+			CreatedAt: time.Now(),
+		}
+
+		err = a.accounts.CreateBankAccount(account)
+		if errors.Is(err, storage.ErrAccountNumberTaken) && attempt < maxAccountNumberAttempts {
+			log.Printf("Generated account number is already taken, retrying (attempt %d)", attempt)
+			continue
+		}
+		return account, err
+	}
+}
@@ -0,0 +1,251 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"bankapp/internal/models"
+	"bankapp/internal/storage"
+)
+
+// AdminListUsersHandler возвращает пользователей с фильтрацией по роли и имени
+// Параметры запроса: role, username
+func (a *API) AdminListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.UserFilter{
+		Role:     query.Get("role"),
+		Username: query.Get("username"),
+	}
+	if filter.Role != "" && !models.IsValidRole(filter.Role) {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Unknown role %q", filter.Role))
+		return
+	}
+
+	users, err := a.users.GetAllUsers(filter)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to list users: %v", err))
+		return
+	}
+	if users == nil {
+		users = []models.User{}
+	}
+
+	log.Printf("Admin fetched %d users", len(users))
+	respondJSON(w, http.StatusOK, users)
+}
+
+// AdminSetUserRoleHandler изменяет роль пользователя и завершает все его сессии,
+// чтобы выданные ранее токены с прежней ролью перестали приниматься
+// Единственного администратора лишить роли администратора нельзя
+func (a *API) AdminSetUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+
+	var req models.SetRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if !models.IsValidRole(req.Role) {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Unknown role %q", req.Role))
+		return
+	}
+
+	user, ok := a.users.GetUserByID(userID)
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("User %s not found", userID))
+		return
+	}
+
+	if user.Role == req.Role {
+		respondJSON(w, http.StatusOK, user)
+		return
+	}
+
+	if err := a.users.UpdateUserRole(userID, req.Role); err != nil {
+		if errors.Is(err, storage.ErrLastAdmin) {
+			respondError(w, http.StatusConflict, "Cannot demote the last admin")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to update role: %v", err))
+		return
+	}
+
+	// Время выпуска в JWT хранится с точностью до секунды, поэтому границу сдвигаем на начало следующей секунды:
+	// иначе токен с прежней ролью, выпущенный в ту же секунду, продолжит приниматься
+	if err := a.tokens.RevokeAllUserSessions(userID, time.Now().Truncate(time.Second).Add(time.Second)); err != nil {
+		log.Printf("Failed to revoke sessions of user %s after role change: %v", userID, err)
+		respondError(w, http.StatusInternalServerError, "Role updated, but failed to revoke user sessions")
+		return
+	}
+
+	user.Role = req.Role
+	adminID, _ := GetUserIDFromContext(r)
+	log.Printf("Admin %s set role of user %s to %s and revoked the user's sessions", adminID, userID, req.Role)
+	respondJSON(w, http.StatusOK, user)
+}
+
+// AdminGetUserAccountsHandler возвращает все счета указанного пользователя
+func (a *API) AdminGetUserAccountsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+
+	if _, ok := a.users.GetUserByID(userID); !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("User %s not found", userID))
+		return
+	}
+
+	accounts := a.accounts.GetUserAccounts(userID)
+	if accounts == nil {
+		accounts = []models.Account{}
+	}
+	respondJSON(w, http.StatusOK, accounts)
+}
+
+// AdminFreezeAccountHandler замораживает счет: списания запрещены, зачисления разрешены
+func (a *API) AdminFreezeAccountHandler(w http.ResponseWriter, r *http.Request) {
+	a.setAccountStatus(w, r, models.AccountStatusFrozen)
+}
+
+// AdminUnfreezeAccountHandler снимает заморозку со счета
+func (a *API) AdminUnfreezeAccountHandler(w http.ResponseWriter, r *http.Request) {
+	a.setAccountStatus(w, r, models.AccountStatusActive)
+}
+
+// setAccountStatus изменяет статус счета из пути запроса и возвращает обновленный счет
+func (a *API) setAccountStatus(w http.ResponseWriter, r *http.Request, status string) {
+	accountID := mux.Vars(r)["accountId"]
+
+	if err := a.accounts.UpdateAccountStatus(accountID, status); err != nil {
+		if errors.Is(err, storage.ErrAccountNotFound) {
+			respondError(w, http.StatusNotFound, fmt.Sprintf("Account %s not found", accountID))
+			return
+		}
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to update account status: %v", err))
+		return
+	}
+
+	account, _ := a.accounts.GetAccount(accountID)
+	operatorID, _ := GetUserIDFromContext(r)
+	log.Printf("Operator %s set status of account %s to %s", operatorID, accountID, status)
+	respondJSON(w, http.StatusOK, account)
+}
+
+// AdminUnblockCardHandler снимает блокировку с карты, например после неверных CVV
+// или если утерянная карта нашлась
+func (a *API) AdminUnblockCardHandler(w http.ResponseWriter, r *http.Request) {
+	cardID := mux.Vars(r)["cardId"]
+
+	card, ok := a.cards.GetCard(cardID)
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Card %s not found", cardID))
+		return
+	}
+	if card.Status != models.CardStatusBlocked {
+		respondErrorCode(w, http.StatusConflict, CardErrorInvalidTransition, "Only a blocked card can be unblocked")
+		return
+	}
+
+	operatorID, _ := GetUserIDFromContext(r)
+	log.Printf("Operator %s unblocks card %s", operatorID, cardID)
+	a.transitionCard(w, card, models.CardStatusActive)
+}
+
+// AdminListTransactionsHandler возвращает транзакции с фильтрацией
+// Параметры запроса: account_id, type, from, to (RFC 3339 или YYYY-MM-DD), limit
+func (a *API) AdminListTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.TransactionFilter{
+		AccountID:       query.Get("account_id"),
+		TransactionType: query.Get("type"),
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam(query.Get("from")); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid from parameter. Use RFC 3339 or YYYY-MM-DD.")
+		return
+	}
+	if filter.To, err = parseTimeParam(query.Get("to")); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid to parameter. Use RFC 3339 or YYYY-MM-DD.")
+		return
+	}
+	if limitStr := query.Get("limit"); limitStr != "" {
+		filter.Limit, err = strconv.Atoi(limitStr)
+		if err != nil || filter.Limit <= 0 {
+			respondError(w, http.StatusBadRequest, "Invalid limit parameter. Must be a positive integer.")
+			return
+		}
+	}
+
+	transactions, err := a.transactions.GetAllTransactions(filter)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to list transactions: %v", err))
+		return
+	}
+	if transactions == nil {
+		transactions = []models.Transaction{}
+	}
+
+	log.Printf("Admin fetched %d transactions", len(transactions))
+	respondJSON(w, http.StatusOK, transactions)
+}
+
+// AdminListLoansHandler возвращает кредиты с фильтрацией
+// Параметры запроса: user_id, account_id, active (true/false)
+func (a *API) AdminListLoansHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.LoanFilter{
+		UserID:    query.Get("user_id"),
+		AccountID: query.Get("account_id"),
+	}
+	if activeStr := query.Get("active"); activeStr != "" {
+		active, err := strconv.ParseBool(activeStr)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid active parameter. Must be true or false.")
+			return
+		}
+		filter.ActiveOnly = active
+	}
+
+	loans := a.loans.GetAllLoans(filter)
+	if loans == nil {
+		loans = []models.Loan{}
+	}
+
+	log.Printf("Admin fetched %d loans", len(loans))
+	respondJSON(w, http.StatusOK, loans)
+}
+
+// AdminReconciliationHandler сверяет балансы счетов с главной книгой
+// и возвращает найденные расхождения
+func (a *API) AdminReconciliationHandler(w http.ResponseWriter, r *http.Request) {
+	discrepancies, err := a.transactions.ReconcileBalances()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to reconcile balances: %v", err))
+		return
+	}
+	if discrepancies == nil {
+		discrepancies = []models.BalanceDiscrepancy{}
+	}
+
+	respondJSON(w, http.StatusOK, discrepancies)
+}
+
+// parseTimeParam разбирает параметр даты в формате RFC 3339 или YYYY-MM-DD
+// Пустая строка дает нулевое время (без ограничения)
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"bankapp/internal/models"
+	"bankapp/internal/storage"
+)
+
+// registerTestUser регистрирует пользователя с ролью role и возвращает его ID
+func registerTestUser(t *testing.T, store *storage.MemoryStorage, name, role string) string {
+	t.Helper()
+	id := uuid.New().String()
+	err := store.RegisterNewUser(models.User{
+		ID:        id,
+		Username:  name,
+		Email:     name + "@example.com",
+		Role:      role,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+	return id
+}
+
+func TestAdminSetUserRoleRevokesSessions(t *testing.T) {
+	router, store := newTestRouter(t)
+	adminID := registerTestUser(t, store, "admin", models.RoleAdmin)
+	userID := registerTestUser(t, store, "user", models.RoleCustomer)
+	adminToken := testToken(t, adminID, models.RoleAdmin)
+	userToken := testToken(t, userID, models.RoleCustomer)
+
+	rec := doRequest(t, router, "PUT", "/admin/users/"+userID+"/role", adminToken, models.SetRoleRequest{Role: models.RoleOperator})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT role: статус %d, тело %s", rec.Code, rec.Body)
+	}
+	if user, _ := store.GetUserByID(userID); user.Role != models.RoleOperator {
+		t.Fatalf("роль пользователя %s, ожидалась %s", user.Role, models.RoleOperator)
+	}
+
+	// Токен с прежней ролью, выпущенный до изменения роли, больше не принимается
+	if rec := doRequest(t, router, "GET", "/users/"+userID+"/accounts", userToken, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("токен с прежней ролью: статус %d, ожидался 401", rec.Code)
+	}
+}
+
+func TestAdminSetUserRoleKeepsLastAdmin(t *testing.T) {
+	router, store := newTestRouter(t)
+	adminID := registerTestUser(t, store, "admin", models.RoleAdmin)
+	adminToken := testToken(t, adminID, models.RoleAdmin)
+
+	rec := doRequest(t, router, "PUT", "/admin/users/"+adminID+"/role", adminToken, models.SetRoleRequest{Role: models.RoleCustomer})
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("понижение единственного администратора: статус %d, ожидался 409, тело %s", rec.Code, rec.Body)
+	}
+	if user, _ := store.GetUserByID(adminID); user.Role != models.RoleAdmin {
+		t.Fatalf("единственный администратор лишен роли: %s", user.Role)
+	}
+
+	// При втором администраторе первого можно понизить
+	secondID := registerTestUser(t, store, "second", models.RoleAdmin)
+	secondToken := testToken(t, secondID, models.RoleAdmin)
+	rec = doRequest(t, router, "PUT", "/admin/users/"+adminID+"/role", secondToken, models.SetRoleRequest{Role: models.RoleOperator})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("понижение одного из двух администраторов: статус %d, тело %s", rec.Code, rec.Body)
+	}
+	rec = doRequest(t, router, "PUT", "/admin/users/"+secondID+"/role", secondToken, models.SetRoleRequest{Role: models.RoleCustomer})
+	if rec.Code != http.StatusConflict {
+		t.Errorf("понижение последнего администратора: статус %d, ожидался 409", rec.Code)
+	}
+}
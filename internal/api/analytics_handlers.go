@@ -12,20 +12,23 @@ import (
 	"github.com/shopspring/decimal"
 
 	"bankapp/internal/models"
-	"bankapp/internal/storage"
 )
 
 // GetTransactionsHandler обрабатывает запросы на получение транзакций для счета
-func GetTransactionsHandler(w http.ResponseWriter, r *http.Request) {
+func (a *API) GetTransactionsHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	accountID := vars["accountId"]
 
-	if _, ok := storage.GetAccount(accountID); !ok {
+	account, ok := a.accounts.GetAccount(accountID)
+	if !ok {
 		respondError(w, http.StatusNotFound, fmt.Sprintf("Account %s not found", accountID))
 		return
 	}
+	if !requireAccountOwner(w, r, account) {
+		return
+	}
 
-	transactions := storage.GetAccountTransactions(accountID)
+	transactions := a.transactions.GetAccountTransactions(accountID)
 
 	sort.Slice(transactions, func(i, j int) bool {
 		return transactions[i].Timestamp.After(transactions[j].Timestamp)
@@ -36,22 +39,28 @@ func GetTransactionsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetFinancialSummaryHandler обрабатывает запросы на получение финансовой сводки для пользователя
-func GetFinancialSummaryHandler(w http.ResponseWriter, r *http.Request) {
+func (a *API) GetFinancialSummaryHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userID := vars["userId"]
+	if !requireSelf(w, r, userID) {
+		return
+	}
 
-	accounts := storage.GetUserAccounts(userID)
-	loans := storage.GetUserLoans(userID)
+	accounts := a.accounts.GetUserAccounts(userID)
+	loans := a.loans.GetUserLoans(userID)
 
-	totalBalance := decimal.Zero
+	// Суммы в разных валютах не складываются: итоги считаются по каждой валюте,
+	// а общие поля сводки содержат рублевые итоги
+	balances := make(map[string]decimal.Decimal)
 	for _, acc := range accounts {
-		totalBalance = totalBalance.Add(acc.Balance)
+		balances[acc.Currency] = balances[acc.Currency].Add(acc.Balance)
 	}
+	totalBalance := balances[models.CurrencyRUB]
 
-	totalLoanDebt := decimal.Zero
+	loanDebts := make(map[string]decimal.Decimal)
 	activeLoans := 0
 	for _, loan := range loans {
-		totalLoanDebt = totalLoanDebt.Add(loan.RemainingAmount)
+		loanDebts[loan.Currency] = loanDebts[loan.Currency].Add(loan.RemainingAmount)
 		if loan.RemainingAmount.GreaterThan(decimal.Zero) {
 			activeLoans++
 		}
@@ -61,7 +70,9 @@ func GetFinancialSummaryHandler(w http.ResponseWriter, r *http.Request) {
 		"user_id":               userID,
 		"total_account_balance": totalBalance,
 		"number_of_accounts":    len(accounts),
-		"total_loan_debt":       totalLoanDebt,
+		"balances_by_currency":  balances,
+		"total_loan_debt":       loanDebts[models.CurrencyRUB],
+		"loan_debt_by_currency": loanDebts,
 		"active_loans":          activeLoans,
 	}
 
@@ -70,7 +81,7 @@ func GetFinancialSummaryHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // BalancePredictionHandler обрабатывает запросы на прогнозирование баланса счета на будущие дни
-func BalancePredictionHandler(w http.ResponseWriter, r *http.Request) {
+func (a *API) BalancePredictionHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	accountID := vars["accountId"]
 
@@ -93,17 +104,20 @@ func BalancePredictionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Получаем счет
-	account, ok := storage.GetAccount(accountID)
+	account, ok := a.accounts.GetAccount(accountID)
 	if !ok {
 		respondError(w, http.StatusNotFound, fmt.Sprintf("Account %s not found", accountID))
 		return
 	}
+	if !requireAccountOwner(w, r, account) {
+		return
+	}
 
 	// Получаем все транзакции по счету для анализа шаблонов
-	transactions := storage.GetAccountTransactions(accountID)
+	transactions := a.transactions.GetAccountTransactions(accountID)
 
 	// Получаем все кредиты, связанные с этим счетом
-	loans := storage.GetAccountLoans(accountID)
+	loans := a.loans.GetAccountLoans(accountID)
 
 	// Текущий баланс является отправной точкой
 	currentBalance := account.Balance
@@ -128,7 +142,7 @@ func BalancePredictionHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if tx.ToAccountID == accountID {
-			incomingAmount = incomingAmount.Add(tx.Amount)
+			incomingAmount = incomingAmount.Add(tx.CreditedAmount())
 			incomingCount++
 		}
 	}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"bankapp/internal/auth"
+	"bankapp/internal/storage"
+)
+
+// newTestRouter создает маршрутизатор API поверх хранилища в памяти
+func newTestRouter(t *testing.T) (*mux.Router, *storage.MemoryStorage) {
+	t.Helper()
+	t.Setenv("APP_ENV", auth.DevelopmentEnv)
+	if err := auth.InitSigningKeys(); err != nil {
+		t.Fatalf("InitSigningKeys: %v", err)
+	}
+	store := storage.NewMemoryStorage()
+	return SetupRouter(store), store
+}
+
+// testToken выпускает токен доступа пользователя userID с ролью role
+func testToken(t *testing.T, userID, role string) string {
+	t.Helper()
+	token, err := auth.GenerateJWT(userID, role)
+	if err != nil {
+		t.Fatalf("GenerateJWT: %v", err)
+	}
+	return token
+}
+
+// newTestRequest создает запрос с телом body в JSON; пустой token означает запрос без авторизации
+func newTestRequest(t *testing.T, method, path, token string, body interface{}) *http.Request {
+	t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			t.Fatalf("не удалось закодировать тело запроса: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, &payload)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+// doRequest выполняет запрос к обработчику и возвращает записанный ответ
+func doRequest(t *testing.T, handler http.Handler, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newTestRequest(t, method, path, token, body))
+	return rec
+}
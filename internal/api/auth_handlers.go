@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -15,7 +16,7 @@ import (
 )
 
 // RegisterUserHandler обрабатывает запросы на регистрацию пользователей
-func RegisterUserHandler(w http.ResponseWriter, r *http.Request) {
+func (a *API) RegisterUserHandler(w http.ResponseWriter, r *http.Request) {
 	var req models.RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid request payload")
@@ -39,10 +40,11 @@ func RegisterUserHandler(w http.ResponseWriter, r *http.Request) {
 		Username:     req.Username,
 		Email:        req.Email,
 		PasswordHash: hashedPassword,
+		Role:         models.RoleCustomer,
 		CreatedAt:    time.Now(),
 	}
 
-	if err := storage.RegisterNewUser(user); err != nil {
+	if err := a.users.RegisterNewUser(user); err != nil {
 		respondError(w, http.StatusConflict, err.Error())
 		return
 	}
@@ -62,7 +64,7 @@ func RegisterUserHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // LoginUserHandler обрабатывает запросы на вход пользователей
-func LoginUserHandler(w http.ResponseWriter, r *http.Request) {
+func (a *API) LoginUserHandler(w http.ResponseWriter, r *http.Request) {
 	var req models.LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid request payload")
@@ -70,7 +72,7 @@ func LoginUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	user, ok := storage.GetUserByUsername(req.Username)
+	user, ok := a.users.GetUserByUsername(req.Username)
 	if !ok {
 		respondError(w, http.StatusUnauthorized, "Invalid username or password")
 		return
@@ -81,18 +83,206 @@ func LoginUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// При включенной двухфакторной аутентификации токены выдаются только после проверки кода
+	if mfa, ok := a.mfa.GetUserMFA(user.ID); ok && mfa.Enabled {
+		mfaToken, err := auth.GenerateMFAToken(user.ID)
+		if err != nil {
+			log.Printf("Failed to generate MFA token: %v", err)
+			respondError(w, http.StatusInternalServerError, "Failed to generate authentication token")
+			return
+		}
+
+		log.Printf("User %s passed password check, awaiting second factor", user.Username)
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"message":      "Two-factor code required",
+			"user_id":      user.ID,
+			"mfa_required": true,
+			"mfa_token":    mfaToken,
+			"expires_in":   int64(auth.MFATokenTTL.Seconds()),
+		})
+		return
+	}
+
+	log.Printf("User logged in: %s", user.Username)
+	a.respondWithSession(w, user)
+}
+
+// respondWithSession начинает новую сессию: выдает токен доступа
+// и токен обновления, открывающий новую цепочку ротации
+func (a *API) respondWithSession(w http.ResponseWriter, user models.User) {
+	refreshToken, err := a.issueRefreshToken(user.ID)
+	if err != nil {
+		log.Printf("Failed to issue refresh token: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to generate authentication token")
+		return
+	}
+
 	// Генерируем JWT токен
-	token, err := auth.GenerateJWT(user.ID)
+	token, err := auth.GenerateJWT(user.ID, user.Role)
 	if err != nil {
 		log.Printf("Failed to generate JWT token: %v", err)
 		respondError(w, http.StatusInternalServerError, "Failed to generate authentication token")
 		return
 	}
 
-	log.Printf("User logged in: %s", user.Username)
-	respondJSON(w, http.StatusOK, map[string]string{
-		"message": "Login successful",
-		"user_id": user.ID,
-		"token":   token,
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"message":       "Login successful",
+		"user_id":       user.ID,
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int64(auth.AccessTokenTTL.Seconds()),
 	})
 }
+
+// RefreshTokenHandler обменивает токен обновления на новую пару токенов
+// Предъявленный токен обновления становится недействительным (ротация)
+func (a *API) RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.RefreshToken == "" {
+		respondError(w, http.StatusBadRequest, "refresh_token is required")
+		return
+	}
+
+	refreshToken, err := auth.GenerateRefreshToken()
+	if err != nil {
+		log.Printf("Failed to generate refresh token: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to generate authentication token")
+		return
+	}
+
+	now := time.Now()
+	next, err := a.tokens.RotateRefreshToken(auth.HashRefreshToken(req.RefreshToken), models.RefreshToken{
+		ID:        utils.CreateUniqueIdentifier(),
+		TokenHash: auth.HashRefreshToken(refreshToken),
+		ExpiresAt: now.Add(auth.RefreshTokenTTL),
+		CreatedAt: now,
+	})
+	switch {
+	case errors.Is(err, storage.ErrRefreshTokenReused):
+		respondError(w, http.StatusUnauthorized, "Refresh token reuse detected, all sessions of this login were revoked")
+		return
+	case errors.Is(err, storage.ErrRefreshTokenNotFound),
+		errors.Is(err, storage.ErrRefreshTokenExpired),
+		errors.Is(err, storage.ErrRefreshTokenRevoked):
+		respondError(w, http.StatusUnauthorized, "Invalid or expired refresh token")
+		return
+	case err != nil:
+		log.Printf("Failed to rotate refresh token: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to refresh token")
+		return
+	}
+
+	// Роль берется из хранилища, чтобы изменения роли вступали в силу при обновлении токена
+	user, ok := a.users.GetUserByID(next.UserID)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, "Invalid or expired refresh token")
+		return
+	}
+
+	token, err := auth.GenerateJWT(user.ID, user.Role)
+	if err != nil {
+		log.Printf("Failed to generate JWT token: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to generate authentication token")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"user_id":       user.ID,
+		"token":         token,
+		"refresh_token": refreshToken,
+		"expires_in":    int64(auth.AccessTokenTTL.Seconds()),
+	})
+}
+
+// LogoutHandler завершает сессию: отзывает текущий токен доступа и переданный токен обновления
+// При all_sessions=true отзываются все токены пользователя на всех устройствах
+func (a *API) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.LogoutRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+	}
+	defer r.Body.Close()
+
+	claims, ok := GetClaimsFromContext(r)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	if req.RefreshToken != "" {
+		err := a.tokens.RevokeRefreshToken(claims.UserID, auth.HashRefreshToken(req.RefreshToken))
+		if err != nil && !errors.Is(err, storage.ErrRefreshTokenNotFound) {
+			log.Printf("Failed to revoke refresh token: %v", err)
+			respondError(w, http.StatusInternalServerError, "Failed to log out")
+			return
+		}
+	}
+
+	if req.AllSessions {
+		// Время выпуска в JWT хранится с точностью до секунды, поэтому и границу округляем до секунды
+		if err := a.tokens.RevokeAllUserSessions(claims.UserID, time.Now().Truncate(time.Second)); err != nil {
+			log.Printf("Failed to revoke sessions of user %s: %v", claims.UserID, err)
+			respondError(w, http.StatusInternalServerError, "Failed to log out")
+			return
+		}
+	}
+
+	// Текущий токен отзывается явно: граница all_sessions может не задеть токен, выпущенный в ту же секунду
+	if claims.ID != "" && claims.ExpiresAt != nil {
+		if err := a.tokens.RevokeAccessToken(claims.ID, claims.UserID, claims.ExpiresAt.Time); err != nil {
+			log.Printf("Failed to revoke access token: %v", err)
+			respondError(w, http.StatusInternalServerError, "Failed to log out")
+			return
+		}
+	}
+
+	log.Printf("User logged out: %s (all sessions: %t)", claims.UserID, req.AllSessions)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Logged out"})
+}
+
+// JWKSHandler публикует открытые ключи проверки подписи токенов (RFC 7517)
+// Другие сервисы используют их для проверки токенов bankapp без доступа к закрытым ключам
+func (a *API) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	set, err := auth.PublicJWKS()
+	if err != nil {
+		log.Printf("Failed to load signing keys: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to load signing keys")
+		return
+	}
+
+	// Клиенты кешируют набор ключей ненадолго: новый ключ начинает подписывать токены
+	// только после того, как истечет закешированный набор
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(auth.JWKSCacheTTL.Seconds())))
+	respondJSON(w, http.StatusOK, set)
+}
+
+// issueRefreshToken выпускает токен обновления, начинающий новую цепочку ротации
+func (a *API) issueRefreshToken(userID string) (string, error) {
+	refreshToken, err := auth.GenerateRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	err = a.tokens.SaveRefreshToken(models.RefreshToken{
+		ID:        utils.CreateUniqueIdentifier(),
+		UserID:    userID,
+		FamilyID:  utils.CreateUniqueIdentifier(),
+		TokenHash: auth.HashRefreshToken(refreshToken),
+		ExpiresAt: now.Add(auth.RefreshTokenTTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return "", err
+	}
+	return refreshToken, nil
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/config"
+	"bankapp/internal/models"
+)
+
+// OTPCodeHeader - заголовок с кодом второго фактора для подтверждения чувствительных операций
+const OTPCodeHeader = "X-OTP-Code"
+
+// requireSelf проверяет, что ID пользователя из пути или тела запроса совпадает
+// с аутентифицированным пользователем; иначе отвечает 403 и возвращает false
+func requireSelf(w http.ResponseWriter, r *http.Request, userID string) bool {
+	currentUserID, ok := GetUserIDFromContext(r)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, "Authentication required")
+		return false
+	}
+	if currentUserID != userID {
+		log.Printf("Пользователь %s пытался получить доступ к данным пользователя %s", currentUserID, userID)
+		respondError(w, http.StatusForbidden, "Access to another user's data is forbidden")
+		return false
+	}
+	return true
+}
+
+// requireAccountOwner проверяет, что счет принадлежит аутентифицированному пользователю;
+// иначе отвечает 403 и возвращает false
+func requireAccountOwner(w http.ResponseWriter, r *http.Request, account models.Account) bool {
+	currentUserID, ok := GetUserIDFromContext(r)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, "Authentication required")
+		return false
+	}
+	if account.UserID != currentUserID {
+		log.Printf("Пользователь %s пытался получить доступ к чужому счету %s", currentUserID, account.ID)
+		respondError(w, http.StatusForbidden, "Access to this account is forbidden")
+		return false
+	}
+	return true
+}
+
+// requireLoanOwner проверяет, что кредит оформлен на аутентифицированного пользователя;
+// иначе отвечает 403 и возвращает false
+func requireLoanOwner(w http.ResponseWriter, r *http.Request, loan models.Loan) bool {
+	currentUserID, ok := GetUserIDFromContext(r)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, "Authentication required")
+		return false
+	}
+	if loan.UserID != currentUserID {
+		log.Printf("Пользователь %s пытался получить доступ к чужому кредиту %s", currentUserID, loan.ID)
+		respondError(w, http.StatusForbidden, "Access to this loan is forbidden")
+		return false
+	}
+	return true
+}
+
+// requireStepUp требует подтверждения операции кодом второго фактора из заголовка X-OTP-Code,
+// если сумма превышает порог STEP_UP_THRESHOLD; иначе отвечает 401 и возвращает false
+// Пользователи без двухфакторной аутентификации не могут проводить такие операции
+func (a *API) requireStepUp(w http.ResponseWriter, r *http.Request, amount decimal.Decimal) bool {
+	threshold := config.GetStepUpThreshold()
+	if amount.LessThanOrEqual(threshold) {
+		return true
+	}
+	return a.requireSecondFactor(w, r, "operations above "+threshold.String())
+}
+
+// requireStepUpInCurrency применяет порог requireStepUp к сумме в валюте currency,
+// пересчитанной в рубли по сохраненному курсу; без актуального курса код требуется всегда
+func (a *API) requireStepUpInCurrency(w http.ResponseWriter, r *http.Request, amount decimal.Decimal, currency string) bool {
+	rubAmount, err := a.rubEquivalent(amount, currency, time.Now())
+	if err != nil {
+		log.Printf("Step-up for %s %s without a current exchange rate: %v", amount.String(), currency, err)
+		return a.requireSecondFactor(w, r, "operations in "+currency+" while its exchange rate is unavailable")
+	}
+	return a.requireStepUp(w, r, rubAmount)
+}
+
+// requireSecondFactor требует подтверждения операции кодом второго фактора из заголовка X-OTP-Code
+// независимо от суммы; operation описывает операцию в сообщении об ошибке
+// Пользователи без двухфакторной аутентификации не могут проводить такие операции
+func (a *API) requireSecondFactor(w http.ResponseWriter, r *http.Request, operation string) bool {
+	currentUserID, ok := GetUserIDFromContext(r)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, "Authentication required")
+		return false
+	}
+
+	if mfa, ok := a.mfa.GetUserMFA(currentUserID); !ok || !mfa.Enabled {
+		respondError(w, http.StatusForbidden, "Two-factor authentication must be enabled for "+operation)
+		return false
+	}
+
+	code := r.Header.Get(OTPCodeHeader)
+	if code == "" {
+		respondError(w, http.StatusUnauthorized, "Two-factor code required: repeat the request with the X-OTP-Code header")
+		return false
+	}
+
+	if !a.checkSecondFactor(w, currentUserID, code) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,702 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/auth"
+	"bankapp/internal/config"
+	"bankapp/internal/models"
+	"bankapp/internal/storage"
+)
+
+// authzCustomer - клиент с набором собственных ресурсов, к которым проверяется доступ
+type authzCustomer struct {
+	id            string
+	token         string
+	account       models.Account
+	card          models.Card // Физическая карта; номер и CVV известны открыто
+	virtualCard   models.Card
+	holdID        string
+	paymentID     string // Платеж по карте без спора
+	disputeID     string // Спор по другому платежу
+	ruleID        string
+	loanID        string
+	applicationID string // Заявка, ожидающая решения операциониста
+	mfaSecret     string
+	recoveryCodes []string
+}
+
+// authzFixture - хранилище с двумя клиентами, операционистом и администратором
+type authzFixture struct {
+	router        *mux.Router
+	store         *storage.MemoryStorage
+	owner         *authzCustomer
+	other         *authzCustomer
+	operatorToken string
+	adminToken    string
+}
+
+// setAuthzEnv задает окружение, в котором все маршруты работают без сети:
+// ставка задается вручную, заявки уходят операционисту, курсы читаются из заглушек ЦБ РФ
+func setAuthzEnv(t *testing.T) {
+	t.Setenv("KEY_RATE_PROVIDER", config.KeyRateProviderManual)
+	t.Setenv("KEY_RATE_MANUAL", "16")
+	t.Setenv("CREDIT_SCORER", config.CreditScorerManual)
+	t.Setenv("CBR_STUB_DIR", "../services/testdata/cbr")
+}
+
+// newAuthzFixture создает хранилище с клиентами owner и other, у каждого из которых есть
+// счет, карты, удержание, платежи, спор, правило карты, выданный кредит и заявка на рассмотрении
+func newAuthzFixture(t *testing.T) *authzFixture {
+	t.Helper()
+	router, store := newTestRouter(t)
+	f := &authzFixture{
+		router:        router,
+		store:         store,
+		operatorToken: testToken(t, uuid.New().String(), models.RoleOperator),
+		adminToken:    testToken(t, uuid.New().String(), models.RoleAdmin),
+	}
+	f.owner = f.newCustomer(t, "owner")
+	f.other = f.newCustomer(t, "other")
+	return f
+}
+
+// newCustomer регистрирует клиента и создает его ресурсы через API
+func (f *authzFixture) newCustomer(t *testing.T, name string) *authzCustomer {
+	t.Helper()
+	u := &authzCustomer{id: uuid.New().String()}
+	err := f.store.RegisterNewUser(models.User{
+		ID:        u.id,
+		Username:  name,
+		Email:     name + "@example.com",
+		Role:      models.RoleCustomer,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+	u.token = testToken(t, u.id, models.RoleCustomer)
+
+	f.mustDo(t, "POST", "/accounts", u.token, models.CreateAccountRequest{UserID: u.id}, http.StatusCreated, &u.account)
+	f.mustDo(t, "POST", "/deposits", u.token,
+		models.DepositRequest{ToAccountID: u.account.ID, Amount: decimal.NewFromInt(100000)}, http.StatusOK, nil)
+
+	u.card = f.issueCard(t, u.account.ID, models.CardTypePhysical)
+	u.virtualCard = f.issueCard(t, u.account.ID, models.CardTypeVirtual)
+
+	var hold models.Hold
+	f.mustDo(t, "POST", "/payments/card/authorize", u.token, cardPayment(u.card, 100), http.StatusCreated, &hold)
+	u.holdID = hold.ID
+
+	u.paymentID = f.payWithCard(t, u, 200)
+	var dispute models.Dispute
+	f.mustDo(t, "POST", "/transactions/"+f.payWithCard(t, u, 300)+"/disputes", u.token,
+		models.OpenDisputeRequest{Reason: "Товар не доставлен"}, http.StatusCreated, &dispute)
+	u.disputeID = dispute.ID
+
+	var rule models.MerchantRule
+	f.mustDo(t, "POST", "/cards/"+u.card.ID+"/merchant-rules", u.token,
+		models.MerchantRuleRequest{List: models.MerchantRuleDeny, Kind: "merchant", Value: "Casino"}, http.StatusCreated, &rule)
+	u.ruleID = rule.ID
+
+	// Кредит по первой заявке выдается при одобрении операционистом, вторая ожидает решения
+	var application models.LoanApplication
+	f.mustDo(t, "POST", "/loan-applications", u.token, loanApplication(u), http.StatusCreated, &application)
+	f.mustDo(t, "PUT", "/admin/loan-applications/"+application.ID+"/decision", f.operatorToken,
+		models.LoanDecisionRequest{Decision: "approve", Comment: "Одобрено"}, http.StatusOK, &application)
+	u.loanID = application.LoanID
+	f.mustDo(t, "POST", "/loan-applications", u.token, loanApplication(u), http.StatusCreated, &application)
+	u.applicationID = application.ID
+
+	// Двухфакторная аутентификация включена, коды восстановления подтверждают операции
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret: %v", err)
+	}
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %v", err)
+	}
+	if err := f.store.SaveMFASecret(u.id, secret); err != nil {
+		t.Fatalf("SaveMFASecret: %v", err)
+	}
+	if err := f.store.EnableMFA(u.id, 0, hashes); err != nil {
+		t.Fatalf("EnableMFA: %v", err)
+	}
+	u.mfaSecret = secret
+	u.recoveryCodes = codes
+	return u
+}
+
+// issueCard выпускает карту к счету и возвращает ее вместе с открытыми номером и CVV
+func (f *authzFixture) issueCard(t *testing.T, accountID, cardType string) models.Card {
+	t.Helper()
+	template := models.Card{AccountID: accountID, Product: models.CardProductDebit, Type: cardType}
+	card, err := issueCard(template, config.GetCardBINs()[models.CardProductDebit], f.store.AddCard)
+	if err != nil {
+		t.Fatalf("issueCard: %v", err)
+	}
+	return card
+}
+
+// payWithCard проводит платеж по физической карте клиента и возвращает ID транзакции
+func (f *authzFixture) payWithCard(t *testing.T, u *authzCustomer, amount int64) string {
+	t.Helper()
+	known := make(map[string]bool)
+	for _, tx := range f.store.GetAccountTransactions(u.account.ID) {
+		known[tx.ID] = true
+	}
+	f.mustDo(t, "POST", "/payments/card", u.token, cardPayment(u.card, amount), http.StatusOK, nil)
+	for _, tx := range f.store.GetAccountTransactions(u.account.ID) {
+		if !known[tx.ID] && tx.TransactionType == "payment" {
+			return tx.ID
+		}
+	}
+	t.Fatal("платеж по карте не найден в истории счета")
+	return ""
+}
+
+// mustDo выполняет запрос при подготовке данных и разбирает ответ в out
+func (f *authzFixture) mustDo(t *testing.T, method, path, token string, body interface{}, want int, out interface{}) {
+	t.Helper()
+	rec := doRequest(t, f.router, method, path, token, body)
+	if rec.Code != want {
+		t.Fatalf("%s %s: статус %d, ожидался %d, тело %s", method, path, rec.Code, want, rec.Body)
+	}
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: не удалось разобрать ответ: %v", method, path, err)
+		}
+	}
+}
+
+// cardPayment формирует запрос на оплату картой на сумму amount
+func cardPayment(card models.Card, amount int64) models.PaymentRequest {
+	return models.PaymentRequest{
+		CardNumber:  card.Number,
+		ExpiryMonth: card.ExpiryMonth,
+		ExpiryYear:  card.ExpiryYear,
+		CVV:         card.CVV,
+		Amount:      decimal.NewFromInt(amount),
+		Merchant:    "Shop",
+	}
+}
+
+// loanApplication формирует заявку клиента на кредит по продукту с фиксированной ставкой
+func loanApplication(u *authzCustomer) models.ApplyLoanRequest {
+	return models.ApplyLoanRequest{
+		UserID:     u.id,
+		AccountID:  u.account.ID,
+		Amount:     decimal.NewFromInt(50000),
+		TermMonths: 12,
+		ProductID:  "consumer-fixed",
+	}
+}
+
+// testTOTP вычисляет текущий код TOTP (RFC 6238) для секрета в base32; для некорректного секрета - пустую строку
+func testTOTP(secret string) string {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		return ""
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(time.Now().Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+// authzCase описывает проверку доступа к одному маршруту
+type authzCase struct {
+	method  string
+	route   string // Шаблон маршрута, как он зарегистрирован в SetupRouter
+	name    string // Уточнение, если маршрут проверяется несколькими наборами данных
+	query   string
+	role    string // Роль административного маршрута; пусто - маршрут клиента
+	foreign bool   // В пути или теле передаются ресурсы пользователя: чужие должны давать 403
+	hidden  bool   // Чужой ресурс неотличим от несуществующего: вместо 403 ожидается 404
+	virtual bool   // {cardId} - виртуальная карта клиента
+	otp     bool   // Операция подтверждается кодом восстановления в X-OTP-Code
+	body    func(f *authzFixture, u *authzCustomer) interface{}
+	prepare func(t *testing.T, f *authzFixture)
+	want    int // Статус успешного ответа владельцу или сотруднику с нужной ролью
+}
+
+func (c authzCase) String() string {
+	if c.name != "" {
+		return c.method + " " + c.route + " " + c.name
+	}
+	return c.method + " " + c.route
+}
+
+// path подставляет в шаблон маршрута ID ресурсов клиента u
+func (c authzCase) path(u *authzCustomer) string {
+	card := u.card
+	if c.virtual {
+		card = u.virtualCard
+	}
+	path := strings.NewReplacer(
+		"{userId}", u.id,
+		"{accountId}", u.account.ID,
+		"{cardId}", card.ID,
+		"{holdId}", u.holdID,
+		"{transactionId}", u.paymentID,
+		"{disputeId}", u.disputeID,
+		"{ruleId}", u.ruleID,
+		"{loanId}", u.loanID,
+		"{applicationId}", u.applicationID,
+		"{productId}", "consumer-floating",
+		"{currency}", "USD",
+	).Replace(c.route)
+	if c.query != "" {
+		path += "?" + c.query
+	}
+	return path
+}
+
+// do выполняет запрос маршрута к ресурсам клиента target с токеном token
+func (c authzCase) do(t *testing.T, f *authzFixture, target *authzCustomer, token string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body interface{}
+	if c.body != nil {
+		body = c.body(f, target)
+	}
+	req := newTestRequest(t, c.method, c.path(target), token, body)
+	if c.otp {
+		req.Header.Set(OTPCodeHeader, f.owner.recoveryCodes[0])
+	}
+	rec := httptest.NewRecorder()
+	f.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// emptyBody - тело запроса без полей для обработчиков, которые читают JSON
+func emptyBody(*authzFixture, *authzCustomer) interface{} {
+	return map[string]interface{}{}
+}
+
+// recoveryCodeBody - тело с кодом восстановления владельца
+func recoveryCodeBody(f *authzFixture, _ *authzCustomer) interface{} {
+	return models.OTPCodeRequest{Code: f.owner.recoveryCodes[0]}
+}
+
+// setCardStatus переводит физическую карту владельца в статус status
+func setCardStatus(status string) func(t *testing.T, f *authzFixture) {
+	return func(t *testing.T, f *authzFixture) {
+		if err := f.store.UpdateCardStatus(f.owner.card.ID, models.CardStatusActive, status); err != nil {
+			t.Fatalf("UpdateCardStatus: %v", err)
+		}
+	}
+}
+
+// counterpart возвращает второго клиента фикстуры
+func (f *authzFixture) counterpart(u *authzCustomer) *authzCustomer {
+	if u == f.owner {
+		return f.other
+	}
+	return f.owner
+}
+
+// authzCases перечисляет все маршруты, требующие аутентификации
+var authzCases = []authzCase{
+	// Сессия и двухфакторная аутентификация относятся только к вызывающему пользователю
+	{method: "POST", route: "/logout", want: http.StatusOK},
+	{method: "POST", route: "/2fa/enroll", want: http.StatusOK,
+		prepare: func(t *testing.T, f *authzFixture) {
+			if err := f.store.DisableMFA(f.owner.id); err != nil {
+				t.Fatalf("DisableMFA: %v", err)
+			}
+		}},
+	{method: "POST", route: "/2fa/confirm", want: http.StatusOK,
+		prepare: func(t *testing.T, f *authzFixture) {
+			if err := f.store.DisableMFA(f.owner.id); err != nil {
+				t.Fatalf("DisableMFA: %v", err)
+			}
+			if err := f.store.SaveMFASecret(f.owner.id, f.owner.mfaSecret); err != nil {
+				t.Fatalf("SaveMFASecret: %v", err)
+			}
+		},
+		body: func(f *authzFixture, _ *authzCustomer) interface{} {
+			return models.OTPCodeRequest{Code: testTOTP(f.owner.mfaSecret)}
+		}},
+	{method: "POST", route: "/2fa/disable", body: recoveryCodeBody, want: http.StatusOK},
+	{method: "POST", route: "/2fa/recovery-codes", body: recoveryCodeBody, want: http.StatusOK},
+
+	// Счета
+	{method: "POST", route: "/accounts", foreign: true, want: http.StatusCreated,
+		body: func(_ *authzFixture, u *authzCustomer) interface{} {
+			return models.CreateAccountRequest{UserID: u.id}
+		}},
+	{method: "GET", route: "/users/{userId}/accounts", foreign: true, want: http.StatusOK},
+
+	// Карты
+	{method: "POST", route: "/cards", foreign: true, want: http.StatusCreated,
+		body: func(_ *authzFixture, u *authzCustomer) interface{} {
+			return models.GenerateCardRequest{AccountID: u.account.ID}
+		}},
+	{method: "GET", route: "/accounts/{accountId}/cards", foreign: true, want: http.StatusOK},
+	{method: "POST", route: "/cards/{cardId}/freeze", foreign: true, want: http.StatusOK},
+	{method: "POST", route: "/cards/{cardId}/unfreeze", foreign: true, want: http.StatusOK,
+		prepare: setCardStatus(models.CardStatusFrozen)},
+	{method: "POST", route: "/cards/{cardId}/block", foreign: true, want: http.StatusOK},
+	{method: "POST", route: "/cards/{cardId}/close", foreign: true, want: http.StatusOK},
+	{method: "POST", route: "/cards/{cardId}/reissue", foreign: true, want: http.StatusCreated},
+	{method: "POST", route: "/cards/{cardId}/reveal", foreign: true, virtual: true, otp: true, want: http.StatusOK},
+	{method: "PUT", route: "/cards/{cardId}/limits", foreign: true, want: http.StatusOK,
+		body: func(*authzFixture, *authzCustomer) interface{} {
+			return models.CardLimits{PerTransaction: decimal.NewNullDecimal(decimal.NewFromInt(1000))}
+		}},
+	{method: "GET", route: "/cards/{cardId}/merchant-rules", foreign: true, want: http.StatusOK},
+	{method: "POST", route: "/cards/{cardId}/merchant-rules", foreign: true, want: http.StatusCreated,
+		body: func(*authzFixture, *authzCustomer) interface{} {
+			return models.MerchantRuleRequest{List: models.MerchantRuleDeny, Kind: "category", Value: "gambling"}
+		}},
+	{method: "DELETE", route: "/cards/{cardId}/merchant-rules/{ruleId}", foreign: true, want: http.StatusOK},
+	{method: "POST", route: "/payments/card", foreign: true, want: http.StatusOK,
+		body: func(_ *authzFixture, u *authzCustomer) interface{} {
+			return cardPayment(u.card, 100)
+		}},
+
+	// Двухфазные платежи: держателю карты доступен только просмотр удержаний
+	{method: "POST", route: "/payments/card/authorize", foreign: true, want: http.StatusCreated,
+		body: func(_ *authzFixture, u *authzCustomer) interface{} {
+			return cardPayment(u.card, 100)
+		}},
+	{method: "GET", route: "/payments/card/holds/{holdId}", foreign: true, want: http.StatusOK},
+	{method: "GET", route: "/cards/{cardId}/holds", foreign: true, want: http.StatusOK},
+
+	// Споры
+	{method: "POST", route: "/transactions/{transactionId}/disputes", foreign: true, want: http.StatusCreated,
+		body: func(*authzFixture, *authzCustomer) interface{} {
+			return models.OpenDisputeRequest{Reason: "Платеж не совершался"}
+		}},
+	{method: "GET", route: "/accounts/{accountId}/disputes", foreign: true, want: http.StatusOK},
+
+	// Переводы и пополнения
+	{method: "POST", route: "/transfers", foreign: true, hidden: true, want: http.StatusOK,
+		body: func(f *authzFixture, u *authzCustomer) interface{} {
+			return models.TransferRequest{FromAccountID: u.account.ID, ToAccountID: f.counterpart(u).account.ID,
+				Amount: decimal.NewFromInt(100)}
+		}},
+	{method: "POST", route: "/deposits", foreign: true, want: http.StatusOK,
+		body: func(_ *authzFixture, u *authzCustomer) interface{} {
+			return models.DepositRequest{ToAccountID: u.account.ID, Amount: decimal.NewFromInt(100)}
+		}},
+
+	// Курсы и ставки не принадлежат пользователям
+	{method: "GET", route: "/exchange-rates", want: http.StatusOK},
+	{method: "GET", route: "/rates/currencies", query: "date=2025-01-15", want: http.StatusOK},
+	{method: "GET", route: "/rates/key", want: http.StatusOK},
+
+	// Кредиты
+	{method: "POST", route: "/loan-applications", name: "user_id", foreign: true, want: http.StatusCreated,
+		body: func(_ *authzFixture, u *authzCustomer) interface{} {
+			return loanApplication(u)
+		}},
+	{method: "POST", route: "/loan-applications", name: "account_id", foreign: true, want: http.StatusCreated,
+		// Свой user_id не дает права выдать кредит на чужой счет
+		body: func(f *authzFixture, u *authzCustomer) interface{} {
+			req := loanApplication(u)
+			req.UserID = f.owner.id
+			return req
+		}},
+	{method: "POST", route: "/loans", foreign: true, want: http.StatusCreated,
+		body: func(_ *authzFixture, u *authzCustomer) interface{} {
+			return loanApplication(u)
+		}},
+	{method: "GET", route: "/loan-applications/{applicationId}", foreign: true, want: http.StatusOK},
+	{method: "GET", route: "/users/{userId}/loan-applications", foreign: true, want: http.StatusOK},
+	{method: "GET", route: "/loans/{loanId}/schedule", foreign: true, want: http.StatusOK},
+	{method: "GET", route: "/loan-products", want: http.StatusOK},
+
+	// Аналитика
+	{method: "GET", route: "/analytics/transactions/{accountId}", foreign: true, want: http.StatusOK},
+	{method: "GET", route: "/analytics/summary/{userId}", foreign: true, want: http.StatusOK},
+	{method: "GET", route: "/accounts/{accountId}/predict", foreign: true, want: http.StatusOK},
+
+	// Административные маршруты: клиентам запрещены, операции только администратора запрещены операционистам
+	{method: "GET", route: "/admin/users", role: models.RoleOperator, want: http.StatusOK},
+	{method: "GET", route: "/admin/users/{userId}/accounts", role: models.RoleOperator, want: http.StatusOK},
+	{method: "PUT", route: "/admin/users/{userId}/role", role: models.RoleAdmin, want: http.StatusOK,
+		body: func(*authzFixture, *authzCustomer) interface{} {
+			return models.SetRoleRequest{Role: models.RoleOperator}
+		}},
+	{method: "POST", route: "/admin/accounts/{accountId}/freeze", role: models.RoleOperator, want: http.StatusOK},
+	{method: "POST", route: "/admin/accounts/{accountId}/unfreeze", role: models.RoleOperator, want: http.StatusOK},
+	{method: "POST", route: "/admin/cards/{cardId}/unblock", role: models.RoleOperator, want: http.StatusOK,
+		prepare: setCardStatus(models.CardStatusBlocked)},
+	{method: "POST", route: "/admin/holds/{holdId}/capture", role: models.RoleOperator, body: emptyBody, want: http.StatusOK},
+	{method: "POST", route: "/admin/holds/{holdId}/void", role: models.RoleOperator, want: http.StatusOK},
+	{method: "GET", route: "/admin/transactions", role: models.RoleOperator, want: http.StatusOK},
+	{method: "POST", route: "/admin/transactions/{transactionId}/refund", role: models.RoleOperator, want: http.StatusCreated,
+		body: func(*authzFixture, *authzCustomer) interface{} {
+			return models.RefundRequest{Amount: decimal.NewFromInt(50), Reason: "Возврат товара"}
+		}},
+	{method: "GET", route: "/admin/disputes", role: models.RoleOperator, want: http.StatusOK},
+	{method: "PUT", route: "/admin/disputes/{disputeId}/status", role: models.RoleOperator, want: http.StatusOK,
+		body: func(*authzFixture, *authzCustomer) interface{} {
+			return models.DisputeStatusRequest{Status: models.DisputeStatusUnderReview}
+		}},
+	{method: "GET", route: "/admin/loans", role: models.RoleOperator, want: http.StatusOK},
+	{method: "GET", route: "/admin/loan-applications", role: models.RoleOperator, want: http.StatusOK},
+	{method: "GET", route: "/admin/loan-applications/{applicationId}", role: models.RoleOperator, want: http.StatusOK},
+	{method: "PUT", route: "/admin/loan-applications/{applicationId}/decision", role: models.RoleOperator, want: http.StatusOK,
+		body: func(*authzFixture, *authzCustomer) interface{} {
+			return models.LoanDecisionRequest{Decision: "approve", Comment: "Одобрено"}
+		}},
+	{method: "POST", route: "/admin/loan-applications/{applicationId}/disburse", role: models.RoleOperator, want: http.StatusOK,
+		// Заявка одобрена, но кредит при одобрении выдать не удалось
+		prepare: func(t *testing.T, f *authzFixture) {
+			application, _ := f.store.GetLoanApplication(f.owner.applicationID)
+			approved := application
+			approved.Status = models.LoanApplicationApproved
+			if err := f.store.UpdateLoanApplication(approved, application.Status); err != nil {
+				t.Fatalf("UpdateLoanApplication: %v", err)
+			}
+		}},
+	{method: "GET", route: "/admin/loan-products", role: models.RoleOperator, want: http.StatusOK},
+	{method: "POST", route: "/admin/loan-products", role: models.RoleAdmin, want: http.StatusCreated,
+		body: func(*authzFixture, *authzCustomer) interface{} {
+			return loanProductRequest("Новый продукт")
+		}},
+	{method: "GET", route: "/admin/loan-products/{productId}", role: models.RoleOperator, want: http.StatusOK},
+	{method: "PUT", route: "/admin/loan-products/{productId}", role: models.RoleAdmin, want: http.StatusOK,
+		body: func(*authzFixture, *authzCustomer) interface{} {
+			return loanProductRequest("Измененный продукт")
+		}},
+	{method: "DELETE", route: "/admin/loan-products/{productId}", role: models.RoleAdmin, want: http.StatusOK},
+	{method: "GET", route: "/admin/ledger/reconciliation", role: models.RoleOperator, want: http.StatusOK},
+	{method: "PUT", route: "/admin/exchange-rates/{currency}", role: models.RoleAdmin, want: http.StatusOK,
+		body: func(*authzFixture, *authzCustomer) interface{} {
+			return models.ExchangeRateRequest{Rate: decimal.NewFromInt(90)}
+		}},
+}
+
+// loanProductRequest формирует условия кредитного продукта с надбавкой к ключевой ставке
+func loanProductRequest(name string) models.LoanProductRequest {
+	return models.LoanProductRequest{
+		Name:          name,
+		MinAmount:     decimal.NewFromInt(10000),
+		MaxAmount:     decimal.NewFromInt(1000000),
+		MinTermMonths: 3,
+		MaxTermMonths: 36,
+		RateMargin:    decimal.NewFromInt(3),
+	}
+}
+
+func TestRouteAuthorization(t *testing.T) {
+	setAuthzEnv(t)
+
+	for _, tc := range authzCases {
+		t.Run(tc.String(), func(t *testing.T) {
+			t.Run("без токена", func(t *testing.T) {
+				f := newAuthzFixture(t)
+				if rec := tc.do(t, f, f.owner, ""); rec.Code != http.StatusUnauthorized {
+					t.Errorf("статус %d, ожидался 401, тело %s", rec.Code, rec.Body)
+				}
+			})
+
+			if tc.role == "" && tc.foreign {
+				t.Run("чужие данные", func(t *testing.T) {
+					f := newAuthzFixture(t)
+					want := http.StatusForbidden
+					if tc.hidden {
+						want = http.StatusNotFound
+					}
+					if rec := tc.do(t, f, f.other, f.owner.token); rec.Code != want {
+						t.Errorf("статус %d, ожидался %d, тело %s", rec.Code, want, rec.Body)
+					}
+				})
+			}
+
+			if tc.role != "" {
+				t.Run("без роли", func(t *testing.T) {
+					f := newAuthzFixture(t)
+					tokens := map[string]string{models.RoleCustomer: f.owner.token}
+					if tc.role == models.RoleAdmin {
+						tokens[models.RoleOperator] = f.operatorToken
+					}
+					for role, token := range tokens {
+						if rec := tc.do(t, f, f.owner, token); rec.Code != http.StatusForbidden {
+							t.Errorf("роль %s: статус %d, ожидался 403, тело %s", role, rec.Code, rec.Body)
+						}
+					}
+				})
+			}
+
+			t.Run("владелец", func(t *testing.T) {
+				f := newAuthzFixture(t)
+				if tc.prepare != nil {
+					tc.prepare(t, f)
+				}
+				token := f.owner.token
+				switch tc.role {
+				case models.RoleOperator:
+					token = f.operatorToken
+				case models.RoleAdmin:
+					token = f.adminToken
+				}
+				if rec := tc.do(t, f, f.owner, token); rec.Code != tc.want {
+					t.Errorf("статус %d, ожидался %d, тело %s", rec.Code, tc.want, rec.Body)
+				}
+			})
+		})
+	}
+}
+
+// publicCase описывает маршрут, доступный без токена доступа
+type publicCase struct {
+	method string
+	route  string
+	check  func(t *testing.T, f *authzFixture)
+}
+
+// publicCases проверяют, что маршруты входа работают без токена и отклоняют неверные учетные данные
+var publicCases = []publicCase{
+	{method: "POST", route: "/register", check: func(t *testing.T, f *authzFixture) {
+		f.mustDo(t, "POST", "/register", "", models.RegisterRequest{
+			Username: "newcomer", Email: "newcomer@example.com", Password: "Str0ng-passw0rd"}, http.StatusCreated, nil)
+	}},
+	{method: "POST", route: "/login", check: func(t *testing.T, f *authzFixture) {
+		registerWithPassword(t, f, "login-user")
+		f.mustDo(t, "POST", "/login", "", models.LoginRequest{Username: "login-user", Password: "Str0ng-passw0rd"}, http.StatusOK, nil)
+		f.mustDo(t, "POST", "/login", "", models.LoginRequest{Username: "login-user", Password: "wrong"}, http.StatusUnauthorized, nil)
+	}},
+	{method: "POST", route: "/login/2fa", check: func(t *testing.T, f *authzFixture) {
+		userID := registerWithPassword(t, f, "mfa-user")
+		codes, hashes, err := auth.GenerateRecoveryCodes()
+		if err != nil {
+			t.Fatalf("GenerateRecoveryCodes: %v", err)
+		}
+		if err := f.store.SaveMFASecret(userID, f.owner.mfaSecret); err != nil {
+			t.Fatalf("SaveMFASecret: %v", err)
+		}
+		if err := f.store.EnableMFA(userID, 0, hashes); err != nil {
+			t.Fatalf("EnableMFA: %v", err)
+		}
+
+		var challenge struct {
+			MFAToken string `json:"mfa_token"`
+		}
+		f.mustDo(t, "POST", "/login", "", models.LoginRequest{Username: "mfa-user", Password: "Str0ng-passw0rd"}, http.StatusOK, &challenge)
+		f.mustDo(t, "POST", "/login/2fa", "", models.LoginMFARequest{MFAToken: "invalid", Code: codes[0]}, http.StatusUnauthorized, nil)
+		// Промежуточный токен одного пользователя не принимает коды другого
+		f.mustDo(t, "POST", "/login/2fa", "", models.LoginMFARequest{MFAToken: challenge.MFAToken, Code: f.owner.recoveryCodes[0]},
+			http.StatusUnauthorized, nil)
+		// После неудачной попытки промежуточный токен больше не действует, нужно снова ввести пароль
+		f.mustDo(t, "POST", "/login/2fa", "", models.LoginMFARequest{MFAToken: challenge.MFAToken, Code: codes[0]}, http.StatusUnauthorized, nil)
+		f.mustDo(t, "POST", "/login", "", models.LoginRequest{Username: "mfa-user", Password: "Str0ng-passw0rd"}, http.StatusOK, &challenge)
+		f.mustDo(t, "POST", "/login/2fa", "", models.LoginMFARequest{MFAToken: challenge.MFAToken, Code: codes[0]}, http.StatusOK, nil)
+	}},
+	{method: "POST", route: "/token/refresh", check: func(t *testing.T, f *authzFixture) {
+		registerWithPassword(t, f, "refresh-user")
+		var tokens struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		f.mustDo(t, "POST", "/login", "", models.LoginRequest{Username: "refresh-user", Password: "Str0ng-passw0rd"}, http.StatusOK, &tokens)
+		f.mustDo(t, "POST", "/token/refresh", "", models.RefreshTokenRequest{RefreshToken: "invalid"}, http.StatusUnauthorized, nil)
+		f.mustDo(t, "POST", "/token/refresh", "", models.RefreshTokenRequest{RefreshToken: tokens.RefreshToken}, http.StatusOK, nil)
+	}},
+	{method: "GET", route: "/.well-known/jwks.json", check: func(t *testing.T, f *authzFixture) {
+		f.mustDo(t, "GET", "/.well-known/jwks.json", "", nil, http.StatusOK, nil)
+	}},
+}
+
+// registerWithPassword регистрирует пользователя через API и возвращает его ID
+func registerWithPassword(t *testing.T, f *authzFixture, username string) string {
+	t.Helper()
+	f.mustDo(t, "POST", "/register", "", models.RegisterRequest{
+		Username: username, Email: username + "@example.com", Password: "Str0ng-passw0rd"}, http.StatusCreated, nil)
+	user, ok := f.store.GetUserByUsername(username)
+	if !ok {
+		t.Fatalf("пользователь %s не зарегистрирован", username)
+	}
+	return user.ID
+}
+
+// TestTransferFromForeignAccountIsNotFound проверяет, что по ответу на перевод нельзя узнать,
+// существует ли чужой счет списания
+func TestTransferFromForeignAccountIsNotFound(t *testing.T) {
+	setAuthzEnv(t)
+	f := newAuthzFixture(t)
+
+	transfer := func(fromAccountID, toAccountID string) *httptest.ResponseRecorder {
+		return doRequest(t, f.router, "POST", "/transfers", f.owner.token, models.TransferRequest{
+			FromAccountID: fromAccountID, ToAccountID: toAccountID, Amount: decimal.NewFromInt(100)})
+	}
+	missing := uuid.New().String()
+
+	// Владение счетом списания проверяется раньше существования счета зачисления
+	for _, to := range []string{f.owner.account.ID, missing + "-to"} {
+		foreign := transfer(f.other.account.ID, to)
+		absent := transfer(missing, to)
+		if foreign.Code != http.StatusNotFound || absent.Code != http.StatusNotFound {
+			t.Fatalf("счет зачисления %s: статусы %d и %d, ожидался 404", to, foreign.Code, absent.Code)
+		}
+		want := strings.Replace(absent.Body.String(), missing, f.other.account.ID, 1)
+		if foreign.Body.String() != want {
+			t.Errorf("ответ для чужого счета %s отличается от ответа для несуществующего %s", foreign.Body, absent.Body)
+		}
+	}
+}
+
+func TestPublicRoutes(t *testing.T) {
+	setAuthzEnv(t)
+
+	for _, tc := range publicCases {
+		t.Run(tc.method+" "+tc.route, func(t *testing.T) {
+			tc.check(t, newAuthzFixture(t))
+		})
+	}
+}
+
+// TestAuthorizationCoversAllRoutes не дает добавить маршрут без проверки доступа
+func TestAuthorizationCoversAllRoutes(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	covered := make(map[string]bool)
+	for _, tc := range authzCases {
+		covered[tc.method+" "+tc.route] = true
+	}
+	for _, tc := range publicCases {
+		covered[tc.method+" "+tc.route] = true
+	}
+
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		// Подмаршрутизаторы регистрируются без методов
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			if !covered[method+" "+template] {
+				t.Errorf("маршрут %s %s не покрыт проверкой доступа", method, template)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+}
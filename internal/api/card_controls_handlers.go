@@ -0,0 +1,210 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/models"
+	"bankapp/internal/storage"
+	"bankapp/pkg/utils"
+)
+
+// Коды отказов в платеже из-за лимитов и правил карты
+const (
+	CardErrorTransactionLimit   = "per_transaction_limit_exceeded"
+	CardErrorDailyLimit         = "daily_limit_exceeded"
+	CardErrorMonthlyLimit       = "monthly_limit_exceeded"
+	CardErrorMerchantDenied     = "merchant_denied"
+	CardErrorMerchantNotAllowed = "merchant_not_allowed"
+)
+
+// SetCardLimitsHandler заменяет лимиты расходов по карте
+// Лимит со значением null снимается
+func (a *API) SetCardLimitsHandler(w http.ResponseWriter, r *http.Request) {
+	card, ok := a.ownedCard(w, r)
+	if !ok {
+		return
+	}
+	if card.Status == models.CardStatusClosed {
+		respondCardStatusError(w, card.Status)
+		return
+	}
+
+	var limits models.CardLimits
+	if err := json.NewDecoder(r.Body).Decode(&limits); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	for _, limit := range []decimal.NullDecimal{limits.PerTransaction, limits.Daily, limits.Monthly} {
+		if limit.Valid && limit.Decimal.LessThanOrEqual(decimal.Zero) {
+			respondError(w, http.StatusBadRequest, "Card limits must be positive")
+			return
+		}
+	}
+
+	if err := a.cards.UpdateCardLimits(card.ID, limits); err != nil {
+		respondCardUpdateError(w, err, "Failed to update card limits")
+		return
+	}
+
+	log.Printf("Limits updated for card %s", card.ID)
+	card.Limits = limits
+	respondJSON(w, http.StatusOK, card.SecureCard())
+}
+
+// ListMerchantRulesHandler возвращает правила карты по получателям платежей
+func (a *API) ListMerchantRulesHandler(w http.ResponseWriter, r *http.Request) {
+	card, ok := a.ownedCard(w, r)
+	if !ok {
+		return
+	}
+
+	rules, err := a.cards.ListCardMerchantRules(card.ID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to fetch merchant rules: %v", err))
+		return
+	}
+	respondJSON(w, http.StatusOK, rules)
+}
+
+// AddMerchantRuleHandler добавляет получателя или категорию в список разрешенных или запрещенных
+func (a *API) AddMerchantRuleHandler(w http.ResponseWriter, r *http.Request) {
+	card, ok := a.ownedCard(w, r)
+	if !ok {
+		return
+	}
+	if card.Status == models.CardStatusClosed {
+		respondCardStatusError(w, card.Status)
+		return
+	}
+
+	var req models.MerchantRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.List != models.MerchantRuleAllow && req.List != models.MerchantRuleDeny {
+		respondError(w, http.StatusBadRequest, "List must be allow or deny")
+		return
+	}
+	if req.Kind != models.MerchantRuleByName && req.Kind != models.MerchantRuleByCategory {
+		respondError(w, http.StatusBadRequest, "Kind must be merchant or category")
+		return
+	}
+	value := strings.TrimSpace(req.Value)
+	if value == "" {
+		respondError(w, http.StatusBadRequest, "Value is required")
+		return
+	}
+
+	rule := models.MerchantRule{
+		ID:        utils.CreateUniqueIdentifier(),
+		CardID:    card.ID,
+		List:      req.List,
+		Kind:      req.Kind,
+		Value:     value,
+		CreatedAt: time.Now(),
+	}
+	if err := a.cards.AddCardMerchantRule(rule); err != nil {
+		if errors.Is(err, storage.ErrMerchantRuleExists) {
+			respondError(w, http.StatusConflict, "Merchant rule already exists")
+			return
+		}
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to add merchant rule: %v", err))
+		return
+	}
+
+	log.Printf("Merchant rule %s %s=%s added to card %s", rule.List, rule.Kind, rule.Value, card.ID)
+	respondJSON(w, http.StatusCreated, rule)
+}
+
+// DeleteMerchantRuleHandler удаляет правило карты по получателям платежей
+func (a *API) DeleteMerchantRuleHandler(w http.ResponseWriter, r *http.Request) {
+	card, ok := a.ownedCard(w, r)
+	if !ok {
+		return
+	}
+	ruleID := mux.Vars(r)["ruleId"]
+
+	if err := a.cards.DeleteCardMerchantRule(card.ID, ruleID); err != nil {
+		if errors.Is(err, storage.ErrMerchantRuleNotFound) {
+			respondError(w, http.StatusNotFound, fmt.Sprintf("Merchant rule %s not found", ruleID))
+			return
+		}
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to delete merchant rule: %v", err))
+		return
+	}
+
+	log.Printf("Merchant rule %s removed from card %s", ruleID, card.ID)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Merchant rule deleted"})
+}
+
+// checkMerchantRules проверяет получателя платежа по правилам карты
+// Запрещающее правило имеет приоритет; если у карты есть разрешающие правила,
+// платеж проходит только в пользу подходящего под одно из них получателя
+// Возвращает false, если платеж отклонен и ответ уже отправлен
+func (a *API) checkMerchantRules(w http.ResponseWriter, card models.Card, merchant, category string) bool {
+	// Карта, привязанная к получателю, оплачивает только его независимо от правил
+	if card.LockedMerchant != "" && !strings.EqualFold(strings.TrimSpace(merchant), card.LockedMerchant) {
+		respondErrorCode(w, http.StatusForbidden, CardErrorMerchantNotAllowed, "Card is locked to another merchant")
+		return false
+	}
+
+	rules, err := a.cards.ListCardMerchantRules(card.ID)
+	if err != nil {
+		log.Printf("Error fetching merchant rules for card %s: %v", card.ID, err)
+		respondError(w, http.StatusInternalServerError, "Failed to check merchant rules")
+		return false
+	}
+
+	hasAllowRules, allowed := false, false
+	for _, rule := range rules {
+		if !rule.Matches(merchant, category) {
+			if rule.List == models.MerchantRuleAllow {
+				hasAllowRules = true
+			}
+			continue
+		}
+		if rule.List == models.MerchantRuleDeny {
+			respondErrorCode(w, http.StatusForbidden, CardErrorMerchantDenied,
+				fmt.Sprintf("Payments to this %s are blocked for the card", rule.Kind))
+			return false
+		}
+		hasAllowRules, allowed = true, true
+	}
+
+	if hasAllowRules && !allowed {
+		respondErrorCode(w, http.StatusForbidden, CardErrorMerchantNotAllowed, "Merchant is not in the card's allow list")
+		return false
+	}
+	return true
+}
+
+// respondCardPaymentError преобразует ошибку проведения платежа по карте в ответ,
+// указывая превышенный лимит в поле code
+func respondCardPaymentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrTransactionLimitExceeded):
+		respondErrorCode(w, http.StatusForbidden, CardErrorTransactionLimit, "Payment exceeds the card's per-transaction limit")
+	case errors.Is(err, storage.ErrDailyLimitExceeded):
+		respondErrorCode(w, http.StatusForbidden, CardErrorDailyLimit, "Payment exceeds the card's daily limit")
+	case errors.Is(err, storage.ErrMonthlyLimitExceeded):
+		respondErrorCode(w, http.StatusForbidden, CardErrorMonthlyLimit, "Payment exceeds the card's monthly limit")
+	case errors.Is(err, storage.ErrSingleUseCardUsed):
+		respondErrorCode(w, http.StatusGone, CardErrorSingleUseUsed, "Single-use card has already been used")
+	default:
+		respondPostingError(w, err, "Failed to process payment")
+	}
+}
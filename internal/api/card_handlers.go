@@ -1,22 +1,27 @@
 package api
 
 import (
+	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math/big"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/shopspring/decimal"
 
+	"bankapp/internal/config"
 	"bankapp/internal/models"
 	"bankapp/internal/storage"
 	"bankapp/pkg/utils"
 )
 
 // GenerateCardHandler обрабатывает запросы на генерацию новой карты для счета
-func GenerateCardHandler(w http.ResponseWriter, r *http.Request) {
+func (a *API) GenerateCardHandler(w http.ResponseWriter, r *http.Request) {
 	var req models.GenerateCardRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid request payload")
@@ -24,74 +29,78 @@ func GenerateCardHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	if _, ok := storage.GetAccount(req.AccountID); !ok {
+	account, ok := a.accounts.GetAccount(req.AccountID)
+	if !ok {
 		respondError(w, http.StatusBadRequest, fmt.Sprintf("Account %s not found", req.AccountID))
 		return
 	}
-
-	// Генерируем данные карты
-	month, year := utils.GenerateExpiryDate()
-	cardNumber := utils.GenerateCardNumber()
-	cvv := utils.GenerateCVV()
-
-	// Encrypt and hash sensitive data
-	encryptedNumber, err := utils.EncryptData(cardNumber)
-	if err != nil {
-		log.Printf("Error encrypting card number: %v", err)
-		respondError(w, http.StatusInternalServerError, "Failed to secure card data")
+	if !requireAccountOwner(w, r, account) {
 		return
 	}
 
-	numberHMAC := utils.GenerateHMAC(cardNumber)
-
-	cvvHash, err := utils.HashCVV(cvv)
-	if err != nil {
-		log.Printf("Error hashing CVV: %v", err)
-		respondError(w, http.StatusInternalServerError, "Failed to secure card data")
+	product := req.Product
+	if product == "" {
+		product = models.CardProductDebit
+	}
+	bins, ok := config.GetCardBINs()[product]
+	if !ok {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Unknown card product %q", product))
 		return
 	}
 
-	// Create the card with encrypted data
-	card := models.Card{
-		ID:              utils.CreateUniqueIdentifier(),
-		AccountID:       req.AccountID,
-		Number:          cardNumber,
-		EncryptedNumber: encryptedNumber,
-		NumberHMAC:      numberHMAC,
-		ExpiryMonth:     month,
-		ExpiryYear:      year,
-		CVV:             cvv,
-		CVVHash:         cvvHash,
-		CreatedAt:       time.Now(),
+	cardType := req.Type
+	if cardType == "" {
+		cardType = models.CardTypePhysical
+	}
+	if cardType != models.CardTypePhysical && cardType != models.CardTypeVirtual {
+		respondError(w, http.StatusBadRequest, "Card type must be physical or virtual")
+		return
+	}
+	lockedMerchant := strings.TrimSpace(req.LockedMerchant)
+	if cardType != models.CardTypeVirtual && (req.SingleUse || lockedMerchant != "") {
+		respondError(w, http.StatusBadRequest, "Only virtual cards can be single-use or locked to a merchant")
+		return
 	}
 
-	if err := storage.AddCard(card); err != nil {
+	template := models.Card{
+		AccountID:      req.AccountID,
+		Product:        product,
+		Type:           cardType,
+		SingleUse:      req.SingleUse,
+		LockedMerchant: lockedMerchant,
+	}
+	card, err := issueCard(template, bins, a.cards.AddCard)
+	if err != nil {
 		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to generate card: %v", err))
 		return
 	}
 
-	log.Printf("Card generated for account %s", card.AccountID)
+	log.Printf("Card generated for account %s (%s)", card.AccountID, card.Type)
 
 	// Возвращаем безопасную версию карты
 	respondJSON(w, http.StatusCreated, card.SecureCard())
 }
 
 // GetAccountCardsHandler обрабатывает запросы на получение всех карт для счета
-func GetAccountCardsHandler(w http.ResponseWriter, r *http.Request) {
+func (a *API) GetAccountCardsHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	accountID := vars["accountId"]
 
-	if _, ok := storage.GetAccount(accountID); !ok {
+	account, ok := a.accounts.GetAccount(accountID)
+	if !ok {
 		respondError(w, http.StatusNotFound, fmt.Sprintf("Account %s not found", accountID))
 		return
 	}
+	if !requireAccountOwner(w, r, account) {
+		return
+	}
 
-	cards := storage.GetAccountCards(accountID)
+	cards := a.cards.GetAccountCards(accountID)
 
 	// Создаем безопасные версии карт для ответа
 	secureCards := make([]models.Card, len(cards))
 	for i, card := range cards {
-		secureCards[i] = card.SecureCard()
+		secureCards[i] = a.expireCardIfNeeded(card).SecureCard()
 	}
 
 	log.Printf("Fetched %d cards for account %s", len(cards), accountID)
@@ -99,63 +108,447 @@ func GetAccountCardsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // PayWithCardHandler обрабатывает запросы на совершение платежа с использованием карты
-func PayWithCardHandler(w http.ResponseWriter, r *http.Request) {
+func (a *API) PayWithCardHandler(w http.ResponseWriter, r *http.Request) {
+	req, card, account, ok := a.decodeCardPayment(w, r)
+	if !ok {
+		return
+	}
+
+	posting := cardPaymentPosting(card, account.Currency, req.Amount, req.Merchant, req.MerchantCategory, time.Now())
+	// Лимиты карты проверяются при проведении, вместе с уже совершенными платежами
+	if err := a.transactions.PostCardPayment(posting); err != nil {
+		respondCardPaymentError(w, err)
+		return
+	}
+
+	log.Printf("Payment of %s processed from account %s (card %s) to %s", req.Amount.String(), card.AccountID, "*"+card.LastFour, req.Merchant)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Payment successful"})
+}
+
+// decodeCardPayment читает запрос на оплату картой и выполняет все проверки до списания:
+// владелец счета, статус карты, срок действия и CVV, правила по получателям
+// Возвращает карту, ее счет и false, если запрос отклонен и ответ уже отправлен
+func (a *API) decodeCardPayment(w http.ResponseWriter, r *http.Request) (models.PaymentRequest, models.Card, models.Account, bool) {
 	var req models.PaymentRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid request payload")
-		return
+		return req, models.Card{}, models.Account{}, false
 	}
 	defer r.Body.Close()
 
 	if req.Amount.LessThanOrEqual(decimal.Zero) {
 		respondError(w, http.StatusBadRequest, "Payment amount must be positive")
-		return
+		return req, models.Card{}, models.Account{}, false
+	}
+	if req.CardNumber == "" || req.ExpiryMonth == 0 || req.ExpiryYear == 0 || req.CVV == "" {
+		respondError(w, http.StatusBadRequest, "Card number, expiry date and CVV are required")
+		return req, models.Card{}, models.Account{}, false
+	}
+	// Номер с ошибкой в контрольной цифре отклоняем, не обращаясь к хранилищу
+	if !utils.IsValidCardNumber(req.CardNumber) {
+		respondErrorCode(w, http.StatusBadRequest, CardErrorInvalidNumber, "Invalid card number")
+		return req, models.Card{}, models.Account{}, false
 	}
 
-	card, ok := storage.GetCardByNumber(req.CardNumber)
+	card, ok := a.cards.GetCardByNumber(req.CardNumber)
 	if !ok {
 		respondError(w, http.StatusNotFound, "Card not found")
+		return req, models.Card{}, models.Account{}, false
+	}
+
+	account, ok := a.accounts.GetAccount(card.AccountID)
+	if !ok {
+		respondError(w, http.StatusInternalServerError, "Associated account not found")
+		return req, models.Card{}, models.Account{}, false
+	}
+	if !requireAccountOwner(w, r, account) {
+		return req, models.Card{}, models.Account{}, false
+	}
+
+	card = a.expireCardIfNeeded(card)
+	if card.Status != models.CardStatusActive {
+		respondCardStatusError(w, card.Status)
+		return req, models.Card{}, models.Account{}, false
+	}
+	if !a.verifyCardDetails(w, card, req) {
+		return req, models.Card{}, models.Account{}, false
+	}
+	if !a.checkMerchantRules(w, card, req.Merchant, req.MerchantCategory) {
+		return req, models.Card{}, models.Account{}, false
+	}
+	return req, card, account, true
+}
+
+// cardPaymentPosting формирует проводку платежа по карте: списание со счета карты
+// в пользу расчетов с торговыми точками; сумма указывается в валюте счета currency
+func cardPaymentPosting(card models.Card, currency string, amount decimal.Decimal, merchant, category string, at time.Time) models.Posting {
+	tx := models.Transaction{
+		ID:               utils.CreateUniqueIdentifier(),
+		FromAccountID:    card.AccountID,
+		ToAccountID:      "",
+		Amount:           amount,
+		Currency:         currency,
+		Timestamp:        at,
+		TransactionType:  "payment",
+		Description:      fmt.Sprintf("Payment to %s", merchant),
+		CardID:           card.ID,
+		Merchant:         merchant,
+		MerchantCategory: category,
+	}
+	return models.Posting{
+		Transaction: tx,
+		Entries: []models.JournalEntry{
+			storage.DebitLeg(card.AccountID, amount),
+			storage.CreditLeg(storage.LedgerCardSettlement, amount),
+		},
+	}
+}
+
+// verifyCardDetails сверяет срок действия и CVV из запроса с данными карты
+// Неудачные проверки подряд учитываются; после CARD_MAX_FAILED_ATTEMPTS карта блокируется
+// Возвращает false, если проверка не пройдена и ответ уже отправлен
+func (a *API) verifyCardDetails(w http.ResponseWriter, card models.Card, req models.PaymentRequest) bool {
+	cvvValid, err := utils.VerifyCVV(req.CVV, card.CVVHash)
+	if err != nil {
+		log.Printf("Error verifying CVV for card %s: %v", card.ID, err)
+		respondError(w, http.StatusInternalServerError, "Failed to verify card")
+		return false
+	}
+
+	if cvvValid && req.ExpiryMonth == card.ExpiryMonth && req.ExpiryYear == card.ExpiryYear {
+		if card.FailedAttempts > 0 {
+			if err := a.cards.ResetCardVerificationFailures(card.ID); err != nil {
+				log.Printf("Error resetting failed attempts for card %s: %v", card.ID, err)
+			}
+		}
+		return true
+	}
+
+	attempts, blocked, err := a.cards.RecordCardVerificationFailure(card.ID, config.GetCardMaxFailedAttempts())
+	if err != nil {
+		log.Printf("Error recording failed verification for card %s: %v", card.ID, err)
+		respondError(w, http.StatusInternalServerError, "Failed to verify card")
+		return false
+	}
+
+	log.Printf("Card verification failed for card %s (attempt %d)", "*"+card.LastFour, attempts)
+	if blocked {
+		respondErrorCode(w, http.StatusForbidden, CardErrorBlocked, "Card blocked after too many failed verification attempts")
+		return false
+	}
+	respondErrorCode(w, http.StatusForbidden, CardErrorVerificationFailed, "Card verification failed")
+	return false
+}
+
+// FreezeCardHandler временно приостанавливает операции по карте по запросу владельца
+func (a *API) FreezeCardHandler(w http.ResponseWriter, r *http.Request) {
+	card, ok := a.ownedCard(w, r)
+	if !ok {
 		return
 	}
+	a.transitionCard(w, card, models.CardStatusFrozen)
+}
 
-	now := time.Now()
-	expiry := time.Date(card.ExpiryYear, time.Month(card.ExpiryMonth)+1, 0, 23, 59, 59, 0, time.UTC) // Last day of the month
-	if now.After(expiry) {
-		respondError(w, http.StatusBadRequest, "Card expired")
+// UnfreezeCardHandler возобновляет операции по замороженной карте
+// Заблокированную карту владелец разблокировать не может: это делает операционист
+func (a *API) UnfreezeCardHandler(w http.ResponseWriter, r *http.Request) {
+	card, ok := a.ownedCard(w, r)
+	if !ok {
 		return
 	}
+	if card.Status != models.CardStatusFrozen {
+		respondErrorCode(w, http.StatusConflict, CardErrorInvalidTransition, "Only a frozen card can be unfrozen")
+		return
+	}
+	a.transitionCard(w, card, models.CardStatusActive)
+}
 
-	account, ok := storage.GetAccount(card.AccountID)
+// BlockCardHandler блокирует карту, например при утере или краже
+func (a *API) BlockCardHandler(w http.ResponseWriter, r *http.Request) {
+	card, ok := a.ownedCard(w, r)
 	if !ok {
-		respondError(w, http.StatusInternalServerError, "Associated account not found")
+		return
+	}
+	a.transitionCard(w, card, models.CardStatusBlocked)
+}
+
+// CloseCardHandler окончательно закрывает карту
+func (a *API) CloseCardHandler(w http.ResponseWriter, r *http.Request) {
+	card, ok := a.ownedCard(w, r)
+	if !ok {
+		return
+	}
+	a.transitionCard(w, card, models.CardStatusClosed)
+}
+
+// ReissueCardHandler выпускает новую карту к тому же счету с новым номером,
+// сроком действия и CVV; старая карта закрывается
+func (a *API) ReissueCardHandler(w http.ResponseWriter, r *http.Request) {
+	card, ok := a.ownedCard(w, r)
+	if !ok {
+		return
+	}
+	if card.Status == models.CardStatusClosed {
+		respondCardStatusError(w, card.Status)
+		return
+	}
+
+	// Новая карта выпускается по тому же продукту, что и заменяемая
+	bins, ok := config.GetCardBINs()[card.Product]
+	if !ok {
+		respondError(w, http.StatusConflict, fmt.Sprintf("Card product %q is no longer issued", card.Product))
 		return
 	}
 
-	if account.Balance.LessThan(req.Amount) {
-		respondError(w, http.StatusPaymentRequired, "Insufficient funds")
+	// Вид карты и ограничения виртуальной карты переносятся на новую карту
+	template := models.Card{
+		AccountID:      card.AccountID,
+		Product:        card.Product,
+		Type:           card.Type,
+		SingleUse:      card.SingleUse,
+		LockedMerchant: card.LockedMerchant,
+	}
+	replacement, err := issueCard(template, bins, func(replacement models.Card) error {
+		return a.cards.ReissueCard(card.ID, replacement)
+	})
+	if err != nil {
+		respondCardUpdateError(w, err, "Failed to reissue card")
 		return
 	}
 
-	err := storage.UpdateAccountBalance(account.ID, req.Amount.Neg())
+	log.Printf("Card %s reissued as %s for account %s", card.ID, replacement.ID, card.AccountID)
+	respondJSON(w, http.StatusCreated, replacement.SecureCard())
+}
+
+// RevealCardHandler один раз показывает владельцу полный номер и CVV виртуальной карты
+// Требует подтверждения кодом второго фактора; после показа CVV остается только в виде хеша
+func (a *API) RevealCardHandler(w http.ResponseWriter, r *http.Request) {
+	card, ok := a.ownedCard(w, r)
+	if !ok {
+		return
+	}
+	if card.Type != models.CardTypeVirtual {
+		respondErrorCode(w, http.StatusBadRequest, CardErrorNotVirtual, "Only virtual card details can be revealed")
+		return
+	}
+	if card.Status != models.CardStatusActive && card.Status != models.CardStatusFrozen {
+		respondCardStatusError(w, card.Status)
+		return
+	}
+	if card.RevealedAt != nil {
+		respondErrorCode(w, http.StatusConflict, CardErrorAlreadyRevealed, "Card details have already been revealed")
+		return
+	}
+	if !a.requireSecondFactor(w, r, "revealing card details") {
+		return
+	}
+
+	revealed, err := a.cards.RevealCard(card.ID, time.Now())
+	if errors.Is(err, storage.ErrCardAlreadyRevealed) {
+		respondErrorCode(w, http.StatusConflict, CardErrorAlreadyRevealed, "Card details have already been revealed")
+		return
+	}
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to process payment: %v", err))
+		respondCardUpdateError(w, err, "Failed to reveal card details")
 		return
 	}
 
-	tx := models.Transaction{
-		ID:              utils.CreateUniqueIdentifier(),
-		FromAccountID:   account.ID,
-		ToAccountID:     "",
-		Amount:          req.Amount,
-		Timestamp:       time.Now(),
-		TransactionType: "payment",
-		Description:     fmt.Sprintf("Payment to %s", req.Merchant),
+	// Реквизиты уже отмечены показанными: при ошибке расшифровки карту нужно перевыпустить
+	number, err := utils.DecryptField(revealed.EncryptedNumber, revealed.EncryptionKeyID, revealed.ID)
+	if err != nil {
+		log.Printf("Error decrypting number of card %s: %v", card.ID, err)
+		respondError(w, http.StatusInternalServerError, "Failed to reveal card details")
+		return
 	}
-	if err := storage.AddTransaction(tx); err != nil {
-		log.Printf("Failed to record transaction: %v", err)
-		// Продолжаем выполнение, так как деньги уже списаны
+	cvv, err := utils.DecryptField(revealed.EncryptedCVV, revealed.EncryptionKeyID, utils.CVVAssociatedData(revealed.ID))
+	if err != nil {
+		log.Printf("Error decrypting CVV of card %s: %v", card.ID, err)
+		respondError(w, http.StatusInternalServerError, "Failed to reveal card details")
+		return
 	}
 
-	log.Printf("Payment of %s processed from account %s (card %s) to %s", req.Amount.String(), account.ID, card.Number[:4]+"...", req.Merchant)
-	respondJSON(w, http.StatusOK, map[string]string{"message": "Payment successful"})
+	log.Printf("Details of card %s revealed to the owner", card.ID)
+	w.Header().Set("Cache-Control", "no-store")
+	respondJSON(w, http.StatusOK, models.CardDetails{
+		CardID:      card.ID,
+		Number:      number,
+		ExpiryMonth: card.ExpiryMonth,
+		ExpiryYear:  card.ExpiryYear,
+		CVV:         cvv,
+	})
+}
+
+// ownedCard загружает карту из пути запроса и проверяет, что ее счет принадлежит пользователю
+// Возвращает false, если ответ с ошибкой уже отправлен
+func (a *API) ownedCard(w http.ResponseWriter, r *http.Request) (models.Card, bool) {
+	cardID := mux.Vars(r)["cardId"]
+
+	card, ok := a.cards.GetCard(cardID)
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Card %s not found", cardID))
+		return models.Card{}, false
+	}
+
+	account, ok := a.accounts.GetAccount(card.AccountID)
+	if !ok {
+		respondError(w, http.StatusInternalServerError, "Associated account not found")
+		return models.Card{}, false
+	}
+	if !requireAccountOwner(w, r, account) {
+		return models.Card{}, false
+	}
+	return a.expireCardIfNeeded(card), true
+}
+
+// transitionCard переводит карту в статус status, если переход допустим,
+// и отвечает обновленной картой
+func (a *API) transitionCard(w http.ResponseWriter, card models.Card, status string) {
+	if !models.CanTransitionCardStatus(card.Status, status) {
+		respondErrorCode(w, http.StatusConflict, CardErrorInvalidTransition,
+			fmt.Sprintf("Cannot change card status from %s to %s", card.Status, status))
+		return
+	}
+
+	if err := a.cards.UpdateCardStatus(card.ID, card.Status, status); err != nil {
+		respondCardUpdateError(w, err, "Failed to update card status")
+		return
+	}
+
+	log.Printf("Card %s status changed from %s to %s", card.ID, card.Status, status)
+	card.Status = status
+	respondJSON(w, http.StatusOK, card.SecureCard())
+}
+
+// expireCardIfNeeded переводит действующую карту с истекшим сроком в статус expired
+// Ошибка сохранения статуса не мешает обработке: карта все равно считается истекшей
+func (a *API) expireCardIfNeeded(card models.Card) models.Card {
+	if card.Status != models.CardStatusActive && card.Status != models.CardStatusFrozen {
+		return card
+	}
+	if !card.IsExpired(time.Now()) {
+		return card
+	}
+
+	if err := a.cards.UpdateCardStatus(card.ID, card.Status, models.CardStatusExpired); err != nil {
+		log.Printf("Error marking card %s as expired: %v", card.ID, err)
+	}
+	card.Status = models.CardStatusExpired
+	return card
+}
+
+// maxCardNumberAttempts ограничивает число попыток выпуска карты, если сгенерированный номер уже занят
+const maxCardNumberAttempts = 5
+
+// issueCard генерирует карту по шаблону template под одним из BIN bins и сохраняет ее функцией save
+// Если номер совпал с уже выпущенной картой, карта генерируется заново
+func issueCard(template models.Card, bins []string, save func(models.Card) error) (models.Card, error) {
+	for attempt := 1; ; attempt++ {
+		card, err := newCard(template, bins)
+		if err != nil {
+			return models.Card{}, err
+		}
+
+		err = save(card)
+		if errors.Is(err, storage.ErrCardNumberTaken) && attempt < maxCardNumberAttempts {
+			log.Printf("Generated card number is already issued, retrying (attempt %d)", attempt)
+			continue
+		}
+		return card, err
+	}
+}
+
+// newCard генерирует новую активную карту по шаблону template, в котором заданы счет,
+// продукт, вид карты и ее ограничения
+// BIN номера выбирается случайно из bins; номер шифруется, а CVV хешируется,
+// открытые значения остаются только в возвращенной структуре
+// CVV виртуальной карты дополнительно шифруется, чтобы его можно было один раз показать владельцу
+func newCard(template models.Card, bins []string) (models.Card, error) {
+	bin, err := rand.Int(rand.Reader, big.NewInt(int64(len(bins))))
+	if err != nil {
+		return models.Card{}, fmt.Errorf("ошибка при выборе BIN: %w", err)
+	}
+	cardNumber, err := utils.GenerateCardNumber(bins[bin.Int64()])
+	if err != nil {
+		return models.Card{}, fmt.Errorf("ошибка при генерации номера карты: %w", err)
+	}
+	month, year := utils.GenerateExpiryDate()
+	cvv := utils.GenerateCVV()
+
+	cardID := utils.CreateUniqueIdentifier()
+
+	// ID карты привязывается к шифротексту, чтобы его нельзя было перенести на другую карту
+	encryptedNumber, keyID, err := utils.EncryptField(cardNumber, cardID)
+	if err != nil {
+		return models.Card{}, fmt.Errorf("ошибка при шифровании номера карты: %w", err)
+	}
+
+	cvvHash, err := utils.HashCVV(cvv)
+	if err != nil {
+		return models.Card{}, fmt.Errorf("ошибка при хешировании CVV: %w", err)
+	}
+
+	card := template
+	card.ID = cardID
+	card.Number = cardNumber
+	card.EncryptedNumber = encryptedNumber
+	card.EncryptionKeyID = keyID
+	card.NumberHMAC = utils.GenerateHMAC(cardNumber)
+	card.LastFour = cardNumber[len(cardNumber)-4:]
+	card.ExpiryMonth = month
+	card.ExpiryYear = year
+	card.CVV = cvv
+	card.CVVHash = cvvHash
+	card.Status = models.CardStatusActive
+	card.CreatedAt = time.Now()
+
+	if card.Type == models.CardTypeVirtual {
+		// CVV шифруется тем же активным ключом, что и номер
+		card.EncryptedCVV, _, err = utils.EncryptField(cvv, utils.CVVAssociatedData(cardID))
+		if err != nil {
+			return models.Card{}, fmt.Errorf("ошибка при шифровании CVV: %w", err)
+		}
+	}
+	return card, nil
+}
+
+// Коды отказов по карте, передаваемые в поле code ответа об ошибке
+const (
+	CardErrorFrozen             = "card_frozen"
+	CardErrorBlocked            = "card_blocked"
+	CardErrorClosed             = "card_closed"
+	CardErrorExpired            = "card_expired"
+	CardErrorVerificationFailed = "card_verification_failed"
+	CardErrorInvalidNumber      = "invalid_card_number"
+	CardErrorInvalidTransition  = "invalid_card_status_transition"
+	CardErrorNotVirtual         = "card_not_virtual"
+	CardErrorAlreadyRevealed    = "card_details_revealed"
+	CardErrorSingleUseUsed      = "single_use_card_used"
+)
+
+// respondCardStatusError отвечает отказом для карты, статус которой не допускает операции
+func respondCardStatusError(w http.ResponseWriter, status string) {
+	switch status {
+	case models.CardStatusFrozen:
+		respondErrorCode(w, http.StatusForbidden, CardErrorFrozen, "Card is frozen")
+	case models.CardStatusBlocked:
+		respondErrorCode(w, http.StatusForbidden, CardErrorBlocked, "Card is blocked")
+	case models.CardStatusClosed:
+		respondErrorCode(w, http.StatusGone, CardErrorClosed, "Card is closed")
+	case models.CardStatusExpired:
+		respondErrorCode(w, http.StatusBadRequest, CardErrorExpired, "Card expired")
+	default:
+		respondError(w, http.StatusForbidden, fmt.Sprintf("Card is %s", status))
+	}
+}
+
+// respondCardUpdateError преобразует ошибку изменения карты в ответ с соответствующим HTTP-кодом
+func respondCardUpdateError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, storage.ErrCardNotFound):
+		respondError(w, http.StatusNotFound, "Card not found")
+	case errors.Is(err, storage.ErrCardStatusConflict):
+		respondErrorCode(w, http.StatusConflict, CardErrorInvalidTransition, "Card status has changed, please retry")
+	default:
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("%s: %v", message, err))
+	}
 }
@@ -2,8 +2,12 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+
+	"bankapp/internal/storage"
 )
 
 // respondJSON преобразует данные в JSON и отправляет их в качестве ответа
@@ -26,3 +30,27 @@ func respondError(w http.ResponseWriter, code int, message string) {
 	log.Printf("HTTP-ошибка %d: %s", code, message)
 	respondJSON(w, code, map[string]string{"error": message})
 }
+
+// respondErrorCode отправляет ответ с ошибкой и машиночитаемым кодом причины,
+// по которому клиент различает отказы с одинаковым HTTP-кодом статуса
+func respondErrorCode(w http.ResponseWriter, status int, code, message string) {
+	log.Printf("HTTP-ошибка %d (%s): %s", status, code, message)
+	respondJSON(w, status, map[string]string{"error": message, "code": code})
+}
+
+// respondPostingError преобразует ошибку проведения операции в главной книге
+// в ответ с соответствующим HTTP-кодом статуса
+func respondPostingError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, storage.ErrInsufficientFunds):
+		respondError(w, http.StatusPaymentRequired, "Insufficient funds")
+	case errors.Is(err, storage.ErrAccountFrozen):
+		respondError(w, http.StatusForbidden, "Account is frozen")
+	case errors.Is(err, storage.ErrAccountNotFound):
+		respondError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, storage.ErrCurrencyMismatch):
+		respondErrorCode(w, http.StatusBadRequest, ExchangeErrorCurrencyMismatch, "Account currency does not match the operation currency")
+	default:
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("%s: %v", message, err))
+	}
+}
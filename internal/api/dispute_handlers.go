@@ -0,0 +1,290 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/models"
+	"bankapp/internal/storage"
+	"bankapp/pkg/utils"
+)
+
+// Коды отказов при возвратах и спорах по платежам
+const (
+	DisputeErrorNotCardPayment    = "not_card_payment"
+	DisputeErrorRefundExceeds     = "refund_exceeds_payment"
+	DisputeErrorExists            = "dispute_exists"
+	DisputeErrorInvalidTransition = "invalid_dispute_transition"
+)
+
+// AdminRefundPaymentHandler проводит возврат по платежу по карте полностью или частично
+// Возврат зачисляется на счет платежа отдельной транзакцией, связанной с исходной;
+// сумма всех возвратов и компенсаций не может превысить сумму платежа
+func (a *API) AdminRefundPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	payment, ok := a.cardPayment(w, mux.Vars(r)["transactionId"])
+	if !ok {
+		return
+	}
+
+	var req models.RefundRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+	}
+	defer r.Body.Close()
+
+	amount, ok := a.refundAmount(w, payment, req.Amount)
+	if !ok {
+		return
+	}
+
+	description := fmt.Sprintf("Refund from %s", payment.Merchant)
+	if reason := strings.TrimSpace(req.Reason); reason != "" {
+		description += ": " + reason
+	}
+	posting := refundPosting(payment, amount, models.TransactionTypeRefund, description)
+	if err := a.disputes.RefundPayment(posting); err != nil {
+		respondDisputeError(w, err, "Failed to process refund")
+		return
+	}
+
+	operatorID, _ := GetUserIDFromContext(r)
+	log.Printf("Operator %s refunded %s of payment %s to account %s", operatorID, amount.String(), payment.ID, payment.FromAccountID)
+	respondJSON(w, http.StatusCreated, posting.Transaction)
+}
+
+// OpenDisputeHandler открывает спор клиента по платежу по карте с его счета
+func (a *API) OpenDisputeHandler(w http.ResponseWriter, r *http.Request) {
+	payment, ok := a.cardPayment(w, mux.Vars(r)["transactionId"])
+	if !ok {
+		return
+	}
+	account, ok := a.accounts.GetAccount(payment.FromAccountID)
+	if !ok {
+		respondError(w, http.StatusInternalServerError, "Associated account not found")
+		return
+	}
+	if !requireAccountOwner(w, r, account) {
+		return
+	}
+
+	var req models.OpenDisputeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		respondError(w, http.StatusBadRequest, "Reason is required")
+		return
+	}
+	amount, ok := a.refundAmount(w, payment, req.Amount)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	dispute := models.Dispute{
+		ID:            utils.CreateUniqueIdentifier(),
+		TransactionID: payment.ID,
+		AccountID:     payment.FromAccountID,
+		CardID:        payment.CardID,
+		Amount:        amount,
+		Reason:        reason,
+		Status:        models.DisputeStatusOpen,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := a.disputes.OpenDispute(dispute); err != nil {
+		respondDisputeError(w, err, "Failed to open dispute")
+		return
+	}
+
+	log.Printf("Dispute %s opened for payment %s, amount %s", dispute.ID, payment.ID, amount.String())
+	respondJSON(w, http.StatusCreated, dispute)
+}
+
+// ListAccountDisputesHandler возвращает споры по платежам со счета
+func (a *API) ListAccountDisputesHandler(w http.ResponseWriter, r *http.Request) {
+	accountID := mux.Vars(r)["accountId"]
+
+	account, ok := a.accounts.GetAccount(accountID)
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Account %s not found", accountID))
+		return
+	}
+	if !requireAccountOwner(w, r, account) {
+		return
+	}
+
+	disputes, err := a.disputes.ListDisputes(models.DisputeFilter{AccountID: accountID})
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to fetch disputes: %v", err))
+		return
+	}
+	respondJSON(w, http.StatusOK, disputes)
+}
+
+// AdminListDisputesHandler возвращает споры с фильтрацией
+// Параметры запроса: account_id, status
+func (a *API) AdminListDisputesHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.DisputeFilter{
+		AccountID: query.Get("account_id"),
+		Status:    query.Get("status"),
+	}
+
+	disputes, err := a.disputes.ListDisputes(filter)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to list disputes: %v", err))
+		return
+	}
+
+	log.Printf("Admin fetched %d disputes", len(disputes))
+	respondJSON(w, http.StatusOK, disputes)
+}
+
+// AdminUpdateDisputeStatusHandler переводит спор в следующий статус
+// Решение won возвращает оспоренную сумму на счет клиента операцией chargeback
+func (a *API) AdminUpdateDisputeStatusHandler(w http.ResponseWriter, r *http.Request) {
+	disputeID := mux.Vars(r)["disputeId"]
+
+	var req models.DisputeStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Status != models.DisputeStatusUnderReview && req.Status != models.DisputeStatusWon && req.Status != models.DisputeStatusLost {
+		respondError(w, http.StatusBadRequest, "Status must be under_review, won or lost")
+		return
+	}
+
+	dispute, ok := a.disputes.GetDispute(disputeID)
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Dispute %s not found", disputeID))
+		return
+	}
+
+	var chargeback *models.Posting
+	if req.Status == models.DisputeStatusWon {
+		payment, ok := a.transactions.GetTransaction(dispute.TransactionID)
+		if !ok {
+			respondError(w, http.StatusInternalServerError, "Disputed payment not found")
+			return
+		}
+		posting := refundPosting(payment, dispute.Amount, models.TransactionTypeChargeback,
+			fmt.Sprintf("Chargeback from %s", payment.Merchant))
+		chargeback = &posting
+	}
+
+	updated, err := a.disputes.UpdateDisputeStatus(disputeID, req.Status, strings.TrimSpace(req.Resolution), chargeback)
+	if err != nil {
+		respondDisputeError(w, err, "Failed to update dispute")
+		return
+	}
+
+	operatorID, _ := GetUserIDFromContext(r)
+	log.Printf("Operator %s moved dispute %s from %s to %s", operatorID, disputeID, dispute.Status, updated.Status)
+	respondJSON(w, http.StatusOK, updated)
+}
+
+// cardPayment загружает транзакцию и проверяет, что это платеж по карте
+// Возвращает false, если ответ с ошибкой уже отправлен
+func (a *API) cardPayment(w http.ResponseWriter, transactionID string) (models.Transaction, bool) {
+	payment, ok := a.transactions.GetTransaction(transactionID)
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Transaction %s not found", transactionID))
+		return models.Transaction{}, false
+	}
+	if payment.TransactionType != "payment" {
+		respondErrorCode(w, http.StatusBadRequest, DisputeErrorNotCardPayment, "Only card payments can be refunded or disputed")
+		return models.Transaction{}, false
+	}
+	return payment, true
+}
+
+// refundAmount проверяет сумму возврата или спора по платежу
+// Нулевая сумма означает весь еще не возвращенный остаток платежа
+// Возвращает false, если ответ с ошибкой уже отправлен
+func (a *API) refundAmount(w http.ResponseWriter, payment models.Transaction, amount decimal.Decimal) (decimal.Decimal, bool) {
+	if amount.IsNegative() {
+		respondError(w, http.StatusBadRequest, "Amount must be positive")
+		return decimal.Zero, false
+	}
+	if !amount.IsZero() {
+		return amount, true
+	}
+
+	refunded, err := a.disputes.GetRefundedAmount(payment.ID)
+	if err != nil {
+		log.Printf("Error fetching refunded amount for payment %s: %v", payment.ID, err)
+		respondError(w, http.StatusInternalServerError, "Failed to check refunded amount")
+		return decimal.Zero, false
+	}
+	remaining := payment.Amount.Sub(refunded)
+	if !remaining.IsPositive() {
+		respondErrorCode(w, http.StatusConflict, DisputeErrorRefundExceeds, "Payment is already fully refunded")
+		return decimal.Zero, false
+	}
+	return remaining, true
+}
+
+// refundPosting формирует проводки возврата или компенсации по платежу по карте:
+// сумма зачисляется на счет платежа за счет расчетов с торговыми точками
+func refundPosting(payment models.Transaction, amount decimal.Decimal, transactionType, description string) models.Posting {
+	tx := models.Transaction{
+		ID:                   utils.CreateUniqueIdentifier(),
+		FromAccountID:        "",
+		ToAccountID:          payment.FromAccountID,
+		Amount:               amount,
+		Currency:             payment.Currency,
+		Timestamp:            time.Now(),
+		TransactionType:      transactionType,
+		Description:          description,
+		CardID:               payment.CardID,
+		Merchant:             payment.Merchant,
+		MerchantCategory:     payment.MerchantCategory,
+		RelatedTransactionID: payment.ID,
+	}
+	return models.Posting{
+		Transaction: tx,
+		Entries: []models.JournalEntry{
+			storage.DebitLeg(storage.LedgerCardSettlement, amount),
+			storage.CreditLeg(payment.FromAccountID, amount),
+		},
+	}
+}
+
+// respondDisputeError преобразует ошибку возврата или спора в ответ с соответствующим HTTP-кодом
+func respondDisputeError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, storage.ErrTransactionNotFound):
+		respondError(w, http.StatusNotFound, "Transaction not found")
+	case errors.Is(err, storage.ErrDisputeNotFound):
+		respondError(w, http.StatusNotFound, "Dispute not found")
+	case errors.Is(err, storage.ErrNotCardPayment):
+		respondErrorCode(w, http.StatusBadRequest, DisputeErrorNotCardPayment, "Only card payments can be refunded or disputed")
+	case errors.Is(err, storage.ErrRefundExceedsPayment):
+		respondErrorCode(w, http.StatusConflict, DisputeErrorRefundExceeds, "Amount exceeds the part of the payment not yet refunded")
+	case errors.Is(err, storage.ErrDisputeExists):
+		respondErrorCode(w, http.StatusConflict, DisputeErrorExists, "Payment already has an open dispute")
+	case errors.Is(err, storage.ErrDisputeStatusConflict):
+		respondErrorCode(w, http.StatusConflict, DisputeErrorInvalidTransition, "Dispute cannot be moved to this status")
+	default:
+		respondPostingError(w, err, message)
+	}
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/config"
+	"bankapp/internal/models"
+)
+
+// Коды отказов по валютным операциям, передаваемые в поле code ответа об ошибке
+const (
+	ExchangeErrorCurrencyMismatch = "currency_mismatch"
+	ExchangeErrorRateUnavailable  = "exchange_rate_unavailable"
+)
+
+// errExchangeRateUnavailable возвращается, если курса валюты нет или он устарел
+var errExchangeRateUnavailable = errors.New("exchange rate unavailable")
+
+// ListExchangeRatesHandler возвращает курсы валют к рублю, по которым проводятся конвертации
+func (a *API) ListExchangeRatesHandler(w http.ResponseWriter, r *http.Request) {
+	rates, err := a.rates.ListExchangeRates()
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to list exchange rates: %v", err))
+		return
+	}
+	if rates == nil {
+		rates = []models.ExchangeRate{}
+	}
+	respondJSON(w, http.StatusOK, rates)
+}
+
+// AdminSetExchangeRateHandler устанавливает курс валюты к рублю
+func (a *API) AdminSetExchangeRateHandler(w http.ResponseWriter, r *http.Request) {
+	currency := strings.ToUpper(mux.Vars(r)["currency"])
+
+	var req models.ExchangeRateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if !models.IsSupportedCurrency(currency) || currency == models.CurrencyRUB {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Cannot set exchange rate for currency %q", currency))
+		return
+	}
+	if !req.Rate.IsPositive() {
+		respondError(w, http.StatusBadRequest, "Exchange rate must be positive")
+		return
+	}
+
+	rate := models.ExchangeRate{
+		Currency:  currency,
+		Rate:      req.Rate,
+		UpdatedAt: time.Now(),
+	}
+	if err := a.rates.SetExchangeRate(rate); err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save exchange rate: %v", err))
+		return
+	}
+
+	adminID, _ := GetUserIDFromContext(r)
+	log.Printf("Admin %s set exchange rate %s/RUB to %s", adminID, currency, req.Rate.String())
+	respondJSON(w, http.StatusOK, rate)
+}
+
+// quoteConversion рассчитывает конвертацию amount из валюты from в валюту to
+// Кросс-курс получается из курсов обеих валют к рублю, клиенту применяется курс,
+// уменьшенный на спред банка FX_SPREAD_PERCENT; сумма зачисления округляется до копеек
+// Возвращает errExchangeRateUnavailable, если курса одной из валют нет или он устарел
+func (a *API) quoteConversion(amount decimal.Decimal, from, to string, now time.Time) (models.Conversion, error) {
+	fromRate, err := a.rubRate(from, now)
+	if err != nil {
+		return models.Conversion{}, err
+	}
+	toRate, err := a.rubRate(to, now)
+	if err != nil {
+		return models.Conversion{}, err
+	}
+
+	spread := config.GetFXSpreadPercent()
+	midRate := fromRate.Div(toRate).Round(6)
+	rate := midRate.Mul(decimal.NewFromInt(100).Sub(spread)).Div(decimal.NewFromInt(100)).Round(6)
+
+	return models.Conversion{
+		ToCurrency:      to,
+		ConvertedAmount: amount.Mul(rate).Round(2),
+		MidRate:         midRate,
+		Rate:            rate,
+		SpreadPercent:   spread,
+	}, nil
+}
+
+// rubEquivalent пересчитывает amount в валюте currency в рубли по курсу без спреда
+func (a *API) rubEquivalent(amount decimal.Decimal, currency string, now time.Time) (decimal.Decimal, error) {
+	rate, err := a.rubRate(currency, now)
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return amount.Mul(rate).Round(2), nil
+}
+
+// rubRate возвращает курс валюты к рублю; курс рубля равен единице
+// Курс старше FX_RATE_MAX_AGE не используется
+func (a *API) rubRate(currency string, now time.Time) (decimal.Decimal, error) {
+	if currency == models.CurrencyRUB {
+		return decimal.NewFromInt(1), nil
+	}
+	rate, ok := a.rates.GetExchangeRate(currency)
+	if !ok {
+		return decimal.Zero, fmt.Errorf("%w: no rate for %s", errExchangeRateUnavailable, currency)
+	}
+	if now.Sub(rate.UpdatedAt) > config.GetFXRateMaxAge() {
+		return decimal.Zero, fmt.Errorf("%w: rate for %s was updated at %s", errExchangeRateUnavailable,
+			currency, rate.UpdatedAt.Format(time.RFC3339))
+	}
+	return rate.Rate, nil
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/config"
+	"bankapp/internal/models"
+	"bankapp/internal/storage"
+	"bankapp/pkg/utils"
+)
+
+// Коды отказов при списании и отмене удержаний
+const (
+	HoldErrorNotActive     = "hold_not_active"
+	HoldErrorExpired       = "hold_expired"
+	HoldErrorExceedsAmount = "capture_exceeds_hold"
+)
+
+// AuthorizeCardPaymentHandler авторизует платеж по карте: сумма удерживается на счете
+// и уменьшает доступный баланс, но списывается только при последующем capture
+func (a *API) AuthorizeCardPaymentHandler(w http.ResponseWriter, r *http.Request) {
+	req, card, _, ok := a.decodeCardPayment(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	hold := models.Hold{
+		ID:               utils.CreateUniqueIdentifier(),
+		CardID:           card.ID,
+		AccountID:        card.AccountID,
+		Amount:           req.Amount,
+		CapturedAmount:   decimal.Zero,
+		Merchant:         req.Merchant,
+		MerchantCategory: req.MerchantCategory,
+		Status:           models.HoldStatusAuthorized,
+		ExpiresAt:        now.Add(config.GetCardHoldTTL()),
+		CreatedAt:        now,
+	}
+	if err := a.holds.AuthorizeHold(hold); err != nil {
+		respondCardPaymentError(w, err)
+		return
+	}
+
+	log.Printf("Hold %s of %s placed on account %s (card %s) for %s",
+		hold.ID, hold.Amount.String(), hold.AccountID, "*"+card.LastFour, hold.Merchant)
+	respondJSON(w, http.StatusCreated, hold)
+}
+
+// GetHoldHandler возвращает удержание по ID
+func (a *API) GetHoldHandler(w http.ResponseWriter, r *http.Request) {
+	hold, ok := a.ownedHold(w, r)
+	if !ok {
+		return
+	}
+	respondJSON(w, http.StatusOK, hold)
+}
+
+// AdminCaptureHoldHandler списывает удержание полностью или частично по запросу торговой точки
+// Не списанный остаток возвращается в доступный баланс, удержание завершается
+// Держателю карты удержание доступно только для чтения: иначе он мог бы снять его до списания
+func (a *API) AdminCaptureHoldHandler(w http.ResponseWriter, r *http.Request) {
+	hold, ok := a.pathHold(w, r)
+	if !ok {
+		return
+	}
+
+	var req models.CaptureHoldRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+	}
+	defer r.Body.Close()
+
+	amount := req.Amount
+	if amount.IsZero() {
+		amount = hold.Amount
+	}
+	if amount.IsNegative() {
+		respondError(w, http.StatusBadRequest, "Capture amount must be positive")
+		return
+	}
+
+	card, ok := a.cards.GetCard(hold.CardID)
+	if !ok {
+		respondError(w, http.StatusInternalServerError, "Associated card not found")
+		return
+	}
+	account, ok := a.accounts.GetAccount(hold.AccountID)
+	if !ok {
+		respondError(w, http.StatusInternalServerError, "Associated account not found")
+		return
+	}
+
+	posting := cardPaymentPosting(card, account.Currency, amount, hold.Merchant, hold.MerchantCategory, time.Now())
+	captured, err := a.holds.CaptureHold(hold.ID, posting)
+	if err != nil {
+		respondHoldError(w, err, "Failed to capture hold")
+		return
+	}
+
+	operatorID, _ := GetUserIDFromContext(r)
+	log.Printf("Hold %s captured for %s of %s by %s", hold.ID, amount.String(), hold.Amount.String(), operatorID)
+	respondJSON(w, http.StatusOK, captured)
+}
+
+// AdminVoidHoldHandler отменяет удержание по запросу торговой точки и возвращает сумму в доступный баланс
+func (a *API) AdminVoidHoldHandler(w http.ResponseWriter, r *http.Request) {
+	hold, ok := a.pathHold(w, r)
+	if !ok {
+		return
+	}
+
+	voided, err := a.holds.VoidHold(hold.ID)
+	if err != nil {
+		respondHoldError(w, err, "Failed to void hold")
+		return
+	}
+
+	operatorID, _ := GetUserIDFromContext(r)
+	log.Printf("Hold %s voided by %s", hold.ID, operatorID)
+	respondJSON(w, http.StatusOK, voided)
+}
+
+// ListCardHoldsHandler возвращает удержания по карте
+func (a *API) ListCardHoldsHandler(w http.ResponseWriter, r *http.Request) {
+	card, ok := a.ownedCard(w, r)
+	if !ok {
+		return
+	}
+
+	holds, err := a.holds.ListCardHolds(card.ID)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to fetch holds: %v", err))
+		return
+	}
+	respondJSON(w, http.StatusOK, holds)
+}
+
+// pathHold загружает удержание из пути запроса
+// Возвращает false, если ответ с ошибкой уже отправлен
+func (a *API) pathHold(w http.ResponseWriter, r *http.Request) (models.Hold, bool) {
+	holdID := mux.Vars(r)["holdId"]
+
+	hold, ok := a.holds.GetHold(holdID)
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Hold %s not found", holdID))
+		return models.Hold{}, false
+	}
+	return hold, true
+}
+
+// ownedHold загружает удержание из пути запроса и проверяет, что его счет принадлежит пользователю
+// Возвращает false, если ответ с ошибкой уже отправлен
+func (a *API) ownedHold(w http.ResponseWriter, r *http.Request) (models.Hold, bool) {
+	hold, ok := a.pathHold(w, r)
+	if !ok {
+		return models.Hold{}, false
+	}
+
+	account, ok := a.accounts.GetAccount(hold.AccountID)
+	if !ok {
+		respondError(w, http.StatusInternalServerError, "Associated account not found")
+		return models.Hold{}, false
+	}
+	if !requireAccountOwner(w, r, account) {
+		return models.Hold{}, false
+	}
+	return hold, true
+}
+
+// respondHoldError преобразует ошибку списания или отмены удержания в ответ с соответствующим HTTP-кодом
+func respondHoldError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, storage.ErrHoldNotFound):
+		respondError(w, http.StatusNotFound, "Hold not found")
+	case errors.Is(err, storage.ErrHoldNotAuthorized):
+		respondErrorCode(w, http.StatusConflict, HoldErrorNotActive, "Hold is already captured, voided or expired")
+	case errors.Is(err, storage.ErrHoldExpired):
+		respondErrorCode(w, http.StatusGone, HoldErrorExpired, "Hold has expired and the funds were released")
+	case errors.Is(err, storage.ErrCaptureExceedsHold):
+		respondErrorCode(w, http.StatusBadRequest, HoldErrorExceedsAmount, "Capture amount exceeds the held amount")
+	default:
+		respondPostingError(w, err, message)
+	}
+}
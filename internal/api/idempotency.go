@@ -0,0 +1,165 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bankapp/internal/config"
+	"bankapp/internal/models"
+)
+
+// IdempotencyKeyHeader - заголовок, в котором клиент передает ключ идемпотентности
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength ограничивает длину ключа размером столбца в базе данных
+const maxIdempotencyKeyLength = 255
+
+// responseRecorder запоминает код статуса и тело ответа, не передавая их клиенту:
+// ответ отправляется только после того, как он сохранен для ключа идемпотентности
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader запоминает код статуса ответа
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+// Write запоминает тело ответа
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.body.Write(b)
+}
+
+// flush передает клиенту запомненный ответ
+func (rec *responseRecorder) flush() {
+	if rec.status == 0 {
+		return
+	}
+	rec.ResponseWriter.WriteHeader(rec.status)
+	rec.ResponseWriter.Write(rec.body.Bytes())
+}
+
+// IdempotencyMiddleware создает обертку для POST-обработчиков, перемещающих деньги
+// Если запрос содержит заголовок Idempotency-Key, то первый ответ сохраняется и
+// воспроизводится при повторных запросах с тем же ключом, а повторное использование
+// ключа с другим телом запроса отклоняется
+// Ключ хранится IDEMPOTENCY_KEY_TTL; пока исходный запрос не завершен, повторные запросы
+// отклоняются с кодом 409 до истечения этого срока, даже если исходный запрос прервался
+// Должен применяться после AuthMiddleware, так как ключи привязаны к пользователю
+func (a *API) IdempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			respondError(w, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+			return
+		}
+
+		userID, ok := GetUserIDFromContext(r)
+		if !ok {
+			respondError(w, http.StatusUnauthorized, "Authentication is required to use Idempotency-Key")
+			return
+		}
+
+		// Читаем тело запроса, чтобы вычислить отпечаток, и восстанавливаем его для обработчика
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, "Failed to read request body")
+			return
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Время резервирования служит меткой запроса, владеющего ключом; оно округляется
+		// до микросекунд, с которыми его хранит база данных
+		now := time.Now().Truncate(time.Microsecond)
+		record, reserved, err := a.idempotency.ReserveIdempotencyKey(models.IdempotencyRecord{
+			UserID:      userID,
+			Key:         key,
+			Method:      r.Method,
+			Path:        r.URL.Path,
+			Fingerprint: requestFingerprint(r.Method, r.URL.Path, body),
+			CreatedAt:   now,
+			ReservedAt:  now,
+			ExpiresAt:   now.Add(config.GetIdempotencyKeyTTL()),
+		})
+		if err != nil {
+			log.Printf("Ошибка при резервировании ключа идемпотентности: %v", err)
+			respondError(w, http.StatusInternalServerError, "Failed to process Idempotency-Key")
+			return
+		}
+
+		if !reserved {
+			replayIdempotentResponse(w, r, record, body)
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		// Ответы 5xx, 401 и 429 не сохраняются: операция не была проведена и клиент может повторить запрос,
+		// например, добавив код второго фактора или дождавшись снятия блокировки
+		if rec.status >= http.StatusInternalServerError || rec.status == http.StatusUnauthorized ||
+			rec.status == http.StatusTooManyRequests || rec.status == 0 {
+			if err := a.idempotency.ReleaseIdempotencyKey(userID, key, record.ReservedAt); err != nil {
+				log.Printf("Не удалось освободить ключ идемпотентности %s: %v", key, err)
+			}
+			rec.flush()
+			return
+		}
+
+		// Если ответ не сохранен, клиент получает ошибку вместо ответа, который нельзя воспроизвести;
+		// ключ остается зарезервированным, и повтор не проведет операцию второй раз
+		if err := a.idempotency.CompleteIdempotencyKey(userID, key, record.ReservedAt, rec.status, rec.body.Bytes()); err != nil {
+			log.Printf("Не удалось сохранить ответ для ключа идемпотентности %s: %v", key, err)
+			respondError(w, http.StatusInternalServerError, "Failed to store response for Idempotency-Key")
+			return
+		}
+		rec.flush()
+	})
+}
+
+// replayIdempotentResponse отвечает на повторный запрос с уже использованным ключом
+func replayIdempotentResponse(w http.ResponseWriter, r *http.Request, record models.IdempotencyRecord, body []byte) {
+	if record.Fingerprint != requestFingerprint(r.Method, r.URL.Path, body) {
+		respondError(w, http.StatusUnprocessableEntity, "Idempotency-Key has already been used with a different request")
+		return
+	}
+	if !record.Completed {
+		respondError(w, http.StatusConflict, "A request with this Idempotency-Key is still being processed")
+		return
+	}
+
+	log.Printf("Воспроизведен ответ для ключа идемпотентности %s", record.Key)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Idempotent-Replayed", strconv.FormatBool(true))
+	w.WriteHeader(record.StatusCode)
+	w.Write(record.ResponseBody)
+}
+
+// requestFingerprint вычисляет отпечаток запроса по методу, пути и телу
+func requestFingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(path))
+	h.Write([]byte{'\n'})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"bankapp/internal/models"
+	"bankapp/internal/storage"
+)
+
+// idempotencyTestBody - тело запроса, которым проверяется middleware идемпотентности
+const idempotencyTestBody = `{"to_account_id":"account-1","amount":"100"}`
+
+// failingCompleteRepository не сохраняет ответы для ключей идемпотентности
+type failingCompleteRepository struct {
+	storage.IdempotencyRepository
+}
+
+// CompleteIdempotencyKey всегда возвращает ошибку
+func (failingCompleteRepository) CompleteIdempotencyKey(string, string, time.Time, int, []byte) error {
+	return errors.New("база данных недоступна")
+}
+
+// idempotentHandler оборачивает middleware идемпотентности обработчик, считающий проведенные операции
+func idempotentHandler(a *API, calls *int) http.Handler {
+	return a.IdempotencyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		respondJSON(w, http.StatusOK, map[string]int{"operation": *calls})
+	}))
+}
+
+// doIdempotentRequest выполняет запрос пользователя userID с ключом идемпотентности key
+func doIdempotentRequest(handler http.Handler, userID, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/deposits", strings.NewReader(idempotencyTestBody))
+	req.Header.Set(IdempotencyKeyHeader, key)
+	req = req.WithContext(context.WithValue(req.Context(), UserIDKey, userID))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotencyReplaysCompletedResponse(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	var calls int
+	handler := idempotentHandler(NewAPI(store), &calls)
+
+	first := doIdempotentRequest(handler, "user-1", "key-1")
+	second := doIdempotentRequest(handler, "user-1", "key-1")
+	if first.Code != http.StatusOK || second.Code != http.StatusOK {
+		t.Fatalf("статусы %d и %d, ожидался 200", first.Code, second.Code)
+	}
+	if calls != 1 {
+		t.Errorf("операция проведена %d раз, ожидался 1", calls)
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" || second.Body.String() != first.Body.String() {
+		t.Errorf("повтор не воспроизвел исходный ответ: %s", second.Body)
+	}
+}
+
+func TestIdempotencyRetryAfterReservationTimeout(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	var calls int
+	handler := idempotentHandler(NewAPI(store), &calls)
+
+	// Исходный запрос зарезервировал ключ час назад и не завершился, например из-за падения процесса
+	reservedAt := time.Now().Add(-time.Hour)
+	_, reserved, err := store.ReserveIdempotencyKey(models.IdempotencyRecord{
+		UserID:      "user-1",
+		Key:         "key-1",
+		Method:      "POST",
+		Path:        "/deposits",
+		Fingerprint: requestFingerprint("POST", "/deposits", []byte(idempotencyTestBody)),
+		CreatedAt:   reservedAt,
+		ReservedAt:  reservedAt,
+		ExpiresAt:   reservedAt.Add(24 * time.Hour),
+	})
+	if err != nil || !reserved {
+		t.Fatalf("ReserveIdempotencyKey: зарезервирован %v, ошибка %v", reserved, err)
+	}
+
+	// Операция могла быть проведена, поэтому повтор отклоняется до истечения срока хранения ключа
+	rec := doIdempotentRequest(handler, "user-1", "key-1")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("статус %d, ожидался 409, тело %s", rec.Code, rec.Body)
+	}
+	if calls != 0 {
+		t.Fatalf("операция проведена повторно %d раз", calls)
+	}
+
+	// Незавершенный ключ, срок хранения которого истек, можно использовать для нового запроса
+	expiredAt := time.Now().Add(-25 * time.Hour)
+	_, reserved, err = store.ReserveIdempotencyKey(models.IdempotencyRecord{
+		UserID:     "user-1",
+		Key:        "key-2",
+		CreatedAt:  expiredAt,
+		ReservedAt: expiredAt,
+		ExpiresAt:  expiredAt.Add(24 * time.Hour),
+	})
+	if err != nil || !reserved {
+		t.Fatalf("ReserveIdempotencyKey: зарезервирован %v, ошибка %v", reserved, err)
+	}
+	if rec := doIdempotentRequest(handler, "user-1", "key-2"); rec.Code != http.StatusOK {
+		t.Fatalf("истекший ключ: статус %d, ожидался 200, тело %s", rec.Code, rec.Body)
+	}
+	if calls != 1 {
+		t.Errorf("по истекшему ключу операция проведена %d раз, ожидался 1", calls)
+	}
+}
+
+func TestIdempotencyCompleteFailure(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	a := NewAPI(store)
+	a.idempotency = failingCompleteRepository{store}
+	var calls int
+	handler := idempotentHandler(a, &calls)
+
+	// Ответ, который нельзя воспроизвести, не отправляется клиенту
+	rec := doIdempotentRequest(handler, "user-1", "key-1")
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("статус %d, ожидался 500, тело %s", rec.Code, rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), "operation") {
+		t.Errorf("клиенту отправлен несохраненный ответ: %s", rec.Body)
+	}
+
+	// Ключ остается зарезервированным, и повтор не проводит операцию второй раз
+	if rec := doIdempotentRequest(handler, "user-1", "key-1"); rec.Code != http.StatusConflict {
+		t.Fatalf("повтор: статус %d, ожидался 409, тело %s", rec.Code, rec.Body)
+	}
+	if calls != 1 {
+		t.Errorf("операция проведена %d раз, ожидался 1", calls)
+	}
+}
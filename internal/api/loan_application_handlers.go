@@ -0,0 +1,426 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/models"
+	"bankapp/internal/services"
+	"bankapp/internal/storage"
+	"bankapp/pkg/utils"
+)
+
+// Коды отказов при рассмотрении заявок на кредит
+const (
+	// LoanApplicationErrorInvalidTransition - действие недопустимо в текущем статусе заявки
+	LoanApplicationErrorInvalidTransition = "invalid_application_transition"
+	// LoanApplicationErrorSelfReview - операционист рассматривает собственную заявку
+	LoanApplicationErrorSelfReview = "self_review_forbidden"
+)
+
+// SubmitLoanApplicationHandler принимает заявку на кредит по продукту и проводит ее скоринг
+// Одобренный скорингом кредит сразу выдается на счет, отклоненная заявка возвращается с причинами отказа,
+// а пограничная ожидает решения операциониста в статусе manual_review
+func (a *API) SubmitLoanApplicationHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.ApplyLoanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Amount.LessThanOrEqual(decimal.Zero) || req.TermMonths <= 0 {
+		respondError(w, http.StatusBadRequest, "Loan amount and term must be positive")
+		return
+	}
+
+	if req.ProductID == "" {
+		respondError(w, http.StatusBadRequest, "Loan product is required")
+		return
+	}
+
+	if !requireSelf(w, r, req.UserID) {
+		return
+	}
+
+	_, userExists := a.users.GetUserByID(req.UserID)
+	account, accountExists := a.accounts.GetAccount(req.AccountID)
+
+	if !userExists {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("User %s not found", req.UserID))
+		return
+	}
+	if !accountExists {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Account %s not found", req.AccountID))
+		return
+	}
+	if !requireAccountOwner(w, r, account) {
+		return
+	}
+
+	product, ok := a.loanProducts.GetLoanProduct(req.ProductID)
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Loan product %s not found", req.ProductID))
+		return
+	}
+	if !checkLoanProductTerms(w, product, account, req.Amount, req.TermMonths) {
+		return
+	}
+
+	// Ставка и график нужны скорингу для расчета ежемесячного платежа по новому кредиту
+	now := time.Now()
+	quote, err := a.quoteLoan(product, req.UserID, req.AccountID, req.Amount, req.TermMonths, now)
+	if err != nil {
+		log.Printf("Failed to get key rate for loan pricing: %v", err)
+		respondError(w, http.StatusServiceUnavailable, "Key rate is unavailable, loans cannot be priced right now")
+		return
+	}
+
+	application := models.LoanApplication{
+		ID:         utils.CreateUniqueIdentifier(),
+		UserID:     req.UserID,
+		AccountID:  req.AccountID,
+		ProductID:  product.ID,
+		Amount:     req.Amount,
+		Currency:   product.Currency,
+		TermMonths: req.TermMonths,
+		Status:     models.LoanApplicationSubmitted,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := a.applications.CreateLoanApplication(application); err != nil {
+		respondLoanApplicationError(w, err, "Failed to save loan application")
+		return
+	}
+
+	application, err = a.scoreLoanApplication(application, quote)
+	if err != nil {
+		respondLoanApplicationError(w, err, "Failed to score loan application")
+		return
+	}
+
+	if application.Status == models.LoanApplicationApproved {
+		disbursed, err := a.disburseLoanApplication(application, quote, "")
+		if err != nil {
+			// Заявка остается одобренной, кредит по ней выдает операционист
+			log.Printf("Failed to disburse approved loan application %s: %v", application.ID, err)
+		} else {
+			application = disbursed
+		}
+	}
+
+	log.Printf("Loan application %s of user %s under product %s for %s %s, term %d months: %s",
+		application.ID, req.UserID, product.ID, req.Amount.String(), product.Currency, req.TermMonths, application.Status)
+	respondJSON(w, http.StatusCreated, application)
+}
+
+// GetLoanApplicationHandler возвращает заявку на кредит ее владельцу
+func (a *API) GetLoanApplicationHandler(w http.ResponseWriter, r *http.Request) {
+	applicationID := mux.Vars(r)["applicationId"]
+
+	application, ok := a.applications.GetLoanApplication(applicationID)
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Loan application %s not found", applicationID))
+		return
+	}
+	if !requireSelf(w, r, application.UserID) {
+		return
+	}
+	respondJSON(w, http.StatusOK, application)
+}
+
+// ListUserLoanApplicationsHandler возвращает заявки пользователя на кредит
+// Параметры запроса: status
+func (a *API) ListUserLoanApplicationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["userId"]
+	if !requireSelf(w, r, userID) {
+		return
+	}
+
+	applications, err := a.applications.ListLoanApplications(models.LoanApplicationFilter{
+		UserID: userID,
+		Status: r.URL.Query().Get("status"),
+	})
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to fetch loan applications: %v", err))
+		return
+	}
+	respondJSON(w, http.StatusOK, applications)
+}
+
+// AdminListLoanApplicationsHandler возвращает заявки на кредит с фильтрацией
+// Параметры запроса: user_id, status; status=manual_review - очередь заявок на рассмотрение
+func (a *API) AdminListLoanApplicationsHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.LoanApplicationFilter{
+		UserID: query.Get("user_id"),
+		Status: query.Get("status"),
+	}
+
+	applications, err := a.applications.ListLoanApplications(filter)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to list loan applications: %v", err))
+		return
+	}
+
+	log.Printf("Admin fetched %d loan applications", len(applications))
+	respondJSON(w, http.StatusOK, applications)
+}
+
+// AdminGetLoanApplicationHandler возвращает заявку на кредит с результатом скоринга
+func (a *API) AdminGetLoanApplicationHandler(w http.ResponseWriter, r *http.Request) {
+	applicationID := mux.Vars(r)["applicationId"]
+
+	application, ok := a.applications.GetLoanApplication(applicationID)
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Loan application %s not found", applicationID))
+		return
+	}
+	respondJSON(w, http.StatusOK, application)
+}
+
+// AdminDecideLoanApplicationHandler принимает решение операциониста по заявке в статусе manual_review
+// При одобрении кредит рассчитывается на текущую дату и сразу выдается; если выдать его не удалось,
+// заявка остается одобренной и кредит выдается запросом на выдачу
+func (a *API) AdminDecideLoanApplicationHandler(w http.ResponseWriter, r *http.Request) {
+	applicationID := mux.Vars(r)["applicationId"]
+
+	var req models.LoanDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Decision != models.ScoringDecisionApprove && req.Decision != models.ScoringDecisionReject {
+		respondError(w, http.StatusBadRequest, "Decision must be approve or reject")
+		return
+	}
+
+	application, ok := a.applications.GetLoanApplication(applicationID)
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Loan application %s not found", applicationID))
+		return
+	}
+	operatorID, ok := requireNotApplicant(w, r, application)
+	if !ok {
+		return
+	}
+	if application.Status != models.LoanApplicationManualReview {
+		respondErrorCode(w, http.StatusConflict, LoanApplicationErrorInvalidTransition,
+			fmt.Sprintf("Loan application is %s, only applications in manual_review can be decided", application.Status))
+		return
+	}
+
+	now := time.Now()
+	decided := application
+	decided.ReviewerID = operatorID
+	decided.ReviewComment = strings.TrimSpace(req.Comment)
+	decided.UpdatedAt = now
+	decided.DecidedAt = &now
+	decided.Status = models.LoanApplicationRejected
+
+	var loan models.Loan
+	if req.Decision == models.ScoringDecisionApprove {
+		if loan, ok = a.requoteLoanApplication(w, application, now); !ok {
+			return
+		}
+		decided.Status = models.LoanApplicationApproved
+	}
+
+	if err := a.applications.UpdateLoanApplication(decided, application.Status); err != nil {
+		respondLoanApplicationError(w, err, "Failed to update loan application")
+		return
+	}
+	log.Printf("Operator %s moved loan application %s from %s to %s", operatorID, applicationID, application.Status, decided.Status)
+
+	if decided.Status == models.LoanApplicationApproved {
+		disbursed, err := a.disburseLoanApplication(decided, loan, operatorID)
+		if err != nil {
+			log.Printf("Failed to disburse approved loan application %s: %v", applicationID, err)
+			respondLoanApplicationError(w, err, "Loan application approved, but the loan could not be disbursed")
+			return
+		}
+		decided = disbursed
+	}
+
+	a.notifyLoanApplicant(decided)
+	respondJSON(w, http.StatusOK, decided)
+}
+
+// AdminDisburseLoanApplicationHandler выдает кредит по одобренной заявке, выдать который
+// при одобрении не удалось; кредит рассчитывается на текущую дату
+func (a *API) AdminDisburseLoanApplicationHandler(w http.ResponseWriter, r *http.Request) {
+	applicationID := mux.Vars(r)["applicationId"]
+
+	application, ok := a.applications.GetLoanApplication(applicationID)
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Loan application %s not found", applicationID))
+		return
+	}
+	operatorID, ok := requireNotApplicant(w, r, application)
+	if !ok {
+		return
+	}
+	if application.Status != models.LoanApplicationApproved {
+		respondErrorCode(w, http.StatusConflict, LoanApplicationErrorInvalidTransition,
+			fmt.Sprintf("Loan application is %s, only approved applications can be disbursed", application.Status))
+		return
+	}
+
+	loan, ok := a.requoteLoanApplication(w, application, time.Now())
+	if !ok {
+		return
+	}
+	disbursed, err := a.disburseLoanApplication(application, loan, operatorID)
+	if err != nil {
+		respondLoanApplicationError(w, err, "Failed to disburse loan")
+		return
+	}
+
+	log.Printf("Operator %s disbursed loan %s for application %s", operatorID, disbursed.LoanID, applicationID)
+	a.notifyLoanApplicant(disbursed)
+	respondJSON(w, http.StatusOK, disbursed)
+}
+
+// scoreLoanApplication переводит принятую заявку в скоринг, а по его решению - в статус approved,
+// rejected или manual_review; если скоринг не удался, заявка передается операционисту
+// quote - кредит, рассчитанный по заявке
+func (a *API) scoreLoanApplication(application models.LoanApplication, quote models.Loan) (models.LoanApplication, error) {
+	scoring := application
+	scoring.Status = models.LoanApplicationScoring
+	scoring.UpdatedAt = time.Now()
+	if err := a.applications.UpdateLoanApplication(scoring, application.Status); err != nil {
+		return application, err
+	}
+
+	now := time.Now()
+	result, err := a.scoring.Score(scoring, quote, now)
+	if err != nil {
+		log.Printf("Scoring of loan application %s failed, sending it to manual review: %v", application.ID, err)
+		result = models.ScoringResult{
+			Decision: models.ScoringDecisionReview,
+			Reasons:  []models.ScoringReason{{Code: "scoring_failed", Message: "Automatic scoring failed"}},
+			ScoredAt: now,
+		}
+	}
+
+	decided := scoring
+	decided.Scoring = &result
+	decided.UpdatedAt = now
+	switch result.Decision {
+	case models.ScoringDecisionApprove:
+		decided.Status = models.LoanApplicationApproved
+		decided.DecidedAt = &now
+	case models.ScoringDecisionReject:
+		decided.Status = models.LoanApplicationRejected
+		decided.DecidedAt = &now
+	default:
+		decided.Status = models.LoanApplicationManualReview
+	}
+	if err := a.applications.UpdateLoanApplication(decided, scoring.Status); err != nil {
+		return scoring, err
+	}
+	return decided, nil
+}
+
+// requoteLoanApplication рассчитывает кредит по заявке на момент now, чтобы график начинался с даты выдачи
+// Возвращает false, если ответ об ошибке уже отправлен
+func (a *API) requoteLoanApplication(w http.ResponseWriter, application models.LoanApplication, now time.Time) (models.Loan, bool) {
+	product, ok := a.loanProducts.GetLoanProduct(application.ProductID)
+	if !ok {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Loan product %s not found", application.ProductID))
+		return models.Loan{}, false
+	}
+	loan, err := a.quoteLoan(product, application.UserID, application.AccountID, application.Amount, application.TermMonths, now)
+	if err != nil {
+		log.Printf("Failed to get key rate for loan pricing: %v", err)
+		respondError(w, http.StatusServiceUnavailable, "Key rate is unavailable, loans cannot be priced right now")
+		return models.Loan{}, false
+	}
+	return loan, true
+}
+
+// disburseLoanApplication выдает кредит loan по одобренной заявке, зачисляя его сумму на счет заемщика
+func (a *API) disburseLoanApplication(application models.LoanApplication, loan models.Loan, operatorID string) (models.LoanApplication, error) {
+	tx := models.Transaction{
+		ID:              utils.CreateUniqueIdentifier(),
+		FromAccountID:   "",
+		ToAccountID:     loan.AccountID,
+		Amount:          loan.Amount,
+		Currency:        loan.Currency,
+		Timestamp:       time.Now(),
+		TransactionType: "loan_disbursement",
+		Description:     fmt.Sprintf("Loan disbursement (ID: %s)", loan.ID),
+	}
+	disbursement := models.Posting{
+		Transaction: tx,
+		Entries: []models.JournalEntry{
+			storage.DebitLeg(storage.LedgerLoans, loan.Amount),
+			storage.CreditLeg(loan.AccountID, loan.Amount),
+		},
+	}
+	return a.applications.DisburseLoanApplication(application.ID, operatorID, loan, disbursement)
+}
+
+// requireNotApplicant запрещает операционисту рассматривать собственную заявку и выдавать по ней кредит
+// Возвращает ID операциониста и false, если ответ 403 уже отправлен
+func requireNotApplicant(w http.ResponseWriter, r *http.Request, application models.LoanApplication) (string, bool) {
+	operatorID, _ := GetUserIDFromContext(r)
+	if operatorID == application.UserID {
+		log.Printf("Operator %s tried to act on their own loan application %s", operatorID, application.ID)
+		respondErrorCode(w, http.StatusForbidden, LoanApplicationErrorSelfReview,
+			"Operators cannot decide on or disburse their own loan applications")
+		return operatorID, false
+	}
+	return operatorID, true
+}
+
+// notifyLoanApplicant сообщает заявителю о выдаче кредита или отказе по заявке, рассмотренной операционистом
+func (a *API) notifyLoanApplicant(application models.LoanApplication) {
+	user, ok := a.users.GetUserByID(application.UserID)
+	if !ok || user.Email == "" {
+		return
+	}
+
+	var subject, body string
+	switch application.Status {
+	case models.LoanApplicationDisbursed:
+		subject = "Your loan has been approved"
+		body = fmt.Sprintf("Hello %s,\n\nYour loan application %s has been approved and %s %s has been credited to your account.",
+			user.Username, application.ID, application.Amount.StringFixed(2), application.Currency)
+	case models.LoanApplicationRejected:
+		subject = "Your loan application has been declined"
+		body = fmt.Sprintf("Hello %s,\n\nUnfortunately, your loan application %s has been declined.", user.Username, application.ID)
+	default:
+		return
+	}
+
+	go func() {
+		if err := services.SendNotification(user.Email, subject, body); err != nil {
+			log.Printf("Failed to send loan application email to %s: %v", user.Email, err)
+		}
+	}()
+}
+
+// respondLoanApplicationError преобразует ошибку обработки заявки на кредит в ответ с соответствующим HTTP-кодом
+func respondLoanApplicationError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, storage.ErrLoanApplicationNotFound):
+		respondError(w, http.StatusNotFound, "Loan application not found")
+	case errors.Is(err, storage.ErrLoanApplicationStatusConflict):
+		respondErrorCode(w, http.StatusConflict, LoanApplicationErrorInvalidTransition, "Loan application cannot be moved to this status")
+	case errors.Is(err, storage.ErrLoanProductNotFound):
+		respondError(w, http.StatusNotFound, "Loan product not found")
+	default:
+		respondPostingError(w, err, message)
+	}
+}
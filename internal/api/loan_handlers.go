@@ -1,7 +1,6 @@
 package api
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,102 +10,89 @@ import (
 	"github.com/shopspring/decimal"
 
 	"bankapp/internal/models"
-	"bankapp/internal/services"
-	"bankapp/internal/storage"
 	"bankapp/pkg/utils"
 )
 
-// ApplyLoanHandler обрабатывает запросы на получение кредита
-func ApplyLoanHandler(w http.ResponseWriter, r *http.Request) {
-	var req models.ApplyLoanRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		respondError(w, http.StatusBadRequest, "Invalid request payload")
-		return
+// checkLoanProductTerms проверяет, что кредит на amount на termMonths месяцев на счет account
+// допускается продуктом; возвращает false, если ответ об ошибке уже отправлен
+func checkLoanProductTerms(w http.ResponseWriter, product models.LoanProduct, account models.Account, amount decimal.Decimal, termMonths int) bool {
+	if !product.Active {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Loan product %s is not available", product.ID))
+		return false
 	}
-	defer r.Body.Close()
-
-	if req.Amount.LessThanOrEqual(decimal.Zero) || req.TermMonths <= 0 {
-		respondError(w, http.StatusBadRequest, "Loan amount and term must be positive")
-		return
+	if account.Currency != product.Currency {
+		respondErrorCode(w, http.StatusBadRequest, ExchangeErrorCurrencyMismatch,
+			fmt.Sprintf("Loan product %s is in %s, account is in %s", product.ID, product.Currency, account.Currency))
+		return false
 	}
-
-	_, userExists := storage.GetUserByID(req.UserID)
-	_, accountExists := storage.GetAccount(req.AccountID)
-
-	if !userExists {
-		respondError(w, http.StatusNotFound, fmt.Sprintf("User %s not found", req.UserID))
-		return
+	if amount.LessThan(product.MinAmount) || amount.GreaterThan(product.MaxAmount) {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Loan amount must be between %s and %s %s",
+			product.MinAmount.String(), product.MaxAmount.String(), product.Currency))
+		return false
 	}
-	if !accountExists {
-		respondError(w, http.StatusNotFound, fmt.Sprintf("Account %s not found", req.AccountID))
-		return
+	if termMonths < product.MinTermMonths || termMonths > product.MaxTermMonths {
+		respondError(w, http.StatusBadRequest, fmt.Sprintf("Loan term must be between %d and %d months",
+			product.MinTermMonths, product.MaxTermMonths))
+		return false
 	}
+	return true
+}
 
-	baseRate, err := services.FetchCentralBankRate()
-	if err != nil {
-		log.Printf("Warning: Failed to get key rate, using default 10%%: %v", err)
-		baseRate = decimal.NewFromInt(10)
+// quoteLoan рассчитывает кредит по продукту: ставку, график платежей и условия, копируемые из продукта
+// Ставка от ключевой определяется на дату now; без ключевой ставки кредит не может быть оценен,
+// поведение при недоступности источника задает KEY_RATE_FALLBACK
+func (a *API) quoteLoan(product models.LoanProduct, userID, accountID string, amount decimal.Decimal, termMonths int, now time.Time) (models.Loan, error) {
+	interestRate := product.FixedRate
+	margin := decimal.Zero
+	if product.Pricing == models.LoanPricingKeyRateMargin {
+		keyRate, err := a.keyRates.KeyRate(now)
+		if err != nil {
+			return models.Loan{}, err
+		}
+		margin = product.RateMargin
+		interestRate = keyRate.Rate.Add(margin)
 	}
 
-	interestRate := baseRate.Add(decimal.NewFromInt(5))
-
-	monthlyPayment := utils.CalculateMonthlyPayment(req.Amount, interestRate, req.TermMonths)
-	startDate := time.Now()
-	schedule := utils.GeneratePaymentSchedule(req.Amount, interestRate, req.TermMonths, startDate, monthlyPayment)
-
 	loan := models.Loan{
 		ID:              utils.CreateUniqueIdentifier(),
-		UserID:          req.UserID,
-		AccountID:       req.AccountID,
-		Amount:          req.Amount,
+		UserID:          userID,
+		AccountID:       accountID,
+		ProductID:       product.ID,
+		Amount:          amount,
+		Currency:        product.Currency,
 		InterestRate:    interestRate,
-		TermMonths:      req.TermMonths,
-		StartDate:       startDate,
-		PaymentSchedule: schedule,
-		RemainingAmount: req.Amount,
+		RateType:        product.RateType,
+		RateMargin:      margin,
+		Amortization:    product.Amortization,
+		PenaltyPercent:  product.PenaltyPercent,
+		PenaltyDueDays:  product.PenaltyDueDays,
+		TermMonths:      termMonths,
+		StartDate:       now,
+		PaymentSchedule: utils.GenerateLoanSchedule(product.Amortization, amount, interestRate, termMonths, now),
+		RemainingAmount: amount,
 	}
-
-	if err := storage.AddLoan(loan); err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save loan: %v", err))
-		return
+	// Плавающая ставка пересматривается планировщиком с сохранением маржи, установленной при выдаче
+	if product.RateType == models.LoanRateFloating {
+		loan.RateResetMonths = product.RateResetMonths
+		nextReset := now.AddDate(0, loan.RateResetMonths, 0)
+		loan.NextRateResetDate = &nextReset
 	}
-
-	err = storage.UpdateAccountBalance(req.AccountID, req.Amount)
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to disburse loan funds: %v", err))
-		return
-	}
-
-	tx := models.Transaction{
-		ID:              utils.CreateUniqueIdentifier(),
-		FromAccountID:   "",
-		ToAccountID:     req.AccountID,
-		Amount:          req.Amount,
-		Timestamp:       time.Now(),
-		TransactionType: "loan_disbursement",
-		Description:     fmt.Sprintf("Loan disbursement (ID: %s)", loan.ID),
-	}
-	if err := storage.AddTransaction(tx); err != nil {
-		log.Printf("Failed to record loan disbursement transaction: %v", err)
-		// Продолжаем выполнение, так как кредит уже выдан и деньги зачислены
-	}
-
-	log.Printf("Loan %s approved for user %s, amount %s, rate %s%%, term %d months. Funds disbursed to account %s.",
-		loan.ID, req.UserID, req.Amount.String(), interestRate.String(), req.TermMonths, req.AccountID)
-
-	respondJSON(w, http.StatusCreated, loan)
+	return loan, nil
 }
 
 // GetLoanScheduleHandler обрабатывает запросы на получение графика платежей по кредиту
-func GetLoanScheduleHandler(w http.ResponseWriter, r *http.Request) {
+func (a *API) GetLoanScheduleHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	loanID := vars["loanId"]
 
-	loan, ok := storage.GetLoan(loanID)
+	loan, ok := a.loans.GetLoan(loanID)
 	if !ok {
 		respondError(w, http.StatusNotFound, fmt.Sprintf("Loan %s not found", loanID))
 		return
 	}
+	if !requireLoanOwner(w, r, loan) {
+		return
+	}
 
 	log.Printf("Fetched payment schedule for loan %s", loanID)
 	respondJSON(w, http.StatusOK, loan.PaymentSchedule)
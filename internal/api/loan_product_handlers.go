@@ -0,0 +1,243 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/config"
+	"bankapp/internal/models"
+	"bankapp/internal/storage"
+	"bankapp/pkg/utils"
+)
+
+// Значения по умолчанию для штрафа за просроченный платеж по кредитному продукту
+const (
+	defaultLoanPenaltyPercent = 10
+	defaultLoanPenaltyDueDays = 7
+)
+
+// ListLoanProductsHandler возвращает кредитные продукты, доступные для оформления кредита
+func (a *API) ListLoanProductsHandler(w http.ResponseWriter, r *http.Request) {
+	products, err := a.loanProducts.ListLoanProducts(true)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to list loan products: %v", err))
+		return
+	}
+	respondJSON(w, http.StatusOK, products)
+}
+
+// AdminListLoanProductsHandler возвращает все кредитные продукты, включая недоступные для новых кредитов
+func (a *API) AdminListLoanProductsHandler(w http.ResponseWriter, r *http.Request) {
+	products, err := a.loanProducts.ListLoanProducts(false)
+	if err != nil {
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to list loan products: %v", err))
+		return
+	}
+	respondJSON(w, http.StatusOK, products)
+}
+
+// AdminGetLoanProductHandler возвращает кредитный продукт
+func (a *API) AdminGetLoanProductHandler(w http.ResponseWriter, r *http.Request) {
+	productID := mux.Vars(r)["productId"]
+	product, ok := a.loanProducts.GetLoanProduct(productID)
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Loan product %s not found", productID))
+		return
+	}
+	respondJSON(w, http.StatusOK, product)
+}
+
+// AdminCreateLoanProductHandler создает кредитный продукт
+func (a *API) AdminCreateLoanProductHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.LoanProductRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	now := time.Now()
+	product, err := loanProductFromRequest(req)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	product.ID = utils.CreateUniqueIdentifier()
+	product.CreatedAt = now
+	product.UpdatedAt = now
+
+	if err := a.loanProducts.CreateLoanProduct(product); err != nil {
+		respondLoanProductError(w, err, product.ID)
+		return
+	}
+
+	adminID, _ := GetUserIDFromContext(r)
+	log.Printf("Admin %s created loan product %s (%s)", adminID, product.ID, product.Name)
+	respondJSON(w, http.StatusCreated, product)
+}
+
+// AdminUpdateLoanProductHandler заменяет условия кредитного продукта
+// Выданные по продукту кредиты сохраняют условия, действовавшие при выдаче
+func (a *API) AdminUpdateLoanProductHandler(w http.ResponseWriter, r *http.Request) {
+	productID := mux.Vars(r)["productId"]
+	existing, ok := a.loanProducts.GetLoanProduct(productID)
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Loan product %s not found", productID))
+		return
+	}
+
+	var req models.LoanProductRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	product, err := loanProductFromRequest(req)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	product.ID = existing.ID
+	product.CreatedAt = existing.CreatedAt
+	product.UpdatedAt = time.Now()
+
+	if err := a.loanProducts.UpdateLoanProduct(product); err != nil {
+		respondLoanProductError(w, err, productID)
+		return
+	}
+
+	adminID, _ := GetUserIDFromContext(r)
+	log.Printf("Admin %s updated loan product %s", adminID, productID)
+	respondJSON(w, http.StatusOK, product)
+}
+
+// AdminDeleteLoanProductHandler удаляет кредитный продукт, по которому нет кредитов и заявок
+func (a *API) AdminDeleteLoanProductHandler(w http.ResponseWriter, r *http.Request) {
+	productID := mux.Vars(r)["productId"]
+	if err := a.loanProducts.DeleteLoanProduct(productID); err != nil {
+		respondLoanProductError(w, err, productID)
+		return
+	}
+
+	adminID, _ := GetUserIDFromContext(r)
+	log.Printf("Admin %s deleted loan product %s", adminID, productID)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Loan product deleted"})
+}
+
+// respondLoanProductError отправляет ответ об ошибке хранилища кредитных продуктов
+func respondLoanProductError(w http.ResponseWriter, err error, productID string) {
+	switch {
+	case errors.Is(err, storage.ErrLoanProductNotFound):
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Loan product %s not found", productID))
+	case errors.Is(err, storage.ErrLoanProductExists):
+		respondError(w, http.StatusConflict, "Loan product with this name already exists")
+	case errors.Is(err, storage.ErrLoanProductInUse):
+		respondError(w, http.StatusConflict, "Loan product has loans or loan applications; deactivate it instead")
+	default:
+		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to save loan product: %v", err))
+	}
+}
+
+// loanProductFromRequest проверяет условия продукта из запроса и заполняет значения по умолчанию
+// Ошибка содержит сообщение для клиента
+func loanProductFromRequest(req models.LoanProductRequest) (models.LoanProduct, error) {
+	product := models.LoanProduct{
+		Name:            strings.TrimSpace(req.Name),
+		Currency:        strings.ToUpper(req.Currency),
+		MinAmount:       req.MinAmount,
+		MaxAmount:       req.MaxAmount,
+		MinTermMonths:   req.MinTermMonths,
+		MaxTermMonths:   req.MaxTermMonths,
+		Pricing:         req.Pricing,
+		RateType:        req.RateType,
+		RateResetMonths: req.RateResetMonths,
+		PenaltyPercent:  decimal.NewFromInt(defaultLoanPenaltyPercent),
+		PenaltyDueDays:  req.PenaltyDueDays,
+		Amortization:    req.Amortization,
+		Active:          req.Active == nil || *req.Active,
+	}
+	if product.Currency == "" {
+		product.Currency = models.CurrencyRUB
+	}
+	if product.Pricing == "" {
+		product.Pricing = models.LoanPricingKeyRateMargin
+	}
+	if product.RateType == "" {
+		product.RateType = models.LoanRateFixed
+	}
+	if product.Amortization == "" {
+		product.Amortization = models.AmortizationAnnuity
+	}
+	if req.PenaltyPercent != nil {
+		product.PenaltyPercent = *req.PenaltyPercent
+	}
+	if product.PenaltyDueDays == 0 {
+		product.PenaltyDueDays = defaultLoanPenaltyDueDays
+	}
+
+	if product.Name == "" {
+		return product, errors.New("Name is required")
+	}
+	if !models.IsSupportedCurrency(product.Currency) {
+		return product, fmt.Errorf("Unsupported currency %q", req.Currency)
+	}
+	if !product.MinAmount.IsPositive() || product.MaxAmount.LessThan(product.MinAmount) {
+		return product, errors.New("Amounts must be positive and min_amount must not exceed max_amount")
+	}
+	if product.MinTermMonths <= 0 || product.MaxTermMonths < product.MinTermMonths {
+		return product, errors.New("Terms must be positive and min_term_months must not exceed max_term_months")
+	}
+
+	switch product.Pricing {
+	case models.LoanPricingKeyRateMargin:
+		if req.RateMargin.IsNegative() {
+			return product, errors.New("Rate margin must not be negative")
+		}
+		product.RateMargin = req.RateMargin
+	case models.LoanPricingFixedRate:
+		if !req.FixedRate.IsPositive() {
+			return product, errors.New("Fixed rate must be positive")
+		}
+		product.FixedRate = req.FixedRate
+	default:
+		return product, errors.New("Pricing must be key_rate_margin or fixed_rate")
+	}
+
+	switch product.RateType {
+	case models.LoanRateFixed:
+		product.RateResetMonths = 0
+	case models.LoanRateFloating:
+		// Плавающая ставка пересматривается по ключевой, поэтому у ставки продукта ее быть не может
+		if product.Pricing != models.LoanPricingKeyRateMargin {
+			return product, errors.New("Floating rate requires key_rate_margin pricing")
+		}
+		if product.RateResetMonths < 0 {
+			return product, errors.New("Rate reset period must be positive")
+		}
+		if product.RateResetMonths == 0 {
+			product.RateResetMonths = config.GetLoanRateResetMonths()
+		}
+	default:
+		return product, errors.New("Rate type must be fixed or floating")
+	}
+
+	if product.PenaltyPercent.IsNegative() || product.PenaltyPercent.GreaterThan(decimal.NewFromInt(100)) {
+		return product, errors.New("Penalty percent must be between 0 and 100")
+	}
+	if product.PenaltyDueDays < 0 {
+		return product, errors.New("Penalty due days must be positive")
+	}
+	if product.Amortization != models.AmortizationAnnuity && product.Amortization != models.AmortizationDifferentiated {
+		return product, errors.New("Amortization must be annuity or differentiated")
+	}
+	return product, nil
+}
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bankapp/internal/auth"
+	"bankapp/internal/config"
+	"bankapp/internal/models"
+)
+
+// EnrollMFAHandler начинает настройку двухфакторной аутентификации:
+// генерирует секрет TOTP и otpauth URI для приложения-аутентификатора
+// Настройка вступает в силу только после подтверждения кодом (ConfirmMFAHandler)
+func (a *API) EnrollMFAHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _ := GetUserIDFromContext(r)
+	user, ok := a.users.GetUserByID(userID)
+	if !ok {
+		respondError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if mfa, ok := a.mfa.GetUserMFA(userID); ok && mfa.Enabled {
+		respondError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		log.Printf("Failed to generate TOTP secret: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to start two-factor enrollment")
+		return
+	}
+	if err := a.mfa.SaveMFASecret(userID, secret); err != nil {
+		log.Printf("Failed to save TOTP secret: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to start two-factor enrollment")
+		return
+	}
+
+	log.Printf("Two-factor enrollment started for user %s", userID)
+	respondJSON(w, http.StatusOK, map[string]string{
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPURI(user.Username, secret),
+	})
+}
+
+// ConfirmMFAHandler включает двухфакторную аутентификацию после проверки первого кода
+// Возвращает коды восстановления; они показываются только один раз
+func (a *API) ConfirmMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.OTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	userID, _ := GetUserIDFromContext(r)
+	mfa, ok := a.mfa.GetUserMFA(userID)
+	if !ok {
+		respondError(w, http.StatusBadRequest, "Two-factor enrollment has not been started")
+		return
+	}
+	if mfa.Enabled {
+		respondError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	counter, valid := auth.ValidateTOTP(mfa.Secret, req.Code, time.Now())
+	if !valid {
+		respondError(w, http.StatusUnauthorized, "Invalid two-factor code")
+		return
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		log.Printf("Failed to generate recovery codes: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to enable two-factor authentication")
+		return
+	}
+	if err := a.mfa.EnableMFA(userID, counter, hashes); err != nil {
+		log.Printf("Failed to enable two-factor authentication: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to enable two-factor authentication")
+		return
+	}
+
+	log.Printf("Two-factor authentication enabled for user %s", userID)
+	respondJSON(w, http.StatusOK, map[string]interface{}{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// DisableMFAHandler отключает двухфакторную аутентификацию
+// Требует действующий код TOTP или код восстановления
+func (a *API) DisableMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.OTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	userID, _ := GetUserIDFromContext(r)
+	if !a.checkSecondFactor(w, userID, req.Code) {
+		return
+	}
+
+	if err := a.mfa.DisableMFA(userID); err != nil {
+		log.Printf("Failed to disable two-factor authentication: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to disable two-factor authentication")
+		return
+	}
+
+	log.Printf("Two-factor authentication disabled for user %s", userID)
+	respondJSON(w, http.StatusOK, map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodesHandler выпускает новые коды восстановления взамен всех старых
+// Требует действующий код TOTP или код восстановления
+func (a *API) RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.OTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	userID, _ := GetUserIDFromContext(r)
+	if !a.checkSecondFactor(w, userID, req.Code) {
+		return
+	}
+
+	codes, hashes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		log.Printf("Failed to generate recovery codes: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to generate recovery codes")
+		return
+	}
+	if err := a.mfa.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		log.Printf("Failed to save recovery codes: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to generate recovery codes")
+		return
+	}
+
+	log.Printf("Recovery codes regenerated for user %s", userID)
+	respondJSON(w, http.StatusOK, map[string]interface{}{"recovery_codes": codes})
+}
+
+// LoginMFAHandler обрабатывает второй шаг входа: проверяет код второго фактора
+// и выдает токены пользователю, прошедшему проверку пароля
+func (a *API) LoginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.LoginMFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid request payload")
+		return
+	}
+	defer r.Body.Close()
+
+	claims, err := auth.ValidateMFAToken(req.MFAToken)
+	if err != nil {
+		respondError(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+
+	// Промежуточный токен одноразовый: после любой попытки, успешной или нет,
+	// нужно снова ввести пароль, что ограничивает перебор кодов
+	revoked, err := a.tokens.IsAccessTokenRevoked(claims.ID, claims.UserID, claims.IssuedAt.Time)
+	if err != nil {
+		log.Printf("Failed to check MFA token revocation: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to verify MFA token")
+		return
+	}
+	if revoked {
+		respondError(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+	if err := a.tokens.RevokeAccessToken(claims.ID, claims.UserID, claims.ExpiresAt.Time); err != nil {
+		log.Printf("Failed to revoke MFA token: %v", err)
+		respondError(w, http.StatusInternalServerError, "Failed to verify MFA token")
+		return
+	}
+
+	user, ok := a.users.GetUserByID(claims.UserID)
+	if !ok {
+		respondError(w, http.StatusUnauthorized, "Invalid or expired MFA token")
+		return
+	}
+
+	if !a.checkSecondFactor(w, user.ID, req.Code) {
+		return
+	}
+
+	log.Printf("User passed two-factor verification: %s", user.Username)
+	a.respondWithSession(w, user)
+}
+
+// verifySecondFactor проверяет код второго фактора: сначала как код TOTP,
+// затем как код восстановления; использованные коды повторно не принимаются
+func (a *API) verifySecondFactor(userID, code string) (bool, error) {
+	mfa, ok := a.mfa.GetUserMFA(userID)
+	if !ok || !mfa.Enabled {
+		return false, nil
+	}
+
+	if counter, valid := auth.ValidateTOTP(mfa.Secret, code, time.Now()); valid {
+		return a.mfa.UseTOTPCounter(userID, counter)
+	}
+
+	return a.mfa.UseRecoveryCode(userID, auth.HashRecoveryCode(code))
+}
+
+// checkSecondFactor проверяет код второго фактора и отвечает 401, если код неверен
+// После MFA_MAX_FAILED_ATTEMPTS неверных кодов подряд проверка блокируется на MFA_LOCKOUT
+// с удвоением за каждый следующий неверный код; пока она заблокирована, любой код
+// отклоняется с ответом 429, что не позволяет подобрать код перебором
+// Возвращает true, если проверка пройдена
+func (a *API) checkSecondFactor(w http.ResponseWriter, userID, code string) bool {
+	if mfa, ok := a.mfa.GetUserMFA(userID); ok && mfa.IsLocked(time.Now()) {
+		respondMFALocked(w, *mfa.LockedUntil)
+		return false
+	}
+
+	valid, err := a.verifySecondFactor(userID, code)
+	if err != nil {
+		log.Printf("Failed to verify second factor for user %s: %v", userID, err)
+		respondError(w, http.StatusInternalServerError, "Failed to verify two-factor code")
+		return false
+	}
+	if !valid {
+		attempts, lockedUntil, err := a.mfa.RecordMFAFailure(userID, config.GetMFAMaxFailedAttempts(), config.GetMFALockout())
+		if err != nil {
+			log.Printf("Failed to record invalid second factor code for user %s: %v", userID, err)
+		}
+		log.Printf("Invalid second factor code for user %s (%d in a row)", userID, attempts)
+		if lockedUntil != nil {
+			respondMFALocked(w, *lockedUntil)
+			return false
+		}
+		respondError(w, http.StatusUnauthorized, "Invalid two-factor code")
+		return false
+	}
+
+	if err := a.mfa.ResetMFAFailures(userID); err != nil {
+		log.Printf("Failed to reset invalid second factor codes for user %s: %v", userID, err)
+	}
+	return true
+}
+
+// respondMFALocked отвечает 429, пока проверка кодов второго фактора заблокирована
+func respondMFALocked(w http.ResponseWriter, lockedUntil time.Time) {
+	retryAfter := int(math.Ceil(time.Until(lockedUntil).Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	respondError(w, http.StatusTooManyRequests, "Too many invalid two-factor codes, try again later")
+}
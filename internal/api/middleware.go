@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"bankapp/internal/auth"
+	"bankapp/internal/models"
 )
 
 // Тип ключа для значений контекста
@@ -16,6 +17,12 @@ type contextKey string
 // UserIDKey - ключ для ID пользователя в контексте запроса
 const UserIDKey contextKey = "userID"
 
+// RoleKey - ключ для роли пользователя в контексте запроса
+const RoleKey contextKey = "role"
+
+// ClaimsKey - ключ для утверждений проверенного токена доступа в контексте запроса
+const ClaimsKey contextKey = "claims"
+
 // LoggingMiddleware создает обертку для HTTP-обработчиков,
 // которая логирует информацию о входящих запросах и времени их выполнения
 // Возвращает HTTP-обработчик с добавленным функционалом логирования
@@ -38,8 +45,9 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 
 // AuthMiddleware создает обертку для HTTP-обработчиков,
 // которая проверяет JWT-токены и добавляет ID пользователя в контекст запроса
+// Отозванные токены (выход из системы, завершение всех сессий) отклоняются
 // Возвращает HTTP-обработчик с добавленным функционалом аутентификации
-func AuthMiddleware(next http.Handler) http.Handler {
+func (a *API) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Получаем заголовок Authorization
 		authHeader := r.Header.Get("Authorization")
@@ -66,8 +74,31 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// Добавляем ID пользователя в контекст запроса
+		// Проверяем, не был ли токен отозван
+		var issuedAt time.Time
+		if claims.IssuedAt != nil {
+			issuedAt = claims.IssuedAt.Time
+		}
+		revoked, err := a.tokens.IsAccessTokenRevoked(claims.ID, claims.UserID, issuedAt)
+		if err != nil {
+			log.Printf("Не удалось проверить отзыв токена: %v", err)
+			respondError(w, http.StatusInternalServerError, "Failed to verify token")
+			return
+		}
+		if revoked {
+			respondError(w, http.StatusUnauthorized, "Token has been revoked")
+			return
+		}
+
+		// Добавляем ID и роль пользователя в контекст запроса
+		// Токены, выпущенные до появления ролей, считаются клиентскими
+		role := claims.Role
+		if role == "" {
+			role = models.RoleCustomer
+		}
 		ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
+		ctx = context.WithValue(ctx, RoleKey, role)
+		ctx = context.WithValue(ctx, ClaimsKey, claims)
 
 		// Создаем новый запрос с обновленным контекстом
 		r = r.WithContext(ctx)
@@ -77,9 +108,56 @@ func AuthMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// RequireRole создает middleware, пропускающий только пользователей с одной из указанных ролей
+// Должен применяться после AuthMiddleware
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, _ := GetRoleFromContext(r)
+			for _, allowed := range roles {
+				if role == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			userID, _ := GetUserIDFromContext(r)
+			log.Printf("Пользователю %s с ролью %q запрещен доступ к %s %s", userID, role, r.Method, r.URL.Path)
+			respondError(w, http.StatusForbidden, "Insufficient role for this operation")
+		})
+	}
+}
+
+// DeprecatedMiddleware создает middleware для устаревших маршрутов: ответ помечается заголовком
+// Deprecation, а заголовок Link указывает маршрут successor, которым клиентам следует пользоваться
+func DeprecatedMiddleware(successor string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", "true")
+			w.Header().Set("Link", "<"+successor+">; rel=\"successor-version\"")
+			log.Printf("Вызов устаревшего маршрута %s %s, следует использовать %s", r.Method, r.URL.Path, successor)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // GetUserIDFromContext извлекает ID пользователя из контекста запроса
 // Возвращает ID пользователя и булево значение, указывающее, найден ли ID
 func GetUserIDFromContext(r *http.Request) (string, bool) {
 	userID, ok := r.Context().Value(UserIDKey).(string)
 	return userID, ok
 }
+
+// GetRoleFromContext извлекает роль пользователя из контекста запроса
+// Возвращает роль и булево значение, указывающее, найдена ли роль
+func GetRoleFromContext(r *http.Request) (string, bool) {
+	role, ok := r.Context().Value(RoleKey).(string)
+	return role, ok
+}
+
+// GetClaimsFromContext извлекает утверждения токена доступа из контекста запроса
+// Возвращает утверждения и булево значение, указывающее, найдены ли они
+func GetClaimsFromContext(r *http.Request) (*auth.Claims, bool) {
+	claims, ok := r.Context().Value(ClaimsKey).(*auth.Claims)
+	return claims, ok
+}
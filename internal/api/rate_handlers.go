@@ -0,0 +1,81 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"bankapp/internal/services"
+)
+
+// GetCurrencyRatesHandler возвращает официальные курсы валют Банка России на дату
+// Параметр запроса date в формате YYYY-MM-DD; по умолчанию - текущая дата
+func (a *API) GetCurrencyRatesHandler(w http.ResponseWriter, r *http.Request) {
+	date, ok := rateDateParam(w, r)
+	if !ok {
+		return
+	}
+
+	rates, err := a.currencyRates.RatesOnDate(date)
+	if errors.Is(err, services.ErrCurrencyRatesNotFound) {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("No currency rates for %s", date.Format("2006-01-02")))
+		return
+	}
+	// Курсов нет в истории, а лимит запросов к Банку России исчерпан
+	if errors.Is(err, services.ErrCurrencyRatesThrottled) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(services.CurrencyRateFetchCooldown.Seconds())))
+		respondError(w, http.StatusServiceUnavailable, "Too many currency rate requests, try again later")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to get currency rates for %s: %v", date.Format("2006-01-02"), err)
+		respondError(w, http.StatusBadGateway, "Failed to get currency rates from the central bank")
+		return
+	}
+
+	respondJSON(w, http.StatusOK, rates)
+}
+
+// GetKeyRateHandler возвращает ключевую ставку Банка России, действующую на дату
+// Параметр запроса date в формате YYYY-MM-DD; по умолчанию - текущая дата
+func (a *API) GetKeyRateHandler(w http.ResponseWriter, r *http.Request) {
+	date, ok := rateDateParam(w, r)
+	if !ok {
+		return
+	}
+
+	rate, err := a.keyRates.KeyRate(date)
+	if err != nil {
+		log.Printf("Failed to get key rate for %s: %v", date.Format("2006-01-02"), err)
+		respondError(w, http.StatusServiceUnavailable, fmt.Sprintf("Key rate for %s is unavailable", date.Format("2006-01-02")))
+		return
+	}
+
+	respondJSON(w, http.StatusOK, rate)
+}
+
+// rateDateParam читает дату из параметра запроса date (YYYY-MM-DD); по умолчанию - текущая дата
+// Банк России устанавливает курсы и ставку заранее, поэтому допускается не далее завтрашнего дня;
+// курсы на завтрашний день не сохраняются в историю, пока эта дата не наступит
+// Возвращает false, если дата некорректна и ответ уже отправлен
+func rateDateParam(w http.ResponseWriter, r *http.Request) (time.Time, bool) {
+	today := services.RateDate(time.Now())
+	value := r.URL.Query().Get("date")
+	if value == "" {
+		return today, true
+	}
+
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		respondError(w, http.StatusBadRequest, "Invalid date, expected YYYY-MM-DD")
+		return time.Time{}, false
+	}
+	if date.After(today.AddDate(0, 0, 1)) {
+		respondError(w, http.StatusBadRequest, "Rates are not available for future dates")
+		return time.Time{}, false
+	}
+	return date, true
+}
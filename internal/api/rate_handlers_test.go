@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/models"
+)
+
+func TestGetCurrencyRatesOnPastDate(t *testing.T) {
+	t.Setenv("CBR_STUB_DIR", "../services/testdata/cbr")
+	router, store := newTestRouter(t)
+	token := testToken(t, uuid.New().String(), models.RoleCustomer)
+
+	rec := doRequest(t, router, "GET", "/rates/currencies?date=2025-01-15", token, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /rates/currencies: статус %d, тело %s", rec.Code, rec.Body)
+	}
+
+	var rates []models.CurrencyRate
+	if err := json.Unmarshal(rec.Body.Bytes(), &rates); err != nil {
+		t.Fatalf("не удалось разобрать ответ: %v", err)
+	}
+	date := time.Date(2025, time.January, 15, 0, 0, 0, 0, time.UTC)
+	if len(rates) != 8 {
+		t.Fatalf("получено %d курсов, ожидалось 8", len(rates))
+	}
+	for _, rate := range rates {
+		if !rate.Date.Equal(date) {
+			t.Errorf("курс %s на %s, ожидался на 2025-01-15", rate.Currency, rate.Date.Format("2006-01-02"))
+		}
+		if rate.Currency == "USD" && !rate.Rate.Equal(decimal.RequireFromString("102.8076")) {
+			t.Errorf("курс USD = %s, ожидался 102.8076", rate.Rate)
+		}
+	}
+
+	// Ответ сохранен в историю курсов
+	stored, err := store.GetCurrencyRates(date)
+	if err != nil {
+		t.Fatalf("GetCurrencyRates: %v", err)
+	}
+	if len(stored) != len(rates) {
+		t.Errorf("в истории %d курсов, ожидалось %d", len(stored), len(rates))
+	}
+}
+
+func TestGetCurrencyRatesInvalidDate(t *testing.T) {
+	t.Setenv("CBR_STUB_DIR", "../services/testdata/cbr")
+	router, _ := newTestRouter(t)
+	token := testToken(t, uuid.New().String(), models.RoleCustomer)
+
+	for _, date := range []string{"15.01.2025", time.Now().AddDate(0, 0, 7).Format("2006-01-02")} {
+		rec := doRequest(t, router, "GET", "/rates/currencies?date="+date, token, nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("date=%s: статус %d, ожидался 400", date, rec.Code)
+		}
+	}
+}
@@ -1,49 +1,174 @@
 package api
 
 import (
+	"net/http"
+
 	"github.com/gorilla/mux"
+
+	"bankapp/internal/models"
+	"bankapp/internal/services"
+	"bankapp/internal/storage"
 )
 
+// API содержит зависимости HTTP-обработчиков
+// Репозитории внедряются при создании, что позволяет подменять хранилище
+type API struct {
+	users        storage.UserRepository
+	accounts     storage.AccountRepository
+	cards        storage.CardRepository
+	transactions storage.TransactionRepository
+	loans        storage.LoanRepository
+	loanProducts storage.LoanProductRepository
+	applications storage.LoanApplicationRepository
+	idempotency  storage.IdempotencyRepository
+	tokens       storage.TokenRepository
+	mfa          storage.MFARepository
+	holds        storage.HoldRepository
+	disputes     storage.DisputeRepository
+	rates        storage.ExchangeRateRepository
+
+	currencyRates *services.CurrencyRateService
+	keyRates      *services.KeyRateService
+	scoring       *services.CreditScoringService
+}
+
+// NewAPI создает набор обработчиков, работающих с переданным хранилищем
+func NewAPI(store storage.Storage) *API {
+	return &API{
+		users:        store,
+		accounts:     store,
+		cards:        store,
+		transactions: store,
+		loans:        store,
+		loanProducts: store,
+		applications: store,
+		idempotency:  store,
+		tokens:       store,
+		mfa:          store,
+		holds:        store,
+		disputes:     store,
+		rates:        store,
+
+		currencyRates: services.NewCurrencyRateService(store, store),
+		keyRates:      services.NewKeyRateService(store),
+		scoring:       services.NewCreditScoringService(store, store, store),
+	}
+}
+
 // SetupRouter создает и настраивает маршрутизатор API
-// Регистрирует все обработчики запросов
+// Регистрирует все обработчики запросов, работающие с переданным хранилищем
 // Возвращает настроенный маршрутизатор
-func SetupRouter() *mux.Router {
+func SetupRouter(store storage.Storage) *mux.Router {
+	a := NewAPI(store)
 	r := mux.NewRouter()
 
 	// Публичные маршруты (аутентификация не требуется)
-	r.HandleFunc("/register", RegisterUserHandler).Methods("POST")
-	r.HandleFunc("/login", LoginUserHandler).Methods("POST")
+	r.HandleFunc("/register", a.RegisterUserHandler).Methods("POST")
+	r.HandleFunc("/login", a.LoginUserHandler).Methods("POST")
+	r.HandleFunc("/login/2fa", a.LoginMFAHandler).Methods("POST")
+	r.HandleFunc("/token/refresh", a.RefreshTokenHandler).Methods("POST")
+	r.HandleFunc("/.well-known/jwks.json", a.JWKSHandler).Methods("GET")
 
 	// Защищенные маршруты (требуется аутентификация)
 	// Создаем подмаршрутизатор для защищенных маршрутов
 	protected := r.PathPrefix("").Subrouter()
 
 	// Применяем middleware аутентификации ко всем защищенным маршрутам
-	protected.Use(AuthMiddleware)
+	protected.Use(a.AuthMiddleware)
+
+	// Завершение сессии
+	protected.HandleFunc("/logout", a.LogoutHandler).Methods("POST")
+
+	// Двухфакторная аутентификация
+	protected.HandleFunc("/2fa/enroll", a.EnrollMFAHandler).Methods("POST")
+	protected.HandleFunc("/2fa/confirm", a.ConfirmMFAHandler).Methods("POST")
+	protected.HandleFunc("/2fa/disable", a.DisableMFAHandler).Methods("POST")
+	protected.HandleFunc("/2fa/recovery-codes", a.RegenerateRecoveryCodesHandler).Methods("POST")
 
 	// Маршруты управления счетами
-	protected.HandleFunc("/accounts", CreateAccountHandler).Methods("POST")
-	protected.HandleFunc("/users/{userId}/accounts", GetUserAccountsHandler).Methods("GET")
+	protected.HandleFunc("/accounts", a.CreateAccountHandler).Methods("POST")
+	protected.HandleFunc("/users/{userId}/accounts", a.GetUserAccountsHandler).Methods("GET")
 
 	// Маршруты управления картами
-	protected.HandleFunc("/cards", GenerateCardHandler).Methods("POST")
-	protected.HandleFunc("/accounts/{accountId}/cards", GetAccountCardsHandler).Methods("GET")
-	protected.HandleFunc("/payments/card", PayWithCardHandler).Methods("POST")
+	protected.HandleFunc("/cards", a.GenerateCardHandler).Methods("POST")
+	protected.HandleFunc("/accounts/{accountId}/cards", a.GetAccountCardsHandler).Methods("GET")
+	protected.HandleFunc("/cards/{cardId}/freeze", a.FreezeCardHandler).Methods("POST")
+	protected.HandleFunc("/cards/{cardId}/unfreeze", a.UnfreezeCardHandler).Methods("POST")
+	protected.HandleFunc("/cards/{cardId}/block", a.BlockCardHandler).Methods("POST")
+	protected.HandleFunc("/cards/{cardId}/close", a.CloseCardHandler).Methods("POST")
+	protected.HandleFunc("/cards/{cardId}/reissue", a.ReissueCardHandler).Methods("POST")
+	protected.HandleFunc("/cards/{cardId}/reveal", a.RevealCardHandler).Methods("POST")
+	protected.HandleFunc("/cards/{cardId}/limits", a.SetCardLimitsHandler).Methods("PUT")
+	protected.HandleFunc("/cards/{cardId}/merchant-rules", a.ListMerchantRulesHandler).Methods("GET")
+	protected.HandleFunc("/cards/{cardId}/merchant-rules", a.AddMerchantRuleHandler).Methods("POST")
+	protected.HandleFunc("/cards/{cardId}/merchant-rules/{ruleId}", a.DeleteMerchantRuleHandler).Methods("DELETE")
+	protected.Handle("/payments/card", a.IdempotencyMiddleware(http.HandlerFunc(a.PayWithCardHandler))).Methods("POST")
+
+	// Двухфазные платежи по карте: авторизация с удержанием, затем списание или отмена
+	// Списание и отмена удержания доступны только операционистам (/admin), держателю карты - просмотр
+	protected.Handle("/payments/card/authorize", a.IdempotencyMiddleware(http.HandlerFunc(a.AuthorizeCardPaymentHandler))).Methods("POST")
+	protected.HandleFunc("/payments/card/holds/{holdId}", a.GetHoldHandler).Methods("GET")
+	protected.HandleFunc("/cards/{cardId}/holds", a.ListCardHoldsHandler).Methods("GET")
+
+	// Споры по платежам по карте
+	protected.HandleFunc("/transactions/{transactionId}/disputes", a.OpenDisputeHandler).Methods("POST")
+	protected.HandleFunc("/accounts/{accountId}/disputes", a.ListAccountDisputesHandler).Methods("GET")
 
 	// Маршруты для переводов и пополнений
-	protected.HandleFunc("/transfers", TransferHandler).Methods("POST")
-	protected.HandleFunc("/deposits", DepositHandler).Methods("POST")
+	// Запросы, перемещающие деньги, поддерживают заголовок Idempotency-Key
+	protected.Handle("/transfers", a.IdempotencyMiddleware(http.HandlerFunc(a.TransferHandler))).Methods("POST")
+	protected.Handle("/deposits", a.IdempotencyMiddleware(http.HandlerFunc(a.DepositHandler))).Methods("POST")
 
-	// Маршруты для кредитов
-	protected.HandleFunc("/loans", ApplyLoanHandler).Methods("POST")
-	protected.HandleFunc("/loans/{loanId}/schedule", GetLoanScheduleHandler).Methods("GET")
+	// Курсы валют для конвертации при переводах между счетами в разных валютах
+	protected.HandleFunc("/exchange-rates", a.ListExchangeRatesHandler).Methods("GET")
+	protected.HandleFunc("/rates/currencies", a.GetCurrencyRatesHandler).Methods("GET")
+	protected.HandleFunc("/rates/key", a.GetKeyRateHandler).Methods("GET")
+
+	// Маршруты для кредитов: кредит выдается по заявке, прошедшей скоринг или рассмотрение операционистом
+	protected.Handle("/loan-applications", a.IdempotencyMiddleware(http.HandlerFunc(a.SubmitLoanApplicationHandler))).Methods("POST")
+	// Устаревший маршрут оформления кредита: подает заявку и возвращает ее, как POST /loan-applications
+	protected.Handle("/loans", DeprecatedMiddleware("/loan-applications")(
+		a.IdempotencyMiddleware(http.HandlerFunc(a.SubmitLoanApplicationHandler)))).Methods("POST")
+	protected.HandleFunc("/loan-applications/{applicationId}", a.GetLoanApplicationHandler).Methods("GET")
+	protected.HandleFunc("/users/{userId}/loan-applications", a.ListUserLoanApplicationsHandler).Methods("GET")
+	protected.HandleFunc("/loans/{loanId}/schedule", a.GetLoanScheduleHandler).Methods("GET")
+	protected.HandleFunc("/loan-products", a.ListLoanProductsHandler).Methods("GET")
 
 	// Маршруты для аналитики
-	protected.HandleFunc("/analytics/transactions/{accountId}", GetTransactionsHandler).Methods("GET")
-	protected.HandleFunc("/analytics/summary/{userId}", GetFinancialSummaryHandler).Methods("GET")
+	protected.HandleFunc("/analytics/transactions/{accountId}", a.GetTransactionsHandler).Methods("GET")
+	protected.HandleFunc("/analytics/summary/{userId}", a.GetFinancialSummaryHandler).Methods("GET")
 
 	// Эндпоинт прогнозирования баланса
-	protected.HandleFunc("/accounts/{accountId}/predict", BalancePredictionHandler).Methods("GET")
+	protected.HandleFunc("/accounts/{accountId}/predict", a.BalancePredictionHandler).Methods("GET")
+
+	// Административные маршруты (требуется роль operator или admin)
+	admin := protected.PathPrefix("/admin").Subrouter()
+	admin.Use(RequireRole(models.RoleOperator, models.RoleAdmin))
+
+	admin.HandleFunc("/users", a.AdminListUsersHandler).Methods("GET")
+	admin.HandleFunc("/users/{userId}/accounts", a.AdminGetUserAccountsHandler).Methods("GET")
+	admin.Handle("/users/{userId}/role", RequireRole(models.RoleAdmin)(http.HandlerFunc(a.AdminSetUserRoleHandler))).Methods("PUT")
+	admin.HandleFunc("/accounts/{accountId}/freeze", a.AdminFreezeAccountHandler).Methods("POST")
+	admin.HandleFunc("/accounts/{accountId}/unfreeze", a.AdminUnfreezeAccountHandler).Methods("POST")
+	admin.HandleFunc("/cards/{cardId}/unblock", a.AdminUnblockCardHandler).Methods("POST")
+	admin.Handle("/holds/{holdId}/capture", a.IdempotencyMiddleware(http.HandlerFunc(a.AdminCaptureHoldHandler))).Methods("POST")
+	admin.HandleFunc("/holds/{holdId}/void", a.AdminVoidHoldHandler).Methods("POST")
+	admin.HandleFunc("/transactions", a.AdminListTransactionsHandler).Methods("GET")
+	admin.Handle("/transactions/{transactionId}/refund", a.IdempotencyMiddleware(http.HandlerFunc(a.AdminRefundPaymentHandler))).Methods("POST")
+	admin.HandleFunc("/disputes", a.AdminListDisputesHandler).Methods("GET")
+	admin.HandleFunc("/disputes/{disputeId}/status", a.AdminUpdateDisputeStatusHandler).Methods("PUT")
+	admin.HandleFunc("/loans", a.AdminListLoansHandler).Methods("GET")
+	admin.HandleFunc("/loan-applications", a.AdminListLoanApplicationsHandler).Methods("GET")
+	admin.HandleFunc("/loan-applications/{applicationId}", a.AdminGetLoanApplicationHandler).Methods("GET")
+	admin.HandleFunc("/loan-applications/{applicationId}/decision", a.AdminDecideLoanApplicationHandler).Methods("PUT")
+	admin.HandleFunc("/loan-applications/{applicationId}/disburse", a.AdminDisburseLoanApplicationHandler).Methods("POST")
+	admin.HandleFunc("/loan-products", a.AdminListLoanProductsHandler).Methods("GET")
+	admin.Handle("/loan-products", RequireRole(models.RoleAdmin)(http.HandlerFunc(a.AdminCreateLoanProductHandler))).Methods("POST")
+	admin.HandleFunc("/loan-products/{productId}", a.AdminGetLoanProductHandler).Methods("GET")
+	admin.Handle("/loan-products/{productId}", RequireRole(models.RoleAdmin)(http.HandlerFunc(a.AdminUpdateLoanProductHandler))).Methods("PUT")
+	admin.Handle("/loan-products/{productId}", RequireRole(models.RoleAdmin)(http.HandlerFunc(a.AdminDeleteLoanProductHandler))).Methods("DELETE")
+	admin.HandleFunc("/ledger/reconciliation", a.AdminReconciliationHandler).Methods("GET")
+	admin.Handle("/exchange-rates/{currency}", RequireRole(models.RoleAdmin)(http.HandlerFunc(a.AdminSetExchangeRateHandler))).Methods("PUT")
 
 	return r
 }
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/shopspring/decimal"
@@ -16,7 +15,7 @@ import (
 )
 
 // TransferHandler обрабатывает запросы на перевод денег между счетами
-func TransferHandler(w http.ResponseWriter, r *http.Request) {
+func (a *API) TransferHandler(w http.ResponseWriter, r *http.Request) {
 	var req models.TransferRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid request payload")
@@ -33,57 +32,100 @@ func TransferHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fromAccount, okFrom := storage.GetAccount(req.FromAccountID)
-	toAccount, okTo := storage.GetAccount(req.ToAccountID)
-
+	// Владение счетом списания проверяется первым, а чужой счет неотличим от несуществующего,
+	// чтобы по ответам нельзя было перебирать идентификаторы счетов
+	currentUserID, _ := GetUserIDFromContext(r)
+	fromAccount, okFrom := a.accounts.GetAccount(req.FromAccountID)
+	if okFrom && fromAccount.UserID != currentUserID {
+		log.Printf("Пользователь %s пытался перевести деньги с чужого счета %s", currentUserID, req.FromAccountID)
+		okFrom = false
+	}
 	if !okFrom {
 		respondError(w, http.StatusNotFound, fmt.Sprintf("Source account %s not found", req.FromAccountID))
 		return
 	}
+
+	toAccount, okTo := a.accounts.GetAccount(req.ToAccountID)
 	if !okTo {
 		respondError(w, http.StatusNotFound, fmt.Sprintf("Destination account %s not found", req.ToAccountID))
 		return
 	}
 
-	if fromAccount.Balance.LessThan(req.Amount) {
-		respondError(w, http.StatusPaymentRequired, "Insufficient funds in source account")
+	// Перевод между счетами в разных валютах возможен только с явно запрошенной конвертацией
+	exchange := fromAccount.Currency != toAccount.Currency
+	if exchange && !req.Exchange {
+		respondErrorCode(w, http.StatusBadRequest, ExchangeErrorCurrencyMismatch,
+			fmt.Sprintf("Accounts are in different currencies (%s and %s); set exchange to convert",
+				fromAccount.Currency, toAccount.Currency))
 		return
 	}
-
-	err := storage.UpdateAccountBalance(req.FromAccountID, req.Amount.Neg())
-	if err != nil {
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to debit source account: %v", err))
-		return
-	}
-
-	err = storage.UpdateAccountBalance(req.ToAccountID, req.Amount)
-	if err != nil {
-		// Пытаемся откатить списание, если зачисление не удалось
-		storage.UpdateAccountBalance(req.FromAccountID, req.Amount)
-		respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to credit destination account: %v", err))
+	if !a.requireStepUpInCurrency(w, r, req.Amount, fromAccount.Currency) {
 		return
 	}
 
+	now := time.Now()
 	tx := models.Transaction{
 		ID:              utils.CreateUniqueIdentifier(),
 		FromAccountID:   req.FromAccountID,
 		ToAccountID:     req.ToAccountID,
 		Amount:          req.Amount,
-		Timestamp:       time.Now(),
+		Currency:        fromAccount.Currency,
+		Timestamp:       now,
 		TransactionType: "transfer",
 		Description:     fmt.Sprintf("Transfer from %s to %s", fromAccount.Number, toAccount.Number),
 	}
-	if err := storage.AddTransaction(tx); err != nil {
-		log.Printf("Failed to record transaction: %v", err)
-		// Продолжаем выполнение, так как деньги уже переведены
+	entries := []models.JournalEntry{
+		storage.DebitLeg(req.FromAccountID, req.Amount),
+		storage.CreditLeg(req.ToAccountID, req.Amount),
+	}
+
+	if exchange {
+		conversion, err := a.quoteConversion(req.Amount, fromAccount.Currency, toAccount.Currency, now)
+		if err != nil {
+			log.Printf("Exchange %s/%s unavailable: %v", fromAccount.Currency, toAccount.Currency, err)
+			respondErrorCode(w, http.StatusServiceUnavailable, ExchangeErrorRateUnavailable,
+				fmt.Sprintf("Exchange rate %s/%s is unavailable", fromAccount.Currency, toAccount.Currency))
+			return
+		}
+		if !conversion.ConvertedAmount.IsPositive() {
+			respondError(w, http.StatusBadRequest, "Transfer amount is too small to convert")
+			return
+		}
+
+		// Каждая валюта проводится через валютную позицию банка в этой же валюте
+		tx.TransactionType = models.TransactionTypeExchange
+		tx.Conversion = &conversion
+		entries = []models.JournalEntry{
+			storage.DebitLeg(req.FromAccountID, req.Amount),
+			storage.CreditLeg(storage.FXLedgerAccount(fromAccount.Currency), req.Amount),
+			storage.DebitLeg(storage.FXLedgerAccount(toAccount.Currency), conversion.ConvertedAmount),
+			storage.CreditLeg(req.ToAccountID, conversion.ConvertedAmount),
+		}
+	}
+
+	posting := models.Posting{Transaction: tx, Entries: entries}
+	if err := a.transactions.PostTransaction(posting); err != nil {
+		respondPostingError(w, err, "Failed to process transfer")
+		return
+	}
+
+	if tx.Conversion != nil {
+		log.Printf("Exchange transfer of %s %s from %s to %s successful: %s %s at %s",
+			req.Amount.String(), tx.Currency, req.FromAccountID, req.ToAccountID,
+			tx.Conversion.ConvertedAmount.String(), tx.Conversion.ToCurrency, tx.Conversion.Rate.String())
+		respondJSON(w, http.StatusOK, map[string]interface{}{
+			"message":    "Transfer successful",
+			"conversion": tx.Conversion,
+		})
+		return
 	}
 
 	log.Printf("Transfer of %s from %s to %s successful", req.Amount.String(), req.FromAccountID, req.ToAccountID)
 	respondJSON(w, http.StatusOK, map[string]string{"message": "Transfer successful"})
 }
 
-// DepositHandler handles requests to deposit money into an account
-func DepositHandler(w http.ResponseWriter, r *http.Request) {
+// DepositHandler обрабатывает запросы на пополнение счета
+func (a *API) DepositHandler(w http.ResponseWriter, r *http.Request) {
 	var req models.DepositRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		respondError(w, http.StatusBadRequest, "Invalid request payload")
@@ -96,29 +138,35 @@ func DepositHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := storage.UpdateAccountBalance(req.ToAccountID, req.Amount)
-	if err != nil {
-		if strings.Contains(err.Error(), "not found") {
-			respondError(w, http.StatusNotFound, err.Error())
-		} else {
-			respondError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to process deposit: %v", err))
-		}
+	account, ok := a.accounts.GetAccount(req.ToAccountID)
+	if !ok {
+		respondError(w, http.StatusNotFound, fmt.Sprintf("Account %s not found", req.ToAccountID))
+		return
+	}
+	if !requireAccountOwner(w, r, account) {
 		return
 	}
 
-	account, _ := storage.GetAccount(req.ToAccountID)
 	tx := models.Transaction{
 		ID:              utils.CreateUniqueIdentifier(),
 		FromAccountID:   "",
 		ToAccountID:     req.ToAccountID,
 		Amount:          req.Amount,
+		Currency:        account.Currency,
 		Timestamp:       time.Now(),
 		TransactionType: "deposit",
 		Description:     fmt.Sprintf("Deposit to account %s", account.Number),
 	}
-	if err := storage.AddTransaction(tx); err != nil {
-		log.Printf("Failed to record transaction: %v", err)
-		// Продолжаем выполнение, так как деньги уже зачислены
+	posting := models.Posting{
+		Transaction: tx,
+		Entries: []models.JournalEntry{
+			storage.DebitLeg(storage.LedgerCash, req.Amount),
+			storage.CreditLeg(req.ToAccountID, req.Amount),
+		},
+	}
+	if err := a.transactions.PostTransaction(posting); err != nil {
+		respondPostingError(w, err, "Failed to process deposit")
+		return
 	}
 
 	log.Printf("Deposit of %s to account %s successful", req.Amount.String(), req.ToAccountID)
@@ -1,34 +1,47 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"log"
 	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// Секретный ключ JWT
-var jwtSecret = []byte(getJWTSecret())
-
-// Время истечения токена по умолчанию - 24 часа
-const tokenExpirationHours = 24
+// Время жизни токенов доступа и токенов обновления
+// Переопределяется переменными окружения ACCESS_TOKEN_TTL и REFRESH_TOKEN_TTL (например, "15m", "720h")
+var (
+	AccessTokenTTL  = getDurationEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+	RefreshTokenTTL = getDurationEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+)
 
 // Claims Структура пользовательских JWT
 type Claims struct {
-	UserID string `json:"user_id"`
+	UserID  string `json:"user_id"`
+	Role    string `json:"role"`
+	Purpose string `json:"purpose,omitempty"` // Назначение служебного токена; пусто у токенов доступа
 	jwt.RegisteredClaims
 }
 
-// getJWTSecret возвращает JWT из переменной окружения или значение по умолчанию
-func getJWTSecret() string {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		// Секрет по умолчанию для разработки - в продакшене должен быть установлен через переменную окружения
-		return "your-256-bit-secret-key-for-jwt-token-generation"
+// getDurationEnv возвращает длительность из переменной окружения или значение по умолчанию
+func getDurationEnv(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		log.Printf("Некорректное значение %s=%q, используется %v", name, value, fallback)
+		return fallback
 	}
-	return secret
+	return d
 }
 
 // EncryptUserPassword шифрует пароль пользователя с использованием bcrypt
@@ -48,15 +61,16 @@ func VerifyPasswordMatch(password, hash string) bool {
 	return err == nil
 }
 
-// GenerateJWT генерирует JWT-токен для пользователя
-// Принимает ID пользователя и возвращает строку токена и ошибку, если генерация не удалась
-func GenerateJWT(userID string) (string, error) {
-	// Устанавливаем время истечения - 24 часа от текущего момента
-	expirationTime := time.Now().Add(tokenExpirationHours * time.Hour)
+// GenerateJWT генерирует короткоживущий токен доступа для пользователя
+// Принимает ID и роль пользователя и возвращает строку токена и ошибку, если генерация не удалась
+// Каждый токен получает уникальный идентификатор (jti), по которому его можно отозвать
+func GenerateJWT(userID, role string) (string, error) {
+	expirationTime := time.Now().Add(AccessTokenTTL)
 
 	// Создаем JWT-утверждения, которые включают ID пользователя и время истечения
 	claims := &Claims{
 		UserID: userID,
+		Role:   role,
 		RegisteredClaims: jwt.RegisteredClaims{
 			// Устанавливаем стандартные утверждения
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
@@ -64,27 +78,44 @@ func GenerateJWT(userID string) (string, error) {
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			Issuer:    "bankapp",
 			Subject:   userID,
+			ID:        uuid.NewString(),
 		},
 	}
 
-	// Создаем токен с утверждениями и подписываем его секретным ключом
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtSecret)
-
-	return tokenString, err
+	// Подписываем токен активным ключом; его kid попадает в заголовок токена
+	km, err := signingKeys()
+	if err != nil {
+		return "", err
+	}
+	return km.Sign(claims)
 }
 
-// ValidateJWT проверяет JWT-токен
+// ValidateJWT проверяет токен доступа
 // Принимает строку токена и возвращает утверждения и ошибку, если проверка не удалась
+// Служебные токены (например, токен второго шага входа) отклоняются
 func ValidateJWT(tokenString string) (*Claims, error) {
-	// Разбираем токен
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		// Проверяем метод подписи
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return jwtSecret, nil
-	})
+	claims, err := parseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, errors.New("not an access token")
+	}
+	return claims, nil
+}
+
+// parseClaims проверяет подпись и срок действия токена и возвращает его утверждения
+func parseClaims(tokenString string) (*Claims, error) {
+	km, err := signingKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	// Разбираем токен; ключ проверки выбирается по kid, допускаются только асимметричные алгоритмы
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, km.verificationKey,
+		jwt.WithValidMethods([]string{AlgRS256, AlgEdDSA}),
+		jwt.WithIssuer("bankapp"),
+	)
 
 	if err != nil {
 		return nil, err
@@ -96,3 +127,19 @@ func ValidateJWT(tokenString string) (*Claims, error) {
 
 	return nil, errors.New("invalid token")
 }
+
+// GenerateRefreshToken создает случайный токен обновления
+// Сервер хранит только хеш токена, сам токен передается клиенту один раз
+func GenerateRefreshToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashRefreshToken возвращает SHA-256 хеш токена обновления для хранения и поиска
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,494 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Алгоритмы подписи, поддерживаемые для токенов доступа
+const (
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// minRSAKeyBits - минимальный допустимый размер RSA-ключа
+const minRSAKeyBits = 2048
+
+// JWKSCacheTTL - время, на которое клиенты кешируют набор открытых ключей (Cache-Control: max-age)
+// Новый ключ начинает подписывать токены не раньше, чем через это время после публикации,
+// чтобы клиенты с закешированным набором успели его получить
+const JWKSCacheTTL = 5 * time.Minute
+
+// DevelopmentEnv - значение APP_ENV, при котором допускаются ключи подписи, сгенерированные в памяти
+const DevelopmentEnv = "development"
+
+// signingKey - ключ подписи с идентификатором kid
+type signingKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	private   crypto.Signer
+	published time.Time // Момент публикации в JWKS; нулевое значение у ключей, загруженных при запуске
+	retiredAt time.Time // Момент вывода из обращения; нулевое значение у действующих ключей
+}
+
+// KeyManager хранит ключи подписи токенов и управляет их ротацией
+// Токены подписываются активным ключом; новый ключ при ротации сначала публикуется в JWKS
+// и становится активным через JWKSCacheTTL. Выведенные из обращения ключи остаются
+// доступными для проверки, пока не истекут подписанные ими токены доступа
+type KeyManager struct {
+	mu      sync.RWMutex
+	keys    map[string]*signingKey
+	active  string
+	pending string // Опубликованный ключ, ожидающий активации; пустая строка - ротация не идет
+
+	dir       string // Каталог с PEM-файлами ключей; пустая строка - ключи генерируются в памяти
+	activeKID string // Явно выбранный активный ключ из каталога
+	alg       string // Алгоритм для ключей, генерируемых в памяти
+}
+
+// JWK - открытый ключ в формате JSON Web Key (RFC 7517)
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS - набор открытых ключей, публикуемый на /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+var (
+	defaultKeys     *KeyManager
+	defaultKeysErr  error
+	defaultKeysOnce sync.Once
+)
+
+// InitSigningKeys загружает ключи подписи из окружения и запускает их ротацию
+// Вызывается при старте сервера, чтобы ошибки конфигурации обнаруживались сразу
+//
+// Переменные окружения:
+//   - JWT_KEYS_DIR - каталог с PEM-файлами закрытых ключей (PKCS#8 или PKCS#1), kid = имя файла без .pem;
+//     обязателен, если APP_ENV не равен development
+//   - JWT_ACTIVE_KID - ключ для подписи; по умолчанию последний по алфавиту kid из каталога
+//   - JWT_SIGNING_ALG - RS256 или EdDSA (по умолчанию) для ключей, генерируемых в памяти
+//   - JWT_KEY_ROTATION_INTERVAL - период ротации: перечитывание каталога или генерация нового ключа
+func InitSigningKeys() error {
+	km, err := signingKeys()
+	if err != nil {
+		return err
+	}
+
+	if interval := getDurationEnv("JWT_KEY_ROTATION_INTERVAL", 0); interval > 0 {
+		km.StartRotation(interval)
+	}
+	return nil
+}
+
+// signingKeys возвращает менеджер ключей процесса, создавая его при первом обращении
+func signingKeys() (*KeyManager, error) {
+	defaultKeysOnce.Do(func() {
+		defaultKeys, defaultKeysErr = keyManagerFromEnv()
+	})
+	return defaultKeys, defaultKeysErr
+}
+
+// keyManagerFromEnv создает менеджер ключей по переменным окружения
+// Ключ в памяти у каждого процесса свой и теряется при перезапуске, поэтому без JWT_KEYS_DIR
+// менеджер создается только при APP_ENV=development
+func keyManagerFromEnv() (*KeyManager, error) {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" && os.Getenv("APP_ENV") != DevelopmentEnv {
+		return nil, fmt.Errorf("JWT_KEYS_DIR не задан: ключи подписи в памяти допускаются только при APP_ENV=%s", DevelopmentEnv)
+	}
+	return NewKeyManager(dir, os.Getenv("JWT_ACTIVE_KID"), os.Getenv("JWT_SIGNING_ALG"))
+}
+
+// NewKeyManager создает менеджер ключей
+// Если dir пуст, генерирует ключ алгоритма alg в памяти: такие токены
+// становятся недействительными после перезапуска процесса
+func NewKeyManager(dir, activeKID, alg string) (*KeyManager, error) {
+	if alg == "" {
+		alg = AlgEdDSA
+	}
+	if alg != AlgRS256 && alg != AlgEdDSA {
+		return nil, fmt.Errorf("неподдерживаемый алгоритм подписи %q: ожидается %s или %s", alg, AlgRS256, AlgEdDSA)
+	}
+
+	km := &KeyManager{
+		keys:      make(map[string]*signingKey),
+		dir:       dir,
+		activeKID: activeKID,
+		alg:       alg,
+	}
+
+	if dir == "" {
+		log.Printf("JWT_KEYS_DIR не задан, ключ подписи %s сгенерирован в памяти", alg)
+		if err := km.generate(); err != nil {
+			return nil, err
+		}
+		return km, nil
+	}
+
+	if err := km.reload(); err != nil {
+		return nil, err
+	}
+	return km, nil
+}
+
+// StartRotation периодически ротирует ключи подписи
+func (km *KeyManager) StartRotation(interval time.Duration) {
+	log.Printf("Ротация ключей подписи каждые %v", interval)
+	ticker := time.NewTicker(interval)
+	go func() {
+		for range ticker.C {
+			if err := km.Rotate(); err != nil {
+				log.Printf("Не удалось выполнить ротацию ключей подписи: %v", err)
+			}
+		}
+	}()
+}
+
+// Rotate выполняет ротацию ключей: перечитывает каталог ключей
+// или, если каталог не задан, генерирует новый ключ
+// Новый ключ сразу публикуется в JWKS, а подписывать токены начинает через JWKSCacheTTL
+// Ключи, подписавшие еще не истекшие токены, остаются доступными для проверки
+func (km *KeyManager) Rotate() error {
+	var err error
+	if km.dir == "" {
+		err = km.generate()
+	} else {
+		err = km.reload()
+	}
+	if err != nil {
+		return err
+	}
+
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	km.pruneLocked(time.Now())
+	return nil
+}
+
+// Sign подписывает утверждения активным ключом и указывает его kid в заголовке токена
+func (km *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	key := km.signingKey(time.Now())
+
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.kid
+	return token.SignedString(key.private)
+}
+
+// signingKey возвращает активный ключ, предварительно активируя опубликованный ключ,
+// если с момента его публикации прошло JWKSCacheTTL
+func (km *KeyManager) signingKey(now time.Time) *signingKey {
+	km.mu.RLock()
+	key := km.keys[km.active]
+	pending, due := km.keys[km.pending], false
+	if pending != nil {
+		due = now.Sub(pending.published) >= JWKSCacheTTL
+	}
+	km.mu.RUnlock()
+	if !due {
+		return key
+	}
+
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	km.activatePendingLocked(now)
+	return km.keys[km.active]
+}
+
+// activatePendingLocked делает опубликованный ключ активным, если с момента его публикации
+// прошло JWKSCacheTTL; вызывающий код должен удерживать блокировку
+func (km *KeyManager) activatePendingLocked(now time.Time) {
+	pending, ok := km.keys[km.pending]
+	if !ok || now.Sub(pending.published) < JWKSCacheTTL {
+		return
+	}
+	if previous, ok := km.keys[km.active]; ok {
+		previous.retiredAt = now
+	}
+	km.active = pending.kid
+	km.pending = ""
+	log.Printf("Активный ключ подписи: %s (%s)", pending.kid, pending.method.Alg())
+}
+
+// publishLocked добавляет ключ в набор и, если активный ключ уже есть, ставит его в ожидание
+// активации через JWKSCacheTTL после публикации; ключ, ожидавший активации до него, выводится
+// из обращения, не подписав ни одного токена. Вызывающий код должен удерживать блокировку
+func (km *KeyManager) publishLocked(key *signingKey, now time.Time) {
+	km.keys[key.kid] = key
+	key.retiredAt = time.Time{}
+	if _, ok := km.keys[km.active]; !ok || km.active == key.kid {
+		if km.active != key.kid {
+			log.Printf("Активный ключ подписи: %s (%s)", key.kid, key.method.Alg())
+		}
+		km.active = key.kid
+		return
+	}
+	if km.pending == key.kid {
+		return
+	}
+
+	if previous, ok := km.keys[km.pending]; ok {
+		previous.retiredAt = now
+	}
+	km.pending = key.kid
+	log.Printf("Ключ подписи %s (%s) опубликован и станет активным после %s",
+		key.kid, key.method.Alg(), key.published.Add(JWKSCacheTTL).Format(time.RFC3339))
+}
+
+// verificationKey возвращает открытый ключ для проверки токена по его kid
+func (km *KeyManager) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid")
+	}
+
+	km.mu.RLock()
+	key, ok := km.keys[kid]
+	km.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.private.Public(), nil
+}
+
+// JWKS возвращает открытые части всех ключей, которыми могут быть подписаны действующие токены
+func (km *KeyManager) JWKS() JWKS {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+
+	kids := make([]string, 0, len(km.keys))
+	for kid := range km.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	set := JWKS{Keys: make([]JWK, 0, len(kids))}
+	for _, kid := range kids {
+		key := km.keys[kid]
+		jwk := JWK{Kid: kid, Use: "sig", Alg: key.method.Alg()}
+		switch pub := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// generate создает новый ключ в памяти и публикует его
+func (km *KeyManager) generate() error {
+	private, err := GenerateSigningKey(km.alg)
+	if err != nil {
+		return err
+	}
+	key, err := newSigningKey(uuid.NewString(), private)
+	if err != nil {
+		return err
+	}
+	key.published = time.Now()
+
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	now := time.Now()
+	km.activatePendingLocked(now)
+	km.publishLocked(key, now)
+	return nil
+}
+
+// reload перечитывает ключи из каталога и выбирает активный ключ
+// Новый ключ, выбранный активным, публикуется и начинает подписывать токены через JWKSCacheTTL
+// Ключи, удаленные из каталога, выводятся из обращения, но остаются для проверки
+func (km *KeyManager) reload() error {
+	paths, err := filepath.Glob(filepath.Join(km.dir, "*.pem"))
+	if err != nil {
+		return fmt.Errorf("ошибка при чтении каталога ключей %s: %w", km.dir, err)
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("в каталоге %s нет ключей подписи (*.pem)", km.dir)
+	}
+
+	loaded := make(map[string]*signingKey, len(paths))
+	for _, path := range paths {
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		private, err := readPrivateKey(path)
+		if err != nil {
+			return err
+		}
+		key, err := newSigningKey(kid, private)
+		if err != nil {
+			return fmt.Errorf("ключ %s: %w", path, err)
+		}
+		loaded[kid] = key
+	}
+
+	active := km.activeKID
+	if active == "" {
+		kids := make([]string, 0, len(loaded))
+		for kid := range loaded {
+			kids = append(kids, kid)
+		}
+		sort.Strings(kids)
+		active = kids[len(kids)-1]
+	}
+	if _, ok := loaded[active]; !ok {
+		return fmt.Errorf("активный ключ %q не найден в каталоге %s", active, km.dir)
+	}
+
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	now := time.Now()
+	km.activatePendingLocked(now)
+	for kid, reloaded := range loaded {
+		// Ключи, появившиеся в каталоге после запуска, опубликованы только сейчас
+		if key, ok := km.keys[kid]; ok {
+			reloaded.published = key.published
+		} else if len(km.keys) > 0 {
+			reloaded.published = now
+		}
+	}
+	for kid, key := range km.keys {
+		if _, ok := loaded[kid]; ok {
+			continue
+		}
+		// Активный ключ, удаленный из каталога, подписывает токены до активации нового
+		if key.retiredAt.IsZero() && kid != km.active {
+			key.retiredAt = now
+		}
+		loaded[kid] = key
+	}
+	km.keys = loaded
+	if pending, ok := km.keys[km.pending]; ok && km.pending != active {
+		pending.retiredAt = now
+		km.pending = ""
+	}
+	km.publishLocked(km.keys[active], now)
+	return nil
+}
+
+// pruneLocked удаляет выведенные из обращения ключи, которыми не может быть подписан
+// ни один действующий токен доступа; вызывающий код должен удерживать блокировку
+func (km *KeyManager) pruneLocked(now time.Time) {
+	for kid, key := range km.keys {
+		if kid == km.active || kid == km.pending {
+			continue
+		}
+		if !key.retiredAt.IsZero() && now.Sub(key.retiredAt) > AccessTokenTTL {
+			delete(km.keys, kid)
+			log.Printf("Ключ подписи %s удален из набора проверочных ключей", kid)
+		}
+	}
+}
+
+// newSigningKey определяет алгоритм подписи по типу закрытого ключа
+func newSigningKey(kid string, private crypto.Signer) (*signingKey, error) {
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		if k.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("размер RSA-ключа %d бит меньше допустимого %d", k.N.BitLen(), minRSAKeyBits)
+		}
+		return &signingKey{kid: kid, method: jwt.SigningMethodRS256, private: k}, nil
+	case ed25519.PrivateKey:
+		return &signingKey{kid: kid, method: jwt.SigningMethodEdDSA, private: k}, nil
+	default:
+		return nil, fmt.Errorf("неподдерживаемый тип ключа %T", private)
+	}
+}
+
+// readPrivateKey читает закрытый ключ из PEM-файла
+func readPrivateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при чтении ключа %s: %w", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("файл %s не содержит PEM-блока", path)
+	}
+
+	if block.Type == "RSA PRIVATE KEY" {
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при разборе ключа %s: %w", path, err)
+		}
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при разборе ключа %s: %w", path, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("ключ %s не может использоваться для подписи", path)
+	}
+	return signer, nil
+}
+
+// GenerateSigningKey создает новый закрытый ключ для алгоритма RS256 или EdDSA
+func GenerateSigningKey(alg string) (crypto.Signer, error) {
+	switch alg {
+	case AlgRS256:
+		return rsa.GenerateKey(rand.Reader, minRSAKeyBits)
+	case AlgEdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		return private, err
+	default:
+		return nil, fmt.Errorf("неподдерживаемый алгоритм подписи %q", alg)
+	}
+}
+
+// EncodePrivateKeyPEM кодирует закрытый ключ в PEM (PKCS#8) для сохранения в JWT_KEYS_DIR
+func EncodePrivateKeyPEM(private crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// PublicJWKS возвращает набор открытых ключей для проверки токенов bankapp
+func PublicJWKS() (JWKS, error) {
+	km, err := signingKeys()
+	if err != nil {
+		return JWKS{}, err
+	}
+	return km.JWKS(), nil
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signedKID подписывает токен и возвращает kid ключа, которым он подписан
+func signedKID(t *testing.T, km *KeyManager) string {
+	t.Helper()
+	signed, err := km.Sign(jwt.RegisteredClaims{Subject: "user-1"})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	token, err := jwt.Parse(signed, km.verificationKey)
+	if err != nil {
+		t.Fatalf("подписанный токен не проходит проверку: %v", err)
+	}
+	kid, _ := token.Header["kid"].(string)
+	return kid
+}
+
+// publishedKIDs возвращает kid ключей, опубликованных в JWKS
+func publishedKIDs(km *KeyManager) map[string]bool {
+	kids := make(map[string]bool)
+	for _, key := range km.JWKS().Keys {
+		kids[key.Kid] = true
+	}
+	return kids
+}
+
+// backdatePending переносит публикацию ключа, ожидающего активации, на JWKSCacheTTL назад
+func backdatePending(t *testing.T, km *KeyManager) {
+	t.Helper()
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	pending, ok := km.keys[km.pending]
+	if !ok {
+		t.Fatal("нет ключа, ожидающего активации")
+	}
+	pending.published = pending.published.Add(-JWKSCacheTTL)
+}
+
+// writeSigningKey сохраняет новый ключ алгоритма alg в каталог dir под именем kid
+func writeSigningKey(t *testing.T, dir, kid, alg string) {
+	t.Helper()
+	private, err := GenerateSigningKey(alg)
+	if err != nil {
+		t.Fatalf("GenerateSigningKey: %v", err)
+	}
+	data, err := EncodePrivateKeyPEM(private)
+	if err != nil {
+		t.Fatalf("EncodePrivateKeyPEM: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600); err != nil {
+		t.Fatalf("не удалось записать ключ %s: %v", kid, err)
+	}
+}
+
+func TestRotatePublishesKeyBeforeSigning(t *testing.T) {
+	km, err := NewKeyManager("", "", AlgEdDSA)
+	if err != nil {
+		t.Fatalf("NewKeyManager: %v", err)
+	}
+	old := signedKID(t, km)
+
+	if err := km.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	next := km.pending
+	if next == "" || next == old {
+		t.Fatalf("новый ключ не ожидает активации: %q", next)
+	}
+
+	// Новый ключ сразу опубликован, но токены подписываются прежним, пока не истечет кеш JWKS
+	if kids := publishedKIDs(km); !kids[old] || !kids[next] {
+		t.Fatalf("в JWKS опубликованы %v, ожидались %s и %s", kids, old, next)
+	}
+	if kid := signedKID(t, km); kid != old {
+		t.Fatalf("токен подписан ключом %s до истечения кеша JWKS, ожидался %s", kid, old)
+	}
+
+	backdatePending(t, km)
+	if kid := signedKID(t, km); kid != next {
+		t.Fatalf("после истечения кеша JWKS токен подписан ключом %s, ожидался %s", kid, next)
+	}
+	if km.keys[old].retiredAt.IsZero() {
+		t.Error("прежний ключ не выведен из обращения")
+	}
+	if kids := publishedKIDs(km); !kids[old] {
+		t.Error("прежний ключ удален из JWKS, пока действуют подписанные им токены")
+	}
+}
+
+func TestReloadPublishesKeyBeforeSigning(t *testing.T) {
+	dir := t.TempDir()
+	writeSigningKey(t, dir, "2025-01", AlgEdDSA)
+	km, err := NewKeyManager(dir, "", "")
+	if err != nil {
+		t.Fatalf("NewKeyManager: %v", err)
+	}
+	// Ключ из каталога при запуске сразу становится активным
+	if kid := signedKID(t, km); kid != "2025-01" {
+		t.Fatalf("токен подписан ключом %s, ожидался 2025-01", kid)
+	}
+
+	writeSigningKey(t, dir, "2025-02", AlgRS256)
+	if err := km.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if kids := publishedKIDs(km); !kids["2025-02"] {
+		t.Fatalf("новый ключ не опубликован в JWKS: %v", kids)
+	}
+	if kid := signedKID(t, km); kid != "2025-01" {
+		t.Fatalf("токен подписан ключом %s до истечения кеша JWKS, ожидался 2025-01", kid)
+	}
+
+	// Повторное перечитывание каталога не откладывает активацию
+	backdatePending(t, km)
+	if err := km.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if kid := signedKID(t, km); kid != "2025-02" {
+		t.Fatalf("после истечения кеша JWKS токен подписан ключом %s, ожидался 2025-02", kid)
+	}
+}
+
+func TestKeyManagerFromEnvRequiresKeysDir(t *testing.T) {
+	t.Setenv("JWT_KEYS_DIR", "")
+	t.Setenv("JWT_ACTIVE_KID", "")
+	t.Setenv("JWT_SIGNING_ALG", "")
+
+	t.Setenv("APP_ENV", "")
+	if _, err := keyManagerFromEnv(); err == nil {
+		t.Error("без JWT_KEYS_DIR вне режима разработки ожидалась ошибка")
+	}
+
+	t.Setenv("APP_ENV", DevelopmentEnv)
+	if _, err := keyManagerFromEnv(); err != nil {
+		t.Errorf("в режиме разработки ключ должен генерироваться в памяти: %v", err)
+	}
+}
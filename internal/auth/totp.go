@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Параметры TOTP (RFC 6238), совместимые с Google Authenticator и аналогами
+const (
+	totpIssuer     = "Simple Bank"
+	totpDigits     = 6
+	totpPeriod     = 30 * time.Second
+	totpSkewSteps  = 1  // Допустимое расхождение часов: по одному шагу в обе стороны
+	totpSecretSize = 20 // 160 бит, как рекомендует RFC 4226
+)
+
+// Параметры кодов восстановления
+const (
+	RecoveryCodeCount = 10
+	recoveryCodeSize  = 10 // Символов base32: 50 бит энтропии
+)
+
+// mfaTokenPurpose помечает промежуточный токен второго шага входа
+const mfaTokenPurpose = "mfa"
+
+// MFATokenTTL - время, за которое нужно ввести код второго фактора после пароля
+const MFATokenTTL = 5 * time.Minute
+
+var base32NoPadding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret создает случайный секрет TOTP в кодировке base32
+func GenerateTOTPSecret() (string, error) {
+	buf := make([]byte, totpSecretSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base32NoPadding.EncodeToString(buf), nil
+}
+
+// TOTPURI формирует otpauth:// URI для добавления секрета в приложение-аутентификатор
+func TOTPURI(accountName, secret string) string {
+	label := url.PathEscape(totpIssuer + ":" + accountName)
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(int(totpPeriod.Seconds())))
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// ValidateTOTP проверяет код TOTP с учетом допустимого расхождения часов
+// Возвращает номер временного шага, которому соответствует код: он сохраняется,
+// чтобы один и тот же код нельзя было использовать повторно
+func ValidateTOTP(secret, code string, now time.Time) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	key, err := base32NoPadding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+
+	current := now.Unix() / int64(totpPeriod.Seconds())
+	for step := current - totpSkewSteps; step <= current+totpSkewSteps; step++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode вычисляет код HOTP (RFC 4226) для указанного временного шага
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// GenerateRecoveryCodes создает одноразовые коды восстановления
+// Возвращает коды для показа пользователю и их хеши для хранения
+func GenerateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, recoveryCodeSize)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		code := base32NoPadding.EncodeToString(buf)[:recoveryCodeSize]
+		codes[i] = strings.ToLower(code[:5] + "-" + code[5:])
+		hashes[i] = HashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode возвращает SHA-256 хеш кода восстановления
+// Регистр и дефисы не учитываются, чтобы код было проще вводить
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateMFAToken выпускает промежуточный токен после проверки пароля
+// Токен подтверждает только первый фактор и не принимается как токен доступа
+func GenerateMFAToken(userID string) (string, error) {
+	now := time.Now()
+	claims := &Claims{
+		UserID:  userID,
+		Purpose: mfaTokenPurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(MFATokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "bankapp",
+			Subject:   userID,
+			ID:        uuid.NewString(),
+		},
+	}
+
+	km, err := signingKeys()
+	if err != nil {
+		return "", err
+	}
+	return km.Sign(claims)
+}
+
+// ValidateMFAToken проверяет промежуточный токен второго шага входа
+// Возвращает утверждения токена с ID пользователя, прошедшего проверку пароля
+func ValidateMFAToken(tokenString string) (*Claims, error) {
+	claims, err := parseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != mfaTokenPurpose {
+		return nil, errors.New("not an MFA token")
+	}
+	return claims, nil
+}
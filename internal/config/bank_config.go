@@ -0,0 +1,76 @@
+package config
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// defaultBankBIC is a development BIC used when BANK_BIC is not set
+const defaultBankBIC = "044525999"
+
+// GetBankBIC returns the bank's 9-digit BIC (BANK_BIC) used to compute the control
+// digit of account numbers. Changing it invalidates the control digits of accounts
+// opened under the previous BIC
+func GetBankBIC() string {
+	value := getEnv("BANK_BIC", defaultBankBIC)
+	if len(value) != 9 {
+		log.Printf("Invalid BANK_BIC %q, using %s", value, defaultBankBIC)
+		return defaultBankBIC
+	}
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			log.Printf("Invalid BANK_BIC %q, using %s", value, defaultBankBIC)
+			return defaultBankBIC
+		}
+	}
+	return value
+}
+
+// defaultFXSpreadPercent is the bank's margin on currency conversions
+const defaultFXSpreadPercent = "1"
+
+// GetFXSpreadPercent returns the spread applied to the cross rate on currency
+// conversions, in percent (FX_SPREAD_PERCENT), defaulting to 1%
+func GetFXSpreadPercent() decimal.Decimal {
+	value := getEnv("FX_SPREAD_PERCENT", defaultFXSpreadPercent)
+	spread, err := decimal.NewFromString(value)
+	if err != nil || spread.IsNegative() || spread.GreaterThanOrEqual(decimal.NewFromInt(100)) {
+		log.Printf("Invalid FX_SPREAD_PERCENT %q, using %s", value, defaultFXSpreadPercent)
+		return decimal.RequireFromString(defaultFXSpreadPercent)
+	}
+	return spread
+}
+
+// defaultFXRateMaxAge is how long a stored exchange rate may be used for conversions
+const defaultFXRateMaxAge = 48 * time.Hour
+
+// GetFXRateMaxAge returns how old a stored exchange rate may be before conversions
+// in that currency are refused (FX_RATE_MAX_AGE), defaulting to 48 hours
+func GetFXRateMaxAge() time.Duration {
+	value := getEnv("FX_RATE_MAX_AGE", defaultFXRateMaxAge.String())
+	maxAge, err := time.ParseDuration(value)
+	if err != nil || maxAge <= 0 {
+		log.Printf("Invalid FX_RATE_MAX_AGE %q, using %s", value, defaultFXRateMaxAge)
+		return defaultFXRateMaxAge
+	}
+	return maxAge
+}
+
+// defaultLoanRateResetMonths resets floating rates quarterly
+const defaultLoanRateResetMonths = 3
+
+// GetLoanRateResetMonths returns how often the rate of a floating rate loan is
+// reset to the current key rate plus its margin (LOAN_RATE_RESET_MONTHS), in months.
+// Loan products that do not set their own reset period use this value
+func GetLoanRateResetMonths() int {
+	value := getEnv("LOAN_RATE_RESET_MONTHS", strconv.Itoa(defaultLoanRateResetMonths))
+	months, err := strconv.Atoi(value)
+	if err != nil || months <= 0 {
+		log.Printf("Invalid LOAN_RATE_RESET_MONTHS %q, using %d", value, defaultLoanRateResetMonths)
+		return defaultLoanRateResetMonths
+	}
+	return months
+}
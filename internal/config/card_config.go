@@ -0,0 +1,74 @@
+package config
+
+import (
+	"log"
+	"strings"
+	"time"
+)
+
+// defaultCardHoldTTL is how long an uncaptured card authorization keeps funds on hold
+const defaultCardHoldTTL = 7 * 24 * time.Hour
+
+// GetCardHoldTTL returns how long a card authorization hold stays valid before
+// it expires and the funds are released (CARD_HOLD_TTL), defaulting to 7 days
+func GetCardHoldTTL() time.Duration {
+	value := getEnv("CARD_HOLD_TTL", defaultCardHoldTTL.String())
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		log.Printf("Invalid CARD_HOLD_TTL %q, using %s", value, defaultCardHoldTTL)
+		return defaultCardHoldTTL
+	}
+	return ttl
+}
+
+// defaultCardBINs issues debit cards under a single BIN when CARD_BINS is not set
+const defaultCardBINs = "debit:400000"
+
+// GetCardBINs returns the issuer BIN prefixes per card product (CARD_BINS), e.g.
+// "debit:427600|427601,premium:546900". A product with several BINs issues cards
+// under a randomly chosen one. Malformed entries are skipped with a warning; if no
+// valid entry remains, the default debit BIN 400000 is used
+func GetCardBINs() map[string][]string {
+	value := getEnv("CARD_BINS", defaultCardBINs)
+	bins := parseCardBINs(value)
+	if len(bins) == 0 {
+		log.Printf("Invalid CARD_BINS %q, using %s", value, defaultCardBINs)
+		return parseCardBINs(defaultCardBINs)
+	}
+	return bins
+}
+
+// parseCardBINs parses a "product:bin|bin,product:bin" list; a BIN is 6 to 8 digits
+func parseCardBINs(spec string) map[string][]string {
+	bins := make(map[string][]string)
+	for _, item := range strings.Split(spec, ",") {
+		product, list, ok := strings.Cut(strings.TrimSpace(item), ":")
+		product = strings.TrimSpace(product)
+		if !ok || product == "" {
+			log.Printf("Skipping CARD_BINS entry %q: expected product:bin", item)
+			continue
+		}
+		for _, bin := range strings.Split(list, "|") {
+			bin = strings.TrimSpace(bin)
+			if !isBIN(bin) {
+				log.Printf("Skipping BIN %q of card product %q: expected 6 to 8 digits", bin, product)
+				continue
+			}
+			bins[product] = append(bins[product], bin)
+		}
+	}
+	return bins
+}
+
+// isBIN reports whether s is a 6 to 8 digit issuer identification number
+func isBIN(s string) bool {
+	if len(s) < 6 || len(s) > 8 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
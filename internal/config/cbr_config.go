@@ -0,0 +1,68 @@
+package config
+
+import (
+	"log"
+
+	"github.com/shopspring/decimal"
+)
+
+// defaultCBRURL is the Bank of Russia DailyInfo SOAP web service
+const defaultCBRURL = "https://www.cbr.ru/DailyInfoWebServ/DailyInfo.asmx"
+
+// GetCBRURL returns the endpoint of the Bank of Russia DailyInfo web service (CBR_URL)
+func GetCBRURL() string {
+	return getEnv("CBR_URL", defaultCBRURL)
+}
+
+// GetCBRStubDir returns the directory with recorded SOAP responses (CBR_STUB_DIR).
+// When set, the service reads responses from <method>.xml files in this directory
+// instead of calling the Bank of Russia, which is meant for tests and offline development
+func GetCBRStubDir() string {
+	return getEnv("CBR_STUB_DIR", "")
+}
+
+// Key rate providers selectable with KEY_RATE_PROVIDER
+const (
+	KeyRateProviderCBR    = "cbr"    // Bank of Russia DailyInfo SOAP service
+	KeyRateProviderFile   = "file"   // JSON file with the key rate history (KEY_RATE_FILE)
+	KeyRateProviderManual = "manual" // Fixed rate set by the operator (KEY_RATE_MANUAL)
+)
+
+// GetKeyRateProvider returns the source of the key rate (KEY_RATE_PROVIDER),
+// defaulting to the Bank of Russia web service
+func GetKeyRateProvider() string {
+	return getEnv("KEY_RATE_PROVIDER", KeyRateProviderCBR)
+}
+
+// GetKeyRateFile returns the path of the key rate history file used by the file provider (KEY_RATE_FILE)
+func GetKeyRateFile() string {
+	return getEnv("KEY_RATE_FILE", "")
+}
+
+// GetKeyRateManual returns the key rate set by the operator for the manual provider (KEY_RATE_MANUAL).
+// The second result is false if the variable is missing or is not a positive number
+func GetKeyRateManual() (decimal.Decimal, bool) {
+	value := getEnv("KEY_RATE_MANUAL", "")
+	rate, err := decimal.NewFromString(value)
+	if err != nil || !rate.IsPositive() {
+		return decimal.Zero, false
+	}
+	return rate, true
+}
+
+// What to do when the key rate provider fails (KEY_RATE_FALLBACK)
+const (
+	KeyRateFallbackFail       = "fail"        // refuse operations that need the key rate
+	KeyRateFallbackLastStored = "last_stored" // use the latest rate stored in the key rate history
+)
+
+// GetKeyRateFallback returns the behavior when the key rate provider fails (KEY_RATE_FALLBACK),
+// defaulting to the last stored rate. An unknown value is treated as fail
+func GetKeyRateFallback() string {
+	value := getEnv("KEY_RATE_FALLBACK", KeyRateFallbackLastStored)
+	if value != KeyRateFallbackFail && value != KeyRateFallbackLastStored {
+		log.Printf("Invalid KEY_RATE_FALLBACK %q, using %s", value, KeyRateFallbackFail)
+		return KeyRateFallbackFail
+	}
+	return value
+}
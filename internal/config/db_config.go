@@ -28,6 +28,18 @@ func GetDBConfig() DBConfig {
 	}
 }
 
+// Storage backends supported by the application
+const (
+	StorageBackendPostgres = "postgres"
+	StorageBackendMemory   = "memory"
+)
+
+// GetStorageBackend returns the storage backend selected by the STORAGE_BACKEND
+// environment variable, defaulting to PostgreSQL
+func GetStorageBackend() string {
+	return getEnv("STORAGE_BACKEND", StorageBackendPostgres)
+}
+
 // ConnectionString returns the PostgreSQL connection string
 func (c DBConfig) ConnectionString() string {
 	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
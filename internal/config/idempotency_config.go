@@ -0,0 +1,22 @@
+package config
+
+import (
+	"log"
+	"time"
+)
+
+// defaultIdempotencyKeyTTL is how long a stored response is replayed for its Idempotency-Key
+const defaultIdempotencyKeyTTL = 24 * time.Hour
+
+// GetIdempotencyKeyTTL returns how long an Idempotency-Key and its response are kept
+// (IDEMPOTENCY_KEY_TTL), defaulting to 24 hours. An expired key is purged by the
+// scheduler and may be used again for a new request
+func GetIdempotencyKeyTTL() time.Duration {
+	value := getEnv("IDEMPOTENCY_KEY_TTL", defaultIdempotencyKeyTTL.String())
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		log.Printf("Invalid IDEMPOTENCY_KEY_TTL %q, using %s", value, defaultIdempotencyKeyTTL)
+		return defaultIdempotencyKeyTTL
+	}
+	return ttl
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"log"
+	"strconv"
+
+	"github.com/shopspring/decimal"
+)
+
+// Credit scoring models selectable with CREDIT_SCORER
+const (
+	CreditScorerDTI    = "dti"    // Decides by the debt-to-income ratio and the borrower's payment history
+	CreditScorerManual = "manual" // Sends every application to operator review
+)
+
+// GetCreditScorer returns the scoring model that decides on loan applications (CREDIT_SCORER),
+// defaulting to the debt-to-income model
+func GetCreditScorer() string {
+	return getEnv("CREDIT_SCORER", CreditScorerDTI)
+}
+
+// Default debt-to-income thresholds, in percent of the monthly income
+const (
+	defaultScoringDTIApprove = "40"
+	defaultScoringDTIReject  = "60"
+)
+
+// GetScoringDTIApprove returns the debt-to-income ratio up to which an application
+// is approved automatically (SCORING_DTI_APPROVE), in percent, defaulting to 40%
+func GetScoringDTIApprove() decimal.Decimal {
+	return getPercent("SCORING_DTI_APPROVE", defaultScoringDTIApprove)
+}
+
+// GetScoringDTIReject returns the debt-to-income ratio above which an application
+// is rejected automatically (SCORING_DTI_REJECT), in percent, defaulting to 60%.
+// Applications between the approve and reject thresholds go to operator review
+func GetScoringDTIReject() decimal.Decimal {
+	return getPercent("SCORING_DTI_REJECT", defaultScoringDTIReject)
+}
+
+// getPercent reads a non-negative percentage from the environment variable key
+func getPercent(key, defaultValue string) decimal.Decimal {
+	value := getEnv(key, defaultValue)
+	percent, err := decimal.NewFromString(value)
+	if err != nil || percent.IsNegative() {
+		log.Printf("Invalid %s %q, using %s", key, value, defaultValue)
+		return decimal.RequireFromString(defaultValue)
+	}
+	return percent
+}
+
+// defaultScoringReviewAmount is the loan amount above which an operator reviews every application
+const defaultScoringReviewAmount = "1000000"
+
+// GetScoringReviewAmount returns the loan amount above which an application is never
+// approved automatically and goes to operator review (SCORING_REVIEW_AMOUNT), defaulting to 1000000
+func GetScoringReviewAmount() decimal.Decimal {
+	value := getEnv("SCORING_REVIEW_AMOUNT", defaultScoringReviewAmount)
+	amount, err := decimal.NewFromString(value)
+	if err != nil || !amount.IsPositive() {
+		log.Printf("Invalid SCORING_REVIEW_AMOUNT %q, using %s", value, defaultScoringReviewAmount)
+		return decimal.RequireFromString(defaultScoringReviewAmount)
+	}
+	return amount
+}
+
+// defaultScoringIncomeMonths is the period over which the borrower's income is averaged
+const defaultScoringIncomeMonths = 3
+
+// GetScoringIncomeMonths returns the number of past months over which incoming payments
+// to the borrower's accounts are averaged into the monthly income (SCORING_INCOME_MONTHS), defaulting to 3
+func GetScoringIncomeMonths() int {
+	value := getEnv("SCORING_INCOME_MONTHS", strconv.Itoa(defaultScoringIncomeMonths))
+	months, err := strconv.Atoi(value)
+	if err != nil || months <= 0 {
+		log.Printf("Invalid SCORING_INCOME_MONTHS %q, using %d", value, defaultScoringIncomeMonths)
+		return defaultScoringIncomeMonths
+	}
+	return months
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// defaultStepUpThreshold is the transfer amount above which a second factor is required
+const defaultStepUpThreshold = "100000"
+
+// GetStepUpThreshold returns the transfer amount above which the user must confirm
+// the operation with a TOTP code (STEP_UP_THRESHOLD), defaulting to 100000
+func GetStepUpThreshold() decimal.Decimal {
+	value := getEnv("STEP_UP_THRESHOLD", defaultStepUpThreshold)
+	threshold, err := decimal.NewFromString(value)
+	if err != nil || threshold.IsNegative() {
+		log.Printf("Invalid STEP_UP_THRESHOLD %q, using %s", value, defaultStepUpThreshold)
+		return decimal.RequireFromString(defaultStepUpThreshold)
+	}
+	return threshold
+}
+
+// defaultCardMaxFailedAttempts is the number of failed CVV/expiry checks in a row
+// after which a card is blocked
+const defaultCardMaxFailedAttempts = 3
+
+// GetCardMaxFailedAttempts returns the number of failed card verifications in a row
+// that blocks the card (CARD_MAX_FAILED_ATTEMPTS), defaulting to 3
+func GetCardMaxFailedAttempts() int {
+	value := getEnv("CARD_MAX_FAILED_ATTEMPTS", strconv.Itoa(defaultCardMaxFailedAttempts))
+	attempts, err := strconv.Atoi(value)
+	if err != nil || attempts <= 0 {
+		log.Printf("Invalid CARD_MAX_FAILED_ATTEMPTS %q, using %d", value, defaultCardMaxFailedAttempts)
+		return defaultCardMaxFailedAttempts
+	}
+	return attempts
+}
+
+// defaultMFAMaxFailedAttempts is the number of invalid second factor codes in a row
+// after which code verification is locked
+const defaultMFAMaxFailedAttempts = 5
+
+// GetMFAMaxFailedAttempts returns the number of invalid TOTP or recovery codes in a row
+// that locks second factor verification for the user (MFA_MAX_FAILED_ATTEMPTS), defaulting to 5
+func GetMFAMaxFailedAttempts() int {
+	value := getEnv("MFA_MAX_FAILED_ATTEMPTS", strconv.Itoa(defaultMFAMaxFailedAttempts))
+	attempts, err := strconv.Atoi(value)
+	if err != nil || attempts <= 0 {
+		log.Printf("Invalid MFA_MAX_FAILED_ATTEMPTS %q, using %d", value, defaultMFAMaxFailedAttempts)
+		return defaultMFAMaxFailedAttempts
+	}
+	return attempts
+}
+
+// defaultMFALockout is how long second factor verification stays locked after the limit is reached
+const defaultMFALockout = 5 * time.Minute
+
+// GetMFALockout returns how long second factor verification is locked once the limit
+// of invalid codes is reached (MFA_LOCKOUT), defaulting to 5 minutes. Every further
+// invalid code doubles the lockout, up to 24 hours
+func GetMFALockout() time.Duration {
+	value := getEnv("MFA_LOCKOUT", defaultMFALockout.String())
+	lockout, err := time.ParseDuration(value)
+	if err != nil || lockout <= 0 {
+		log.Printf("Invalid MFA_LOCKOUT %q, using %s", value, defaultMFALockout)
+		return defaultMFALockout
+	}
+	return lockout
+}
@@ -1,41 +1,214 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/shopspring/decimal"
 )
 
+// Роли пользователей, определяющие доступ к операциям банка
+const (
+	RoleCustomer = "customer" // Клиент: работает только со своими счетами
+	RoleOperator = "operator" // Операционист: просматривает данные клиентов и замораживает счета
+	RoleAdmin    = "admin"    // Администратор: дополнительно управляет ролями пользователей
+)
+
+// IsValidRole сообщает, является ли строка известной ролью
+func IsValidRole(role string) bool {
+	return role == RoleCustomer || role == RoleOperator || role == RoleAdmin
+}
+
 // User представляет информацию о зарегистрированном пользователе в системе
 type User struct {
 	ID           string    `json:"id"`         // Уникальный идентификатор пользователя
 	Username     string    `json:"username"`   // Имя пользователя для входа в систему
 	Email        string    `json:"email"`      // Электронная почта пользователя
 	PasswordHash string    `json:"-"`          // Хеш пароля (не отправляется в JSON)
+	Role         string    `json:"role"`       // Роль пользователя (customer, operator, admin)
 	CreatedAt    time.Time `json:"created_at"` // Дата и время регистрации
 }
 
+// Статусы банковского счета
+const (
+	AccountStatusActive = "active" // Счет обслуживается без ограничений
+	AccountStatusFrozen = "frozen" // Списания со счета запрещены, зачисления разрешены
+)
+
+// Типы банковских счетов
+const (
+	AccountTypeCurrent = "current" // Текущий счет физического лица
+	AccountTypeSavings = "savings" // Сберегательный счет (вклад до востребования)
+)
+
+// accountBalancePrefixes задает балансовый счет второго порядка для каждого типа счета,
+// с которого начинается номер счета
+var accountBalancePrefixes = map[string]string{
+	AccountTypeCurrent: "40817",
+	AccountTypeSavings: "42301",
+}
+
+// AccountBalancePrefix возвращает балансовый счет второго порядка для типа счета
+// Второе значение равно false для неизвестного типа
+func AccountBalancePrefix(accountType string) (string, bool) {
+	prefix, ok := accountBalancePrefixes[accountType]
+	return prefix, ok
+}
+
+// CurrencyRUB - валюта счетов по умолчанию и валюта, к которой устанавливаются курсы
+const CurrencyRUB = "RUB"
+
+// currencyNumericCodes задает поддерживаемые валюты счетов (буквенный код ISO 4217)
+// и их цифровые коды, входящие в номер счета
+var currencyNumericCodes = map[string]string{
+	CurrencyRUB: "810",
+	"USD":       "840",
+	"EUR":       "978",
+	"GBP":       "826",
+	"CHF":       "756",
+	"CNY":       "156",
+}
+
+// CurrencyNumericCode возвращает цифровой код ISO 4217 для буквенного кода валюты
+// Второе значение равно false для неподдерживаемой валюты
+func CurrencyNumericCode(currency string) (string, bool) {
+	code, ok := currencyNumericCodes[currency]
+	return code, ok
+}
+
+// IsSupportedCurrency сообщает, можно ли открыть счет в валюте currency
+func IsSupportedCurrency(currency string) bool {
+	_, ok := currencyNumericCodes[currency]
+	return ok
+}
+
 // Account представляет банковский счет пользователя
 type Account struct {
-	ID        string          `json:"id"`         // Уникальный идентификатор счета
-	UserID    string          `json:"user_id"`    // Идентификатор владельца счета
-	Number    string          `json:"number"`     // Номер счета в банковском формате
-	Balance   decimal.Decimal `json:"balance"`    // Текущий баланс счета
-	CreatedAt time.Time       `json:"created_at"` // Дата и время создания счета
+	ID               string          `json:"id"`                // Уникальный идентификатор счета
+	UserID           string          `json:"user_id"`           // Идентификатор владельца счета
+	Number           string          `json:"number"`            // Номер счета в банковском формате
+	Type             string          `json:"type"`              // Тип счета (current, savings)
+	Currency         string          `json:"currency"`          // Валюта счета (ISO 4217)
+	Balance          decimal.Decimal `json:"balance"`           // Учетный баланс счета по главной книге
+	HeldAmount       decimal.Decimal `json:"held_amount"`       // Сумма действующих удержаний по картам
+	AvailableBalance decimal.Decimal `json:"available_balance"` // Баланс за вычетом удержаний, заполняется хранилищем
+	Status           string          `json:"status"`            // Статус счета (active, frozen)
+	CreatedAt        time.Time       `json:"created_at"`        // Дата и время создания счета
 }
 
+// Available возвращает сумму, доступную для списаний: учетный баланс за вычетом удержаний
+func (a Account) Available() decimal.Decimal {
+	return a.Balance.Sub(a.HeldAmount)
+}
+
+// Статусы банковской карты
+const (
+	CardStatusActive  = "active"  // Карта обслуживается
+	CardStatusFrozen  = "frozen"  // Владелец временно приостановил операции по карте
+	CardStatusBlocked = "blocked" // Карта заблокирована: утеряна, украдена или введены неверные CVV
+	CardStatusClosed  = "closed"  // Карта закрыта или перевыпущена; статус окончательный
+	CardStatusExpired = "expired" // Истек срок действия карты
+)
+
+// cardStatusTransitions перечисляет допустимые переходы между статусами карты
+var cardStatusTransitions = map[string][]string{
+	CardStatusActive:  {CardStatusFrozen, CardStatusBlocked, CardStatusClosed, CardStatusExpired},
+	CardStatusFrozen:  {CardStatusActive, CardStatusBlocked, CardStatusClosed, CardStatusExpired},
+	CardStatusBlocked: {CardStatusActive, CardStatusClosed},
+	CardStatusExpired: {CardStatusClosed},
+}
+
+// CanTransitionCardStatus сообщает, допустим ли переход карты из статуса from в статус to
+func CanTransitionCardStatus(from, to string) bool {
+	for _, allowed := range cardStatusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CardProductDebit - продукт, выпускаемый, если в запросе продукт не указан
+// Список продуктов и их BIN задается переменной окружения CARD_BINS
+const CardProductDebit = "debit"
+
+// Виды карт
+const (
+	CardTypePhysical = "physical" // Пластиковая карта
+	CardTypeVirtual  = "virtual"  // Виртуальная карта: действует сразу, реквизиты показываются владельцу один раз
+)
+
 // Card представляет платежную карту, привязанную к счету
 type Card struct {
-	ID              string    `json:"id"`         // Уникальный идентификатор карты
-	AccountID       string    `json:"account_id"` // Счет, к которому привязана карта
-	Number          string    `json:"number"`     // Номер карты (маскируется в JSON)
-	EncryptedNumber string    `json:"-"`          // Зашифрованный номер карты (хранится в БД)
-	NumberHMAC      string    `json:"-"`          // HMAC для проверки целостности номера карты
-	ExpiryMonth     int       `json:"expiry_month"`
-	ExpiryYear      int       `json:"expiry_year"`
-	CVV             string    `json:"-"` // Код безопасности (не отправляется в JSON)
-	CVVHash         string    `json:"-"` // Хешированный CVV (хранится в БД)
-	CreatedAt       time.Time `json:"created_at"`
+	ID              string     `json:"id"`                        // Уникальный идентификатор карты
+	AccountID       string     `json:"account_id"`                // Счет, к которому привязана карта
+	Product         string     `json:"product"`                   // Карточный продукт, определяющий BIN номера
+	Type            string     `json:"type"`                      // Вид карты: physical или virtual
+	SingleUse       bool       `json:"single_use"`                // Карта закрывается после первого успешного платежа
+	LockedMerchant  string     `json:"locked_merchant,omitempty"` // Единственный получатель, которому можно платить картой
+	Number          string     `json:"number"`                    // Номер карты (маскируется в JSON, в БД не хранится)
+	EncryptedNumber string     `json:"-"`                         // Зашифрованный номер карты (хранится в БД)
+	EncryptionKeyID string     `json:"-"`                         // Идентификатор ключа, которым зашифрован номер
+	NumberHMAC      string     `json:"-"`                         // HMAC номера карты для поиска без расшифровки
+	LastFour        string     `json:"-"`                         // Последние 4 цифры номера для отображения
+	ExpiryMonth     int        `json:"expiry_month"`
+	ExpiryYear      int        `json:"expiry_year"`
+	CVV             string     `json:"-"`                     // Код безопасности (не отправляется в JSON)
+	CVVHash         string     `json:"-"`                     // Хешированный CVV (хранится в БД)
+	EncryptedCVV    string     `json:"-"`                     // Зашифрованный CVV виртуальной карты; удаляется после показа владельцу
+	RevealedAt      *time.Time `json:"revealed_at,omitempty"` // Когда реквизиты виртуальной карты были показаны
+	Status          string     `json:"status"`
+	FailedAttempts  int        `json:"-"`                     // Неудачные проверки CVV и срока действия подряд
+	ReplacedBy      string     `json:"replaced_by,omitempty"` // ID карты, перевыпущенной взамен этой
+	Limits          CardLimits `json:"limits"`                // Лимиты расходов по карте
+	CreatedAt       time.Time  `json:"created_at"`
+}
+
+// CardLimits задает лимиты расходов по карте; значение null означает отсутствие лимита
+// Дневной и месячный лимиты считаются по календарным суткам и месяцам UTC
+type CardLimits struct {
+	PerTransaction decimal.NullDecimal `json:"per_transaction"` // Максимальная сумма одного платежа
+	Daily          decimal.NullDecimal `json:"daily"`           // Максимальная сумма платежей за сутки
+	Monthly        decimal.NullDecimal `json:"monthly"`         // Максимальная сумма платежей за месяц
+}
+
+// Списки правил по получателям платежей
+const (
+	MerchantRuleAllow = "allow" // Платежи разрешены только подходящим получателям
+	MerchantRuleDeny  = "deny"  // Платежи подходящим получателям запрещены
+)
+
+// Признаки, по которым правило сопоставляется с получателем платежа
+const (
+	MerchantRuleByName     = "merchant" // Название получателя
+	MerchantRuleByCategory = "category" // Категория получателя
+)
+
+// MerchantRule ограничивает платежи по карте в пользу определенных получателей
+type MerchantRule struct {
+	ID        string    `json:"id"`
+	CardID    string    `json:"card_id"`
+	List      string    `json:"list"`  // Список: allow или deny
+	Kind      string    `json:"kind"`  // Признак сопоставления: merchant или category
+	Value     string    `json:"value"` // Название или категория получателя
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Matches сообщает, подходит ли получатель платежа под правило
+// Сравнение выполняется без учета регистра и пробелов по краям
+func (r MerchantRule) Matches(merchant, category string) bool {
+	value := merchant
+	if r.Kind == MerchantRuleByCategory {
+		value = category
+	}
+	return value != "" && strings.EqualFold(strings.TrimSpace(value), strings.TrimSpace(r.Value))
+}
+
+// IsExpired сообщает, истек ли срок действия карты к моменту now
+// Карта действует до конца месяца, указанного на ней
+func (c Card) IsExpired(now time.Time) bool {
+	expiry := time.Date(c.ExpiryYear, time.Month(c.ExpiryMonth)+1, 0, 23, 59, 59, 0, time.UTC) // Last day of the month
+	return now.After(expiry)
 }
 
 // SecureCard создает безопасную версию карты с маскированным номером для ответов API
@@ -44,48 +217,405 @@ func (c Card) SecureCard() Card {
 	secureCard := c
 
 	// Маскируем номер карты (показываем только последние 4 цифры)
+	lastFour := c.LastFour
 	if len(c.Number) > 4 {
-		secureCard.Number = "****-****-****-" + c.Number[len(c.Number)-4:]
+		lastFour = c.Number[len(c.Number)-4:]
 	}
+	secureCard.Number = "****-****-****-" + lastFour
 
 	// Очищаем конфиденциальные данные
 	secureCard.EncryptedNumber = ""
+	secureCard.EncryptionKeyID = ""
 	secureCard.NumberHMAC = ""
 	secureCard.CVV = ""
 	secureCard.CVVHash = ""
+	secureCard.EncryptedCVV = ""
 
 	return secureCard
 }
 
+// CardDetails - полные реквизиты виртуальной карты, которые показываются владельцу один раз
+type CardDetails struct {
+	CardID      string `json:"card_id"`
+	Number      string `json:"number"`
+	ExpiryMonth int    `json:"expiry_month"`
+	ExpiryYear  int    `json:"expiry_year"`
+	CVV         string `json:"cvv"`
+}
+
+// Статусы удержания по карте
+const (
+	HoldStatusAuthorized = "authorized" // Сумма удержана и ожидает списания
+	HoldStatusCaptured   = "captured"   // Удержание списано полностью или частично
+	HoldStatusVoided     = "voided"     // Удержание отменено
+	HoldStatusExpired    = "expired"    // Удержание не списано до истечения срока и снято
+)
+
+// Hold представляет удержание средств на счете при авторизации платежа по карте
+// Удержание уменьшает доступный баланс счета, но не учетный: проводки в главной книге
+// создаются только при списании
+type Hold struct {
+	ID               string          `json:"id"`
+	CardID           string          `json:"card_id"`
+	AccountID        string          `json:"account_id"`
+	Amount           decimal.Decimal `json:"amount"`          // Авторизованная сумма
+	CapturedAmount   decimal.Decimal `json:"captured_amount"` // Списанная сумма; остаток возвращается в доступный баланс
+	Merchant         string          `json:"merchant,omitempty"`
+	MerchantCategory string          `json:"merchant_category,omitempty"`
+	Status           string          `json:"status"`
+	TransactionID    string          `json:"transaction_id,omitempty"` // Транзакция списания
+	ExpiresAt        time.Time       `json:"expires_at"`
+	CreatedAt        time.Time       `json:"created_at"`
+	CompletedAt      *time.Time      `json:"completed_at,omitempty"` // Время списания, отмены или истечения
+}
+
 // Transaction представляет финансовую операцию в системе
 type Transaction struct {
+	ID                   string          `json:"id"`
+	FromAccountID        string          `json:"from_account_id,omitempty"`
+	ToAccountID          string          `json:"to_account_id,omitempty"`
+	Amount               decimal.Decimal `json:"amount"`
+	Currency             string          `json:"currency"` // Валюта суммы операции (ISO 4217)
+	Timestamp            time.Time       `json:"timestamp"`
+	TransactionType      string          `json:"transaction_type"` //Тип транзакции например платеж
+	Description          string          `json:"description,omitempty"`
+	CardID               string          `json:"card_id,omitempty"`                // Карта, которой оплачена операция
+	Merchant             string          `json:"merchant,omitempty"`               // Получатель платежа по карте
+	MerchantCategory     string          `json:"merchant_category,omitempty"`      // Категория получателя платежа
+	RelatedTransactionID string          `json:"related_transaction_id,omitempty"` // Исходный платеж для возвратов и компенсаций
+	DisputeStatus        string          `json:"dispute_status,omitempty"`         // Статус последнего спора по операции, заполняется хранилищем
+	Conversion           *Conversion     `json:"conversion,omitempty"`             // Конвертация при переводе между счетами в разных валютах
+}
+
+// TransactionTypeExchange - перевод между счетами в разных валютах с конвертацией
+const TransactionTypeExchange = "exchange"
+
+// TransactionTypeOpeningBalance - входящий остаток счета, открытого до ведения главной книги,
+// проведенный миграцией против системного счета system:opening
+const TransactionTypeOpeningBalance = "opening_balance"
+
+// CreditedAmount возвращает сумму, зачисленную на счет получателя, в валюте этого счета
+func (t Transaction) CreditedAmount() decimal.Decimal {
+	if t.Conversion != nil {
+		return t.Conversion.ConvertedAmount
+	}
+	return t.Amount
+}
+
+// Conversion описывает конвертацию суммы операции в валюту счета получателя
+// Курсы выражены в единицах валюты получателя за единицу валюты операции
+type Conversion struct {
+	ToCurrency      string          `json:"to_currency"`      // Валюта счета получателя
+	ConvertedAmount decimal.Decimal `json:"converted_amount"` // Сумма, зачисленная получателю
+	MidRate         decimal.Decimal `json:"mid_rate"`         // Кросс-курс по сохраненным курсам валют
+	Rate            decimal.Decimal `json:"rate"`             // Примененный курс с учетом спреда
+	SpreadPercent   decimal.Decimal `json:"spread_percent"`   // Спред банка в процентах от кросс-курса
+}
+
+// ExchangeRate хранит курс валюты к рублю, по которому проводятся конвертации
+type ExchangeRate struct {
+	Currency  string          `json:"currency"`   // Буквенный код валюты (ISO 4217)
+	Rate      decimal.Decimal `json:"rate"`       // Рублей за единицу валюты
+	UpdatedAt time.Time       `json:"updated_at"` // Время установки курса
+}
+
+// CurrencyRate - официальный курс валюты, установленный Банком России на дату
+// История курсов хранится, чтобы расчеты за прошлые даты были воспроизводимы
+type CurrencyRate struct {
+	Date        time.Time       `json:"date"`         // Дата, на которую установлен курс
+	Currency    string          `json:"currency"`     // Буквенный код валюты (ISO 4217)
+	NumericCode string          `json:"numeric_code"` // Цифровой код валюты (ISO 4217)
+	Name        string          `json:"name"`         // Наименование валюты
+	Nominal     int             `json:"nominal"`      // Количество единиц валюты, за которое установлен курс
+	Value       decimal.Decimal `json:"value"`        // Рублей за Nominal единиц валюты
+	Rate        decimal.Decimal `json:"rate"`         // Рублей за единицу валюты
+	FetchedAt   time.Time       `json:"fetched_at"`   // Время получения курса от Банка России
+}
+
+// Источники ключевой ставки
+const (
+	KeyRateSourceCBR    = "cbr"    // Веб-сервис Банка России
+	KeyRateSourceFile   = "file"   // Файл с историей ставки
+	KeyRateSourceManual = "manual" // Ставка, заданная оператором
+)
+
+// KeyRate - ключевая ставка Банка России, действующая с даты Date
+type KeyRate struct {
+	Date      time.Time       `json:"date"`       // Дата, с которой действует ставка
+	Rate      decimal.Decimal `json:"rate"`       // Ставка, % годовых
+	Source    string          `json:"source"`     // Источник ставки
+	FetchedAt time.Time       `json:"fetched_at"` // Время получения ставки от источника
+}
+
+// Типы операций, связанных с исходным платежом по карте
+const (
+	TransactionTypeRefund     = "refund"     // Возврат средств по инициативе получателя платежа
+	TransactionTypeChargeback = "chargeback" // Компенсация по спору, решенному в пользу клиента
+)
+
+// Статусы спора по платежу
+const (
+	DisputeStatusOpen        = "open"         // Спор открыт клиентом и ожидает рассмотрения
+	DisputeStatusUnderReview = "under_review" // Операционист запросил документы у получателя платежа
+	DisputeStatusWon         = "won"          // Спор решен в пользу клиента, сумма возвращена на счет
+	DisputeStatusLost        = "lost"         // В споре отказано; статус окончательный
+)
+
+// disputeStatusTransitions перечисляет допустимые переходы между статусами спора
+var disputeStatusTransitions = map[string][]string{
+	DisputeStatusOpen:        {DisputeStatusUnderReview, DisputeStatusWon, DisputeStatusLost},
+	DisputeStatusUnderReview: {DisputeStatusWon, DisputeStatusLost},
+}
+
+// CanTransitionDisputeStatus сообщает, допустим ли переход спора из статуса from в статус to
+func CanTransitionDisputeStatus(from, to string) bool {
+	for _, allowed := range disputeStatusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActiveDisputeStatus сообщает, что спор еще не решен
+func IsActiveDisputeStatus(status string) bool {
+	return status == DisputeStatusOpen || status == DisputeStatusUnderReview
+}
+
+// Dispute представляет спор клиента по платежу по карте
+// Спор, решенный в пользу клиента, возвращает сумму на счет операцией chargeback
+type Dispute struct {
+	ID                      string          `json:"id"`
+	TransactionID           string          `json:"transaction_id"` // Оспариваемый платеж
+	AccountID               string          `json:"account_id"`
+	CardID                  string          `json:"card_id,omitempty"`
+	Amount                  decimal.Decimal `json:"amount"` // Оспариваемая сумма
+	Reason                  string          `json:"reason"`
+	Status                  string          `json:"status"`
+	Resolution              string          `json:"resolution,omitempty"`                // Комментарий операциониста
+	ChargebackTransactionID string          `json:"chargeback_transaction_id,omitempty"` // Операция компенсации
+	CreatedAt               time.Time       `json:"created_at"`
+	UpdatedAt               time.Time       `json:"updated_at"`
+	ResolvedAt              *time.Time      `json:"resolved_at,omitempty"`
+}
+
+// Способы расчета ставки кредитного продукта
+const (
+	LoanPricingKeyRateMargin = "key_rate_margin" // Ключевая ставка Банка России плюс маржа продукта
+	LoanPricingFixedRate     = "fixed_rate"      // Ставка, установленная продуктом, независимо от ключевой
+)
+
+// Способы погашения кредита
+const (
+	AmortizationAnnuity        = "annuity"        // Равные ежемесячные платежи
+	AmortizationDifferentiated = "differentiated" // Равные доли основного долга плюс проценты на остаток
+)
+
+// LoanProduct представляет кредитный продукт: ограничения суммы и срока, правила расчета ставки,
+// штрафов и погашения. Условия продукта копируются в кредит при выдаче, поэтому изменение
+// продукта действует только для новых кредитов
+type LoanProduct struct {
 	ID              string          `json:"id"`
-	FromAccountID   string          `json:"from_account_id,omitempty"`
-	ToAccountID     string          `json:"to_account_id,omitempty"`
-	Amount          decimal.Decimal `json:"amount"`
-	Timestamp       time.Time       `json:"timestamp"`
-	TransactionType string          `json:"transaction_type"` //Тип транзакции например платеж
-	Description     string          `json:"description,omitempty"`
+	Name            string          `json:"name"`
+	Currency        string          `json:"currency"`          // Валюта кредита; счет выдачи должен быть в этой валюте
+	MinAmount       decimal.Decimal `json:"min_amount"`        // Минимальная сумма кредита
+	MaxAmount       decimal.Decimal `json:"max_amount"`        // Максимальная сумма кредита
+	MinTermMonths   int             `json:"min_term_months"`   // Минимальный срок в месяцах
+	MaxTermMonths   int             `json:"max_term_months"`   // Максимальный срок в месяцах
+	Pricing         string          `json:"pricing"`           // Расчет ставки: key_rate_margin или fixed_rate
+	RateMargin      decimal.Decimal `json:"rate_margin"`       // Надбавка к ключевой ставке, процентных пунктов
+	FixedRate       decimal.Decimal `json:"fixed_rate"`        // Ставка продукта fixed_rate, % годовых
+	RateType        string          `json:"rate_type"`         // fixed или floating; плавающая ставка - только от ключевой
+	RateResetMonths int             `json:"rate_reset_months"` // Период пересмотра плавающей ставки в месяцах
+	PenaltyPercent  decimal.Decimal `json:"penalty_percent"`   // Штраф за просроченный платеж, % от платежа
+	PenaltyDueDays  int             `json:"penalty_due_days"`  // Срок оплаты штрафа в днях
+	Amortization    string          `json:"amortization"`      // Способ погашения: annuity или differentiated
+	Active          bool            `json:"active"`            // Продукт доступен для новых кредитов
+	CreatedAt       time.Time       `json:"created_at"`
+	UpdatedAt       time.Time       `json:"updated_at"`
 }
 
+// Виды процентной ставки по кредиту
+const (
+	LoanRateFixed    = "fixed"    // Ставка фиксируется при выдаче на весь срок
+	LoanRateFloating = "floating" // Ставка равна ключевой ставке плюс маржа и периодически пересматривается
+)
+
 // Loan представляет информацию о выданном кредите
 type Loan struct {
-	ID              string          `json:"id"`
-	UserID          string          `json:"user_id"`
-	AccountID       string          `json:"account_id"`
-	Amount          decimal.Decimal `json:"amount"`
-	InterestRate    decimal.Decimal `json:"interest_rate"`    // Процентная ставка
-	TermMonths      int             `json:"term_months"`      // Срок кредита в месяцах
-	StartDate       time.Time       `json:"start_date"`       // Дата выдачи кредита
-	PaymentSchedule []Payment       `json:"payment_schedule"` // График платежей
-	RemainingAmount decimal.Decimal `json:"remaining_amount"` // Оставшаяся сумма долга
+	ID                string          `json:"id"`
+	UserID            string          `json:"user_id"`
+	AccountID         string          `json:"account_id"`
+	ProductID         string          `json:"product_id,omitempty"` // Кредитный продукт; пусто у кредитов, выданных до появления продуктов
+	Amount            decimal.Decimal `json:"amount"`
+	Currency          string          `json:"currency"`                       // Валюта кредита, совпадает с валютой счета выдачи
+	InterestRate      decimal.Decimal `json:"interest_rate"`                  // Процентная ставка, действующая сейчас
+	RateType          string          `json:"rate_type"`                      // Вид ставки: fixed или floating
+	RateMargin        decimal.Decimal `json:"rate_margin"`                    // Надбавка к ключевой ставке, процентных пунктов
+	RateResetMonths   int             `json:"rate_reset_months,omitempty"`    // Период пересмотра плавающей ставки в месяцах
+	NextRateResetDate *time.Time      `json:"next_rate_reset_date,omitempty"` // Дата следующего пересмотра плавающей ставки
+	Amortization      string          `json:"amortization"`                   // Способ погашения: annuity или differentiated
+	PenaltyPercent    decimal.Decimal `json:"penalty_percent"`                // Штраф за просроченный платеж, % от платежа
+	PenaltyDueDays    int             `json:"penalty_due_days"`               // Срок оплаты штрафа в днях
+	TermMonths        int             `json:"term_months"`                    // Срок кредита в месяцах
+	StartDate         time.Time       `json:"start_date"`                     // Дата выдачи кредита
+	PaymentSchedule   []Payment       `json:"payment_schedule"`               // График платежей
+	RemainingAmount   decimal.Decimal `json:"remaining_amount"`               // Оставшаяся сумма долга
 }
 
 // Payment представляет информацию о платеже по кредиту
 type Payment struct {
+	ID            int64           `json:"-"` // Идентификатор строки графика платежей
 	DueDate       time.Time       `json:"due_date"`
 	Amount        decimal.Decimal `json:"amount"`
 	PrincipalPart decimal.Decimal `json:"principal_part"` // Часть платежа, идущая на погашение основного долга
 	InterestPart  decimal.Decimal `json:"interest_part"`  // Часть платежа, идущая на погашение процентов
 	Paid          bool            `json:"paid"`           // Флаг, указывающий, был ли платеж совершен
 }
+
+// Статусы заявки на кредит
+const (
+	LoanApplicationSubmitted    = "submitted"     // Заявка принята, скоринг еще не проведен
+	LoanApplicationScoring      = "scoring"       // Идет скоринг заявки
+	LoanApplicationManualReview = "manual_review" // Скоринг не принял решения, заявку рассматривает операционист
+	LoanApplicationApproved     = "approved"      // Кредит одобрен, но еще не выдан
+	LoanApplicationRejected     = "rejected"      // В кредите отказано; статус окончательный
+	LoanApplicationDisbursed    = "disbursed"     // Кредит выдан на счет заемщика; статус окончательный
+)
+
+// loanApplicationTransitions перечисляет допустимые переходы между статусами заявки на кредит
+var loanApplicationTransitions = map[string][]string{
+	LoanApplicationSubmitted:    {LoanApplicationScoring},
+	LoanApplicationScoring:      {LoanApplicationApproved, LoanApplicationRejected, LoanApplicationManualReview},
+	LoanApplicationManualReview: {LoanApplicationApproved, LoanApplicationRejected},
+	LoanApplicationApproved:     {LoanApplicationDisbursed},
+}
+
+// CanTransitionLoanApplication сообщает, допустим ли переход заявки на кредит из статуса from в статус to
+func CanTransitionLoanApplication(from, to string) bool {
+	for _, allowed := range loanApplicationTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Решения скоринга по заявке на кредит
+const (
+	ScoringDecisionApprove = "approve" // Кредит одобряется автоматически
+	ScoringDecisionReject  = "reject"  // В кредите отказывается автоматически
+	ScoringDecisionReview  = "review"  // Заявка передается на рассмотрение операционисту
+)
+
+// ScoringReason - причина решения скоринга с машиночитаемым кодом
+type ScoringReason struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ScoringResult содержит решение скоринга и сведения о заемщике, на которых оно основано
+// Суммы указаны в валюте кредита
+type ScoringResult struct {
+	Scorer              string          `json:"scorer"`                // Модель скоринга, принявшая решение
+	Decision            string          `json:"decision"`              // approve, reject или review
+	Reasons             []ScoringReason `json:"reasons"`               // Причины решения
+	MonthlyIncome       decimal.Decimal `json:"monthly_income"`        // Средний ежемесячный доход по поступлениям на счета
+	MonthlyDebtPayments decimal.Decimal `json:"monthly_debt_payments"` // Ежемесячные платежи по действующим кредитам
+	MonthlyPayment      decimal.Decimal `json:"monthly_payment"`       // Наибольший ежемесячный платеж по запрошенному кредиту
+	DebtToIncome        decimal.Decimal `json:"debt_to_income"`        // Доля платежей по всем кредитам в доходе, %
+	Balance             decimal.Decimal `json:"balance"`               // Доступный остаток на счетах заемщика
+	OverduePayments     int             `json:"overdue_payments"`      // Просроченные платежи по действующим кредитам
+	ScoredAt            time.Time       `json:"scored_at"`
+}
+
+// LoanApplication представляет заявку клиента на кредит по продукту
+// Заявка проходит скоринг и, если он не принял решения, рассмотрение операционистом;
+// одобренный кредит выдается на счет заемщика
+type LoanApplication struct {
+	ID            string          `json:"id"`
+	UserID        string          `json:"user_id"`
+	AccountID     string          `json:"account_id"` // Счет выдачи кредита
+	ProductID     string          `json:"product_id"`
+	Amount        decimal.Decimal `json:"amount"`
+	Currency      string          `json:"currency"`
+	TermMonths    int             `json:"term_months"`
+	Status        string          `json:"status"`
+	Scoring       *ScoringResult  `json:"scoring,omitempty"`        // Результат скоринга
+	ReviewerID    string          `json:"reviewer_id,omitempty"`    // Операционист, рассмотревший заявку
+	ReviewComment string          `json:"review_comment,omitempty"` // Комментарий операциониста
+	LoanID        string          `json:"loan_id,omitempty"`        // Выданный кредит
+	DisbursedBy   string          `json:"disbursed_by,omitempty"`   // Операционист, выдавший кредит; пусто при автоматической выдаче
+	CreatedAt     time.Time       `json:"created_at"`
+	UpdatedAt     time.Time       `json:"updated_at"`
+	DecidedAt     *time.Time      `json:"decided_at,omitempty"` // Время одобрения или отказа
+}
+
+// Posting объединяет транзакцию и ее проводки, которые проводятся атомарно
+type Posting struct {
+	Transaction Transaction    // Запись об операции, видимая в истории счета
+	Entries     []JournalEntry // Сбалансированные проводки по дебету и кредиту
+}
+
+// JournalEntry представляет одну проводку двойной записи в главной книге
+type JournalEntry struct {
+	ID            int64           `json:"id"`
+	TransactionID string          `json:"transaction_id"`
+	LedgerAccount string          `json:"ledger_account"` // ID клиентского счета или код системного счета
+	Debit         decimal.Decimal `json:"debit"`
+	Credit        decimal.Decimal `json:"credit"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// BalanceDiscrepancy описывает расхождение между сохраненным балансом счета и суммой его проводок
+type BalanceDiscrepancy struct {
+	AccountID     string          `json:"account_id"`
+	StoredBalance decimal.Decimal `json:"stored_balance"` // Баланс из таблицы accounts
+	LedgerBalance decimal.Decimal `json:"ledger_balance"` // Баланс, рассчитанный по проводкам
+}
+
+// IdempotencyRecord хранит отпечаток запроса с ключом идемпотентности и исходный ответ на него
+type IdempotencyRecord struct {
+	UserID       string    // Пользователь, отправивший запрос
+	Key          string    // Значение заголовка Idempotency-Key
+	Method       string    // HTTP-метод запроса
+	Path         string    // Путь запроса
+	Fingerprint  string    // SHA-256 от метода, пути и тела запроса
+	StatusCode   int       // HTTP-код исходного ответа
+	ResponseBody []byte    // Тело исходного ответа
+	Completed    bool      // Завершена ли обработка исходного запроса
+	CreatedAt    time.Time // Время первого запроса
+	ReservedAt   time.Time // Время резервирования ключа запросом, который его обрабатывает
+	ExpiresAt    time.Time // Время, после которого ключ удаляется и может быть использован заново
+}
+
+// RefreshToken хранит выданный токен обновления
+// Токены одной цепочки ротации объединены общим FamilyID
+type RefreshToken struct {
+	ID         string     // Уникальный идентификатор токена
+	UserID     string     // Владелец токена
+	FamilyID   string     // Цепочка ротации, начатая при входе в систему
+	TokenHash  string     // SHA-256 хеш токена; сам токен не хранится
+	ExpiresAt  time.Time  // Время истечения
+	CreatedAt  time.Time  // Время выдачи
+	RevokedAt  *time.Time // Время отзыва или ротации
+	ReplacedBy string     // ID токена, выданного взамен при ротации
+}
+
+// UserMFA хранит настройки двухфакторной аутентификации пользователя
+type UserMFA struct {
+	UserID      string     // Пользователь
+	Secret      string     // Секрет TOTP в base32
+	Enabled     bool       // Подтверждена ли настройка кодом из приложения
+	LastCounter int64      // Последний использованный временной шаг TOTP (защита от повтора кода)
+	CreatedAt   time.Time  // Время начала настройки
+	ConfirmedAt *time.Time // Время подтверждения
+	// Неверные коды второго фактора подряд и время, до которого проверка кодов заблокирована
+	FailedAttempts int
+	LockedUntil    *time.Time
+}
+
+// IsLocked сообщает, заблокирована ли проверка кодов второго фактора в момент now
+func (m UserMFA) IsLocked(now time.Time) bool {
+	return m.LockedUntil != nil && now.Before(*m.LockedUntil)
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+// UserFilter задает условия выборки пользователей для административного API
+type UserFilter struct {
+	Role     string // Точное совпадение роли
+	Username string // Подстрока имени пользователя (без учета регистра)
+}
+
+// TransactionFilter задает условия выборки транзакций для административного API
+type TransactionFilter struct {
+	AccountID       string    // Счет, являющийся источником или получателем
+	TransactionType string    // Тип транзакции
+	From            time.Time // Начало периода (включительно)
+	To              time.Time // Конец периода (не включительно)
+	Limit           int       // Максимальное количество записей (0 - без ограничения)
+}
+
+// LoanFilter задает условия выборки кредитов
+type LoanFilter struct {
+	UserID     string // Заемщик
+	AccountID  string // Счет выдачи кредита
+	ActiveOnly bool   // Только кредиты с непогашенным остатком
+}
+
+// DisputeFilter задает условия выборки споров по платежам
+type DisputeFilter struct {
+	AccountID string // Счет оспариваемого платежа
+	Status    string // Статус спора
+}
+
+// LoanApplicationFilter задает условия выборки заявок на кредит
+type LoanApplicationFilter struct {
+	UserID string // Заявитель
+	Status string // Статус заявки
+}
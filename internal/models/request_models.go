@@ -19,26 +19,37 @@ type LoginRequest struct {
 
 // CreateAccountRequest содержит данные для создания нового банковского счета
 type CreateAccountRequest struct {
-	UserID string `json:"user_id"`    // ID пользователя, для которого создается счет
+	UserID   string `json:"user_id"`  // ID пользователя, для которого создается счет
+	Type     string `json:"type"`     // Тип счета: current или savings; по умолчанию current
+	Currency string `json:"currency"` // Валюта счета (ISO 4217); по умолчанию RUB
 }
 
 // GenerateCardRequest содержит данные для выпуска новой банковской карты
 type GenerateCardRequest struct {
-	AccountID string `json:"account_id"` // ID счета, к которому будет привязана карта
+	AccountID      string `json:"account_id"`      // ID счета, к которому будет привязана карта
+	Product        string `json:"product"`         // Карточный продукт из CARD_BINS; по умолчанию debit
+	Type           string `json:"type"`            // Вид карты: physical (по умолчанию) или virtual
+	SingleUse      bool   `json:"single_use"`      // Только для виртуальной карты: закрыть после первого платежа
+	LockedMerchant string `json:"locked_merchant"` // Только для виртуальной карты: единственный допустимый получатель
 }
 
 // PaymentRequest содержит данные для совершения платежа по карте
 type PaymentRequest struct {
-	CardNumber string          `json:"card_number"` // Номер карты
-	Amount     decimal.Decimal `json:"amount"`      // Сумма платежа
-	Merchant   string          `json:"merchant"`    // Получатель платежа (магазин, сервис)
+	CardNumber       string          `json:"card_number"`       // Номер карты
+	ExpiryMonth      int             `json:"expiry_month"`      // Месяц окончания срока действия
+	ExpiryYear       int             `json:"expiry_year"`       // Год окончания срока действия
+	CVV              string          `json:"cvv"`               // Код безопасности
+	Amount           decimal.Decimal `json:"amount"`            // Сумма платежа
+	Merchant         string          `json:"merchant"`          // Получатель платежа (магазин, сервис)
+	MerchantCategory string          `json:"merchant_category"` // Категория получателя (например, gambling)
 }
 
 // TransferRequest содержит данные для перевода средств между счетами
 type TransferRequest struct {
 	FromAccountID string          `json:"from_account_id"` // Счет отправителя
 	ToAccountID   string          `json:"to_account_id"`   // Счет получателя
-	Amount        decimal.Decimal `json:"amount"`          // Сумма перевода
+	Amount        decimal.Decimal `json:"amount"`          // Сумма перевода в валюте счета отправителя
+	Exchange      bool            `json:"exchange"`        // Разрешить конвертацию, если валюты счетов различаются
 }
 
 // DepositRequest содержит данные для пополнения счета
@@ -47,10 +58,99 @@ type DepositRequest struct {
 	Amount      decimal.Decimal `json:"amount"`        // Сумма пополнения
 }
 
-// ApplyLoanRequest содержит данные для оформления кредита
+// ApplyLoanRequest содержит данные заявки на кредит
 type ApplyLoanRequest struct {
 	UserID     string          `json:"user_id"`      // ID заемщика
 	AccountID  string          `json:"account_id"`   // Счет для выдачи кредита
 	Amount     decimal.Decimal `json:"amount"`       // Сумма кредита
 	TermMonths int             `json:"term_months"`  // Срок кредита в месяцах
+	ProductID  string          `json:"product_id"`   // Кредитный продукт, определяющий ограничения и ставку
+}
+
+// SetRoleRequest содержит новую роль пользователя
+type SetRoleRequest struct {
+	Role string `json:"role"` // Роль: customer, operator или admin
+}
+
+// RefreshTokenRequest содержит токен обновления для получения новой пары токенов
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// LogoutRequest содержит параметры выхода из системы
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token,omitempty"` // Токен обновления текущей сессии
+	AllSessions  bool   `json:"all_sessions,omitempty"`  // Завершить все сессии пользователя
+}
+
+// OTPCodeRequest содержит код второго фактора: TOTP из приложения или код восстановления
+type OTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// LoginMFARequest содержит данные второго шага входа
+type LoginMFARequest struct {
+	MFAToken string `json:"mfa_token"` // Промежуточный токен, выданный после проверки пароля
+	Code     string `json:"code"`      // Код TOTP или код восстановления
+}
+
+// MerchantRuleRequest содержит правило ограничения платежей по получателю
+type MerchantRuleRequest struct {
+	List  string `json:"list"`  // Список: allow или deny
+	Kind  string `json:"kind"`  // Признак сопоставления: merchant или category
+	Value string `json:"value"` // Название или категория получателя
+}
+
+// CaptureHoldRequest содержит сумму списания по удержанию
+type CaptureHoldRequest struct {
+	Amount decimal.Decimal `json:"amount"` // Сумма списания; если не указана, списывается вся удержанная сумма
+}
+
+// RefundRequest содержит параметры возврата по платежу
+type RefundRequest struct {
+	Amount decimal.Decimal `json:"amount"` // Сумма возврата; если не указана, возвращается весь невозвращенный остаток
+	Reason string          `json:"reason"` // Причина возврата
+}
+
+// OpenDisputeRequest содержит параметры спора по платежу
+type OpenDisputeRequest struct {
+	Amount decimal.Decimal `json:"amount"` // Оспариваемая сумма; если не указана, оспаривается весь невозвращенный остаток
+	Reason string          `json:"reason"` // Описание претензии
+}
+
+// DisputeStatusRequest содержит новый статус спора и комментарий операциониста
+type DisputeStatusRequest struct {
+	Status     string `json:"status"`     // under_review, won или lost
+	Resolution string `json:"resolution"` // Комментарий к решению
+}
+
+// LoanProductRequest содержит условия кредитного продукта при его создании или изменении
+// Поля с нулевыми значениями заменяются значениями по умолчанию, описанными у LoanProduct
+type LoanProductRequest struct {
+	Name            string           `json:"name"`
+	Currency        string           `json:"currency"` // По умолчанию RUB
+	MinAmount       decimal.Decimal  `json:"min_amount"`
+	MaxAmount       decimal.Decimal  `json:"max_amount"`
+	MinTermMonths   int              `json:"min_term_months"`
+	MaxTermMonths   int              `json:"max_term_months"`
+	Pricing         string           `json:"pricing"`           // key_rate_margin (по умолчанию) или fixed_rate
+	RateMargin      decimal.Decimal  `json:"rate_margin"`       // Для key_rate_margin
+	FixedRate       decimal.Decimal  `json:"fixed_rate"`        // Для fixed_rate
+	RateType        string           `json:"rate_type"`         // fixed (по умолчанию) или floating
+	RateResetMonths int              `json:"rate_reset_months"` // Для floating; по умолчанию LOAN_RATE_RESET_MONTHS
+	PenaltyPercent  *decimal.Decimal `json:"penalty_percent"`   // По умолчанию 10
+	PenaltyDueDays  int              `json:"penalty_due_days"`  // По умолчанию 7
+	Amortization    string           `json:"amortization"`      // annuity (по умолчанию) или differentiated
+	Active          *bool            `json:"active"`            // По умолчанию true
+}
+
+// LoanDecisionRequest содержит решение операциониста по заявке на кредит, переданной на рассмотрение
+type LoanDecisionRequest struct {
+	Decision string `json:"decision"` // approve или reject
+	Comment  string `json:"comment"`  // Обоснование решения
+}
+
+// ExchangeRateRequest содержит курс валюты к рублю
+type ExchangeRateRequest struct {
+	Rate decimal.Decimal `json:"rate"` // Рублей за единицу валюты
 }
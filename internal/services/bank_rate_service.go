@@ -1,147 +1,212 @@
 package services
 
 import (
-	"bytes"
-	"encoding/xml"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
-	"regexp"
-	"strings"
+	"sort"
 	"sync"
 	"time"
 
-	"github.com/shopspring/decimal"
+	"bankapp/internal/config"
+	"bankapp/internal/models"
+	"bankapp/internal/storage"
 )
 
-const (
-	cbrURL      = "https://www.cbr.ru/DailyInfoWebServ/DailyInfo.asmx"
-	soapAction  = "http://web.cbr.ru/KeyRate"
-	soapRequest = `<?xml version="1.0" encoding="utf-8"?>
-<soap:Envelope xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
-  <soap:Body>
-    <KeyRate xmlns="http://web.cbr.ru/">
-      <fromDate>%s</fromDate>
-      <ToDate>%s</ToDate>
-    </KeyRate>
-  </soap:Body>
-</soap:Envelope>`
-)
+// keyRateLookbackDays - глубина периода, за который запрашивается ставка у провайдера
+// Банк России публикует ставку по рабочим дням, поэтому период должен перекрывать праздники
+const keyRateLookbackDays = 14
 
-// KeyRateResponse представляет XML-структуру ответа Центрального банка о ключевой ставке
-type KeyRateResponse struct {
-	XMLName xml.Name `xml:"Envelope"`
-	Body    struct {
-		XMLName      xml.Name `xml:"Body"`
-		KeyRateXML   string   `xml:"KeyRateResponse>KeyRateResult>diffgram>KeyRate"`
-		KeyRateTable struct {
-			XMLName xml.Name `xml:"KeyRate"`
-			Rates   []struct {
-				Date string  `xml:"DT"`
-				Rate float64 `xml:"Rate"`
-			} `xml:"KR"`
-		} `xml:"KeyRateResponse>KeyRateResult>diffgram>KeyRate"`
-	}
-}
+// keyRateCacheTTL - время, в течение которого полученная от провайдера ставка не запрашивается повторно
+const keyRateCacheTTL = time.Hour
 
-// Кэш для ключевой ставки, чтобы избежать частых внешних запросов
-var cachedKeyRate struct {
-	rate decimal.Decimal
-	time time.Time
+// ErrKeyRateUnavailable возвращается, если провайдер не вернул ставку,
+// а использование сохраненной ставки запрещено настройкой KEY_RATE_FALLBACK или она не найдена
+var ErrKeyRateUnavailable = errors.New("key rate unavailable")
+
+// RateProvider - источник ключевой ставки
+type RateProvider interface {
+	// KeyRates возвращает ставки, действовавшие в период [from, to]: ставку, действовавшую на from,
+	// с ее датой начала действия и все изменения до to включительно
+	KeyRates(from, to time.Time) ([]models.KeyRate, error)
 }
-var keyRateMutex sync.Mutex
-
-// FetchCentralBankRate получает текущую ключевую ставку из Центрального банка
-// Возвращает ставку в виде decimal.Decimal и ошибку, если запрос не удался
-func FetchCentralBankRate() (decimal.Decimal, error) {
-	// Блокируем мьютекс для безопасного доступа к кэшу
-	keyRateMutex.Lock()
-	defer keyRateMutex.Unlock()
-
-	// Проверяем, есть ли актуальное значение в кэше (не старше 1 часа)
-	if !cachedKeyRate.rate.IsZero() && time.Since(cachedKeyRate.time) < time.Hour {
-		log.Println("Используем кэшированное значение ключевой ставки")
-		return cachedKeyRate.rate, nil
+
+// NewRateProvider создает провайдер ключевой ставки, выбранный переменной KEY_RATE_PROVIDER
+func NewRateProvider() (RateProvider, error) {
+	switch name := config.GetKeyRateProvider(); name {
+	case config.KeyRateProviderCBR:
+		return &CBRRateProvider{client: newCBRClient()}, nil
+	case config.KeyRateProviderFile:
+		path := config.GetKeyRateFile()
+		if path == "" {
+			return nil, errors.New("KEY_RATE_FILE не задан")
+		}
+		return &FileRateProvider{Path: path}, nil
+	case config.KeyRateProviderManual:
+		rate, ok := config.GetKeyRateManual()
+		if !ok {
+			return nil, errors.New("KEY_RATE_MANUAL не задан или не является положительным числом")
+		}
+		return &ManualRateProvider{Rate: rate}, nil
+	default:
+		return nil, fmt.Errorf("неизвестный провайдер ключевой ставки %q", name)
 	}
+}
 
-	log.Println("Запрашиваем ключевую ставку из Центрального банка России")
+// cachedKeyRate - ставка, полученная от провайдера на дату, и время ее получения
+type cachedKeyRate struct {
+	date      time.Time
+	rate      models.KeyRate
+	fetchedAt time.Time
+}
 
-	// Для демонстрационных целей используем запасное значение, если запрос не удастся
-	fallbackRate := decimal.NewFromFloat(16.0)
+// KeyRateService определяет ключевую ставку на дату и хранит историю полученных ставок
+// Если провайдер недоступен, поведение задается KEY_RATE_FALLBACK: отказ или последняя сохраненная ставка
+type KeyRateService struct {
+	provider RateProvider // nil - провайдер создается по настройкам окружения при каждом запросе
+	history  storage.KeyRateRepository
 
-	// Пытаемся получить актуальную ставку из Центрального банка
-	rate, err := fetchKeyRateFromCBR()
-	if err != nil {
-		log.Printf("Не удалось получить ключевую ставку из ЦБ РФ: %v. Используем запасное значение: %s", err, fallbackRate.String())
+	mu    sync.Mutex
+	cache cachedKeyRate // Ставка на последнюю запрошенную у провайдера дату
+}
 
-		// Обновляем кэш запасным значением
-		cachedKeyRate.rate = fallbackRate
-		cachedKeyRate.time = time.Now()
+// NewKeyRateService создает сервис с провайдером, выбранным переменной KEY_RATE_PROVIDER
+func NewKeyRateService(history storage.KeyRateRepository) *KeyRateService {
+	return NewKeyRateServiceWithProvider(nil, history)
+}
 
-		return fallbackRate, nil
+// NewKeyRateServiceWithProvider создает сервис с заданным провайдером ключевой ставки
+func NewKeyRateServiceWithProvider(provider RateProvider, history storage.KeyRateRepository) *KeyRateService {
+	return &KeyRateService{
+		provider: provider,
+		history:  history,
 	}
+}
 
-	// Обновляем кэш актуальным значением
-	cachedKeyRate.rate = rate
-	cachedKeyRate.time = time.Now()
+// KeyRate возвращает ключевую ставку, действующую на дату date
+// Ставка на прошедшую дату берется из истории, если история покрывает эту дату; иначе,
+// как и ставка на текущую дату, она запрашивается у провайдера и сохраняется в историю
+// с датами начала действия
+// Возвращает ErrKeyRateUnavailable, если ставку определить не удалось
+func (s *KeyRateService) KeyRate(date time.Time) (models.KeyRate, error) {
+	date = RateDate(date)
+	day := date.Format("2006-01-02")
+
+	if date.Before(RateDate(time.Now())) {
+		if stored, ok := s.storedKeyRate(date); ok {
+			return stored, nil
+		}
+	}
 
-	log.Printf("Успешно получена ключевая ставка из ЦБ РФ: %s", rate.String())
-	return rate, nil
-}
+	s.mu.Lock()
+	cached := s.cache
+	s.mu.Unlock()
+	if cached.date.Equal(date) && time.Since(cached.fetchedAt) < keyRateCacheTTL {
+		return cached.rate, nil
+	}
 
-// fetchKeyRateFromCBR делает SOAP-запрос к Центральному банку России
-// для получения текущей ключевой ставки
-func fetchKeyRateFromCBR() (decimal.Decimal, error) {
-	// Устанавливаем диапазон дат для запроса (сегодня и вчера)
-	today := time.Now().Format("2006-01-02")
-	yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	rate, err := s.fetch(date)
+	if err == nil {
+		// Кешируется только ставка на последнюю запрошенную дату: ставки на прошедшие даты берутся из истории
+		s.mu.Lock()
+		if !date.Before(s.cache.date) {
+			s.cache = cachedKeyRate{date: date, rate: rate, fetchedAt: time.Now()}
+		}
+		s.mu.Unlock()
+		return rate, nil
+	}
 
-	// Форматируем SOAP-запрос
-	soapBody := fmt.Sprintf(soapRequest, yesterday, today)
+	if config.GetKeyRateFallback() != config.KeyRateFallbackLastStored {
+		log.Printf("Не удалось получить ключевую ставку на %s: %v. Использование сохраненной ставки отключено", day, err)
+		return models.KeyRate{}, fmt.Errorf("%w: %v", ErrKeyRateUnavailable, err)
+	}
 
-	// Создаем HTTP-запрос
-	req, err := http.NewRequest("POST", cbrURL, bytes.NewBufferString(soapBody))
-	if err != nil {
-		return decimal.Zero, fmt.Errorf("не удалось создать запрос: %w", err)
+	stored, ok := s.history.GetKeyRate(date)
+	if !ok {
+		log.Printf("Не удалось получить ключевую ставку на %s: %v. Сохраненной ставки нет", day, err)
+		return models.KeyRate{}, fmt.Errorf("%w: %v", ErrKeyRateUnavailable, err)
 	}
+	log.Printf("Не удалось получить ключевую ставку на %s: %v. Используем сохраненную ставку %s%% от %s",
+		day, err, stored.Rate.String(), stored.Date.Format("2006-01-02"))
+	return stored, nil
+}
 
-	// Устанавливаем заголовки
-	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
-	req.Header.Set("SOAPAction", soapAction)
+// storedKeyRate возвращает сохраненную ставку на прошедшую дату date, если история покрывает эту дату:
+// Банк России публикует ставку на каждый рабочий день, поэтому сохраненная ставка старше
+// keyRateLookbackDays означает пропуск в истории, и ставку нужно запросить у провайдера
+func (s *KeyRateService) storedKeyRate(date time.Time) (models.KeyRate, bool) {
+	stored, ok := s.history.GetKeyRate(date)
+	if !ok || stored.Date.Before(date.AddDate(0, 0, -keyRateLookbackDays)) {
+		return models.KeyRate{}, false
+	}
+	return stored, true
+}
 
-	// Отправляем запрос
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return decimal.Zero, fmt.Errorf("не удалось отправить запрос: %w", err)
+// fetch запрашивает ставки у провайдера, сохраняет их в историю и выбирает ставку, действующую на date
+func (s *KeyRateService) fetch(date time.Time) (models.KeyRate, error) {
+	provider := s.provider
+	if provider == nil {
+		var err error
+		if provider, err = NewRateProvider(); err != nil {
+			return models.KeyRate{}, err
+		}
 	}
-	defer resp.Body.Close()
 
-	// Читаем ответ
-	body, err := ioutil.ReadAll(resp.Body)
+	rates, err := provider.KeyRates(date.AddDate(0, 0, -keyRateLookbackDays), date)
 	if err != nil {
-		return decimal.Zero, fmt.Errorf("не удалось прочитать ответ: %w", err)
+		return models.KeyRate{}, err
+	}
+	rate, ok := SelectKeyRate(rates, date)
+	if !ok {
+		return models.KeyRate{}, fmt.Errorf("провайдер не вернул ставку на %s", date.Format("2006-01-02"))
 	}
 
-	// Используем регулярное выражение для извлечения ставки из XML
-	// Это более простой подход, чем полный парсинг сложного SOAP-ответа
-	re := regexp.MustCompile(`<Rate>([0-9,.]+)</Rate>`)
-	matches := re.FindAllStringSubmatch(string(body), -1)
+	// Ставку, заданную оператором вручную, не сохраняем: она не является историческим значением
+	if rate.Source != models.KeyRateSourceManual {
+		if err := s.history.SaveKeyRates(rates); err != nil {
+			log.Printf("Не удалось сохранить историю ключевой ставки: %v", err)
+		}
+	}
+	return rate, nil
+}
 
-	if len(matches) == 0 {
-		return decimal.Zero, fmt.Errorf("ключевая ставка не найдена в ответе")
+// SelectKeyRate выбирает из ставок последнюю с датой начала действия не позже date
+// Порядок ставок не важен: провайдеры могут возвращать их как по возрастанию, так и по убыванию дат
+func SelectKeyRate(rates []models.KeyRate, date time.Time) (models.KeyRate, bool) {
+	sorted := append([]models.KeyRate(nil), rates...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Date.Before(sorted[j].Date)
+	})
+
+	var found models.KeyRate
+	ok := false
+	for _, rate := range sorted {
+		if rate.Date.After(date) {
+			break
+		}
+		found, ok = rate, true
 	}
+	return found, ok
+}
+
+// keyRateParams - параметры метода KeyRate: период, за который запрашивается ключевая ставка
+const keyRateParams = `<fromDate>%s</fromDate>
+      <ToDate>%s</ToDate>`
+
+// CBRRateProvider получает ключевую ставку методом KeyRate веб-сервиса DailyInfo Банка России
+type CBRRateProvider struct {
+	client *cbrClient
+}
 
-	// Получаем самую последнюю ставку
-	rateStr := matches[len(matches)-1][1]
-	rateStr = strings.Replace(rateStr, ",", ".", -1) // Заменяем запятую на точку для парсинга десятичного числа
+// KeyRates запрашивает ставки за период [from, to]
+// Банк России возвращает ставку на каждый рабочий день периода
+func (p *CBRRateProvider) KeyRates(from, to time.Time) ([]models.KeyRate, error) {
+	log.Println("Запрашиваем ключевую ставку из Центрального банка России")
 
-	// Парсим ставку как decimal
-	rate, err := decimal.NewFromString(rateStr)
+	toDay := to.Format("2006-01-02")
+	body, err := p.client.call("KeyRate", fmt.Sprintf(keyRateParams, from.Format("2006-01-02"), toDay), toDay)
 	if err != nil {
-		return decimal.Zero, fmt.Errorf("не удалось распарсить ставку '%s': %w", rateStr, err)
+		return nil, err
 	}
-
-	return rate, nil
+	return decodeKeyRates(body, time.Now())
 }
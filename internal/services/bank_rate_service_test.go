@@ -0,0 +1,116 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/models"
+	"bankapp/internal/storage"
+)
+
+// countingRateProvider возвращает ставки из записанного ответа KeyRate и считает обращения
+type countingRateProvider struct {
+	rates []models.KeyRate
+	calls int
+}
+
+// KeyRates возвращает записанные ставки периода [from, to]
+func (p *countingRateProvider) KeyRates(from, to time.Time) ([]models.KeyRate, error) {
+	p.calls++
+	var rates []models.KeyRate
+	for _, rate := range p.rates {
+		if !rate.Date.Before(from) && !rate.Date.After(to) {
+			rates = append(rates, rate)
+		}
+	}
+	return rates, nil
+}
+
+// newCountingRateProvider создает провайдер со ставками из записанного ответа file
+func newCountingRateProvider(t *testing.T, file string) *countingRateProvider {
+	t.Helper()
+	rates, err := decodeKeyRates(readCBRTestdata(t, file), time.Now())
+	if err != nil {
+		t.Fatalf("decodeKeyRates: %v", err)
+	}
+	return &countingRateProvider{rates: rates}
+}
+
+func TestKeyRateOnPastDateFromHistory(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	provider := newCountingRateProvider(t, "KeyRate_2025-06-10.xml")
+	service := NewKeyRateServiceWithProvider(provider, store)
+
+	// Истории нет: ставка запрашивается у провайдера и сохраняется
+	rate, err := service.KeyRate(day(t, "2025-06-10"))
+	if err != nil {
+		t.Fatalf("KeyRate: %v", err)
+	}
+	if !rate.Rate.Equal(decimal.NewFromInt(20)) || provider.calls != 1 {
+		t.Fatalf("ставка %s, обращений к провайдеру %d", rate.Rate, provider.calls)
+	}
+
+	// Ставки на прошедшие даты, покрытые историей, берутся из нее без обращения к провайдеру
+	for _, tt := range []struct {
+		date string
+		want int64
+	}{
+		{"2025-06-10", 20},
+		{"2025-06-08", 21},
+		{"2025-06-02", 21},
+	} {
+		rate, err := service.KeyRate(day(t, tt.date))
+		if err != nil {
+			t.Fatalf("KeyRate(%s): %v", tt.date, err)
+		}
+		if !rate.Rate.Equal(decimal.NewFromInt(tt.want)) {
+			t.Errorf("KeyRate(%s) = %s, ожидалась %d", tt.date, rate.Rate, tt.want)
+		}
+	}
+	if provider.calls != 1 {
+		t.Errorf("для дат из истории провайдер вызван %d раз", provider.calls-1)
+	}
+
+	// Дата позже истории на срок больше глубины запроса - пропуск, ставка запрашивается у провайдера
+	if _, err := service.KeyRate(day(t, "2025-07-10")); err != nil {
+		t.Fatalf("KeyRate: %v", err)
+	}
+	if provider.calls != 2 {
+		t.Errorf("для даты вне истории провайдер вызван %d раз, ожидался 1", provider.calls-1)
+	}
+}
+
+func TestKeyRateCacheKeepsLatestDate(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	provider := &countingRateProvider{}
+	service := NewKeyRateServiceWithProvider(&ManualRateProvider{Rate: decimal.NewFromInt(16)}, store)
+
+	today := RateDate(time.Now())
+	for i := 30; i >= 0; i-- {
+		if _, err := service.KeyRate(today.AddDate(0, 0, -i)); err != nil {
+			t.Fatalf("KeyRate: %v", err)
+		}
+	}
+	if !service.cache.date.Equal(today) {
+		t.Errorf("в кеше ставка на %s, ожидалась на текущую дату", service.cache.date.Format("2006-01-02"))
+	}
+
+	// Запрос на прошедшую дату не вытесняет ставку на текущую дату
+	if _, err := service.KeyRate(today.AddDate(0, 0, -1)); err != nil {
+		t.Fatalf("KeyRate: %v", err)
+	}
+	if !service.cache.date.Equal(today) {
+		t.Errorf("ставка на текущую дату вытеснена ставкой на %s", service.cache.date.Format("2006-01-02"))
+	}
+
+	// Повторный запрос на текущую дату обслуживается из кеша
+	service.provider = provider
+	if _, err := service.KeyRate(today); err != nil {
+		t.Fatalf("KeyRate: %v", err)
+	}
+	if provider.calls != 0 {
+		t.Errorf("ставка на текущую дату запрошена повторно %d раз", provider.calls)
+	}
+}
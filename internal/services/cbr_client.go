@@ -0,0 +1,116 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"bankapp/internal/config"
+)
+
+// cbrNamespace - пространство имен методов веб-сервиса DailyInfo
+const cbrNamespace = "http://web.cbr.ru/"
+
+// soapEnvelope - шаблон SOAP-запроса: имя метода и его параметры в виде XML
+const soapEnvelope = `<?xml version="1.0" encoding="utf-8"?>
+<soap:Envelope xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body>
+    <%[1]s xmlns="` + cbrNamespace + `">
+      %[2]s
+    </%[1]s>
+  </soap:Body>
+</soap:Envelope>`
+
+// cbrClient выполняет SOAP-запросы к веб-сервису DailyInfo Банка России
+// Если задан каталог заглушек CBR_STUB_DIR, ответы читаются из файлов вместо обращения к сети
+type cbrClient struct {
+	url     string
+	stubDir string
+	http    *http.Client
+}
+
+// newCBRClient создает клиент по настройкам окружения
+func newCBRClient() *cbrClient {
+	return &cbrClient{
+		url:     config.GetCBRURL(),
+		stubDir: config.GetCBRStubDir(),
+		http:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// call вызывает метод веб-сервиса с параметрами params и возвращает тело ответа
+// stubKey выбирает файл заглушки <метод>_<stubKey>.xml; если его нет, используется <метод>.xml
+// Ответ с элементом soap:Fault возвращается как ошибка *SOAPFault
+func (c *cbrClient) call(method, params, stubKey string) ([]byte, error) {
+	var body []byte
+	var err error
+	status := http.StatusOK
+	if c.stubDir != "" {
+		body, err = c.readStub(method, stubKey)
+	} else {
+		body, status, err = c.post(method, params)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Веб-сервис сообщает об ошибках метода через soap:Fault со статусом 500, но статус не всегда ему соответствует
+	if fault := parseSOAPFault(body); fault != nil {
+		return nil, fmt.Errorf("метод %s веб-сервиса ЦБ РФ вернул ошибку: %w", method, fault)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("веб-сервис ЦБ РФ ответил статусом %d", status)
+	}
+	return body, nil
+}
+
+// post отправляет SOAP-запрос метода и возвращает тело и статус ответа
+func (c *cbrClient) post(method, params string) ([]byte, int, error) {
+
+	soapBody := fmt.Sprintf(soapEnvelope, method, params)
+	req, err := http.NewRequest("POST", c.url, bytes.NewBufferString(soapBody))
+	if err != nil {
+		return nil, 0, fmt.Errorf("не удалось создать запрос: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	req.Header.Set("SOAPAction", cbrNamespace+method)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("не удалось отправить запрос: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("не удалось прочитать ответ: %w", err)
+	}
+	return body, resp.StatusCode, nil
+}
+
+// readStub читает записанный ответ метода из каталога заглушек
+func (c *cbrClient) readStub(method, stubKey string) ([]byte, error) {
+	candidates := []string{filepath.Join(c.stubDir, method+".xml")}
+	if stubKey != "" {
+		candidates = append([]string{filepath.Join(c.stubDir, method+"_"+stubKey+".xml")}, candidates...)
+	}
+
+	for _, path := range candidates {
+		body, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("не удалось прочитать заглушку %s: %w", path, err)
+		}
+		log.Printf("Используем заглушку ответа ЦБ РФ %s", path)
+		return body, nil
+	}
+	return nil, fmt.Errorf("заглушка ответа метода %s не найдена в %s", method, c.stubDir)
+}
@@ -0,0 +1,189 @@
+package services
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/models"
+)
+
+// SOAPFault - ошибка, которую веб-сервис Банка России вернул в элементе soap:Fault
+// Возвращается вместо разбора ответа, даже если HTTP-статус ответа 200
+type SOAPFault struct {
+	Code   string // faultcode, например soap:Server
+	Reason string // faultstring
+}
+
+// Error возвращает описание ошибки веб-сервиса
+func (f *SOAPFault) Error() string {
+	return fmt.Sprintf("SOAP fault %s: %s", f.Code, f.Reason)
+}
+
+// soapFaultEnvelope представляет SOAP-ответ с ошибкой
+type soapFaultEnvelope struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Fault   *struct {
+		Code   string `xml:"faultcode"`
+		Reason string `xml:"faultstring"`
+	} `xml:"Body>Fault"`
+}
+
+// parseSOAPFault возвращает ошибку из элемента soap:Fault или nil, если ответ ее не содержит
+// Ответ, который не является SOAP-конвертом, тоже возвращает nil: его отклонит разбор ответа метода
+func parseSOAPFault(body []byte) *SOAPFault {
+	var envelope soapFaultEnvelope
+	if err := xml.Unmarshal(body, &envelope); err != nil || envelope.Fault == nil {
+		return nil
+	}
+	return &SOAPFault{
+		Code:   strings.TrimSpace(envelope.Fault.Code),
+		Reason: strings.TrimSpace(envelope.Fault.Reason),
+	}
+}
+
+// KeyRateResponse представляет XML-структуру ответа Центрального банка о ключевой ставке
+// Таблица KR передается в формате DataSet diffgram; порядок строк не гарантирован
+type KeyRateResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Body    struct {
+		XMLName      xml.Name `xml:"Body"`
+		KeyRateTable struct {
+			XMLName xml.Name `xml:"KeyRate"`
+			Rates   []struct {
+				Date string `xml:"DT"`   // Дата ставки в формате xs:dateTime
+				Rate string `xml:"Rate"` // Ставка, % годовых
+			} `xml:"KR"`
+		} `xml:"KeyRateResponse>KeyRateResult>diffgram>KeyRate"`
+	}
+}
+
+// cursOnDateResponse представляет ответ метода GetCursOnDate: таблицу ValuteData в формате diffgram
+type cursOnDateResponse struct {
+	XMLName xml.Name `xml:"Envelope"`
+	Data    struct {
+		OnDate string `xml:"OnDate,attr"` // Дата курсов в формате YYYYMMDD
+		Rows   []struct {
+			Name        string `xml:"Vname"`   // Наименование валюты, дополненное пробелами
+			Nominal     string `xml:"Vnom"`    // Номинал
+			Value       string `xml:"Vcurs"`   // Курс за номинал
+			NumericCode string `xml:"Vcode"`   // Цифровой код без ведущих нулей
+			Code        string `xml:"VchCode"` // Буквенный код
+		} `xml:"ValuteCursOnDate"`
+	} `xml:"Body>GetCursOnDateResponse>GetCursOnDateResult>diffgram>ValuteData"`
+}
+
+// decodeKeyRates разбирает ответ метода KeyRate в ставки с датами начала действия
+// Строки возвращаются в порядке ответа; выбор ставки на дату выполняет SelectKeyRate
+func decodeKeyRates(body []byte, fetchedAt time.Time) ([]models.KeyRate, error) {
+	var response KeyRateResponse
+	if err := xml.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("не удалось разобрать ответ KeyRate: %w", err)
+	}
+
+	rows := response.Body.KeyRateTable.Rates
+	if len(rows) == 0 {
+		return nil, errors.New("ключевая ставка не найдена в ответе")
+	}
+
+	rates := make([]models.KeyRate, 0, len(rows))
+	for _, row := range rows {
+		date, err := parseCBRDate(row.Date)
+		if err != nil {
+			return nil, fmt.Errorf("некорректная дата ставки: %w", err)
+		}
+		rate, err := parseCBRDecimal(row.Rate)
+		if err != nil || rate.IsNegative() {
+			return nil, fmt.Errorf("некорректная ставка %q на %s", row.Rate, date.Format("2006-01-02"))
+		}
+		rates = append(rates, models.KeyRate{
+			Date:      date,
+			Rate:      rate,
+			Source:    models.KeyRateSourceCBR,
+			FetchedAt: fetchedAt,
+		})
+	}
+	return rates, nil
+}
+
+// decodeCurrencyRates разбирает ответ метода GetCursOnDate в курсы на дату date
+// Курс за единицу валюты рассчитывается делением курса на номинал
+// Возвращает также дату курсов, указанную в ответе; нулевое значение - ответ ее не содержит
+func decodeCurrencyRates(body []byte, date, fetchedAt time.Time) ([]models.CurrencyRate, time.Time, error) {
+	var response cursOnDateResponse
+	if err := xml.Unmarshal(body, &response); err != nil {
+		return nil, time.Time{}, fmt.Errorf("не удалось разобрать ответ GetCursOnDate: %w", err)
+	}
+
+	day := date.Format("2006-01-02")
+	// Ответ на более позднюю дату означает, что он получен не на тот запрос
+	var onDate time.Time
+	if response.Data.OnDate != "" {
+		var err error
+		onDate, err = parseCBRDate(response.Data.OnDate)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("некорректная дата курсов: %w", err)
+		}
+		if onDate.After(date) {
+			return nil, time.Time{}, fmt.Errorf("курсы установлены на %s, запрошены на %s", onDate.Format("2006-01-02"), day)
+		}
+	}
+	if len(response.Data.Rows) == 0 {
+		return nil, time.Time{}, fmt.Errorf("%w: %s", ErrCurrencyRatesNotFound, day)
+	}
+
+	rates := make([]models.CurrencyRate, 0, len(response.Data.Rows))
+	for _, row := range response.Data.Rows {
+		code := strings.TrimSpace(row.Code)
+		nominal, err := parseCBRDecimal(row.Nominal)
+		if err != nil || !nominal.IsPositive() || !nominal.Equal(nominal.Truncate(0)) {
+			return nil, time.Time{}, fmt.Errorf("некорректный номинал %q валюты %s", row.Nominal, code)
+		}
+		value, err := parseCBRDecimal(row.Value)
+		if err != nil || !value.IsPositive() {
+			return nil, time.Time{}, fmt.Errorf("некорректный курс %q валюты %s", row.Value, code)
+		}
+		numericCode, err := strconv.Atoi(strings.TrimSpace(row.NumericCode))
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("некорректный цифровой код %q валюты %s", row.NumericCode, code)
+		}
+
+		rates = append(rates, models.CurrencyRate{
+			Date:        date,
+			Currency:    code,
+			NumericCode: fmt.Sprintf("%03d", numericCode),
+			Name:        strings.TrimSpace(row.Name),
+			Nominal:     int(nominal.IntPart()),
+			Value:       value,
+			Rate:        value.Div(nominal).Round(6),
+			FetchedAt:   fetchedAt,
+		})
+	}
+	return rates, onDate, nil
+}
+
+// cbrDateLayouts - форматы дат в ответах веб-сервиса: xs:dateTime с часовым поясом и без него,
+// а также атрибуты вида OnDate="20250115"
+var cbrDateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02", "20060102"}
+
+// parseCBRDate разбирает дату из ответа веб-сервиса
+// Возвращается календарная дата в часовом поясе ответа (московская дата для ЦБ РФ)
+func parseCBRDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range cbrDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return RateDate(t), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("неизвестный формат даты %q", value)
+}
+
+// parseCBRDecimal разбирает число из ответа веб-сервиса; запятая допускается как десятичный разделитель
+func parseCBRDecimal(value string) (decimal.Decimal, error) {
+	return decimal.NewFromString(strings.Replace(strings.TrimSpace(value), ",", ".", 1))
+}
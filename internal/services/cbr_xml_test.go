@@ -0,0 +1,257 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"text/tabwriter"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/models"
+)
+
+// update перезаписывает эталонные файлы testdata/cbr/golden результатом разбора записанных ответов:
+// go test ./internal/services -run Golden -update
+var update = flag.Bool("update", false, "перезаписать эталонные файлы testdata/cbr/golden")
+
+// cbrTestdata - каталог записанных ответов веб-сервиса ЦБ РФ
+const cbrTestdata = "testdata/cbr"
+
+// readCBRTestdata читает записанный ответ веб-сервиса
+func readCBRTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join(cbrTestdata, name))
+	if err != nil {
+		t.Fatalf("не удалось прочитать %s: %v", name, err)
+	}
+	return body
+}
+
+// checkGolden сравнивает результат с эталонным файлом или перезаписывает его с флагом -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join(cbrTestdata, "golden", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("не удалось записать %s: %v", path, err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("не удалось прочитать %s: %v", path, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("результат не совпадает с %s\nполучено:\n%s\nожидалось:\n%s", path, got, want)
+	}
+}
+
+// day возвращает календарную дату так же, как ее возвращает разбор ответов
+func day(t *testing.T, value string) time.Time {
+	t.Helper()
+	date, err := parseCBRDate(value)
+	if err != nil {
+		t.Fatalf("некорректная дата %q: %v", value, err)
+	}
+	return date
+}
+
+// formatKeyRates печатает ставки по возрастанию дат и ставку, действующую на дату date
+func formatKeyRates(rates []models.KeyRate, date time.Time) []byte {
+	sorted := append([]models.KeyRate(nil), rates...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Date.Before(sorted[j].Date)
+	})
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ДАТА\tСТАВКА\tИСТОЧНИК")
+	for _, rate := range sorted {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", rate.Date.Format("2006-01-02"), rate.Rate.StringFixed(2), rate.Source)
+	}
+	w.Flush()
+
+	if rate, ok := SelectKeyRate(rates, date); ok {
+		fmt.Fprintf(&buf, "Ставка на %s: %s%% (по данным на %s)\n",
+			date.Format("2006-01-02"), rate.Rate.StringFixed(2), rate.Date.Format("2006-01-02"))
+	} else {
+		fmt.Fprintf(&buf, "Ставка на %s не найдена\n", date.Format("2006-01-02"))
+	}
+	return buf.Bytes()
+}
+
+// formatCurrencyRates печатает курсы в порядке ответа
+func formatCurrencyRates(rates []models.CurrencyRate) []byte {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ВАЛЮТА\tКОД\tНОМИНАЛ\tКУРС\tЗА ЕДИНИЦУ\tНАИМЕНОВАНИЕ")
+	for _, rate := range rates {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", rate.Currency, rate.NumericCode, rate.Nominal,
+			rate.Value.StringFixed(4), rate.Rate.StringFixed(6), rate.Name)
+	}
+	w.Flush()
+	return buf.Bytes()
+}
+
+func TestDecodeKeyRatesGolden(t *testing.T) {
+	tests := []struct {
+		file   string
+		date   string
+		golden string
+	}{
+		// Строки по убыванию дат, как их возвращает веб-сервис
+		{"KeyRate.xml", "2025-10-16", "key-rate_2025-10-16.txt"},
+		// Изменение ставки внутри периода и выходные без строк
+		{"KeyRate_2025-06-10.xml", "2025-06-10", "key-rate_2025-06-10.txt"},
+		// Строки не по порядку, другие префиксы пространств имен diffgram и запятая в ставке
+		{"KeyRate_2024-07-28.xml", "2024-07-28", "key-rate_2024-07-28.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			fetchedAt := time.Now()
+			rates, err := decodeKeyRates(readCBRTestdata(t, tt.file), fetchedAt)
+			if err != nil {
+				t.Fatalf("decodeKeyRates: %v", err)
+			}
+			for _, rate := range rates {
+				if rate.Source != models.KeyRateSourceCBR || !rate.FetchedAt.Equal(fetchedAt) {
+					t.Errorf("ставка на %s: источник %q, получена %v", rate.Date.Format("2006-01-02"), rate.Source, rate.FetchedAt)
+				}
+			}
+			checkGolden(t, tt.golden, formatKeyRates(rates, day(t, tt.date)))
+		})
+	}
+}
+
+func TestDecodeCurrencyRatesGolden(t *testing.T) {
+	tests := []struct {
+		file   string
+		date   string
+		golden string
+	}{
+		{"GetCursOnDate.xml", "2025-10-17", "currency-rates_2025-10-17.txt"},
+		{"GetCursOnDate_2025-01-15.xml", "2025-01-15", "currency-rates_2025-01-15.txt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			date := day(t, tt.date)
+			rates, onDate, err := decodeCurrencyRates(readCBRTestdata(t, tt.file), date, time.Now())
+			if err != nil {
+				t.Fatalf("decodeCurrencyRates: %v", err)
+			}
+			if !onDate.Equal(date) {
+				t.Errorf("дата курсов в ответе %s, ожидалась %s", onDate.Format("2006-01-02"), tt.date)
+			}
+			for _, rate := range rates {
+				if !rate.Date.Equal(date) {
+					t.Errorf("курс %s на %s, ожидалось на %s", rate.Currency, rate.Date.Format("2006-01-02"), tt.date)
+				}
+			}
+			checkGolden(t, tt.golden, formatCurrencyRates(rates))
+		})
+	}
+}
+
+func TestDecodeCurrencyRatesRejectsLaterDate(t *testing.T) {
+	// Курсы на 17.10.2025 не могут быть ответом на запрос курсов на 15.01.2025
+	_, _, err := decodeCurrencyRates(readCBRTestdata(t, "GetCursOnDate.xml"), day(t, "2025-01-15"), time.Now())
+	if err == nil {
+		t.Fatal("ожидалась ошибка для ответа на более позднюю дату")
+	}
+}
+
+func TestDecodeRejectsMalformedResponse(t *testing.T) {
+	body := []byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`)
+	if _, err := decodeKeyRates(body, time.Now()); err == nil {
+		t.Error("decodeKeyRates: ожидалась ошибка для неполного ответа")
+	}
+	if _, _, err := decodeCurrencyRates(body, time.Now(), time.Now()); err == nil {
+		t.Error("decodeCurrencyRates: ожидалась ошибка для неполного ответа")
+	}
+}
+
+func TestSOAPFault(t *testing.T) {
+	fault := parseSOAPFault(readCBRTestdata(t, "KeyRate_2013-09-01.xml"))
+	if fault == nil {
+		t.Fatal("parseSOAPFault: ошибка веб-сервиса не найдена")
+	}
+	if fault.Code != "soap:Server" {
+		t.Errorf("faultcode = %q, ожидался soap:Server", fault.Code)
+	}
+	if !strings.Contains(fault.Reason, "13.09.2013") {
+		t.Errorf("faultstring = %q", fault.Reason)
+	}
+
+	// Обычные ответы ошибки не содержат
+	for _, file := range []string{"KeyRate.xml", "KeyRate_2024-07-28.xml", "GetCursOnDate.xml"} {
+		if fault := parseSOAPFault(readCBRTestdata(t, file)); fault != nil {
+			t.Errorf("%s: неожиданная ошибка %v", file, fault)
+		}
+	}
+
+	// Клиент возвращает ошибку веб-сервиса вместо тела ответа
+	client := &cbrClient{stubDir: cbrTestdata}
+	body, err := client.call("KeyRate", "", "2013-09-01")
+	var soapFault *SOAPFault
+	if !errors.As(err, &soapFault) || body != nil {
+		t.Fatalf("call: получено %v, ожидалась ошибка *SOAPFault", err)
+	}
+	if soapFault.Code != "soap:Server" {
+		t.Errorf("faultcode = %q, ожидался soap:Server", soapFault.Code)
+	}
+}
+
+func TestSelectKeyRate(t *testing.T) {
+	rates, err := decodeKeyRates(readCBRTestdata(t, "KeyRate_2025-06-10.xml"), time.Now())
+	if err != nil {
+		t.Fatalf("decodeKeyRates: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		date     string
+		wantOK   bool
+		wantDate string
+		wantRate string
+	}{
+		{"дата ставки", "2025-06-09", true, "2025-06-09", "20"},
+		{"последний день прежней ставки", "2025-06-06", true, "2025-06-06", "21"},
+		{"выходной день", "2025-06-08", true, "2025-06-06", "21"},
+		{"дата позже ответа", "2025-06-20", true, "2025-06-10", "20"},
+		{"первая строка ответа", "2025-05-27", true, "2025-05-27", "21"},
+		{"дата раньше ответа", "2025-05-26", false, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, ok := SelectKeyRate(rates, day(t, tt.date))
+			if ok != tt.wantOK {
+				t.Fatalf("SelectKeyRate(%s): ok = %v, ожидалось %v", tt.date, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if got := rate.Date.Format("2006-01-02"); got != tt.wantDate {
+				t.Errorf("SelectKeyRate(%s): ставка на %s, ожидалась на %s", tt.date, got, tt.wantDate)
+			}
+			if !rate.Rate.Equal(decimal.RequireFromString(tt.wantRate)) {
+				t.Errorf("SelectKeyRate(%s): ставка %s, ожидалась %s", tt.date, rate.Rate, tt.wantRate)
+			}
+		})
+	}
+
+	if _, ok := SelectKeyRate(nil, day(t, "2025-06-10")); ok {
+		t.Error("SelectKeyRate без ставок: ожидалось отсутствие ставки")
+	}
+}
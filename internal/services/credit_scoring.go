@@ -0,0 +1,250 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/config"
+	"bankapp/internal/models"
+	"bankapp/internal/storage"
+)
+
+// CreditScorer - модель скоринга, принимающая решение по заявке на кредит
+type CreditScorer interface {
+	// Name возвращает название модели, сохраняемое в результате скоринга
+	Name() string
+	// Decide возвращает решение approve, reject или review и его причины
+	Decide(data ScoringData) (string, []models.ScoringReason)
+}
+
+// ScoringData - сведения о заявке и заемщике, по которым модель скоринга принимает решение
+// Суммы указаны в валюте кредита: счета, поступления и кредиты в других валютах в доход,
+// остаток и платежи не входят, а просроченные платежи учитываются по всем кредитам
+type ScoringData struct {
+	Amount              decimal.Decimal // Сумма кредита
+	MonthlyIncome       decimal.Decimal // Средний ежемесячный доход за SCORING_INCOME_MONTHS месяцев
+	MonthlyDebtPayments decimal.Decimal // Ежемесячные платежи по действующим кредитам
+	MonthlyPayment      decimal.Decimal // Наибольший ежемесячный платеж по запрошенному кредиту
+	DebtToIncome        decimal.Decimal // Доля всех платежей с учетом нового кредита в доходе, %; 0 - дохода нет
+	Balance             decimal.Decimal // Доступный остаток на счетах заемщика
+	OverduePayments     int             // Просроченные неоплаченные платежи по действующим кредитам
+}
+
+// NewCreditScorer создает модель скоринга, выбранную переменной CREDIT_SCORER
+func NewCreditScorer() (CreditScorer, error) {
+	switch name := config.GetCreditScorer(); name {
+	case config.CreditScorerDTI:
+		approve, reject := config.GetScoringDTIApprove(), config.GetScoringDTIReject()
+		if approve.GreaterThan(reject) {
+			return nil, fmt.Errorf("порог одобрения SCORING_DTI_APPROVE (%s%%) больше порога отказа SCORING_DTI_REJECT (%s%%)",
+				approve.String(), reject.String())
+		}
+		return &DTIScorer{ApproveDTI: approve, RejectDTI: reject, ReviewAmount: config.GetScoringReviewAmount()}, nil
+	case config.CreditScorerManual:
+		return ManualReviewScorer{}, nil
+	default:
+		return nil, fmt.Errorf("неизвестная модель скоринга %q", name)
+	}
+}
+
+// DTIScorer принимает решение по отношению платежей по кредитам к доходу (debt-to-income)
+// Заявка отклоняется при просрочках, отсутствии дохода или DTI выше RejectDTI и одобряется при DTI
+// не выше ApproveDTI; пограничный DTI, сумма больше ReviewAmount и остаток на счетах меньше
+// ежемесячного платежа передают заявку операционисту
+type DTIScorer struct {
+	ApproveDTI   decimal.Decimal // Наибольший DTI для автоматического одобрения, %
+	RejectDTI    decimal.Decimal // DTI, выше которого в кредите отказывается, %
+	ReviewAmount decimal.Decimal // Сумма кредита, выше которой заявку всегда рассматривает операционист
+}
+
+// Name возвращает название модели
+func (s *DTIScorer) Name() string {
+	return config.CreditScorerDTI
+}
+
+// Decide принимает решение по заявке; отказ имеет приоритет над передачей на рассмотрение
+func (s *DTIScorer) Decide(data ScoringData) (string, []models.ScoringReason) {
+	var reasons []models.ScoringReason
+	reject, review := false, false
+
+	if data.OverduePayments > 0 {
+		reject = true
+		reasons = append(reasons, models.ScoringReason{Code: "overdue_payments",
+			Message: fmt.Sprintf("Borrower has %d overdue loan payments", data.OverduePayments)})
+	}
+
+	switch {
+	case !data.MonthlyIncome.IsPositive():
+		reject = true
+		reasons = append(reasons, models.ScoringReason{Code: "no_income",
+			Message: "No incoming payments to the borrower's accounts in the loan currency during the scoring period"})
+	case data.DebtToIncome.GreaterThan(s.RejectDTI):
+		reject = true
+		reasons = append(reasons, models.ScoringReason{Code: "dti_above_limit",
+			Message: fmt.Sprintf("Debt-to-income ratio %s%% exceeds %s%%", data.DebtToIncome.String(), s.RejectDTI.String())})
+	case data.DebtToIncome.GreaterThan(s.ApproveDTI):
+		review = true
+		reasons = append(reasons, models.ScoringReason{Code: "dti_borderline",
+			Message: fmt.Sprintf("Debt-to-income ratio %s%% is between %s%% and %s%%",
+				data.DebtToIncome.String(), s.ApproveDTI.String(), s.RejectDTI.String())})
+	}
+
+	if data.Amount.GreaterThan(s.ReviewAmount) {
+		review = true
+		reasons = append(reasons, models.ScoringReason{Code: "amount_requires_review",
+			Message: fmt.Sprintf("Loan amount exceeds %s and requires operator review", s.ReviewAmount.String())})
+	}
+	if data.Balance.LessThan(data.MonthlyPayment) {
+		review = true
+		reasons = append(reasons, models.ScoringReason{Code: "low_balance",
+			Message: fmt.Sprintf("Available balance %s does not cover a monthly payment of %s",
+				data.Balance.StringFixed(2), data.MonthlyPayment.StringFixed(2))})
+	}
+
+	switch {
+	case reject:
+		return models.ScoringDecisionReject, reasons
+	case review:
+		return models.ScoringDecisionReview, reasons
+	}
+	return models.ScoringDecisionApprove, []models.ScoringReason{{Code: "dti_within_limit",
+		Message: fmt.Sprintf("Debt-to-income ratio %s%% is within %s%%", data.DebtToIncome.String(), s.ApproveDTI.String())}}
+}
+
+// ManualReviewScorer передает операционисту каждую заявку; сведения о заемщике сохраняются
+// в результате скоринга, чтобы операционист принимал решение по ним
+type ManualReviewScorer struct{}
+
+// Name возвращает название модели
+func (ManualReviewScorer) Name() string {
+	return config.CreditScorerManual
+}
+
+// Decide передает заявку на рассмотрение
+func (ManualReviewScorer) Decide(data ScoringData) (string, []models.ScoringReason) {
+	return models.ScoringDecisionReview, []models.ScoringReason{{Code: "manual_review_required",
+		Message: "Every loan application is reviewed by an operator"}}
+}
+
+// CreditScoringService собирает сведения о заемщике по его счетам, поступлениям и действующим кредитам
+// и передает их модели скоринга
+type CreditScoringService struct {
+	scorer       CreditScorer // nil - модель создается по настройкам окружения при каждой заявке
+	accounts     storage.AccountRepository
+	transactions storage.TransactionRepository
+	loans        storage.LoanRepository
+}
+
+// NewCreditScoringService создает сервис с моделью скоринга, выбранной переменной CREDIT_SCORER
+func NewCreditScoringService(accounts storage.AccountRepository, transactions storage.TransactionRepository,
+	loans storage.LoanRepository) *CreditScoringService {
+	return NewCreditScoringServiceWithScorer(nil, accounts, transactions, loans)
+}
+
+// NewCreditScoringServiceWithScorer создает сервис с заданной моделью скоринга
+func NewCreditScoringServiceWithScorer(scorer CreditScorer, accounts storage.AccountRepository,
+	transactions storage.TransactionRepository, loans storage.LoanRepository) *CreditScoringService {
+	return &CreditScoringService{
+		scorer:       scorer,
+		accounts:     accounts,
+		transactions: transactions,
+		loans:        loans,
+	}
+}
+
+// Score оценивает заявку на кредит на момент now; quote - кредит, рассчитанный по заявке,
+// по графику которого определяется ежемесячный платеж
+func (s *CreditScoringService) Score(application models.LoanApplication, quote models.Loan, now time.Time) (models.ScoringResult, error) {
+	scorer := s.scorer
+	if scorer == nil {
+		var err error
+		if scorer, err = NewCreditScorer(); err != nil {
+			return models.ScoringResult{}, err
+		}
+	}
+
+	data := s.collect(application, quote, now)
+	decision, reasons := scorer.Decide(data)
+	return models.ScoringResult{
+		Scorer:              scorer.Name(),
+		Decision:            decision,
+		Reasons:             reasons,
+		MonthlyIncome:       data.MonthlyIncome,
+		MonthlyDebtPayments: data.MonthlyDebtPayments,
+		MonthlyPayment:      data.MonthlyPayment,
+		DebtToIncome:        data.DebtToIncome,
+		Balance:             data.Balance,
+		OverduePayments:     data.OverduePayments,
+		ScoredAt:            now,
+	}, nil
+}
+
+// collect собирает сведения о заемщике для скоринга заявки
+func (s *CreditScoringService) collect(application models.LoanApplication, quote models.Loan, now time.Time) ScoringData {
+	data := ScoringData{Amount: application.Amount}
+	for _, payment := range quote.PaymentSchedule {
+		if payment.Amount.GreaterThan(data.MonthlyPayment) {
+			data.MonthlyPayment = payment.Amount
+		}
+	}
+
+	accounts := s.accounts.GetUserAccounts(application.UserID)
+	own := make(map[string]bool, len(accounts))
+	for _, account := range accounts {
+		own[account.ID] = true
+	}
+
+	// Доход - поступления на счета заемщика от других лиц, кроме выдачи кредитов, возвратов платежей
+	// и входящих остатков
+	months := config.GetScoringIncomeMonths()
+	from := now.AddDate(0, -months, 0)
+	income := decimal.Zero
+	for _, account := range accounts {
+		if account.Currency != application.Currency {
+			continue
+		}
+		data.Balance = data.Balance.Add(account.Available())
+		for _, tx := range s.transactions.GetAccountTransactions(account.ID) {
+			if tx.ToAccountID != account.ID || own[tx.FromAccountID] || tx.Timestamp.Before(from) || !tx.Timestamp.Before(now) {
+				continue
+			}
+			switch tx.TransactionType {
+			case "loan_disbursement", models.TransactionTypeRefund, models.TransactionTypeChargeback,
+				models.TransactionTypeOpeningBalance:
+				continue
+			}
+			income = income.Add(tx.CreditedAmount())
+		}
+	}
+	data.MonthlyIncome = income.Div(decimal.NewFromInt(int64(months))).Round(2)
+
+	for _, loan := range s.loans.GetUserLoans(application.UserID) {
+		if !loan.RemainingAmount.IsPositive() {
+			continue
+		}
+		var next *models.Payment
+		for i, payment := range loan.PaymentSchedule {
+			if payment.Paid {
+				continue
+			}
+			if payment.DueDate.Before(now) {
+				data.OverduePayments++
+			}
+			// Штрафы не входят в ежемесячный платеж
+			if next == nil && payment.PrincipalPart.IsPositive() {
+				next = &loan.PaymentSchedule[i]
+			}
+		}
+		if next != nil && loan.Currency == application.Currency {
+			data.MonthlyDebtPayments = data.MonthlyDebtPayments.Add(next.Amount)
+		}
+	}
+
+	if data.MonthlyIncome.IsPositive() {
+		data.DebtToIncome = data.MonthlyDebtPayments.Add(data.MonthlyPayment).
+			Div(data.MonthlyIncome).Mul(decimal.NewFromInt(100)).Round(2)
+	}
+	return data
+}
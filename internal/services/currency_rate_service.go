@@ -0,0 +1,199 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"bankapp/internal/models"
+	"bankapp/internal/storage"
+)
+
+// currencyRateSyncInterval - период обновления официальных курсов валют
+// Банк России устанавливает курсы раз в рабочий день, частый опрос нужен лишь для быстрого получения новых курсов
+const currencyRateSyncInterval = 6 * time.Hour
+
+// cursOnDateParams - параметры метода GetCursOnDate: дата, на которую запрашиваются курсы
+const cursOnDateParams = `<On_date>%s</On_date>`
+
+// Ограничения запросов к Банку России по датам, курсов на которые нет в истории:
+// результат запроса на дату переиспользуется CurrencyRateFetchCooldown, а всего за это время
+// выполняется не более maxCurrencyRateFetches запросов
+const (
+	CurrencyRateFetchCooldown = time.Minute
+	maxCurrencyRateFetches    = 20
+)
+
+var (
+	// ErrCurrencyRatesNotFound возвращается, если Банк России не вернул курсов на запрошенную дату
+	ErrCurrencyRatesNotFound = errors.New("currency rates not found")
+	// ErrCurrencyRatesThrottled возвращается, если лимит запросов к Банку России исчерпан
+	ErrCurrencyRatesThrottled = errors.New("too many currency rate requests to the central bank")
+)
+
+// currencyRateFetch - запрос курсов на дату у Банка России; одновременные запросы на ту же дату ждут его результата
+type currencyRateFetch struct {
+	done      chan struct{}
+	startedAt time.Time
+	rates     []models.CurrencyRate
+	err       error
+}
+
+// CurrencyRateService получает официальные курсы валют Банка России и хранит их историю
+// Курсы валют, в которых открываются счета, также становятся курсами конвертации
+type CurrencyRateService struct {
+	history  storage.CurrencyRateRepository
+	exchange storage.ExchangeRateRepository
+	client   *cbrClient
+
+	mu      sync.Mutex
+	running bool
+
+	fetchMu sync.Mutex
+	fetches map[string]*currencyRateFetch // Запросы курсов по датам за последние CurrencyRateFetchCooldown
+}
+
+// NewCurrencyRateService создает сервис, сохраняющий историю курсов в history
+// и обновляющий курсы конвертации в exchange
+func NewCurrencyRateService(history storage.CurrencyRateRepository, exchange storage.ExchangeRateRepository) *CurrencyRateService {
+	return &CurrencyRateService{
+		history:  history,
+		exchange: exchange,
+		client:   newCBRClient(),
+		fetches:  make(map[string]*currencyRateFetch),
+	}
+}
+
+// RateDate возвращает календарную дату момента t, к которой привязываются курсы
+func RateDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Start запускает периодическое обновление курсов на текущую дату
+func (s *CurrencyRateService) Start() {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = true
+	s.mu.Unlock()
+
+	log.Println("Запуск планировщика обновления курсов валют")
+
+	go func() {
+		// Первое обновление выполняем в фоне, чтобы недоступность ЦБ РФ не задерживала запуск сервера
+		s.syncToday()
+
+		ticker := time.NewTicker(currencyRateSyncInterval)
+		for range ticker.C {
+			s.syncToday()
+		}
+	}()
+}
+
+// RatesOnDate возвращает официальные курсы на дату date
+// Курсы берутся из истории; если на эту дату их нет, они запрашиваются у Банка России и сохраняются
+// Возвращает ErrCurrencyRatesNotFound, если Банк России не установил курсов на эту дату,
+// и ErrCurrencyRatesThrottled, если лимит запросов к Банку России исчерпан
+func (s *CurrencyRateService) RatesOnDate(date time.Time) ([]models.CurrencyRate, error) {
+	date = RateDate(date)
+
+	rates, err := s.history.GetCurrencyRates(date)
+	if err != nil {
+		return nil, err
+	}
+	if len(rates) > 0 {
+		return rates, nil
+	}
+
+	return s.fetchLimited(date)
+}
+
+// fetchLimited запрашивает курсы на дату date у Банка России с ограничением частоты:
+// курсы на дату запрашиваются не чаще раза в CurrencyRateFetchCooldown, а всего за это время
+// выполняется не более maxCurrencyRateFetches запросов
+func (s *CurrencyRateService) fetchLimited(date time.Time) ([]models.CurrencyRate, error) {
+	day := date.Format("2006-01-02")
+	now := time.Now()
+
+	s.fetchMu.Lock()
+	for key, fetch := range s.fetches {
+		if now.Sub(fetch.startedAt) >= CurrencyRateFetchCooldown {
+			delete(s.fetches, key)
+		}
+	}
+	fetch, ok := s.fetches[day]
+	if !ok {
+		if len(s.fetches) >= maxCurrencyRateFetches {
+			s.fetchMu.Unlock()
+			return nil, ErrCurrencyRatesThrottled
+		}
+		fetch = &currencyRateFetch{done: make(chan struct{}), startedAt: now}
+		s.fetches[day] = fetch
+	}
+	s.fetchMu.Unlock()
+
+	if !ok {
+		fetch.rates, fetch.err = s.fetchAndStore(date)
+		close(fetch.done)
+	}
+	<-fetch.done
+	return fetch.rates, fetch.err
+}
+
+// syncToday обновляет курсы на текущую дату и курсы конвертации валют счетов
+func (s *CurrencyRateService) syncToday() {
+	now := time.Now()
+	rates, err := s.fetchAndStore(RateDate(now))
+	if err != nil {
+		log.Printf("Не удалось обновить курсы валют ЦБ РФ: %v", err)
+		return
+	}
+
+	updated := 0
+	for _, rate := range rates {
+		if rate.Currency == models.CurrencyRUB || !models.IsSupportedCurrency(rate.Currency) {
+			continue
+		}
+		exchangeRate := models.ExchangeRate{Currency: rate.Currency, Rate: rate.Rate, UpdatedAt: now}
+		if err := s.exchange.SetExchangeRate(exchangeRate); err != nil {
+			log.Printf("Не удалось обновить курс конвертации %s: %v", rate.Currency, err)
+			continue
+		}
+		updated++
+	}
+	log.Printf("Курсы валют ЦБ РФ обновлены: получено %d, курсов конвертации обновлено %d", len(rates), updated)
+}
+
+// fetchAndStore запрашивает курсы на дату date у Банка России и сохраняет их в историю
+// Сохраняются только курсы, которые Банк России указал на саму дату date и которые уже не изменятся:
+// курсы на будущую дату до их установки совпадают с текущими, а курсы из ответа на другую дату
+// не должны закрепляться в истории за запрошенной датой
+func (s *CurrencyRateService) fetchAndStore(date time.Time) ([]models.CurrencyRate, error) {
+	rates, onDate, err := fetchCursOnDate(s.client, date)
+	if err != nil {
+		return nil, err
+	}
+	if !onDate.Equal(date) || date.After(RateDate(time.Now())) {
+		log.Printf("Курсы валют на %s не сохранены в историю: ответ ЦБ РФ на %s",
+			date.Format("2006-01-02"), onDate.Format("2006-01-02"))
+		return rates, nil
+	}
+	if err := s.history.SaveCurrencyRates(rates); err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+// fetchCursOnDate вызывает метод GetCursOnDate и разбирает таблицу курсов
+func fetchCursOnDate(client *cbrClient, date time.Time) ([]models.CurrencyRate, time.Time, error) {
+	day := date.Format("2006-01-02")
+	body, err := client.call("GetCursOnDate", fmt.Sprintf(cursOnDateParams, day), day)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return decodeCurrencyRates(body, date, time.Now())
+}
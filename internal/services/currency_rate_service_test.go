@@ -0,0 +1,194 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/models"
+	"bankapp/internal/storage"
+)
+
+// decodeCurrencyRatesFile разбирает записанный ответ GetCursOnDate в курсы на дату date
+func decodeCurrencyRatesFile(t *testing.T, name string, date time.Time) ([]models.CurrencyRate, error) {
+	t.Helper()
+	rates, _, err := decodeCurrencyRates(readCBRTestdata(t, name), date, time.Now())
+	return rates, err
+}
+
+// findCurrencyRate возвращает курс валюты currency из списка курсов
+func findCurrencyRate(t *testing.T, rates []models.CurrencyRate, currency string) models.CurrencyRate {
+	t.Helper()
+	for _, rate := range rates {
+		if rate.Currency == currency {
+			return rate
+		}
+	}
+	t.Fatalf("курс %s не найден среди %d курсов", currency, len(rates))
+	return models.CurrencyRate{}
+}
+
+func TestCurrencyRatesOnPastDate(t *testing.T) {
+	t.Setenv("CBR_STUB_DIR", cbrTestdata)
+	store := storage.NewMemoryStorage()
+	service := NewCurrencyRateService(store, store)
+	date := day(t, "2025-01-15")
+
+	rates, err := service.RatesOnDate(date)
+	if err != nil {
+		t.Fatalf("RatesOnDate: %v", err)
+	}
+	if len(rates) != 8 {
+		t.Fatalf("получено %d курсов, ожидалось 8", len(rates))
+	}
+
+	// Полученные курсы сохраняются в историю на запрошенную дату
+	stored, err := store.GetCurrencyRates(date)
+	if err != nil {
+		t.Fatalf("GetCurrencyRates: %v", err)
+	}
+	if len(stored) != len(rates) {
+		t.Fatalf("в истории %d курсов, ожидалось %d", len(stored), len(rates))
+	}
+	usd := findCurrencyRate(t, stored, "USD")
+	if !usd.Date.Equal(date) || usd.NumericCode != "840" || usd.Nominal != 1 || !usd.Rate.Equal(decimal.RequireFromString("102.8076")) {
+		t.Errorf("курс USD в истории: %+v", usd)
+	}
+	jpy := findCurrencyRate(t, stored, "JPY")
+	if jpy.Nominal != 100 || !jpy.Rate.Equal(jpy.Value.Div(decimal.NewFromInt(100))) {
+		t.Errorf("курс JPY за единицу рассчитан неверно: %+v", jpy)
+	}
+
+	// Повторный запрос обслуживается из истории без обращения к Банку России
+	t.Setenv("CBR_STUB_DIR", t.TempDir())
+	service = NewCurrencyRateService(store, store)
+	again, err := service.RatesOnDate(date)
+	if err != nil {
+		t.Fatalf("RatesOnDate из истории: %v", err)
+	}
+	if len(again) != len(rates) {
+		t.Errorf("из истории получено %d курсов, ожидалось %d", len(again), len(rates))
+	}
+}
+
+func TestCurrencyRatesRejectedResponseNotStored(t *testing.T) {
+	t.Setenv("CBR_STUB_DIR", cbrTestdata)
+	store := storage.NewMemoryStorage()
+	service := NewCurrencyRateService(store, store)
+	// Для этой даты записанного ответа нет, а общий ответ содержит курсы на 17.10.2025
+	date := day(t, "2025-01-14")
+
+	if _, err := service.RatesOnDate(date); err == nil {
+		t.Fatal("ожидалась ошибка для ответа на более позднюю дату")
+	}
+	stored, err := store.GetCurrencyRates(date)
+	if err != nil {
+		t.Fatalf("GetCurrencyRates: %v", err)
+	}
+	if len(stored) != 0 {
+		t.Errorf("в историю сохранено %d курсов отклоненного ответа", len(stored))
+	}
+}
+
+func TestCurrencyRatesForOtherDateNotStored(t *testing.T) {
+	t.Setenv("CBR_STUB_DIR", cbrTestdata)
+	store := storage.NewMemoryStorage()
+	service := NewCurrencyRateService(store, store)
+
+	// Для этих дат записанного ответа нет, а общий ответ содержит курсы на 17.10.2025:
+	// они действуют на запрошенную дату, но закреплять их в истории за ней нельзя
+	tomorrow := RateDate(time.Now()).AddDate(0, 0, 1)
+	for _, date := range []time.Time{day(t, "2025-10-20"), tomorrow} {
+		rates, err := service.RatesOnDate(date)
+		if err != nil {
+			t.Fatalf("RatesOnDate(%s): %v", date.Format("2006-01-02"), err)
+		}
+		if len(rates) != 8 {
+			t.Errorf("на %s получено %d курсов, ожидалось 8", date.Format("2006-01-02"), len(rates))
+		}
+		stored, err := store.GetCurrencyRates(date)
+		if err != nil {
+			t.Fatalf("GetCurrencyRates: %v", err)
+		}
+		if len(stored) != 0 {
+			t.Errorf("в историю на %s сохранено %d курсов из ответа на другую дату", date.Format("2006-01-02"), len(stored))
+		}
+	}
+}
+
+func TestCurrencyRatesFetchLimited(t *testing.T) {
+	t.Setenv("CBR_STUB_DIR", cbrTestdata)
+	store := storage.NewMemoryStorage()
+	service := NewCurrencyRateService(store, store)
+
+	first := day(t, "2025-10-20")
+	if _, err := service.RatesOnDate(first); err != nil {
+		t.Fatalf("RatesOnDate: %v", err)
+	}
+
+	// Повторный запрос на ту же дату получает прежний результат без обращения к Банку России
+	service.client.stubDir = t.TempDir()
+	if rates, err := service.RatesOnDate(first); err != nil || len(rates) != 8 {
+		t.Fatalf("повторный запрос: получено %d курсов, ошибка %v", len(rates), err)
+	}
+
+	// Запросы на другие даты ограничены общим лимитом
+	service.client.stubDir = cbrTestdata
+	for i := 1; i < maxCurrencyRateFetches; i++ {
+		if _, err := service.RatesOnDate(first.AddDate(0, 0, i)); err != nil {
+			t.Fatalf("запрос %d: %v", i+1, err)
+		}
+	}
+	_, err := service.RatesOnDate(first.AddDate(0, 0, maxCurrencyRateFetches))
+	if !errors.Is(err, ErrCurrencyRatesThrottled) {
+		t.Fatalf("сверх лимита получено %v, ожидалась ErrCurrencyRatesThrottled", err)
+	}
+
+	// Курсы из истории лимитом не ограничены
+	if _, err := service.RatesOnDate(day(t, "2025-01-15")); !errors.Is(err, ErrCurrencyRatesThrottled) {
+		t.Fatalf("курсов на 15.01.2025 нет в истории, получено %v", err)
+	}
+	rates, err := decodeCurrencyRatesFile(t, "GetCursOnDate_2025-01-15.xml", day(t, "2025-01-15"))
+	if err != nil {
+		t.Fatalf("decodeCurrencyRates: %v", err)
+	}
+	if err := store.SaveCurrencyRates(rates); err != nil {
+		t.Fatalf("SaveCurrencyRates: %v", err)
+	}
+	if _, err := service.RatesOnDate(day(t, "2025-01-15")); err != nil {
+		t.Errorf("курсы из истории: %v", err)
+	}
+}
+
+func TestCurrencyRateSyncUpdatesExchangeRates(t *testing.T) {
+	t.Setenv("CBR_STUB_DIR", cbrTestdata)
+	store := storage.NewMemoryStorage()
+	service := NewCurrencyRateService(store, store)
+
+	// Общий ответ содержит курсы на 17.10.2025: они действуют и на текущую дату, пока ЦБ РФ не установит новые,
+	// но в историю на текущую дату не сохраняются
+	today := RateDate(time.Now())
+	service.syncToday()
+
+	stored, err := store.GetCurrencyRates(today)
+	if err != nil {
+		t.Fatalf("GetCurrencyRates: %v", err)
+	}
+	if len(stored) != 0 {
+		t.Errorf("в историю на текущую дату сохранено %d курсов из ответа на 17.10.2025", len(stored))
+	}
+
+	rates, err := decodeCurrencyRatesFile(t, "GetCursOnDate.xml", today)
+	if err != nil {
+		t.Fatalf("decodeCurrencyRates: %v", err)
+	}
+	rate, ok := store.GetExchangeRate("USD")
+	if !ok {
+		t.Fatal("курс конвертации USD не установлен")
+	}
+	if want := findCurrencyRate(t, rates, "USD").Rate; !rate.Rate.Equal(want) {
+		t.Errorf("курс конвертации USD = %s, ожидался %s", rate.Rate, want)
+	}
+}
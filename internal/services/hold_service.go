@@ -0,0 +1,60 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+// holdExpiryInterval - период проверки истекших удержаний по картам
+const holdExpiryInterval = 15 * time.Minute
+
+// HoldExpiryScheduler периодически снимает удержания по картам, не списанные до истечения срока
+type HoldExpiryScheduler struct {
+	holds storage.HoldRepository
+
+	mu      sync.Mutex
+	running bool
+}
+
+// NewHoldExpiryScheduler создает планировщик, работающий с переданным репозиторием удержаний
+func NewHoldExpiryScheduler(holds storage.HoldRepository) *HoldExpiryScheduler {
+	return &HoldExpiryScheduler{holds: holds}
+}
+
+// Start запускает планировщик снятия истекших удержаний
+func (s *HoldExpiryScheduler) Start() {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = true
+	s.mu.Unlock()
+
+	log.Println("Запуск планировщика снятия удержаний")
+
+	// Запускаем сразу при старте
+	s.expireHolds()
+
+	ticker := time.NewTicker(holdExpiryInterval)
+	go func() {
+		for range ticker.C {
+			s.expireHolds()
+		}
+	}()
+}
+
+// expireHolds снимает удержания с истекшим сроком и возвращает суммы в доступный баланс
+func (s *HoldExpiryScheduler) expireHolds() {
+	count, err := s.holds.ExpireHolds(time.Now())
+	if err != nil {
+		log.Printf("Ошибка при снятии истекших удержаний: %v", err)
+		return
+	}
+	if count > 0 {
+		log.Printf("Снято истекших удержаний: %d", count)
+	}
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"bankapp/internal/storage"
+)
+
+// idempotencyPurgeInterval - период удаления истекших ключей идемпотентности
+const idempotencyPurgeInterval = time.Hour
+
+// IdempotencyKeyScheduler периодически удаляет ключи идемпотентности с истекшим сроком хранения
+type IdempotencyKeyScheduler struct {
+	keys storage.IdempotencyRepository
+
+	mu      sync.Mutex
+	running bool
+}
+
+// NewIdempotencyKeyScheduler создает планировщик, работающий с переданным репозиторием ключей идемпотентности
+func NewIdempotencyKeyScheduler(keys storage.IdempotencyRepository) *IdempotencyKeyScheduler {
+	return &IdempotencyKeyScheduler{keys: keys}
+}
+
+// Start запускает планировщик удаления истекших ключей идемпотентности
+func (s *IdempotencyKeyScheduler) Start() {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
+		return
+	}
+	s.running = true
+	s.mu.Unlock()
+
+	log.Println("Запуск планировщика удаления ключей идемпотентности")
+
+	// Запускаем сразу при старте
+	s.purgeExpiredKeys()
+
+	ticker := time.NewTicker(idempotencyPurgeInterval)
+	go func() {
+		for range ticker.C {
+			s.purgeExpiredKeys()
+		}
+	}()
+}
+
+// purgeExpiredKeys удаляет ключи идемпотентности с истекшим сроком хранения
+func (s *IdempotencyKeyScheduler) purgeExpiredKeys() {
+	count, err := s.keys.PurgeExpiredIdempotencyKeys(time.Now())
+	if err != nil {
+		log.Printf("Ошибка при удалении истекших ключей идемпотентности: %v", err)
+		return
+	}
+	if count > 0 {
+		log.Printf("Удалено истекших ключей идемпотентности: %d", count)
+	}
+}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/models"
+)
+
+// keyRateFileEntry - запись файла истории ключевой ставки
+type keyRateFileEntry struct {
+	Date string          `json:"date"` // Дата начала действия ставки в формате YYYY-MM-DD
+	Rate decimal.Decimal `json:"rate"` // Ставка, % годовых
+}
+
+// FileRateProvider читает историю ключевой ставки из JSON-файла вида
+// [{"date": "2025-06-09", "rate": "20"}, ...]
+// Файл читается при каждом запросе, поэтому его можно обновлять без перезапуска сервера
+type FileRateProvider struct {
+	Path string
+}
+
+// KeyRates возвращает ставку, действовавшую на from, и изменения ставки до to включительно
+func (p *FileRateProvider) KeyRates(from, to time.Time) ([]models.KeyRate, error) {
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать файл ключевой ставки: %w", err)
+	}
+	var entries []keyRateFileEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("не удалось разобрать файл ключевой ставки %s: %w", p.Path, err)
+	}
+
+	fetchedAt := time.Now()
+	all := make([]models.KeyRate, 0, len(entries))
+	for _, entry := range entries {
+		date, err := time.Parse("2006-01-02", entry.Date)
+		if err != nil {
+			return nil, fmt.Errorf("некорректная дата %q в файле ключевой ставки: %w", entry.Date, err)
+		}
+		if entry.Rate.IsNegative() {
+			return nil, fmt.Errorf("отрицательная ставка на %s в файле ключевой ставки", entry.Date)
+		}
+		all = append(all, models.KeyRate{Date: date, Rate: entry.Rate, Source: models.KeyRateSourceFile, FetchedAt: fetchedAt})
+	}
+
+	var rates []models.KeyRate
+	if current, ok := SelectKeyRate(all, from); ok {
+		rates = append(rates, current)
+	}
+	for _, rate := range all {
+		if rate.Date.After(from) && !rate.Date.After(to) {
+			rates = append(rates, rate)
+		}
+	}
+	return rates, nil
+}
+
+// ManualRateProvider возвращает ставку, заданную оператором, независимо от даты
+// Используется, когда внешние источники недоступны или ставку нужно зафиксировать
+type ManualRateProvider struct {
+	Rate decimal.Decimal
+}
+
+// KeyRates возвращает заданную ставку как действующую на дату to
+func (p *ManualRateProvider) KeyRates(from, to time.Time) ([]models.KeyRate, error) {
+	return []models.KeyRate{{
+		Date:      RateDate(to),
+		Rate:      p.Rate,
+		Source:    models.KeyRateSourceManual,
+		FetchedAt: time.Now(),
+	}}, nil
+}
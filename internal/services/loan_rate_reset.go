@@ -0,0 +1,131 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"bankapp/internal/config"
+	"bankapp/internal/models"
+	"bankapp/pkg/utils"
+)
+
+// resetFloatingRates пересматривает ставки по кредитам с плавающей ставкой, у которых наступила дата пересмотра
+// Если ключевая ставка недоступна, пересмотр откладывается до следующего запуска планировщика
+func (s *PaymentScheduler) resetFloatingRates() {
+	now := time.Now()
+	for _, loan := range s.loans.GetAllLoans(models.LoanFilter{ActiveOnly: true}) {
+		if loan.RateType != models.LoanRateFloating || loan.NextRateResetDate == nil || loan.NextRateResetDate.After(now) {
+			continue
+		}
+		if err := s.resetLoanRate(loan, now); err != nil {
+			log.Printf("Не удалось пересмотреть ставку по кредиту %s: %v", loan.ID, err)
+		}
+	}
+}
+
+// resetLoanRate устанавливает ставку кредита равной ключевой ставке на дату пересмотра плюс маржа,
+// перестраивает оставшийся график платежей и уведомляет заемщика о новом платеже
+func (s *PaymentScheduler) resetLoanRate(loan models.Loan, now time.Time) error {
+	period := loan.RateResetMonths
+	if period <= 0 {
+		period = config.GetLoanRateResetMonths()
+	}
+
+	// Если планировщик не работал несколько периодов, применяется ставка на последнюю наступившую дату пересмотра
+	resetDate := *loan.NextRateResetDate
+	for next := resetDate.AddDate(0, period, 0); !next.After(now); next = next.AddDate(0, period, 0) {
+		resetDate = next
+	}
+
+	keyRate, err := s.keyRates.KeyRate(resetDate)
+	if err != nil {
+		return err
+	}
+
+	oldRate := loan.InterestRate
+	newRate := keyRate.Rate.Add(loan.RateMargin)
+	nextReset := resetDate.AddDate(0, period, 0)
+	loan.NextRateResetDate = &nextReset
+
+	if newRate.Equal(oldRate) {
+		if err := s.loans.UpdateLoan(loan); err != nil {
+			return err
+		}
+		log.Printf("Ставка по кредиту %s не изменилась (%s%%), следующий пересмотр %s",
+			loan.ID, oldRate.String(), nextReset.Format("2006-01-02"))
+		return nil
+	}
+
+	loan.InterestRate = newRate
+	schedule, next, ok := rescheduleLoan(loan, resetDate)
+	loan.PaymentSchedule = schedule
+	if err := s.loans.UpdateLoan(loan); err != nil {
+		return err
+	}
+
+	log.Printf("Ставка по кредиту %s пересмотрена: %s%% -> %s%% (ключевая ставка %s%% от %s), следующий пересмотр %s",
+		loan.ID, oldRate.String(), newRate.String(), keyRate.Rate.String(), keyRate.Date.Format("2006-01-02"),
+		nextReset.Format("2006-01-02"))
+
+	body := fmt.Sprintf("Ставка по кредиту %s пересмотрена %s: ключевая ставка Банка России %s%% плюс надбавка %s п.п. "+
+		"Новая ставка %s%% годовых вместо %s%%.",
+		loan.ID, resetDate.Format("02.01.2006"), keyRate.Rate.String(), loan.RateMargin.String(), newRate.String(), oldRate.String())
+	if ok {
+		body += fmt.Sprintf(" Ежемесячный платеж начиная с %s составит %s %s.",
+			next.DueDate.Format("02.01.2006"), next.Amount.StringFixed(2), loan.Currency)
+	}
+	s.notifyBorrower(loan, "Изменение ставки по кредиту", body)
+	return nil
+}
+
+// rescheduleLoan перестраивает график платежей кредита по его текущей ставке с даты пересмотра resetDate
+// Оплаченные платежи, платежи со сроком до даты пересмотра и штрафы сохраняются; остальные плановые платежи
+// заменяются новыми с теми же сроками на остаток основного долга, который они должны были погасить,
+// способом погашения кредита.
+// Возвращает новый график и первый перестроенный платеж; false - перестраивать было нечего
+func rescheduleLoan(loan models.Loan, resetDate time.Time) ([]models.Payment, models.Payment, bool) {
+	kept := make([]models.Payment, 0, len(loan.PaymentSchedule))
+	principal := loan.RemainingAmount
+	var dueDates []time.Time
+	for _, payment := range loan.PaymentSchedule {
+		// Штрафы не гасят основной долг и в аннуитет не входят
+		if payment.Paid || !payment.PrincipalPart.IsPositive() || !payment.DueDate.After(resetDate) {
+			kept = append(kept, payment)
+			if !payment.Paid {
+				principal = principal.Sub(payment.PrincipalPart)
+			}
+			continue
+		}
+		dueDates = append(dueDates, payment.DueDate)
+	}
+	if len(dueDates) == 0 || !principal.IsPositive() {
+		return loan.PaymentSchedule, models.Payment{}, false
+	}
+
+	// Пересчитываются только суммы: сроки берутся из прежнего графика, так как даты, полученные
+	// прибавлением месяцев к другой дате, сдвигаются в коротких месяцах для кредитов, выданных 29-31 числа
+	regenerated := utils.GenerateLoanSchedule(loan.Amortization, principal, loan.InterestRate, len(dueDates), resetDate)
+	for i := range regenerated {
+		regenerated[i].DueDate = dueDates[i]
+	}
+
+	schedule := append(kept, regenerated...)
+	sort.SliceStable(schedule, func(i, j int) bool {
+		return schedule[i].DueDate.Before(schedule[j].DueDate)
+	})
+	return schedule, regenerated[0], true
+}
+
+// notifyBorrower отправляет заемщику письмо по кредиту; ошибки отправки только записываются в журнал
+func (s *PaymentScheduler) notifyBorrower(loan models.Loan, subject, body string) {
+	user, ok := s.users.GetUserByID(loan.UserID)
+	if !ok || user.Email == "" {
+		log.Printf("Не удалось уведомить заемщика по кредиту %s: адрес электронной почты не найден", loan.ID)
+		return
+	}
+	if err := SendNotification(user.Email, subject, body); err != nil {
+		log.Printf("Не удалось уведомить заемщика по кредиту %s: %v", loan.ID, err)
+	}
+}
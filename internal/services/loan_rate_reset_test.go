@@ -0,0 +1,101 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/models"
+	"bankapp/pkg/utils"
+)
+
+func TestRescheduleLoanKeepsDueDates(t *testing.T) {
+	tests := []struct {
+		start        string
+		amortization string
+	}{
+		{"2025-01-29", models.AmortizationAnnuity},
+		{"2025-01-30", models.AmortizationAnnuity},
+		{"2025-01-31", models.AmortizationAnnuity},
+		{"2025-03-31", models.AmortizationAnnuity},
+		{"2024-01-31", models.AmortizationDifferentiated},
+		{"2025-05-31", models.AmortizationDifferentiated},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %s", tt.start, tt.amortization), func(t *testing.T) {
+			start := day(t, tt.start)
+			amount := decimal.NewFromInt(120000)
+			loan := models.Loan{
+				Amount:          amount,
+				InterestRate:    decimal.NewFromInt(18),
+				Amortization:    tt.amortization,
+				StartDate:       start,
+				PaymentSchedule: utils.GenerateLoanSchedule(tt.amortization, amount, decimal.NewFromInt(18), 12, start),
+				RemainingAmount: amount,
+			}
+			// Первые два платежа оплачены
+			for i := 0; i < 2; i++ {
+				loan.PaymentSchedule[i].Paid = true
+				loan.RemainingAmount = loan.RemainingAmount.Sub(loan.PaymentSchedule[i].PrincipalPart)
+			}
+			original := append([]models.Payment(nil), loan.PaymentSchedule...)
+
+			// Пересмотр между вторым и третьим платежом
+			resetDate := original[1].DueDate.AddDate(0, 0, 1)
+			loan.InterestRate = decimal.NewFromInt(21)
+			schedule, next, ok := rescheduleLoan(loan, resetDate)
+			if !ok {
+				t.Fatal("rescheduleLoan: график не перестроен")
+			}
+			if len(schedule) != len(original) {
+				t.Fatalf("в графике %d платежей, ожидалось %d", len(schedule), len(original))
+			}
+			if !next.DueDate.Equal(original[2].DueDate) {
+				t.Errorf("первый перестроенный платеж %s, ожидался %s",
+					next.DueDate.Format("2006-01-02"), original[2].DueDate.Format("2006-01-02"))
+			}
+
+			principal := decimal.Zero
+			for i, payment := range schedule {
+				if !payment.DueDate.Equal(original[i].DueDate) {
+					t.Errorf("платеж %d перенесен с %s на %s", i+1,
+						original[i].DueDate.Format("2006-01-02"), payment.DueDate.Format("2006-01-02"))
+				}
+				if i < 2 {
+					if payment != original[i] {
+						t.Errorf("оплаченный платеж %d изменен: %+v", i+1, payment)
+					}
+					continue
+				}
+				if !payment.InterestPart.GreaterThan(original[i].InterestPart) {
+					t.Errorf("проценты платежа %d не выросли по новой ставке: %s, было %s",
+						i+1, payment.InterestPart, original[i].InterestPart)
+				}
+				principal = principal.Add(payment.PrincipalPart)
+			}
+			if !principal.Equal(loan.RemainingAmount) {
+				t.Errorf("перестроенные платежи гасят %s основного долга, ожидалось %s", principal, loan.RemainingAmount)
+			}
+		})
+	}
+}
+
+func TestRescheduleLoanNothingToReschedule(t *testing.T) {
+	start := time.Date(2025, time.January, 31, 0, 0, 0, 0, time.UTC)
+	amount := decimal.NewFromInt(30000)
+	loan := models.Loan{
+		Amount:          amount,
+		InterestRate:    decimal.NewFromInt(18),
+		PaymentSchedule: utils.GenerateLoanSchedule(models.AmortizationAnnuity, amount, decimal.NewFromInt(18), 3, start),
+		RemainingAmount: amount,
+	}
+
+	// После последнего срока перестраивать нечего
+	resetDate := loan.PaymentSchedule[2].DueDate
+	if _, _, ok := rescheduleLoan(loan, resetDate); ok {
+		t.Error("rescheduleLoan: перестроен график без оставшихся платежей")
+	}
+}
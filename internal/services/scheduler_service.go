@@ -1,6 +1,7 @@
 package services
 
 import (
+	"errors"
 	"log"
 	"sync"
 	"time"
@@ -11,42 +12,56 @@ import (
 	"bankapp/internal/storage"
 )
 
-var (
-	schedulerRunning bool
-	schedulerMutex   sync.Mutex
-)
+// PaymentScheduler периодически обрабатывает платежи по кредитам и пересматривает плавающие ставки
+type PaymentScheduler struct {
+	loans    storage.LoanRepository
+	users    storage.UserRepository
+	keyRates *KeyRateService
+
+	mu      sync.Mutex
+	running bool
+}
 
-// StartPaymentScheduler запускает планировщик для обработки платежей по кредитам
+// NewPaymentScheduler создает планировщик, работающий с переданным репозиторием кредитов
+// Ставки по плавающим кредитам пересматриваются по ключевой ставке из keyRates,
+// а заемщики уведомляются о новом платеже по адресам из users
+func NewPaymentScheduler(loans storage.LoanRepository, users storage.UserRepository, keyRates *KeyRateService) *PaymentScheduler {
+	return &PaymentScheduler{loans: loans, users: users, keyRates: keyRates}
+}
+
+// Start запускает планировщик для обработки платежей по кредитам
 // Планировщик работает каждые 12 часов, как указано в требованиях
-func StartPaymentScheduler() {
-	schedulerMutex.Lock()
-	if schedulerRunning {
-		schedulerMutex.Unlock()
+func (s *PaymentScheduler) Start() {
+	s.mu.Lock()
+	if s.running {
+		s.mu.Unlock()
 		return
 	}
-	schedulerRunning = true
-	schedulerMutex.Unlock()
+	s.running = true
+	s.mu.Unlock()
 
 	log.Println("Запуск планировщика платежей")
 
-	// Запускаем сразу при старте
-	processOverduePayments()
+	// Запускаем сразу при старте; ставка пересматривается до списания платежей, наступивших после пересмотра
+	s.resetFloatingRates()
+	s.processOverduePayments()
 
 	// Затем запускаем каждые 12 часов
 	ticker := time.NewTicker(12 * time.Hour)
 	go func() {
 		for range ticker.C {
-			processOverduePayments()
+			s.resetFloatingRates()
+			s.processOverduePayments()
 		}
 	}()
 }
 
 // processOverduePayments обрабатывает все просроченные платежи по кредитам
-func processOverduePayments() {
+func (s *PaymentScheduler) processOverduePayments() {
 	log.Println("Обработка просроченных платежей")
 
 	// Получаем все кредиты
-	loans := storage.GetAllLoans()
+	loans := s.loans.GetAllLoans(models.LoanFilter{ActiveOnly: true})
 	now := time.Now()
 
 	for _, loan := range loans {
@@ -65,49 +80,27 @@ func processOverduePayments() {
 
 			// Проверяем, просрочен ли платеж
 			if payment.DueDate.Before(now) {
-				account, ok := storage.GetAccount(loan.AccountID)
-				if !ok {
-					log.Printf("Счет %s не найден для кредита %s", loan.AccountID, loan.ID)
-					continue
-				}
-
-				// Проверяем, достаточно ли средств на счете
-				if account.Balance.GreaterThanOrEqual(payment.Amount) {
-					// Обрабатываем платеж
-					err := storage.UpdateAccountBalance(loan.AccountID, payment.Amount.Neg())
-					if err != nil {
-						log.Printf("Не удалось списать средства со счета %s для платежа по кредиту: %v", loan.AccountID, err)
-						continue
-					}
-
-					// Обновляем статус платежа
+				// Списываем платеж со счета атомарно вместе с отметкой в графике
+				err := s.loans.PayLoanInstallment(loan.ID, payment, loanRepaymentPosting(loan, payment))
+				if err == nil {
+					// Синхронизируем состояние кредита в памяти с базой данных
 					loan.PaymentSchedule[i].Paid = true
-
-					// Обновляем оставшуюся сумму
 					loan.RemainingAmount = loan.RemainingAmount.Sub(payment.PrincipalPart)
 
-					// Записываем транзакцию
-					tx := models.Transaction{
-						ID:              storage.GenerateTransactionID(),
-						FromAccountID:   loan.AccountID,
-						Amount:          payment.Amount,
-						Timestamp:       time.Now(),
-						TransactionType: "loan_payment",
-						Description:     "Автоматический платеж по кредиту",
-					}
-					storage.AddTransaction(tx)
-
 					log.Printf("Обработан платеж %s для кредита %s", payment.Amount.String(), loan.ID)
-					modified = true
-				} else {
-					// Применяем штраф (10% от суммы платежа) согласно требованиям
-					penaltyAmount := payment.Amount.Mul(decimal.NewFromFloat(0.1))
+				} else if errors.Is(err, storage.ErrInsufficientFunds) {
+					// Применяем штраф по условиям кредитного продукта: процент от суммы платежа
+					penaltyAmount := payment.Amount.Mul(loan.PenaltyPercent).Div(decimal.NewFromInt(100)).Round(2)
+					if !penaltyAmount.IsPositive() {
+						log.Printf("Недостаточно средств для платежа по кредиту %s, штраф условиями не предусмотрен", loan.ID)
+						continue
+					}
 
 					// Создаем новый платеж со штрафом
 					penaltyPayment := models.Payment{
-						DueDate:       time.Now().AddDate(0, 0, 7), // Срок через 7 дней
+						DueDate:       time.Now().AddDate(0, 0, loan.PenaltyDueDays), // Срок оплаты штрафа по условиям кредита
 						Amount:        penaltyAmount,
-						PrincipalPart: decimal.Zero,                // Весь штраф идет на проценты
+						PrincipalPart: decimal.Zero, // Весь штраф идет на проценты
 						InterestPart:  penaltyAmount,
 						Paid:          false,
 					}
@@ -117,13 +110,15 @@ func processOverduePayments() {
 
 					log.Printf("Применен штраф %s за просроченный платеж по кредиту %s", penaltyAmount.String(), loan.ID)
 					modified = true
+				} else {
+					log.Printf("Не удалось провести платеж по кредиту %s со счета %s: %v", loan.ID, loan.AccountID, err)
 				}
 			}
 		}
 
 		// Обновляем кредит, если были изменения
 		if modified {
-			err := storage.UpdateLoan(loan)
+			err := s.loans.UpdateLoan(loan)
 			if err != nil {
 				log.Printf("Не удалось обновить кредит %s: %v", loan.ID, err)
 			}
@@ -132,3 +127,27 @@ func processOverduePayments() {
 
 	log.Println("Завершена обработка просроченных платежей")
 }
+
+// loanRepaymentPosting формирует проводки для платежа по кредиту:
+// основной долг гасит ссудную задолженность, остаток платежа относится на процентные доходы
+func loanRepaymentPosting(loan models.Loan, payment models.Payment) models.Posting {
+	tx := models.Transaction{
+		ID:              storage.GenerateTransactionID(),
+		FromAccountID:   loan.AccountID,
+		Amount:          payment.Amount,
+		Currency:        loan.Currency,
+		Timestamp:       time.Now(),
+		TransactionType: "loan_payment",
+		Description:     "Автоматический платеж по кредиту",
+	}
+
+	entries := []models.JournalEntry{storage.DebitLeg(loan.AccountID, payment.Amount)}
+	if payment.PrincipalPart.IsPositive() {
+		entries = append(entries, storage.CreditLeg(storage.LedgerLoans, payment.PrincipalPart))
+	}
+	if interest := payment.Amount.Sub(payment.PrincipalPart); interest.IsPositive() {
+		entries = append(entries, storage.CreditLeg(storage.LedgerInterestIncome, interest))
+	}
+
+	return models.Posting{Transaction: tx, Entries: entries}
+}
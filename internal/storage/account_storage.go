@@ -5,18 +5,19 @@ import (
 	"fmt"
 	"log"
 
-	"github.com/shopspring/decimal"
-
 	"bankapp/internal/models"
 )
 
+// accountColumns - столбцы таблицы accounts в порядке сканирования scanAccount
+const accountColumns = "id, user_id, number, account_type, currency, balance, held_amount, status, created_at"
+
 // CreateBankAccount создает новый банковский счет для пользователя
 // Проверяет существование пользователя и добавляет счет в базу данных
-// Возвращает ошибку, если пользователь не найден
-func CreateBankAccount(account models.Account) error {
+// Возвращает ошибку, если пользователь не найден, и ErrAccountNumberTaken, если номер уже занят
+func (s *DBStorage) CreateBankAccount(account models.Account) error {
 	// Проверяем, существует ли пользователь
 	var exists bool
-	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", account.UserID).Scan(&exists)
+	err := s.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", account.UserID).Scan(&exists)
 	if err != nil {
 		return fmt.Errorf("ошибка при проверке существования пользователя: %w", err)
 	}
@@ -26,13 +27,22 @@ func CreateBankAccount(account models.Account) error {
 
 	// Сохраняем счет в базу данных
 	query := `
-		INSERT INTO accounts (id, user_id, number, balance, created_at)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO accounts (id, user_id, number, account_type, currency, balance, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (number) DO NOTHING
 	`
-	_, err = db.DB.Exec(query, account.ID, account.UserID, account.Number, account.Balance, account.CreatedAt)
+	result, err := s.DB.Exec(query, account.ID, account.UserID, account.Number, account.Type, account.Currency,
+		account.Balance, account.Status, account.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании счета: %w", err)
+	}
+	affected, err := result.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("ошибка при создании счета: %w", err)
 	}
+	if affected == 0 {
+		return fmt.Errorf("%w: %s", ErrAccountNumberTaken, account.Number)
+	}
 
 	log.Printf("Счет %s создан для пользователя %s", account.ID, account.UserID)
 	return nil
@@ -40,20 +50,13 @@ func CreateBankAccount(account models.Account) error {
 
 // GetAccount получает счет по его ID
 // Возвращает счет и булево значение, указывающее, найден ли счет
-func GetAccount(accountID string) (models.Account, bool) {
-	var account models.Account
+func (s *DBStorage) GetAccount(accountID string) (models.Account, bool) {
 	query := `
-		SELECT id, user_id, number, balance, created_at
+		SELECT ` + accountColumns + `
 		FROM accounts
 		WHERE id = $1
 	`
-	err := db.DB.QueryRow(query, accountID).Scan(
-		&account.ID,
-		&account.UserID,
-		&account.Number,
-		&account.Balance,
-		&account.CreatedAt,
-	)
+	account, err := scanAccount(s.DB.QueryRow(query, accountID))
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -68,14 +71,14 @@ func GetAccount(accountID string) (models.Account, bool) {
 
 // GetUserAccounts получает все счета пользователя
 // Возвращает срез счетов
-func GetUserAccounts(userID string) []models.Account {
+func (s *DBStorage) GetUserAccounts(userID string) []models.Account {
 	query := `
-		SELECT id, user_id, number, balance, created_at
+		SELECT ` + accountColumns + `
 		FROM accounts
 		WHERE user_id = $1
 		ORDER BY created_at
 	`
-	rows, err := db.DB.Query(query, userID)
+	rows, err := s.DB.Query(query, userID)
 	if err != nil {
 		log.Printf("Ошибка при получении счетов пользователя: %v", err)
 		return []models.Account{}
@@ -84,14 +87,7 @@ func GetUserAccounts(userID string) []models.Account {
 
 	var accounts []models.Account
 	for rows.Next() {
-		var account models.Account
-		err := rows.Scan(
-			&account.ID,
-			&account.UserID,
-			&account.Number,
-			&account.Balance,
-			&account.CreatedAt,
-		)
+		account, err := scanAccount(rows)
 		if err != nil {
 			log.Printf("Ошибка при сканировании данных счета: %v", err)
 			continue
@@ -106,35 +102,40 @@ func GetUserAccounts(userID string) []models.Account {
 	return accounts
 }
 
-// UpdateAccountBalance обновляет баланс счета
+// UpdateAccountStatus изменяет статус счета (например, замораживает его)
 // Возвращает ошибку, если счет не найден
-func UpdateAccountBalance(accountID string, amount decimal.Decimal) error {
-	// Проверяем, существует ли счет
-	var exists bool
-	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM accounts WHERE id = $1)", accountID).Scan(&exists)
+func (s *DBStorage) UpdateAccountStatus(accountID, status string) error {
+	result, err := s.DB.Exec("UPDATE accounts SET status = $1 WHERE id = $2", status, accountID)
 	if err != nil {
-		return fmt.Errorf("ошибка при проверке существования счета: %w", err)
+		return fmt.Errorf("ошибка при изменении статуса счета: %w", err)
 	}
-	if !exists {
-		return fmt.Errorf("account %s not found", accountID)
-	}
-
-	// Получаем текущий баланс
-	var currentBalance decimal.Decimal
-	err = db.DB.QueryRow("SELECT balance FROM accounts WHERE id = $1", accountID).Scan(&currentBalance)
+	affected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("ошибка при получении текущего баланса: %w", err)
+		return fmt.Errorf("ошибка при изменении статуса счета: %w", err)
 	}
-
-	// Вычисляем новый баланс
-	newBalance := currentBalance.Add(amount)
-
-	// Обновляем баланс в базе данных
-	_, err = db.DB.Exec("UPDATE accounts SET balance = $1 WHERE id = $2", newBalance, accountID)
-	if err != nil {
-		return fmt.Errorf("ошибка при обновлении баланса: %w", err)
+	if affected == 0 {
+		return fmt.Errorf("%w: %s", ErrAccountNotFound, accountID)
 	}
 
-	log.Printf("Баланс счета %s обновлен. Изменение: %s, новый баланс: %s", accountID, amount.String(), newBalance.String())
+	log.Printf("Статус счета %s изменен на %s", accountID, status)
 	return nil
 }
+
+// scanAccount читает строку таблицы accounts, выбранную со столбцами accountColumns,
+// и вычисляет доступный баланс
+func scanAccount(row interface{ Scan(...interface{}) error }) (models.Account, error) {
+	var account models.Account
+	err := row.Scan(
+		&account.ID,
+		&account.UserID,
+		&account.Number,
+		&account.Type,
+		&account.Currency,
+		&account.Balance,
+		&account.HeldAmount,
+		&account.Status,
+		&account.CreatedAt,
+	)
+	account.AvailableBalance = account.Available()
+	return account, err
+}
@@ -0,0 +1,244 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/models"
+)
+
+var (
+	// ErrTransactionLimitExceeded возвращается, если платеж больше лимита на одну операцию
+	ErrTransactionLimitExceeded = errors.New("per-transaction card limit exceeded")
+	// ErrDailyLimitExceeded возвращается, если платеж превышает дневной лимит карты
+	ErrDailyLimitExceeded = errors.New("daily card limit exceeded")
+	// ErrMonthlyLimitExceeded возвращается, если платеж превышает месячный лимит карты
+	ErrMonthlyLimitExceeded = errors.New("monthly card limit exceeded")
+	// ErrMerchantRuleExists возвращается при добавлении правила, которое уже есть у карты
+	ErrMerchantRuleExists = errors.New("merchant rule already exists")
+	// ErrMerchantRuleNotFound возвращается, если правило карты не найдено
+	ErrMerchantRuleNotFound = errors.New("merchant rule not found")
+	// ErrSingleUseCardUsed возвращается при повторной оплате одноразовой картой,
+	// уже закрытой после платежа или с действующим удержанием
+	ErrSingleUseCardUsed = errors.New("single-use card already used")
+)
+
+// UpdateCardLimits заменяет лимиты расходов по карте
+func (s *DBStorage) UpdateCardLimits(cardID string, limits models.CardLimits) error {
+	result, err := s.DB.Exec(`
+		UPDATE cards SET per_transaction_limit = $2, daily_limit = $3, monthly_limit = $4
+		WHERE id = $1
+	`, cardID, limits.PerTransaction, limits.Daily, limits.Monthly)
+	if err != nil {
+		return fmt.Errorf("ошибка при изменении лимитов карты: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при изменении лимитов карты: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: %s", ErrCardNotFound, cardID)
+	}
+
+	log.Printf("Лимиты карты %s изменены", cardID)
+	return nil
+}
+
+// ListCardMerchantRules возвращает правила карты по получателям платежей в порядке добавления
+func (s *DBStorage) ListCardMerchantRules(cardID string) ([]models.MerchantRule, error) {
+	rows, err := s.DB.Query(`
+		SELECT id, card_id, list, kind, value, created_at
+		FROM card_merchant_rules
+		WHERE card_id = $1
+		ORDER BY created_at, id
+	`, cardID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении правил карты: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []models.MerchantRule{}
+	for rows.Next() {
+		var rule models.MerchantRule
+		if err := rows.Scan(&rule.ID, &rule.CardID, &rule.List, &rule.Kind, &rule.Value, &rule.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании правила карты: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по результатам запроса: %w", err)
+	}
+	return rules, nil
+}
+
+// AddCardMerchantRule добавляет правило карты по получателям платежей
+// Возвращает ErrMerchantRuleExists, если такое же правило уже есть
+func (s *DBStorage) AddCardMerchantRule(rule models.MerchantRule) error {
+	result, err := s.DB.Exec(`
+		INSERT INTO card_merchant_rules (id, card_id, list, kind, value, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT DO NOTHING
+	`, rule.ID, rule.CardID, rule.List, rule.Kind, rule.Value, rule.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при добавлении правила карты: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при добавлении правила карты: %w", err)
+	}
+	if affected == 0 {
+		return ErrMerchantRuleExists
+	}
+
+	log.Printf("Для карты %s добавлено правило %s %s=%s", rule.CardID, rule.List, rule.Kind, rule.Value)
+	return nil
+}
+
+// DeleteCardMerchantRule удаляет правило карты по получателям платежей
+func (s *DBStorage) DeleteCardMerchantRule(cardID, ruleID string) error {
+	result, err := s.DB.Exec("DELETE FROM card_merchant_rules WHERE id = $1 AND card_id = $2", ruleID, cardID)
+	if err != nil {
+		return fmt.Errorf("ошибка при удалении правила карты: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при удалении правила карты: %w", err)
+	}
+	if affected == 0 {
+		return ErrMerchantRuleNotFound
+	}
+	return nil
+}
+
+// PostCardPayment проводит платеж по карте с проверкой ее лимитов расходов
+// Строка карты блокируется на время проверки, поэтому параллельные платежи
+// по одной карте не могут вместе превысить лимит
+// Помимо ошибок PostTransaction возвращает ErrTransactionLimitExceeded,
+// ErrDailyLimitExceeded или ErrMonthlyLimitExceeded
+func (s *DBStorage) PostCardPayment(posting models.Posting) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = checkCardLimitsTx(tx, posting.Transaction.CardID, posting.Transaction.Amount, posting.Transaction.Timestamp); err != nil {
+		return err
+	}
+
+	if err = postTransactionTx(tx, posting); err != nil {
+		return err
+	}
+	if err = closeSingleUseCardTx(tx, posting.Transaction.CardID); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+
+	log.Printf("Платеж %s по карте %s проведен, сумма: %s",
+		posting.Transaction.ID, posting.Transaction.CardID, posting.Transaction.Amount.String())
+	return nil
+}
+
+// checkCardLimitsTx блокирует строку карты и проверяет, что операция amount в момент at
+// укладывается в ее лимиты с учетом платежей и действующих удержаний за сутки и месяц
+// Одноразовая карта должна быть еще не использована
+func checkCardLimitsTx(tx *sql.Tx, cardID string, amount decimal.Decimal, at time.Time) error {
+	var limits models.CardLimits
+	var singleUse bool
+	var status string
+	err := tx.QueryRow(`
+		SELECT per_transaction_limit, daily_limit, monthly_limit, single_use, status
+		FROM cards
+		WHERE id = $1
+		FOR UPDATE
+	`, cardID).Scan(&limits.PerTransaction, &limits.Daily, &limits.Monthly, &singleUse, &status)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: %s", ErrCardNotFound, cardID)
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка при блокировке карты: %w", err)
+	}
+
+	if singleUse {
+		var activeHolds int
+		err = tx.QueryRow("SELECT COUNT(*) FROM card_holds WHERE card_id = $1 AND status = $2",
+			cardID, models.HoldStatusAuthorized).Scan(&activeHolds)
+		if err != nil {
+			return fmt.Errorf("ошибка при проверке удержаний по карте: %w", err)
+		}
+		if status == models.CardStatusClosed || activeHolds > 0 {
+			return fmt.Errorf("%w: %s", ErrSingleUseCardUsed, cardID)
+		}
+	}
+
+	dayStart, monthStart := spendingPeriods(at)
+	var daySpent, monthSpent decimal.Decimal
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(amount) FILTER (WHERE spent_at >= $3), 0),
+			COALESCE(SUM(amount), 0)
+		FROM (
+			SELECT amount, timestamp AS spent_at
+			FROM transactions
+			WHERE card_id = $1 AND transaction_type = 'payment' AND timestamp >= $2
+			UNION ALL
+			SELECT amount, created_at
+			FROM card_holds
+			WHERE card_id = $1 AND status = $4 AND created_at >= $2
+		) spending
+	`, cardID, monthStart, dayStart, models.HoldStatusAuthorized).Scan(&daySpent, &monthSpent)
+	if err != nil {
+		return fmt.Errorf("ошибка при подсчете расходов по карте: %w", err)
+	}
+
+	return checkCardLimits(limits, amount, daySpent, monthSpent)
+}
+
+// closeSingleUseCardTx закрывает одноразовую карту после проведенного по ней платежа
+// Для остальных карт ничего не делает
+func closeSingleUseCardTx(tx *sql.Tx, cardID string) error {
+	result, err := tx.Exec("UPDATE cards SET status = $2 WHERE id = $1 AND single_use AND status <> $2",
+		cardID, models.CardStatusClosed)
+	if err != nil {
+		return fmt.Errorf("ошибка при закрытии одноразовой карты: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected > 0 {
+		log.Printf("Одноразовая карта %s закрыта после платежа", cardID)
+	}
+	return nil
+}
+
+// spendingPeriods возвращает начало календарных суток и месяца UTC, в которые попадает момент t
+func spendingPeriods(t time.Time) (time.Time, time.Time) {
+	t = t.UTC()
+	dayStart := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return dayStart, monthStart
+}
+
+// checkCardLimits проверяет, что платеж amount укладывается в лимиты карты
+// с учетом уже потраченных за сутки и месяц сумм
+func checkCardLimits(limits models.CardLimits, amount, daySpent, monthSpent decimal.Decimal) error {
+	if limits.PerTransaction.Valid && amount.GreaterThan(limits.PerTransaction.Decimal) {
+		return fmt.Errorf("%w: limit %s", ErrTransactionLimitExceeded, limits.PerTransaction.Decimal.String())
+	}
+	if limits.Daily.Valid && daySpent.Add(amount).GreaterThan(limits.Daily.Decimal) {
+		return fmt.Errorf("%w: limit %s, spent %s", ErrDailyLimitExceeded, limits.Daily.Decimal.String(), daySpent.String())
+	}
+	if limits.Monthly.Valid && monthSpent.Add(amount).GreaterThan(limits.Monthly.Decimal) {
+		return fmt.Errorf("%w: limit %s, spent %s", ErrMonthlyLimitExceeded, limits.Monthly.Decimal.String(), monthSpent.String())
+	}
+	return nil
+}
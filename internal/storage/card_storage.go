@@ -2,20 +2,51 @@ package storage
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	"bankapp/internal/models"
 	"bankapp/pkg/utils"
 )
 
+var (
+	// ErrCardNotFound возвращается, если карта не существует
+	ErrCardNotFound = errors.New("card not found")
+	// ErrCardStatusConflict возвращается, если статус карты изменился с момента чтения
+	// или не допускает запрошенной операции
+	ErrCardStatusConflict = errors.New("card status conflict")
+	// ErrCardNumberTaken возвращается, если карта с таким номером уже выпущена;
+	// вызывающий код должен сгенерировать новый номер
+	ErrCardNumberTaken = errors.New("card number already issued")
+	// ErrCardAlreadyRevealed возвращается при повторном запросе реквизитов виртуальной карты
+	ErrCardAlreadyRevealed = errors.New("card details already revealed")
+)
+
+// cardColumns - столбцы таблицы cards в порядке сканирования scanCard
+const cardColumns = `id, account_id, encrypted_number, encryption_key_id, number_hmac, last_four,
+		expiry_month, expiry_year, cvv_hash, status, failed_attempts, replaced_by,
+		per_transaction_limit, daily_limit, monthly_limit, created_at, product,
+		card_type, single_use, locked_merchant, encrypted_cvv, revealed_at`
+
+// insertCardQuery добавляет карту со всеми столбцами cardColumns, значения берутся из cardValues
+// Если номер карты уже выпущен, строка не добавляется
+const insertCardQuery = `
+	INSERT INTO cards (` + cardColumns + `)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17,
+		$18, $19, $20, $21, $22)
+	ON CONFLICT (number_hmac) DO NOTHING
+`
+
 // AddCard добавляет новую карту в базу данных
 // Проверяет существование счета и добавляет карту
-// Возвращает ошибку, если счет не найден
-func AddCard(card models.Card) error {
+// Номер карты сохраняется только в зашифрованном виде
+// Возвращает ошибку, если счет не найден, и ErrCardNumberTaken, если номер уже выпущен
+func (s *DBStorage) AddCard(card models.Card) error {
 	// Проверяем, существует ли счет
 	var exists bool
-	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM accounts WHERE id = $1)", card.AccountID).Scan(&exists)
+	err := s.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM accounts WHERE id = $1)", card.AccountID).Scan(&exists)
 	if err != nil {
 		return fmt.Errorf("ошибка при проверке существования счета: %w", err)
 	}
@@ -24,41 +55,29 @@ func AddCard(card models.Card) error {
 	}
 
 	// Сохраняем карту в базу данных
-	query := `
-		INSERT INTO cards (id, account_id, number, encrypted_number, number_hmac, 
-						  expiry_month, expiry_year, cvv_hash, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-	`
-	_, err = db.DB.Exec(query, 
-		card.ID, 
-		card.AccountID, 
-		card.Number, 
-		card.EncryptedNumber, 
-		card.NumberHMAC, 
-		card.ExpiryMonth, 
-		card.ExpiryYear, 
-		card.CVVHash, 
-		card.CreatedAt)
-
+	result, err := s.DB.Exec(insertCardQuery, cardValues(card)...)
 	if err != nil {
 		return fmt.Errorf("ошибка при добавлении карты: %w", err)
 	}
+	if err := checkCardInserted(result); err != nil {
+		return err
+	}
 
 	log.Printf("Карта %s добавлена для счета %s", card.ID, card.AccountID)
 	return nil
 }
 
 // GetAccountCards получает все карты для счета
+// Номера карт не расшифровываются; для отображения используются последние 4 цифры
 // Возвращает срез карт
-func GetAccountCards(accountID string) []models.Card {
+func (s *DBStorage) GetAccountCards(accountID string) []models.Card {
 	query := `
-		SELECT id, account_id, number, encrypted_number, number_hmac, 
-			   expiry_month, expiry_year, cvv_hash, created_at
+		SELECT ` + cardColumns + `
 		FROM cards
 		WHERE account_id = $1
 		ORDER BY created_at
 	`
-	rows, err := db.DB.Query(query, accountID)
+	rows, err := s.DB.Query(query, accountID)
 	if err != nil {
 		log.Printf("Ошибка при получении карт для счета: %v", err)
 		return []models.Card{}
@@ -67,18 +86,7 @@ func GetAccountCards(accountID string) []models.Card {
 
 	var cards []models.Card
 	for rows.Next() {
-		var card models.Card
-		err := rows.Scan(
-			&card.ID,
-			&card.AccountID,
-			&card.Number,
-			&card.EncryptedNumber,
-			&card.NumberHMAC,
-			&card.ExpiryMonth,
-			&card.ExpiryYear,
-			&card.CVVHash,
-			&card.CreatedAt,
-		)
+		card, err := scanCard(rows)
 		if err != nil {
 			log.Printf("Ошибка при сканировании данных карты: %v", err)
 			continue
@@ -95,18 +103,17 @@ func GetAccountCards(accountID string) []models.Card {
 
 // GetCardByNumber получает карту по ее номеру
 // Возвращает карту и булево значение, указывающее, найдена ли карта
-func GetCardByNumber(number string) (models.Card, bool) {
+func (s *DBStorage) GetCardByNumber(number string) (models.Card, bool) {
 	// Генерируем HMAC для предоставленного номера для сравнения с сохраненными HMAC
 	numberHMAC := utils.GenerateHMAC(number)
 
 	// Сначала ищем карты с совпадающим HMAC
 	query := `
-		SELECT id, account_id, number, encrypted_number, number_hmac, 
-			   expiry_month, expiry_year, cvv_hash, created_at
+		SELECT ` + cardColumns + `
 		FROM cards
 		WHERE number_hmac = $1
 	`
-	rows, err := db.DB.Query(query, numberHMAC)
+	rows, err := s.DB.Query(query, numberHMAC)
 	if err != nil {
 		log.Printf("Ошибка при поиске карты по HMAC: %v", err)
 		return models.Card{}, false
@@ -115,27 +122,20 @@ func GetCardByNumber(number string) (models.Card, bool) {
 
 	// Проверяем каждую найденную карту
 	for rows.Next() {
-		var card models.Card
-		err := rows.Scan(
-			&card.ID,
-			&card.AccountID,
-			&card.Number,
-			&card.EncryptedNumber,
-			&card.NumberHMAC,
-			&card.ExpiryMonth,
-			&card.ExpiryYear,
-			&card.CVVHash,
-			&card.CreatedAt,
-		)
+		card, err := scanCard(rows)
 		if err != nil {
 			log.Printf("Ошибка при сканировании данных карты: %v", err)
 			continue
 		}
 
 		// Расшифровываем номер карты, чтобы проверить точное совпадение
-		decryptedNumber, err := utils.DecryptData(card.EncryptedNumber)
-		if err == nil && decryptedNumber == number {
-			// Обновляем поле с открытым номером карты для вызывающего кода
+		decryptedNumber, err := utils.DecryptField(card.EncryptedNumber, card.EncryptionKeyID, card.ID)
+		if err != nil {
+			log.Printf("Не удалось расшифровать номер карты %s: %v", card.ID, err)
+			continue
+		}
+		if decryptedNumber == number {
+			// Заполняем открытый номер карты для вызывающего кода
 			card.Number = decryptedNumber
 			return card, true
 		}
@@ -150,33 +150,303 @@ func GetCardByNumber(number string) (models.Card, bool) {
 
 // GetCard получает карту по ее ID
 // Возвращает карту и булево значение, указывающее, найдена ли карта
-func GetCard(cardID string) (models.Card, bool) {
-	var card models.Card
+func (s *DBStorage) GetCard(cardID string) (models.Card, bool) {
 	query := `
-		SELECT id, account_id, number, encrypted_number, number_hmac, 
-			   expiry_month, expiry_year, cvv_hash, created_at
+		SELECT ` + cardColumns + `
 		FROM cards
 		WHERE id = $1
 	`
-	err := db.DB.QueryRow(query, cardID).Scan(
+	card, err := scanCard(s.DB.QueryRow(query, cardID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return models.Card{}, false
+		}
+		log.Printf("Ошибка при получении карты по ID: %v", err)
+		return models.Card{}, false
+	}
+
+	return card, true
+}
+
+// ListCardsForReencryption возвращает карты, номера которых зашифрованы не ключом keyID
+// Карты упорядочены по ID; afterID задает позицию продолжения для постраничного обхода
+func (s *DBStorage) ListCardsForReencryption(keyID, afterID string, limit int) ([]models.Card, error) {
+	query := `
+		SELECT ` + cardColumns + `
+		FROM cards
+		WHERE encryption_key_id <> $1 AND id > $2
+		ORDER BY id
+		LIMIT $3
+	`
+	rows, err := s.DB.Query(query, keyID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении карт для перешифрования: %w", err)
+	}
+	defer rows.Close()
+
+	var cards []models.Card
+	for rows.Next() {
+		card, err := scanCard(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании данных карты: %w", err)
+		}
+		cards = append(cards, card)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по результатам запроса: %w", err)
+	}
+	return cards, nil
+}
+
+// UpdateCardEncryption заменяет шифртексты номера и еще не показанного CVV карты,
+// если они все еще зашифрованы ключом oldKeyID
+// CVV, показанный владельцу за это время, не восстанавливается
+// Возвращает false, если карту за это время уже перешифровал другой процесс
+func (s *DBStorage) UpdateCardEncryption(cardID, oldKeyID, encryptedNumber, encryptedCVV, newKeyID string) (bool, error) {
+	result, err := s.DB.Exec(`
+		UPDATE cards
+		SET encrypted_number = $3,
+			encrypted_cvv = CASE WHEN encrypted_cvv IS NULL THEN NULL ELSE NULLIF($4, '') END,
+			encryption_key_id = $5
+		WHERE id = $1 AND encryption_key_id = $2
+	`, cardID, oldKeyID, encryptedNumber, encryptedCVV, newKeyID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка при обновлении шифрования карты: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка при обновлении шифрования карты: %w", err)
+	}
+	return affected == 1, nil
+}
+
+// RevealCard отмечает реквизиты виртуальной карты показанными в момент at и удаляет ее зашифрованный CVV
+// Возвращает карту с шифртекстами номера и CVV, прочитанными до удаления
+// Возвращает ErrCardAlreadyRevealed, если реквизиты уже показывались или карта не виртуальная
+func (s *DBStorage) RevealCard(cardID string, at time.Time) (models.Card, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return models.Card{}, fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	card, err := scanCard(tx.QueryRow("SELECT "+cardColumns+" FROM cards WHERE id = $1 FOR UPDATE", cardID))
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("%w: %s", ErrCardNotFound, cardID)
+		return models.Card{}, err
+	}
+	if err != nil {
+		return models.Card{}, fmt.Errorf("ошибка при получении карты: %w", err)
+	}
+	if card.EncryptedCVV == "" {
+		err = fmt.Errorf("%w: %s", ErrCardAlreadyRevealed, cardID)
+		return models.Card{}, err
+	}
+
+	if _, err = tx.Exec("UPDATE cards SET encrypted_cvv = NULL, revealed_at = $2 WHERE id = $1", cardID, at); err != nil {
+		return models.Card{}, fmt.Errorf("ошибка при отметке показа реквизитов карты: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.Card{}, fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+
+	log.Printf("Реквизиты карты %s показаны владельцу", cardID)
+	return card, nil
+}
+
+// RecordCardVerificationFailure увеличивает счетчик неудачных проверок CVV и срока действия
+// и блокирует карту, когда счетчик достигает maxAttempts
+// Возвращает новое значение счетчика и признак блокировки карты
+func (s *DBStorage) RecordCardVerificationFailure(cardID string, maxAttempts int) (int, bool, error) {
+	var attempts int
+	var status string
+	err := s.DB.QueryRow(`
+		UPDATE cards
+		SET failed_attempts = failed_attempts + 1,
+			status = CASE WHEN failed_attempts + 1 >= $2 THEN $3 ELSE status END
+		WHERE id = $1
+		RETURNING failed_attempts, status
+	`, cardID, maxAttempts, models.CardStatusBlocked).Scan(&attempts, &status)
+	if err != nil {
+		return 0, false, fmt.Errorf("ошибка при учете неудачной проверки карты: %w", err)
+	}
+
+	blocked := status == models.CardStatusBlocked
+	if blocked {
+		log.Printf("Карта %s заблокирована после %d неудачных проверок", cardID, attempts)
+	}
+	return attempts, blocked, nil
+}
+
+// ResetCardVerificationFailures сбрасывает счетчик неудачных проверок после успешной проверки
+func (s *DBStorage) ResetCardVerificationFailures(cardID string) error {
+	_, err := s.DB.Exec("UPDATE cards SET failed_attempts = 0 WHERE id = $1 AND failed_attempts <> 0", cardID)
+	if err != nil {
+		return fmt.Errorf("ошибка при сбросе счетчика проверок карты: %w", err)
+	}
+	return nil
+}
+
+// UpdateCardStatus переводит карту из статуса fromStatus в статус toStatus
+// Возвращает ErrCardStatusConflict, если статус карты уже не равен fromStatus
+// При возврате карты в статус active счетчик неудачных проверок сбрасывается
+func (s *DBStorage) UpdateCardStatus(cardID, fromStatus, toStatus string) error {
+	result, err := s.DB.Exec(`
+		UPDATE cards
+		SET status = $3,
+			failed_attempts = CASE WHEN $3 = $4 THEN 0 ELSE failed_attempts END
+		WHERE id = $1 AND status = $2
+	`, cardID, fromStatus, toStatus, models.CardStatusActive)
+	if err != nil {
+		return fmt.Errorf("ошибка при изменении статуса карты: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при изменении статуса карты: %w", err)
+	}
+	if affected == 0 {
+		if _, ok := s.GetCard(cardID); !ok {
+			return fmt.Errorf("%w: %s", ErrCardNotFound, cardID)
+		}
+		return fmt.Errorf("%w: card %s is no longer %s", ErrCardStatusConflict, cardID, fromStatus)
+	}
+
+	log.Printf("Статус карты %s изменен: %s -> %s", cardID, fromStatus, toStatus)
+	return nil
+}
+
+// ReissueCard выпускает карту newCard взамен карты oldCardID
+// Старая карта закрывается и ссылается на новую; обе операции выполняются в одной транзакции
+// Возвращает ErrCardStatusConflict, если старая карта уже закрыта,
+// и ErrCardNumberTaken, если номер новой карты уже выпущен
+func (s *DBStorage) ReissueCard(oldCardID string, newCard models.Card) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var status string
+	err = tx.QueryRow("SELECT status FROM cards WHERE id = $1 FOR UPDATE", oldCardID).Scan(&status)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("%w: %s", ErrCardNotFound, oldCardID)
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка при получении карты: %w", err)
+	}
+	if status == models.CardStatusClosed {
+		err = fmt.Errorf("%w: card %s is already closed", ErrCardStatusConflict, oldCardID)
+		return err
+	}
+
+	result, err := tx.Exec(insertCardQuery, cardValues(newCard)...)
+	if err != nil {
+		return fmt.Errorf("ошибка при добавлении карты: %w", err)
+	}
+	if err = checkCardInserted(result); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE cards SET status = $2, replaced_by = $3 WHERE id = $1",
+		oldCardID, models.CardStatusClosed, newCard.ID)
+	if err != nil {
+		return fmt.Errorf("ошибка при закрытии перевыпускаемой карты: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+
+	log.Printf("Карта %s перевыпущена, новая карта %s", oldCardID, newCard.ID)
+	return nil
+}
+
+// cardValues возвращает значения столбцов cardColumns для вставки карты
+func cardValues(card models.Card) []interface{} {
+	return []interface{}{
+		card.ID,
+		card.AccountID,
+		card.EncryptedNumber,
+		card.EncryptionKeyID,
+		card.NumberHMAC,
+		card.LastFour,
+		card.ExpiryMonth,
+		card.ExpiryYear,
+		card.CVVHash,
+		card.Status,
+		card.FailedAttempts,
+		sql.NullString{String: card.ReplacedBy, Valid: card.ReplacedBy != ""},
+		card.Limits.PerTransaction,
+		card.Limits.Daily,
+		card.Limits.Monthly,
+		card.CreatedAt,
+		card.Product,
+		card.Type,
+		card.SingleUse,
+		sql.NullString{String: card.LockedMerchant, Valid: card.LockedMerchant != ""},
+		sql.NullString{String: card.EncryptedCVV, Valid: card.EncryptedCVV != ""},
+		card.RevealedAt,
+	}
+}
+
+// checkCardInserted возвращает ErrCardNumberTaken, если вставка карты пропущена из-за совпадения номера
+func checkCardInserted(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при добавлении карты: %w", err)
+	}
+	if affected == 0 {
+		return ErrCardNumberTaken
+	}
+	return nil
+}
+
+// scanCard читает строку таблицы cards, выбранную со столбцами cardColumns
+func scanCard(row interface{ Scan(...interface{}) error }) (models.Card, error) {
+	var card models.Card
+	var replacedBy, lockedMerchant, encryptedCVV sql.NullString
+	var revealedAt sql.NullTime
+	err := row.Scan(
 		&card.ID,
 		&card.AccountID,
-		&card.Number,
 		&card.EncryptedNumber,
+		&card.EncryptionKeyID,
 		&card.NumberHMAC,
+		&card.LastFour,
 		&card.ExpiryMonth,
 		&card.ExpiryYear,
 		&card.CVVHash,
+		&card.Status,
+		&card.FailedAttempts,
+		&replacedBy,
+		&card.Limits.PerTransaction,
+		&card.Limits.Daily,
+		&card.Limits.Monthly,
 		&card.CreatedAt,
+		&card.Product,
+		&card.Type,
+		&card.SingleUse,
+		&lockedMerchant,
+		&encryptedCVV,
+		&revealedAt,
 	)
-
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return models.Card{}, false
-		}
-		log.Printf("Ошибка при получении карты по ID: %v", err)
-		return models.Card{}, false
+	card.ReplacedBy = replacedBy.String
+	card.LockedMerchant = lockedMerchant.String
+	card.EncryptedCVV = encryptedCVV.String
+	if revealedAt.Valid {
+		card.RevealedAt = &revealedAt.Time
 	}
-
-	return card, true
+	return card, err
 }
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"bankapp/internal/models"
+)
+
+// currencyRateColumns - столбцы таблицы currency_rates в порядке сканирования
+const currencyRateColumns = "rate_date, currency, numeric_code, name, nominal, value, rate, fetched_at"
+
+// SaveCurrencyRates сохраняет официальные курсы валют в историю
+// Курс, уже сохраненный на ту же дату, заменяется: Банк России может уточнить курсы до их вступления в силу
+func (s *DBStorage) SaveCurrencyRates(rates []models.CurrencyRate) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, rate := range rates {
+		_, err = tx.Exec(`
+			INSERT INTO currency_rates (`+currencyRateColumns+`)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (rate_date, currency) DO UPDATE
+			SET numeric_code = EXCLUDED.numeric_code, name = EXCLUDED.name, nominal = EXCLUDED.nominal,
+				value = EXCLUDED.value, rate = EXCLUDED.rate, fetched_at = EXCLUDED.fetched_at
+		`, rate.Date, rate.Currency, rate.NumericCode, rate.Name, rate.Nominal, rate.Value, rate.Rate, rate.FetchedAt)
+		if err != nil {
+			return fmt.Errorf("ошибка при сохранении курса валюты %s: %w", rate.Currency, err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+	return nil
+}
+
+// GetCurrencyRates возвращает официальные курсы валют, сохраненные на дату date,
+// в алфавитном порядке кодов; если курсов на эту дату нет, срез пуст
+func (s *DBStorage) GetCurrencyRates(date time.Time) ([]models.CurrencyRate, error) {
+	rows, err := s.DB.Query("SELECT "+currencyRateColumns+" FROM currency_rates WHERE rate_date = $1 ORDER BY currency",
+		date.Format("2006-01-02"))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении курсов валют: %w", err)
+	}
+	defer rows.Close()
+
+	var rates []models.CurrencyRate
+	for rows.Next() {
+		var rate models.CurrencyRate
+		err := rows.Scan(&rate.Date, &rate.Currency, &rate.NumericCode, &rate.Name, &rate.Nominal,
+			&rate.Value, &rate.Rate, &rate.FetchedAt)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании курса валюты: %w", err)
+		}
+		rates = append(rates, rate)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по результатам запроса: %w", err)
+	}
+
+	return rates, nil
+}
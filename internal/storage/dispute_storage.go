@@ -0,0 +1,322 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/models"
+)
+
+var (
+	// ErrTransactionNotFound возвращается, если транзакция не существует
+	ErrTransactionNotFound = errors.New("transaction not found")
+	// ErrNotCardPayment возвращается при попытке вернуть или оспорить операцию, не являющуюся платежом по карте
+	ErrNotCardPayment = errors.New("transaction is not a card payment")
+	// ErrRefundExceedsPayment возвращается, если сумма возвратов и компенсаций превысит сумму платежа
+	ErrRefundExceedsPayment = errors.New("refund exceeds the remaining payment amount")
+	// ErrDisputeExists возвращается при открытии второго нерешенного спора по одному платежу
+	ErrDisputeExists = errors.New("transaction already has an active dispute")
+	// ErrDisputeNotFound возвращается, если спор не существует
+	ErrDisputeNotFound = errors.New("dispute not found")
+	// ErrDisputeStatusConflict возвращается, если переход спора в новый статус недопустим
+	ErrDisputeStatusConflict = errors.New("dispute status conflict")
+)
+
+// disputeColumns - столбцы таблицы card_disputes в порядке сканирования scanDispute
+const disputeColumns = `id, transaction_id, account_id, COALESCE(card_id, ''), amount, reason, status,
+		COALESCE(resolution, ''), COALESCE(chargeback_transaction_id, ''), created_at, updated_at, resolved_at`
+
+// GetRefundedAmount возвращает сумму возвратов и компенсаций, уже проведенных по платежу
+func (s *DBStorage) GetRefundedAmount(transactionID string) (decimal.Decimal, error) {
+	return refundedAmount(s.DB, transactionID)
+}
+
+// RefundPayment проводит возврат posting по платежу, на который ссылается RelatedTransactionID
+// Строка платежа блокируется, поэтому параллельные возвраты не могут вместе превысить его сумму
+// Возвращает ErrTransactionNotFound, ErrNotCardPayment или ErrRefundExceedsPayment
+func (s *DBStorage) RefundPayment(posting models.Posting) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = checkRefundableTx(tx, posting.Transaction.RelatedTransactionID, posting.Transaction.Amount); err != nil {
+		return err
+	}
+	if err = postTransactionTx(tx, posting); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+
+	log.Printf("Возврат %s по платежу %s проведен, сумма: %s",
+		posting.Transaction.ID, posting.Transaction.RelatedTransactionID, posting.Transaction.Amount.String())
+	return nil
+}
+
+// OpenDispute открывает спор по платежу
+// Оспариваемая сумма не может превышать невозвращенный остаток платежа
+// Возвращает ErrTransactionNotFound, ErrNotCardPayment, ErrDisputeExists или ErrRefundExceedsPayment
+func (s *DBStorage) OpenDispute(dispute models.Dispute) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = checkRefundableTx(tx, dispute.TransactionID, dispute.Amount); err != nil {
+		return err
+	}
+
+	var active bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM card_disputes WHERE transaction_id = $1 AND status IN ($2, $3))
+	`, dispute.TransactionID, models.DisputeStatusOpen, models.DisputeStatusUnderReview).Scan(&active)
+	if err != nil {
+		return fmt.Errorf("ошибка при проверке споров по платежу: %w", err)
+	}
+	if active {
+		err = fmt.Errorf("%w: %s", ErrDisputeExists, dispute.TransactionID)
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO card_disputes (id, transaction_id, account_id, card_id, amount, reason, status, created_at, updated_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9)
+	`, dispute.ID, dispute.TransactionID, dispute.AccountID, dispute.CardID, dispute.Amount, dispute.Reason,
+		dispute.Status, dispute.CreatedAt, dispute.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении спора: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+
+	log.Printf("Открыт спор %s по платежу %s на сумму %s", dispute.ID, dispute.TransactionID, dispute.Amount.String())
+	return nil
+}
+
+// GetDispute получает спор по его ID
+// Возвращает спор и булево значение, указывающее, найден ли он
+func (s *DBStorage) GetDispute(disputeID string) (models.Dispute, bool) {
+	dispute, err := scanDispute(s.DB.QueryRow("SELECT "+disputeColumns+" FROM card_disputes WHERE id = $1", disputeID))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Ошибка при получении спора: %v", err)
+		}
+		return models.Dispute{}, false
+	}
+	return dispute, true
+}
+
+// ListDisputes возвращает споры, удовлетворяющие фильтру, начиная с самых новых
+func (s *DBStorage) ListDisputes(filter models.DisputeFilter) ([]models.Dispute, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.AccountID != "" {
+		args = append(args, filter.AccountID)
+		conditions = append(conditions, fmt.Sprintf("account_id = $%d", len(args)))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT `+disputeColumns+`
+		FROM card_disputes
+	`+whereClause(conditions)+`
+		ORDER BY created_at DESC
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении споров: %w", err)
+	}
+	defer rows.Close()
+
+	disputes := []models.Dispute{}
+	for rows.Next() {
+		dispute, err := scanDispute(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании спора: %w", err)
+		}
+		disputes = append(disputes, dispute)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по результатам запроса: %w", err)
+	}
+	return disputes, nil
+}
+
+// UpdateDisputeStatus переводит спор в статус status с комментарием resolution
+// При решении в пользу клиента вместе со сменой статуса проводится компенсация chargeback;
+// для остальных статусов chargeback не используется
+// Возвращает ErrDisputeNotFound, ErrDisputeStatusConflict или ErrRefundExceedsPayment,
+// если после открытия спора по платежу уже прошли возвраты
+func (s *DBStorage) UpdateDisputeStatus(disputeID, status, resolution string, chargeback *models.Posting) (models.Dispute, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return models.Dispute{}, fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Сначала блокируем платеж, затем спор - в том же порядке, что и при открытии спора
+	var transactionID string
+	err = tx.QueryRow("SELECT transaction_id FROM card_disputes WHERE id = $1", disputeID).Scan(&transactionID)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("%w: %s", ErrDisputeNotFound, disputeID)
+		return models.Dispute{}, err
+	}
+	if err != nil {
+		return models.Dispute{}, fmt.Errorf("ошибка при получении спора: %w", err)
+	}
+	if _, _, err = lockPaymentTx(tx, transactionID); err != nil {
+		return models.Dispute{}, err
+	}
+
+	dispute, err := scanDispute(tx.QueryRow("SELECT "+disputeColumns+" FROM card_disputes WHERE id = $1 FOR UPDATE", disputeID))
+	if err != nil {
+		return models.Dispute{}, fmt.Errorf("ошибка при блокировке спора: %w", err)
+	}
+	if !models.CanTransitionDisputeStatus(dispute.Status, status) {
+		err = fmt.Errorf("%w: dispute %s is %s", ErrDisputeStatusConflict, disputeID, dispute.Status)
+		return models.Dispute{}, err
+	}
+
+	now := time.Now()
+	if status == models.DisputeStatusWon {
+		if err = checkRefundableTx(tx, transactionID, chargeback.Transaction.Amount); err != nil {
+			return models.Dispute{}, err
+		}
+		if err = postTransactionTx(tx, *chargeback); err != nil {
+			return models.Dispute{}, err
+		}
+		dispute.ChargebackTransactionID = chargeback.Transaction.ID
+		now = chargeback.Transaction.Timestamp
+	}
+
+	dispute.Status = status
+	dispute.Resolution = resolution
+	dispute.UpdatedAt = now
+	if !models.IsActiveDisputeStatus(status) {
+		dispute.ResolvedAt = &now
+	}
+
+	_, err = tx.Exec(`
+		UPDATE card_disputes
+		SET status = $2, resolution = NULLIF($3, ''), chargeback_transaction_id = NULLIF($4, ''),
+			updated_at = $5, resolved_at = $6
+		WHERE id = $1
+	`, disputeID, dispute.Status, dispute.Resolution, dispute.ChargebackTransactionID, dispute.UpdatedAt, dispute.ResolvedAt)
+	if err != nil {
+		return models.Dispute{}, fmt.Errorf("ошибка при обновлении спора: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.Dispute{}, fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+
+	log.Printf("Спор %s переведен в статус %s", disputeID, status)
+	return dispute, nil
+}
+
+// lockPaymentTx блокирует строку платежа по карте и возвращает его сумму и сумму уже проведенных возвратов
+func lockPaymentTx(tx *sql.Tx, transactionID string) (decimal.Decimal, decimal.Decimal, error) {
+	var amount decimal.Decimal
+	var transactionType string
+	err := tx.QueryRow("SELECT amount, transaction_type FROM transactions WHERE id = $1 FOR UPDATE", transactionID).
+		Scan(&amount, &transactionType)
+	if err == sql.ErrNoRows {
+		return decimal.Zero, decimal.Zero, fmt.Errorf("%w: %s", ErrTransactionNotFound, transactionID)
+	}
+	if err != nil {
+		return decimal.Zero, decimal.Zero, fmt.Errorf("ошибка при блокировке платежа: %w", err)
+	}
+	if transactionType != "payment" {
+		return decimal.Zero, decimal.Zero, fmt.Errorf("%w: %s is %s", ErrNotCardPayment, transactionID, transactionType)
+	}
+
+	refunded, err := refundedAmount(tx, transactionID)
+	if err != nil {
+		return decimal.Zero, decimal.Zero, err
+	}
+	return amount, refunded, nil
+}
+
+// refundedAmount считает сумму возвратов и компенсаций по платежу
+func refundedAmount(q interface {
+	QueryRow(string, ...interface{}) *sql.Row
+}, transactionID string) (decimal.Decimal, error) {
+	var refunded decimal.Decimal
+	err := q.QueryRow(`
+		SELECT COALESCE(SUM(amount), 0)
+		FROM transactions
+		WHERE related_transaction_id = $1 AND transaction_type IN ($2, $3)
+	`, transactionID, models.TransactionTypeRefund, models.TransactionTypeChargeback).Scan(&refunded)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("ошибка при подсчете возвратов по платежу: %w", err)
+	}
+	return refunded, nil
+}
+
+// checkRefundableTx блокирует платеж и проверяет, что сумма amount укладывается в его невозвращенный остаток
+func checkRefundableTx(tx *sql.Tx, transactionID string, amount decimal.Decimal) error {
+	paid, refunded, err := lockPaymentTx(tx, transactionID)
+	if err != nil {
+		return err
+	}
+	return checkRefundable(paid, refunded, amount)
+}
+
+// checkRefundable проверяет, что возврат amount не превысит сумму платежа paid с учетом уже возвращенной refunded
+func checkRefundable(paid, refunded, amount decimal.Decimal) error {
+	if refunded.Add(amount).GreaterThan(paid) {
+		return fmt.Errorf("%w: paid %s, refunded %s", ErrRefundExceedsPayment, paid.String(), refunded.String())
+	}
+	return nil
+}
+
+// scanDispute читает строку таблицы card_disputes, выбранную со столбцами disputeColumns
+func scanDispute(row interface{ Scan(...interface{}) error }) (models.Dispute, error) {
+	var dispute models.Dispute
+	var resolvedAt sql.NullTime
+	err := row.Scan(
+		&dispute.ID,
+		&dispute.TransactionID,
+		&dispute.AccountID,
+		&dispute.CardID,
+		&dispute.Amount,
+		&dispute.Reason,
+		&dispute.Status,
+		&dispute.Resolution,
+		&dispute.ChargebackTransactionID,
+		&dispute.CreatedAt,
+		&dispute.UpdatedAt,
+		&resolvedAt,
+	)
+	if resolvedAt.Valid {
+		dispute.ResolvedAt = &resolvedAt.Time
+	}
+	return dispute, err
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"bankapp/internal/models"
+)
+
+// SetExchangeRate сохраняет курс валюты к рублю, заменяя прежнее значение
+func (s *DBStorage) SetExchangeRate(rate models.ExchangeRate) error {
+	_, err := s.DB.Exec(`
+		INSERT INTO exchange_rates (currency, rate, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (currency) DO UPDATE SET rate = EXCLUDED.rate, updated_at = EXCLUDED.updated_at
+	`, rate.Currency, rate.Rate, rate.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении курса валюты: %w", err)
+	}
+	return nil
+}
+
+// GetExchangeRate получает курс валюты к рублю
+// Возвращает курс и булево значение, указывающее, установлен ли он
+func (s *DBStorage) GetExchangeRate(currency string) (models.ExchangeRate, bool) {
+	var rate models.ExchangeRate
+	err := s.DB.QueryRow("SELECT currency, rate, updated_at FROM exchange_rates WHERE currency = $1", currency).
+		Scan(&rate.Currency, &rate.Rate, &rate.UpdatedAt)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Ошибка при получении курса валюты: %v", err)
+		}
+		return models.ExchangeRate{}, false
+	}
+	return rate, true
+}
+
+// ListExchangeRates возвращает все установленные курсы валют в алфавитном порядке кодов
+func (s *DBStorage) ListExchangeRates() ([]models.ExchangeRate, error) {
+	rows, err := s.DB.Query("SELECT currency, rate, updated_at FROM exchange_rates ORDER BY currency")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении курсов валют: %w", err)
+	}
+	defer rows.Close()
+
+	var rates []models.ExchangeRate
+	for rows.Next() {
+		var rate models.ExchangeRate
+		if err := rows.Scan(&rate.Currency, &rate.Rate, &rate.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании курса валюты: %w", err)
+		}
+		rates = append(rates, rate)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по результатам запроса: %w", err)
+	}
+
+	return rates, nil
+}
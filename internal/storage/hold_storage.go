@@ -0,0 +1,340 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/models"
+)
+
+var (
+	// ErrHoldNotFound возвращается, если удержание не существует
+	ErrHoldNotFound = errors.New("hold not found")
+	// ErrHoldNotAuthorized возвращается при попытке списать или отменить уже завершенное удержание
+	ErrHoldNotAuthorized = errors.New("hold is not authorized")
+	// ErrHoldExpired возвращается при попытке списать удержание с истекшим сроком;
+	// такое удержание снимается
+	ErrHoldExpired = errors.New("hold expired")
+	// ErrCaptureExceedsHold возвращается, если сумма списания больше удержанной
+	ErrCaptureExceedsHold = errors.New("capture amount exceeds hold")
+)
+
+// holdColumns - столбцы таблицы card_holds в порядке сканирования scanHold
+const holdColumns = `id, card_id, account_id, amount, captured_amount, COALESCE(merchant, ''),
+		COALESCE(merchant_category, ''), status, COALESCE(transaction_id, ''), expires_at, created_at, completed_at`
+
+// AuthorizeHold удерживает сумму на счете карты
+// Лимиты карты проверяются с учетом платежей и других удержаний, сумма удержания
+// должна укладываться в доступный баланс счета
+// Возвращает ErrAccountFrozen, ErrInsufficientFunds или ошибки превышения лимитов карты
+func (s *DBStorage) AuthorizeHold(hold models.Hold) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = checkCardLimitsTx(tx, hold.CardID, hold.Amount, hold.CreatedAt); err != nil {
+		return err
+	}
+
+	var balance, held decimal.Decimal
+	var status string
+	err = tx.QueryRow("SELECT balance, held_amount, status FROM accounts WHERE id = $1 FOR UPDATE", hold.AccountID).
+		Scan(&balance, &held, &status)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("%w: %s", ErrAccountNotFound, hold.AccountID)
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка при блокировке счета %s: %w", hold.AccountID, err)
+	}
+	if status == models.AccountStatusFrozen {
+		err = fmt.Errorf("%w: %s", ErrAccountFrozen, hold.AccountID)
+		return err
+	}
+	if balance.Sub(held).LessThan(hold.Amount) {
+		err = fmt.Errorf("%w: account %s", ErrInsufficientFunds, hold.AccountID)
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO card_holds (id, card_id, account_id, amount, captured_amount, merchant, merchant_category,
+			status, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, 0, NULLIF($5, ''), NULLIF($6, ''), $7, $8, $9)
+	`, hold.ID, hold.CardID, hold.AccountID, hold.Amount, hold.Merchant, hold.MerchantCategory,
+		hold.Status, hold.ExpiresAt, hold.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении удержания: %w", err)
+	}
+
+	if _, err = tx.Exec("UPDATE accounts SET held_amount = held_amount + $2 WHERE id = $1", hold.AccountID, hold.Amount); err != nil {
+		return fmt.Errorf("ошибка при обновлении удержанной суммы: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+
+	log.Printf("Удержание %s на сумму %s по карте %s создано", hold.ID, hold.Amount.String(), hold.CardID)
+	return nil
+}
+
+// GetHold получает удержание по его ID
+// Возвращает удержание и булево значение, указывающее, найдено ли оно
+func (s *DBStorage) GetHold(holdID string) (models.Hold, bool) {
+	hold, err := scanHold(s.DB.QueryRow("SELECT "+holdColumns+" FROM card_holds WHERE id = $1", holdID))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Ошибка при получении удержания: %v", err)
+		}
+		return models.Hold{}, false
+	}
+	return hold, true
+}
+
+// ListCardHolds возвращает удержания по карте, начиная с самых новых
+func (s *DBStorage) ListCardHolds(cardID string) ([]models.Hold, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+holdColumns+`
+		FROM card_holds
+		WHERE card_id = $1
+		ORDER BY created_at DESC
+	`, cardID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении удержаний по карте: %w", err)
+	}
+	defer rows.Close()
+
+	holds := []models.Hold{}
+	for rows.Next() {
+		hold, err := scanHold(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании удержания: %w", err)
+		}
+		holds = append(holds, hold)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по результатам запроса: %w", err)
+	}
+	return holds, nil
+}
+
+// CaptureHold списывает удержание: снимает удержанную сумму и проводит платеж posting
+// Сумма списания берется из posting и не может превышать удержанную; остаток
+// возвращается в доступный баланс
+// Удержание с истекшим сроком снимается, и возвращается ErrHoldExpired
+func (s *DBStorage) CaptureHold(holdID string, posting models.Posting) (models.Hold, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return models.Hold{}, fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	hold, err := lockAuthorizedHoldTx(tx, holdID)
+	if err != nil {
+		return models.Hold{}, err
+	}
+
+	now := posting.Transaction.Timestamp
+	if !hold.ExpiresAt.After(now) {
+		if err = releaseHoldTx(tx, hold, models.HoldStatusExpired, now); err != nil {
+			return models.Hold{}, err
+		}
+		if err = tx.Commit(); err != nil {
+			return models.Hold{}, fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+		}
+		log.Printf("Удержание %s истекло до списания и снято", holdID)
+		return models.Hold{}, ErrHoldExpired
+	}
+
+	amount := posting.Transaction.Amount
+	if amount.GreaterThan(hold.Amount) {
+		err = fmt.Errorf("%w: captured %s, held %s", ErrCaptureExceedsHold, amount.String(), hold.Amount.String())
+		return models.Hold{}, err
+	}
+
+	// Сначала снимаем удержание, чтобы списание проверялось по освобожденному доступному балансу
+	if err = releaseHoldTx(tx, hold, models.HoldStatusCaptured, now); err != nil {
+		return models.Hold{}, err
+	}
+	if err = postTransactionTx(tx, posting); err != nil {
+		return models.Hold{}, err
+	}
+	if err = closeSingleUseCardTx(tx, hold.CardID); err != nil {
+		return models.Hold{}, err
+	}
+
+	_, err = tx.Exec("UPDATE card_holds SET captured_amount = $2, transaction_id = $3 WHERE id = $1",
+		holdID, amount, posting.Transaction.ID)
+	if err != nil {
+		return models.Hold{}, fmt.Errorf("ошибка при обновлении удержания: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.Hold{}, fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+
+	hold.Status = models.HoldStatusCaptured
+	hold.CapturedAmount = amount
+	hold.TransactionID = posting.Transaction.ID
+	hold.CompletedAt = &now
+	log.Printf("Удержание %s списано на сумму %s", holdID, amount.String())
+	return hold, nil
+}
+
+// VoidHold отменяет удержание и возвращает сумму в доступный баланс счета
+func (s *DBStorage) VoidHold(holdID string) (models.Hold, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return models.Hold{}, fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	hold, err := lockAuthorizedHoldTx(tx, holdID)
+	if err != nil {
+		return models.Hold{}, err
+	}
+
+	now := time.Now()
+	if err = releaseHoldTx(tx, hold, models.HoldStatusVoided, now); err != nil {
+		return models.Hold{}, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.Hold{}, fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+
+	hold.Status = models.HoldStatusVoided
+	hold.CompletedAt = &now
+	log.Printf("Удержание %s отменено", holdID)
+	return hold, nil
+}
+
+// ExpireHolds снимает удержания, срок которых истек к моменту now
+// Возвращает количество снятых удержаний
+func (s *DBStorage) ExpireHolds(now time.Time) (int, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	rows, err := tx.Query(`
+		UPDATE card_holds SET status = $2, completed_at = $1
+		WHERE status = $3 AND expires_at <= $1
+		RETURNING account_id, amount
+	`, now, models.HoldStatusExpired, models.HoldStatusAuthorized)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при снятии истекших удержаний: %w", err)
+	}
+
+	released := make(map[string]decimal.Decimal)
+	count := 0
+	for rows.Next() {
+		var accountID string
+		var amount decimal.Decimal
+		if err = rows.Scan(&accountID, &amount); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("ошибка при сканировании удержания: %w", err)
+		}
+		released[accountID] = released[accountID].Add(amount)
+		count++
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("ошибка при итерации по результатам запроса: %w", err)
+	}
+
+	// Обновляем счета в порядке возрастания ID, как и при проведении операций
+	accountIDs := make([]string, 0, len(released))
+	for accountID := range released {
+		accountIDs = append(accountIDs, accountID)
+	}
+	sort.Strings(accountIDs)
+	for _, accountID := range accountIDs {
+		_, err = tx.Exec("UPDATE accounts SET held_amount = held_amount - $2 WHERE id = $1", accountID, released[accountID])
+		if err != nil {
+			return 0, fmt.Errorf("ошибка при обновлении удержанной суммы: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+	return count, nil
+}
+
+// lockAuthorizedHoldTx блокирует строку удержания и проверяет, что оно еще действует
+func lockAuthorizedHoldTx(tx *sql.Tx, holdID string) (models.Hold, error) {
+	hold, err := scanHold(tx.QueryRow("SELECT "+holdColumns+" FROM card_holds WHERE id = $1 FOR UPDATE", holdID))
+	if err == sql.ErrNoRows {
+		return models.Hold{}, fmt.Errorf("%w: %s", ErrHoldNotFound, holdID)
+	}
+	if err != nil {
+		return models.Hold{}, fmt.Errorf("ошибка при получении удержания: %w", err)
+	}
+	if hold.Status != models.HoldStatusAuthorized {
+		return models.Hold{}, fmt.Errorf("%w: hold %s is %s", ErrHoldNotAuthorized, holdID, hold.Status)
+	}
+	return hold, nil
+}
+
+// releaseHoldTx завершает удержание со статусом status и возвращает его сумму в доступный баланс счета
+func releaseHoldTx(tx *sql.Tx, hold models.Hold, status string, at time.Time) error {
+	if _, err := tx.Exec("UPDATE card_holds SET status = $2, completed_at = $3 WHERE id = $1", hold.ID, status, at); err != nil {
+		return fmt.Errorf("ошибка при обновлении удержания: %w", err)
+	}
+	_, err := tx.Exec("UPDATE accounts SET held_amount = held_amount - $2 WHERE id = $1", hold.AccountID, hold.Amount)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении удержанной суммы: %w", err)
+	}
+	return nil
+}
+
+// scanHold читает строку таблицы card_holds, выбранную со столбцами holdColumns
+func scanHold(row interface{ Scan(...interface{}) error }) (models.Hold, error) {
+	var hold models.Hold
+	var completedAt sql.NullTime
+	err := row.Scan(
+		&hold.ID,
+		&hold.CardID,
+		&hold.AccountID,
+		&hold.Amount,
+		&hold.CapturedAmount,
+		&hold.Merchant,
+		&hold.MerchantCategory,
+		&hold.Status,
+		&hold.TransactionID,
+		&hold.ExpiresAt,
+		&hold.CreatedAt,
+		&completedAt,
+	)
+	if completedAt.Valid {
+		hold.CompletedAt = &completedAt.Time
+	}
+	return hold, err
+}
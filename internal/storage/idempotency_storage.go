@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"bankapp/internal/models"
+)
+
+// ErrIdempotencyKeyNotReserved возвращается, если ключ идемпотентности больше не зарезервирован запросом
+var ErrIdempotencyKeyNotReserved = errors.New("idempotency key is not reserved by this request")
+
+// ReserveIdempotencyKey резервирует ключ идемпотентности за пользователем
+// Заново резервируется только истекший ключ: незавершенный ключ остается за исходным запросом
+// до истечения срока хранения, так как операция могла быть проведена
+// Если ключ занят, возвращает сохраненную запись и false
+func (s *DBStorage) ReserveIdempotencyKey(record models.IdempotencyRecord) (models.IdempotencyRecord, bool, error) {
+	result, err := s.DB.Exec(`
+		INSERT INTO idempotency_keys (user_id, idempotency_key, method, path, fingerprint, created_at, reserved_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (user_id, idempotency_key) DO UPDATE
+		SET method = EXCLUDED.method,
+			path = EXCLUDED.path,
+			fingerprint = EXCLUDED.fingerprint,
+			status_code = NULL,
+			response_body = NULL,
+			created_at = EXCLUDED.created_at,
+			completed_at = NULL,
+			reserved_at = EXCLUDED.reserved_at,
+			expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= EXCLUDED.reserved_at
+	`, record.UserID, record.Key, record.Method, record.Path, record.Fingerprint, record.CreatedAt,
+		record.ReservedAt, record.ExpiresAt)
+	if err != nil {
+		return models.IdempotencyRecord{}, false, fmt.Errorf("ошибка при резервировании ключа идемпотентности: %w", err)
+	}
+
+	reserved, err := result.RowsAffected()
+	if err != nil {
+		return models.IdempotencyRecord{}, false, fmt.Errorf("ошибка при резервировании ключа идемпотентности: %w", err)
+	}
+	if reserved == 1 {
+		return record, true, nil
+	}
+
+	var existing models.IdempotencyRecord
+	var statusCode sql.NullInt64
+	var completedAt sql.NullTime
+	err = s.DB.QueryRow(`
+		SELECT user_id, idempotency_key, method, path, fingerprint, status_code, response_body, created_at, completed_at,
+			reserved_at, expires_at
+		FROM idempotency_keys
+		WHERE user_id = $1 AND idempotency_key = $2
+	`, record.UserID, record.Key).Scan(
+		&existing.UserID,
+		&existing.Key,
+		&existing.Method,
+		&existing.Path,
+		&existing.Fingerprint,
+		&statusCode,
+		&existing.ResponseBody,
+		&existing.CreatedAt,
+		&completedAt,
+		&existing.ReservedAt,
+		&existing.ExpiresAt,
+	)
+	if err != nil {
+		return models.IdempotencyRecord{}, false, fmt.Errorf("ошибка при получении ключа идемпотентности: %w", err)
+	}
+	existing.StatusCode = int(statusCode.Int64)
+	existing.Completed = completedAt.Valid
+
+	return existing, false, nil
+}
+
+// CompleteIdempotencyKey сохраняет ответ на запрос для последующего воспроизведения
+// Если ключ с тех пор истек и зарезервирован другим запросом, возвращает ErrIdempotencyKeyNotReserved
+func (s *DBStorage) CompleteIdempotencyKey(userID, key string, reservedAt time.Time, statusCode int, responseBody []byte) error {
+	result, err := s.DB.Exec(`
+		UPDATE idempotency_keys
+		SET status_code = $4, response_body = $5, completed_at = $6
+		WHERE user_id = $1 AND idempotency_key = $2 AND reserved_at = $3
+	`, userID, key, reservedAt, statusCode, responseBody, time.Now())
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении ответа для ключа идемпотентности: %w", err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении ответа для ключа идемпотентности: %w", err)
+	}
+	if updated == 0 {
+		return ErrIdempotencyKeyNotReserved
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey освобождает зарезервированный ключ, чтобы запрос можно было повторить
+func (s *DBStorage) ReleaseIdempotencyKey(userID, key string, reservedAt time.Time) error {
+	_, err := s.DB.Exec(`
+		DELETE FROM idempotency_keys
+		WHERE user_id = $1 AND idempotency_key = $2 AND reserved_at = $3 AND completed_at IS NULL
+	`, userID, key, reservedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при освобождении ключа идемпотентности: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpiredIdempotencyKeys удаляет ключи идемпотентности, срок хранения которых истек до момента before
+// Возвращает количество удаленных ключей
+func (s *DBStorage) PurgeExpiredIdempotencyKeys(before time.Time) (int64, error) {
+	result, err := s.DB.Exec("DELETE FROM idempotency_keys WHERE expires_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при удалении истекших ключей идемпотентности: %w", err)
+	}
+	purged, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при удалении истекших ключей идемпотентности: %w", err)
+	}
+	return purged, nil
+}
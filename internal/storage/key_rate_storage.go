@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"bankapp/internal/models"
+)
+
+// SaveKeyRates сохраняет ключевые ставки в историю
+// Ставка, уже сохраненная на ту же дату, заменяется последним полученным значением
+func (s *DBStorage) SaveKeyRates(rates []models.KeyRate) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, rate := range rates {
+		_, err = tx.Exec(`
+			INSERT INTO key_rates (effective_date, rate, source, fetched_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (effective_date) DO UPDATE
+			SET rate = EXCLUDED.rate, source = EXCLUDED.source, fetched_at = EXCLUDED.fetched_at
+		`, rate.Date, rate.Rate, rate.Source, rate.FetchedAt)
+		if err != nil {
+			return fmt.Errorf("ошибка при сохранении ключевой ставки: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+	return nil
+}
+
+// GetKeyRate возвращает ключевую ставку, действовавшую на дату date, - последнюю сохраненную
+// ставку с датой начала действия не позже date
+// Возвращает ставку и булево значение, указывающее, найдена ли она
+func (s *DBStorage) GetKeyRate(date time.Time) (models.KeyRate, bool) {
+	var rate models.KeyRate
+	err := s.DB.QueryRow(`
+		SELECT effective_date, rate, source, fetched_at
+		FROM key_rates
+		WHERE effective_date <= $1
+		ORDER BY effective_date DESC
+		LIMIT 1
+	`, date.Format("2006-01-02")).Scan(&rate.Date, &rate.Rate, &rate.Source, &rate.FetchedAt)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Ошибка при получении ключевой ставки: %v", err)
+		}
+		return models.KeyRate{}, false
+	}
+	return rate, true
+}
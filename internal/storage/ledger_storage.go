@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/models"
+)
+
+// Системные счета главной книги, выступающие второй стороной проводок
+// для операций с внешним миром
+const (
+	LedgerCash           = "system:cash"            // Касса: наличные пополнения счетов
+	LedgerLoans          = "system:loans"           // Ссудная задолженность клиентов
+	LedgerInterestIncome = "system:interest_income" // Процентные доходы и штрафы по кредитам
+	LedgerCardSettlement = "system:card_settlement" // Расчеты с торговыми точками по картам
+	LedgerOpening        = "system:opening"         // Входящие остатки счетов, открытых до ведения главной книги
+)
+
+// systemLedgerPrefix отличает системные счета от клиентских
+const systemLedgerPrefix = "system:"
+
+// fxLedgerPrefix - префикс валютных позиций банка, через которые проходят конвертации
+const fxLedgerPrefix = systemLedgerPrefix + "fx:"
+
+var (
+	// ErrInsufficientFunds возвращается, если проводка уводит клиентский счет в минус
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	// ErrUnbalancedPosting возвращается, если сумма дебета не совпадает с суммой кредита
+	ErrUnbalancedPosting = errors.New("unbalanced posting")
+	// ErrAccountNotFound возвращается, если клиентский счет из проводки не существует
+	ErrAccountNotFound = errors.New("account not found")
+	// ErrAccountFrozen возвращается при попытке списания с замороженного счета
+	ErrAccountFrozen = errors.New("account is frozen")
+	// ErrAccountNumberTaken возвращается при создании счета с уже занятым номером;
+	// вызывающий код должен сгенерировать новый номер
+	ErrAccountNumberTaken = errors.New("account number already taken")
+	// ErrCurrencyMismatch возвращается, если валюта клиентского счета не совпадает с валютой проводки
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+)
+
+// FXLedgerAccount возвращает системный счет валютной позиции банка в валюте currency
+// При конвертации клиентский счет в одной валюте корреспондирует с позицией в той же валюте,
+// поэтому проводки сбалансированы по каждой валюте отдельно
+func FXLedgerAccount(currency string) string {
+	return fxLedgerPrefix + currency
+}
+
+// postingCurrency возвращает валюту, в которой проводка затрагивает клиентский счет
+// При конвертации счет зачисления ведется в целевой валюте, остальные - в валюте операции
+func postingCurrency(tx models.Transaction, accountID string) string {
+	if tx.Conversion != nil && accountID == tx.ToAccountID {
+		return tx.Conversion.ToCurrency
+	}
+	return tx.Currency
+}
+
+// DebitLeg создает проводку по дебету указанного счета главной книги
+// Для клиентского счета дебет уменьшает баланс
+func DebitLeg(ledgerAccount string, amount decimal.Decimal) models.JournalEntry {
+	return models.JournalEntry{LedgerAccount: ledgerAccount, Debit: amount, Credit: decimal.Zero}
+}
+
+// CreditLeg создает проводку по кредиту указанного счета главной книги
+// Для клиентского счета кредит увеличивает баланс
+func CreditLeg(ledgerAccount string, amount decimal.Decimal) models.JournalEntry {
+	return models.JournalEntry{LedgerAccount: ledgerAccount, Debit: decimal.Zero, Credit: amount}
+}
+
+// IsSystemLedgerAccount сообщает, является ли счет главной книги системным
+func IsSystemLedgerAccount(ledgerAccount string) bool {
+	return strings.HasPrefix(ledgerAccount, systemLedgerPrefix)
+}
+
+// PostTransaction атомарно проводит операцию: записывает транзакцию, ее проводки
+// и обновляет балансы затронутых клиентских счетов в одной транзакции базы данных
+// Списание с клиентского счета возможно только в пределах доступного баланса
+// Возвращает ErrUnbalancedPosting, ErrAccountNotFound, ErrAccountFrozen, ErrCurrencyMismatch или ErrInsufficientFunds
+func (s *DBStorage) PostTransaction(posting models.Posting) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = postTransactionTx(tx, posting); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+
+	log.Printf("Транзакция %s проведена. Тип: %s, Сумма: %s, проводок: %d",
+		posting.Transaction.ID, posting.Transaction.TransactionType, posting.Transaction.Amount.String(), len(posting.Entries))
+	return nil
+}
+
+// ReconcileBalances сверяет сохраненные балансы счетов с суммой проводок главной книги
+// Возвращает срез счетов, по которым обнаружены расхождения
+func (s *DBStorage) ReconcileBalances() ([]models.BalanceDiscrepancy, error) {
+	query := `
+		SELECT a.id, a.balance, COALESCE(SUM(e.credit - e.debit), 0) AS ledger_balance
+		FROM accounts a
+		LEFT JOIN journal_entries e ON e.ledger_account = a.id
+		GROUP BY a.id, a.balance
+		HAVING a.balance <> COALESCE(SUM(e.credit - e.debit), 0)
+		ORDER BY a.id
+	`
+	rows, err := s.DB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при сверке балансов: %w", err)
+	}
+	defer rows.Close()
+
+	var discrepancies []models.BalanceDiscrepancy
+	for rows.Next() {
+		var d models.BalanceDiscrepancy
+		if err := rows.Scan(&d.AccountID, &d.StoredBalance, &d.LedgerBalance); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании результатов сверки: %w", err)
+		}
+		discrepancies = append(discrepancies, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по результатам запроса: %w", err)
+	}
+
+	return discrepancies, nil
+}
+
+// validatePosting проверяет, что проводки корректны и сбалансированы
+func validatePosting(posting models.Posting) error {
+	if len(posting.Entries) < 2 {
+		return fmt.Errorf("%w: at least two entries are required", ErrUnbalancedPosting)
+	}
+
+	totalDebit := decimal.Zero
+	totalCredit := decimal.Zero
+	for _, entry := range posting.Entries {
+		if entry.LedgerAccount == "" {
+			return fmt.Errorf("%w: entry without ledger account", ErrUnbalancedPosting)
+		}
+		if entry.Debit.IsNegative() || entry.Credit.IsNegative() || entry.Debit.IsZero() == entry.Credit.IsZero() {
+			return fmt.Errorf("%w: entry for %s must have exactly one positive side", ErrUnbalancedPosting, entry.LedgerAccount)
+		}
+		totalDebit = totalDebit.Add(entry.Debit)
+		totalCredit = totalCredit.Add(entry.Credit)
+	}
+
+	if !totalDebit.Equal(totalCredit) {
+		return fmt.Errorf("%w: debit %s != credit %s", ErrUnbalancedPosting, totalDebit.String(), totalCredit.String())
+	}
+	return nil
+}
+
+// postTransactionTx выполняет проведение операции внутри уже открытой транзакции базы данных
+// Клиентские счета блокируются в порядке возрастания ID, чтобы исключить взаимные блокировки
+func postTransactionTx(tx *sql.Tx, posting models.Posting) error {
+	if err := validatePosting(posting); err != nil {
+		return err
+	}
+
+	// Считаем изменение баланса по каждому клиентскому счету
+	deltas := make(map[string]decimal.Decimal)
+	for _, entry := range posting.Entries {
+		if IsSystemLedgerAccount(entry.LedgerAccount) {
+			continue
+		}
+		deltas[entry.LedgerAccount] = deltas[entry.LedgerAccount].Add(entry.Credit).Sub(entry.Debit)
+	}
+
+	accountIDs := make([]string, 0, len(deltas))
+	for accountID := range deltas {
+		accountIDs = append(accountIDs, accountID)
+	}
+	sort.Strings(accountIDs)
+
+	// Блокируем строки счетов и проверяем достаточность средств
+	// Списание не может затрагивать суммы, удержанные при авторизации платежей по картам
+	newBalances := make(map[string]decimal.Decimal, len(accountIDs))
+	for _, accountID := range accountIDs {
+		var balance, held decimal.Decimal
+		var status, currency string
+		err := tx.QueryRow("SELECT balance, held_amount, status, currency FROM accounts WHERE id = $1 FOR UPDATE", accountID).
+			Scan(&balance, &held, &status, &currency)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: %s", ErrAccountNotFound, accountID)
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка при блокировке счета %s: %w", accountID, err)
+		}
+
+		if expected := postingCurrency(posting.Transaction, accountID); currency != expected {
+			return fmt.Errorf("%w: account %s is in %s, posting is in %s", ErrCurrencyMismatch, accountID, currency, expected)
+		}
+
+		if deltas[accountID].IsNegative() && status == models.AccountStatusFrozen {
+			return fmt.Errorf("%w: %s", ErrAccountFrozen, accountID)
+		}
+
+		newBalance := balance.Add(deltas[accountID])
+		if deltas[accountID].IsNegative() && newBalance.Sub(held).IsNegative() {
+			return fmt.Errorf("%w: account %s", ErrInsufficientFunds, accountID)
+		}
+		newBalances[accountID] = newBalance
+	}
+
+	if err := insertTransaction(tx, posting.Transaction); err != nil {
+		return err
+	}
+
+	for _, entry := range posting.Entries {
+		_, err := tx.Exec(`
+			INSERT INTO journal_entries (transaction_id, ledger_account, debit, credit, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+		`, posting.Transaction.ID, entry.LedgerAccount, entry.Debit, entry.Credit, posting.Transaction.Timestamp)
+		if err != nil {
+			return fmt.Errorf("ошибка при сохранении проводки: %w", err)
+		}
+	}
+
+	for _, accountID := range accountIDs {
+		_, err := tx.Exec("UPDATE accounts SET balance = $1 WHERE id = $2", newBalances[accountID], accountID)
+		if err != nil {
+			return fmt.Errorf("ошибка при обновлении баланса: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"bankapp/internal/models"
+)
+
+var (
+	// ErrLoanApplicationNotFound возвращается, если заявка на кредит не существует
+	ErrLoanApplicationNotFound = errors.New("loan application not found")
+	// ErrLoanApplicationStatusConflict возвращается, если переход заявки в новый статус недопустим
+	// или ее статус изменился параллельным запросом
+	ErrLoanApplicationStatusConflict = errors.New("loan application status conflict")
+)
+
+// loanApplicationColumns - столбцы таблицы loan_applications в порядке сканирования scanLoanApplication
+const loanApplicationColumns = `id, user_id, account_id, product_id, amount, currency, term_months, status, scoring,
+	COALESCE(reviewer_id, ''), COALESCE(review_comment, ''), COALESCE(loan_id, ''), COALESCE(disbursed_by, ''),
+	created_at, updated_at, decided_at`
+
+// CreateLoanApplication сохраняет новую заявку на кредит
+func (s *DBStorage) CreateLoanApplication(application models.LoanApplication) error {
+	scoring, err := marshalScoring(application.Scoring)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.DB.Exec(`
+		INSERT INTO loan_applications (id, user_id, account_id, product_id, amount, currency, term_months,
+			status, scoring, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`, application.ID, application.UserID, application.AccountID, application.ProductID, application.Amount,
+		application.Currency, application.TermMonths, application.Status, scoring,
+		application.CreatedAt, application.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении заявки на кредит: %w", err)
+	}
+
+	log.Printf("Принята заявка на кредит %s пользователя %s на сумму %s", application.ID, application.UserID, application.Amount.String())
+	return nil
+}
+
+// GetLoanApplication получает заявку на кредит по ее ID
+// Возвращает заявку и булево значение, указывающее, найдена ли она
+func (s *DBStorage) GetLoanApplication(applicationID string) (models.LoanApplication, bool) {
+	application, err := scanLoanApplication(s.DB.QueryRow(
+		"SELECT "+loanApplicationColumns+" FROM loan_applications WHERE id = $1", applicationID))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Ошибка при получении заявки на кредит: %v", err)
+		}
+		return models.LoanApplication{}, false
+	}
+	return application, true
+}
+
+// ListLoanApplications возвращает заявки на кредит, удовлетворяющие фильтру, начиная с самых новых
+func (s *DBStorage) ListLoanApplications(filter models.LoanApplicationFilter) ([]models.LoanApplication, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.UserID != "" {
+		args = append(args, filter.UserID)
+		conditions = append(conditions, fmt.Sprintf("user_id = $%d", len(args)))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT `+loanApplicationColumns+`
+		FROM loan_applications
+	`+whereClause(conditions)+`
+		ORDER BY created_at DESC
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении заявок на кредит: %w", err)
+	}
+	defer rows.Close()
+
+	applications := []models.LoanApplication{}
+	for rows.Next() {
+		application, err := scanLoanApplication(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании заявки на кредит: %w", err)
+		}
+		applications = append(applications, application)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по результатам запроса: %w", err)
+	}
+	return applications, nil
+}
+
+// UpdateLoanApplication переводит заявку из статуса fromStatus в статус application.Status
+// и сохраняет результат скоринга и решение операциониста
+// Выдача кредита проводится DisburseLoanApplication
+// Возвращает ErrLoanApplicationNotFound или ErrLoanApplicationStatusConflict, если переход недопустим
+// или заявка уже не в статусе fromStatus
+func (s *DBStorage) UpdateLoanApplication(application models.LoanApplication, fromStatus string) error {
+	if application.Status == models.LoanApplicationDisbursed || !models.CanTransitionLoanApplication(fromStatus, application.Status) {
+		return fmt.Errorf("%w: %s -> %s", ErrLoanApplicationStatusConflict, fromStatus, application.Status)
+	}
+	scoring, err := marshalScoring(application.Scoring)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.DB.Exec(`
+		UPDATE loan_applications
+		SET status = $3, scoring = $4, reviewer_id = NULLIF($5, ''), review_comment = NULLIF($6, ''),
+			updated_at = $7, decided_at = $8
+		WHERE id = $1 AND status = $2
+	`, application.ID, fromStatus, application.Status, scoring, application.ReviewerID, application.ReviewComment,
+		application.UpdatedAt, application.DecidedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении заявки на кредит: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении заявки на кредит: %w", err)
+	}
+	if affected == 0 {
+		if _, ok := s.GetLoanApplication(application.ID); !ok {
+			return fmt.Errorf("%w: %s", ErrLoanApplicationNotFound, application.ID)
+		}
+		return fmt.Errorf("%w: application %s is no longer %s", ErrLoanApplicationStatusConflict, application.ID, fromStatus)
+	}
+
+	log.Printf("Заявка на кредит %s переведена из статуса %s в статус %s", application.ID, fromStatus, application.Status)
+	return nil
+}
+
+// DisburseLoanApplication выдает кредит loan по одобренной заявке: сохраняет кредит, проводит зачисление
+// disbursement и переводит заявку в статус disbursed в одной транзакции базы данных
+// disbursedBy - операционист, выдавший кредит; пусто при автоматической выдаче
+// Возвращает ErrLoanApplicationNotFound или ErrLoanApplicationStatusConflict, если заявка не одобрена
+// или кредит по ней уже выдан
+func (s *DBStorage) DisburseLoanApplication(applicationID, disbursedBy string, loan models.Loan, disbursement models.Posting) (models.LoanApplication, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return models.LoanApplication{}, fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Блокируем заявку, чтобы по ней не выдали кредит дважды
+	application, err := scanLoanApplication(tx.QueryRow(
+		"SELECT "+loanApplicationColumns+" FROM loan_applications WHERE id = $1 FOR UPDATE", applicationID))
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("%w: %s", ErrLoanApplicationNotFound, applicationID)
+		return models.LoanApplication{}, err
+	}
+	if err != nil {
+		return models.LoanApplication{}, fmt.Errorf("ошибка при блокировке заявки на кредит: %w", err)
+	}
+	if application.Status != models.LoanApplicationApproved {
+		err = fmt.Errorf("%w: application %s is %s", ErrLoanApplicationStatusConflict, applicationID, application.Status)
+		return models.LoanApplication{}, err
+	}
+
+	if err = insertLoanTx(tx, loan); err != nil {
+		return models.LoanApplication{}, err
+	}
+	if err = postTransactionTx(tx, disbursement); err != nil {
+		return models.LoanApplication{}, err
+	}
+
+	application.Status = models.LoanApplicationDisbursed
+	application.LoanID = loan.ID
+	application.DisbursedBy = disbursedBy
+	application.UpdatedAt = disbursement.Transaction.Timestamp
+	_, err = tx.Exec(`
+		UPDATE loan_applications SET status = $2, loan_id = $3, disbursed_by = NULLIF($4, ''), updated_at = $5
+		WHERE id = $1
+	`, applicationID, application.Status, application.LoanID, application.DisbursedBy, application.UpdatedAt)
+	if err != nil {
+		return models.LoanApplication{}, fmt.Errorf("ошибка при обновлении заявки на кредит: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.LoanApplication{}, fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+
+	log.Printf("По заявке %s выдан кредит %s на сумму %s", applicationID, loan.ID, loan.Amount.String())
+	return application, nil
+}
+
+// marshalScoring сериализует результат скоринга для столбца scoring; nil сохраняется как NULL
+func marshalScoring(scoring *models.ScoringResult) (interface{}, error) {
+	if scoring == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(scoring)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при сериализации результата скоринга: %w", err)
+	}
+	return data, nil
+}
+
+// scanLoanApplication читает строку таблицы loan_applications, выбранную со столбцами loanApplicationColumns
+func scanLoanApplication(row interface{ Scan(...interface{}) error }) (models.LoanApplication, error) {
+	var application models.LoanApplication
+	var scoring []byte
+	var decidedAt sql.NullTime
+	err := row.Scan(
+		&application.ID,
+		&application.UserID,
+		&application.AccountID,
+		&application.ProductID,
+		&application.Amount,
+		&application.Currency,
+		&application.TermMonths,
+		&application.Status,
+		&scoring,
+		&application.ReviewerID,
+		&application.ReviewComment,
+		&application.LoanID,
+		&application.DisbursedBy,
+		&application.CreatedAt,
+		&application.UpdatedAt,
+		&decidedAt,
+	)
+	if err != nil {
+		return application, err
+	}
+	if len(scoring) > 0 {
+		application.Scoring = &models.ScoringResult{}
+		if err := json.Unmarshal(scoring, application.Scoring); err != nil {
+			return application, fmt.Errorf("ошибка при разборе результата скоринга: %w", err)
+		}
+	}
+	if decidedAt.Valid {
+		application.DecidedAt = &decidedAt.Time
+	}
+	return application, nil
+}
@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/models"
+)
+
+var (
+	// ErrLoanProductNotFound возвращается, если кредитный продукт не существует
+	ErrLoanProductNotFound = errors.New("loan product not found")
+	// ErrLoanProductExists возвращается, если продукт с таким ID или названием уже есть
+	ErrLoanProductExists = errors.New("loan product already exists")
+	// ErrLoanProductInUse возвращается при удалении продукта, по которому выданы кредиты или поданы заявки;
+	// такой продукт можно только сделать недоступным для новых кредитов
+	ErrLoanProductInUse = errors.New("loan product has loans or loan applications")
+)
+
+// loanProductColumns - столбцы таблицы loan_products в порядке сканирования scanLoanProduct
+const loanProductColumns = `id, name, currency, min_amount, max_amount, min_term_months, max_term_months,
+	pricing, rate_margin, fixed_rate, rate_type, rate_reset_months, penalty_percent, penalty_due_days,
+	amortization, active, created_at, updated_at`
+
+// DefaultLoanProducts возвращает кредитные продукты, создаваемые вместе со схемой
+// Миграция 0019_loan_products добавляет такие же продукты в базу данных
+func DefaultLoanProducts(now time.Time) []models.LoanProduct {
+	consumer := models.LoanProduct{
+		ID:             "consumer-fixed",
+		Name:           "Потребительский кредит",
+		Currency:       models.CurrencyRUB,
+		MinAmount:      decimal.NewFromInt(10000),
+		MaxAmount:      decimal.NewFromInt(5000000),
+		MinTermMonths:  3,
+		MaxTermMonths:  60,
+		Pricing:        models.LoanPricingKeyRateMargin,
+		RateMargin:     decimal.NewFromInt(5),
+		RateType:       models.LoanRateFixed,
+		PenaltyPercent: decimal.NewFromInt(10),
+		PenaltyDueDays: 7,
+		Amortization:   models.AmortizationAnnuity,
+		Active:         true,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+
+	floating := consumer
+	floating.ID = "consumer-floating"
+	floating.Name = "Потребительский кредит с плавающей ставкой"
+	floating.RateMargin = decimal.NewFromInt(4)
+	floating.RateType = models.LoanRateFloating
+	floating.RateResetMonths = 3
+
+	return []models.LoanProduct{consumer, floating}
+}
+
+// CreateLoanProduct добавляет кредитный продукт
+// Возвращает ErrLoanProductExists, если продукт с таким ID или названием уже есть
+func (s *DBStorage) CreateLoanProduct(product models.LoanProduct) error {
+	result, err := s.DB.Exec(`
+		INSERT INTO loan_products (`+loanProductColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+		ON CONFLICT DO NOTHING
+	`, product.ID, product.Name, product.Currency, product.MinAmount, product.MaxAmount,
+		product.MinTermMonths, product.MaxTermMonths, product.Pricing, product.RateMargin, product.FixedRate,
+		product.RateType, product.RateResetMonths, product.PenaltyPercent, product.PenaltyDueDays,
+		product.Amortization, product.Active, product.CreatedAt, product.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании кредитного продукта: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при создании кредитного продукта: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: %s", ErrLoanProductExists, product.Name)
+	}
+
+	log.Printf("Создан кредитный продукт %s (%s)", product.ID, product.Name)
+	return nil
+}
+
+// GetLoanProduct возвращает кредитный продукт по ID
+// Возвращает продукт и булево значение, указывающее, найден ли он
+func (s *DBStorage) GetLoanProduct(productID string) (models.LoanProduct, bool) {
+	product, err := scanLoanProduct(s.DB.QueryRow("SELECT "+loanProductColumns+" FROM loan_products WHERE id = $1", productID))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Ошибка при получении кредитного продукта: %v", err)
+		}
+		return models.LoanProduct{}, false
+	}
+	return product, true
+}
+
+// ListLoanProducts возвращает кредитные продукты по названию; activeOnly - только доступные для новых кредитов
+func (s *DBStorage) ListLoanProducts(activeOnly bool) ([]models.LoanProduct, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+loanProductColumns+`
+		FROM loan_products
+		WHERE active OR NOT $1
+		ORDER BY name
+	`, activeOnly)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении кредитных продуктов: %w", err)
+	}
+	defer rows.Close()
+
+	products := []models.LoanProduct{}
+	for rows.Next() {
+		product, err := scanLoanProduct(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании кредитного продукта: %w", err)
+		}
+		products = append(products, product)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по результатам запроса: %w", err)
+	}
+	return products, nil
+}
+
+// UpdateLoanProduct заменяет условия кредитного продукта; выданные кредиты сохраняют прежние условия
+// Возвращает ErrLoanProductNotFound, если продукта нет, и ErrLoanProductExists, если название занято другим продуктом
+func (s *DBStorage) UpdateLoanProduct(product models.LoanProduct) error {
+	var taken bool
+	err := s.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM loan_products WHERE name = $1 AND id <> $2)",
+		product.Name, product.ID).Scan(&taken)
+	if err != nil {
+		return fmt.Errorf("ошибка при проверке названия кредитного продукта: %w", err)
+	}
+	if taken {
+		return fmt.Errorf("%w: %s", ErrLoanProductExists, product.Name)
+	}
+
+	result, err := s.DB.Exec(`
+		UPDATE loan_products
+		SET name = $2, currency = $3, min_amount = $4, max_amount = $5, min_term_months = $6,
+			max_term_months = $7, pricing = $8, rate_margin = $9, fixed_rate = $10, rate_type = $11,
+			rate_reset_months = $12, penalty_percent = $13, penalty_due_days = $14, amortization = $15,
+			active = $16, updated_at = $17
+		WHERE id = $1
+	`, product.ID, product.Name, product.Currency, product.MinAmount, product.MaxAmount,
+		product.MinTermMonths, product.MaxTermMonths, product.Pricing, product.RateMargin, product.FixedRate,
+		product.RateType, product.RateResetMonths, product.PenaltyPercent, product.PenaltyDueDays,
+		product.Amortization, product.Active, product.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при изменении кредитного продукта: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при изменении кредитного продукта: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: %s", ErrLoanProductNotFound, product.ID)
+	}
+
+	log.Printf("Кредитный продукт %s изменен", product.ID)
+	return nil
+}
+
+// DeleteLoanProduct удаляет кредитный продукт
+// Возвращает ErrLoanProductNotFound, если продукта нет, и ErrLoanProductInUse, если по нему выданы кредиты или поданы заявки
+func (s *DBStorage) DeleteLoanProduct(productID string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Блокируем продукт, чтобы по нему не подали заявку между проверкой и удалением
+	var id string
+	err = tx.QueryRow("SELECT id FROM loan_products WHERE id = $1 FOR UPDATE", productID).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("%w: %s", ErrLoanProductNotFound, productID)
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка при блокировке кредитного продукта: %w", err)
+	}
+
+	var inUse bool
+	err = tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM credits WHERE product_id = $1)
+			OR EXISTS(SELECT 1 FROM loan_applications WHERE product_id = $1)
+	`, productID).Scan(&inUse)
+	if err != nil {
+		return fmt.Errorf("ошибка при проверке кредитов и заявок по продукту: %w", err)
+	}
+	if inUse {
+		err = fmt.Errorf("%w: %s", ErrLoanProductInUse, productID)
+		return err
+	}
+
+	if _, err = tx.Exec("DELETE FROM loan_products WHERE id = $1", productID); err != nil {
+		return fmt.Errorf("ошибка при удалении кредитного продукта: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+
+	log.Printf("Кредитный продукт %s удален", productID)
+	return nil
+}
+
+// scanLoanProduct читает строку loan_products со столбцами loanProductColumns
+func scanLoanProduct(row interface{ Scan(...interface{}) error }) (models.LoanProduct, error) {
+	var p models.LoanProduct
+	err := row.Scan(&p.ID, &p.Name, &p.Currency, &p.MinAmount, &p.MaxAmount, &p.MinTermMonths, &p.MaxTermMonths,
+		&p.Pricing, &p.RateMargin, &p.FixedRate, &p.RateType, &p.RateResetMonths, &p.PenaltyPercent,
+		&p.PenaltyDueDays, &p.Amortization, &p.Active, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
@@ -4,17 +4,19 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
 
 	"bankapp/internal/models"
 )
 
-// AddLoan adds a new loan to the database
-// Checks for user and account existence and adds the loan to the database
+// AddLoan adds a new loan to the database and posts its disbursement
+// Checks for user and account existence, then saves the loan, its payment schedule
+// and the disbursement posting in a single database transaction
 // Returns an error if the user or account is not found
-func AddLoan(loan models.Loan) error {
+func (s *DBStorage) AddLoan(loan models.Loan, disbursement models.Posting) error {
 	// Проверяем, существует ли пользователь
 	var exists bool
-	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", loan.UserID).Scan(&exists)
+	err := s.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", loan.UserID).Scan(&exists)
 	if err != nil {
 		return fmt.Errorf("ошибка при проверке существования пользователя: %w", err)
 	}
@@ -23,7 +25,7 @@ func AddLoan(loan models.Loan) error {
 	}
 
 	// Проверяем, существует ли счет
-	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM accounts WHERE id = $1)", loan.AccountID).Scan(&exists)
+	err = s.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM accounts WHERE id = $1)", loan.AccountID).Scan(&exists)
 	if err != nil {
 		return fmt.Errorf("ошибка при проверке существования счета: %w", err)
 	}
@@ -32,7 +34,7 @@ func AddLoan(loan models.Loan) error {
 	}
 
 	// Начинаем транзакцию для атомарной вставки кредита и графика платежей
-	tx, err := db.DB.Begin()
+	tx, err := s.DB.Begin()
 	if err != nil {
 		return fmt.Errorf("ошибка при начале транзакции: %w", err)
 	}
@@ -42,22 +44,53 @@ func AddLoan(loan models.Loan) error {
 		}
 	}()
 
+	if err = insertLoanTx(tx, loan); err != nil {
+		return err
+	}
+
+	// Зачисляем сумму кредита на счет заемщика
+	if err = postTransactionTx(tx, disbursement); err != nil {
+		return err
+	}
+
+	// Фиксируем транзакцию
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+
+	log.Printf("Кредит %s добавлен для пользователя %s на сумму %s", loan.ID, loan.UserID, loan.Amount.String())
+	return nil
+}
+
+// insertLoanTx сохраняет кредит и его график платежей в транзакции tx
+func insertLoanTx(tx *sql.Tx, loan models.Loan) error {
 	// Сохраняем кредит в базу данных
 	query := `
-		INSERT INTO credits (id, user_id, account_id, amount, interest_rate, term_months, 
-							start_date, remaining_amount, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO credits (id, user_id, account_id, amount, currency, interest_rate, term_months, 
+							start_date, remaining_amount, created_at, rate_type, rate_margin,
+							rate_reset_months, next_rate_reset_date, product_id, amortization,
+							penalty_percent, penalty_due_days)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
 	`
-	_, err = tx.Exec(query,
+	_, err := tx.Exec(query,
 		loan.ID,
 		loan.UserID,
 		loan.AccountID,
 		loan.Amount,
+		loan.Currency,
 		loan.InterestRate,
 		loan.TermMonths,
 		loan.StartDate,
 		loan.RemainingAmount,
-		loan.StartDate) // используем StartDate как created_at
+		loan.StartDate, // используем StartDate как created_at
+		loan.RateType,
+		loan.RateMargin,
+		loan.RateResetMonths,
+		loan.NextRateResetDate,
+		sql.NullString{String: loan.ProductID, Valid: loan.ProductID != ""},
+		loan.Amortization,
+		loan.PenaltyPercent,
+		loan.PenaltyDueDays)
 
 	if err != nil {
 		return fmt.Errorf("ошибка при сохранении кредита: %w", err)
@@ -69,7 +102,7 @@ func AddLoan(loan models.Loan) error {
 			INSERT INTO payment_schedules (credit_id, due_date, amount, principal_part, interest_part, paid)
 			VALUES ($1, $2, $3, $4, $5, $6)
 		`
-		_, err = tx.Exec(query,
+		_, err := tx.Exec(query,
 			loan.ID,
 			payment.DueDate,
 			payment.Amount,
@@ -81,20 +114,61 @@ func AddLoan(loan models.Loan) error {
 			return fmt.Errorf("ошибка при сохранении графика платежей: %w", err)
 		}
 	}
+	return nil
+}
+
+// PayLoanInstallment отмечает платеж по графику оплаченным, уменьшает остаток долга по кредиту
+// и проводит погашение в одной транзакции БД
+// Возвращает ошибку, если платеж не найден или уже оплачен
+func (s *DBStorage) PayLoanInstallment(loanID string, payment models.Payment, repayment models.Posting) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Отмечаем платеж как оплаченный, только если он еще не был оплачен
+	result, err := tx.Exec("UPDATE payment_schedules SET paid = TRUE WHERE id = $1 AND credit_id = $2 AND paid = FALSE",
+		payment.ID, loanID)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении графика платежей: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении графика платежей: %w", err)
+	}
+	if affected == 0 {
+		err = fmt.Errorf("payment %d of loan %s not found or already paid", payment.ID, loanID)
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE credits SET remaining_amount = remaining_amount - $1 WHERE id = $2",
+		payment.PrincipalPart, loanID)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении остатка по кредиту: %w", err)
+	}
+
+	// Списываем платеж со счета заемщика
+	if err = postTransactionTx(tx, repayment); err != nil {
+		return err
+	}
 
-	// Фиксируем транзакцию
 	if err = tx.Commit(); err != nil {
 		return fmt.Errorf("ошибка при фиксации транзакции: %w", err)
 	}
 
-	log.Printf("Кредит %s добавлен для пользователя %s на сумму %s", loan.ID, loan.UserID, loan.Amount.String())
+	log.Printf("Платеж %s по кредиту %s проведен", payment.Amount.String(), loanID)
 	return nil
 }
 
 // GetUserLoans retrieves all loans for a user
 // Returns a slice of loans
-func GetUserLoans(userID string) []models.Loan {
-	loans, err := getLoansWithFilter("user_id = $1", userID)
+func (s *DBStorage) GetUserLoans(userID string) []models.Loan {
+	loans, err := s.getLoansWithFilter("user_id = $1", userID)
 	if err != nil {
 		log.Printf("Ошибка при получении кредитов пользователя: %v", err)
 		return []models.Loan{}
@@ -104,8 +178,8 @@ func GetUserLoans(userID string) []models.Loan {
 
 // GetLoan retrieves a loan by its ID
 // Returns the loan and a boolean indicating if the loan was found
-func GetLoan(loanID string) (models.Loan, bool) {
-	loans, err := getLoansWithFilter("id = $1", loanID)
+func (s *DBStorage) GetLoan(loanID string) (models.Loan, bool) {
+	loans, err := s.getLoansWithFilter("id = $1", loanID)
 	if err != nil {
 		log.Printf("Ошибка при получении кредита: %v", err)
 		return models.Loan{}, false
@@ -118,8 +192,8 @@ func GetLoan(loanID string) (models.Loan, bool) {
 
 // GetAccountLoans retrieves all loans associated with an account
 // Returns a slice of loans
-func GetAccountLoans(accountID string) []models.Loan {
-	loans, err := getLoansWithFilter("account_id = $1", accountID)
+func (s *DBStorage) GetAccountLoans(accountID string) []models.Loan {
+	loans, err := s.getLoansWithFilter("account_id = $1", accountID)
 	if err != nil {
 		log.Printf("Ошибка при получении кредитов счета: %v", err)
 		return []models.Loan{}
@@ -127,10 +201,24 @@ func GetAccountLoans(accountID string) []models.Loan {
 	return loans
 }
 
-// GetAllLoans retrieves all loans from the database
-// Returns a slice of all loans
-func GetAllLoans() []models.Loan {
-	loans, err := getLoansWithFilter("1=1", nil)
+// GetAllLoans retrieves all loans matching the filter from the database
+// Returns a slice of loans
+func (s *DBStorage) GetAllLoans(filter models.LoanFilter) []models.Loan {
+	conditions := []string{"1=1"}
+	var args []interface{}
+	if filter.UserID != "" {
+		args = append(args, filter.UserID)
+		conditions = append(conditions, fmt.Sprintf("user_id = $%d", len(args)))
+	}
+	if filter.AccountID != "" {
+		args = append(args, filter.AccountID)
+		conditions = append(conditions, fmt.Sprintf("account_id = $%d", len(args)))
+	}
+	if filter.ActiveOnly {
+		conditions = append(conditions, "remaining_amount > 0")
+	}
+
+	loans, err := s.getLoansWithFilter(strings.Join(conditions, " AND "), args...)
 	if err != nil {
 		log.Printf("Ошибка при получении всех кредитов: %v", err)
 		return []models.Loan{}
@@ -140,10 +228,10 @@ func GetAllLoans() []models.Loan {
 
 // UpdateLoan updates a loan in the database
 // Returns an error if the loan is not found
-func UpdateLoan(loan models.Loan) error {
+func (s *DBStorage) UpdateLoan(loan models.Loan) error {
 	// Проверяем, существует ли кредит
 	var exists bool
-	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM credits WHERE id = $1)", loan.ID).Scan(&exists)
+	err := s.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM credits WHERE id = $1)", loan.ID).Scan(&exists)
 	if err != nil {
 		return fmt.Errorf("ошибка при проверке существования кредита: %w", err)
 	}
@@ -152,7 +240,7 @@ func UpdateLoan(loan models.Loan) error {
 	}
 
 	// Начинаем транзакцию для атомарного обновления кредита и графика платежей
-	tx, err := db.DB.Begin()
+	tx, err := s.DB.Begin()
 	if err != nil {
 		return fmt.Errorf("ошибка при начале транзакции: %w", err)
 	}
@@ -166,7 +254,7 @@ func UpdateLoan(loan models.Loan) error {
 	query := `
 		UPDATE credits
 		SET user_id = $2, account_id = $3, amount = $4, interest_rate = $5, 
-			term_months = $6, start_date = $7, remaining_amount = $8
+			term_months = $6, start_date = $7, remaining_amount = $8, next_rate_reset_date = $9
 		WHERE id = $1
 	`
 	_, err = tx.Exec(query,
@@ -177,7 +265,8 @@ func UpdateLoan(loan models.Loan) error {
 		loan.InterestRate,
 		loan.TermMonths,
 		loan.StartDate,
-		loan.RemainingAmount)
+		loan.RemainingAmount,
+		loan.NextRateResetDate)
 
 	if err != nil {
 		return fmt.Errorf("ошибка при обновлении кредита: %w", err)
@@ -219,26 +308,20 @@ func UpdateLoan(loan models.Loan) error {
 
 // getLoansWithFilter is a helper function to get loans with a specific filter
 // Returns a slice of loans and an error
-func getLoansWithFilter(filter string, param interface{}) ([]models.Loan, error) {
-	var rows *sql.Rows
-	var err error
-
+func (s *DBStorage) getLoansWithFilter(filter string, args ...interface{}) ([]models.Loan, error) {
 	// Формируем запрос с фильтром
 	query := fmt.Sprintf(`
-		SELECT id, user_id, account_id, amount, interest_rate, term_months, 
-			   start_date, remaining_amount, created_at
+		SELECT id, user_id, account_id, amount, currency, interest_rate, term_months, 
+			   start_date, remaining_amount, created_at, rate_type, rate_margin,
+			   rate_reset_months, next_rate_reset_date, product_id, amortization,
+			   penalty_percent, penalty_due_days
 		FROM credits
 		WHERE %s
 		ORDER BY created_at DESC
 	`, filter)
 
-	// Выполняем запрос с параметром или без
-	if param != nil {
-		rows, err = db.DB.Query(query, param)
-	} else {
-		rows, err = db.DB.Query(query)
-	}
-
+	// Выполняем запрос с параметрами фильтра
+	rows, err := s.DB.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при выполнении запроса: %w", err)
 	}
@@ -247,29 +330,40 @@ func getLoansWithFilter(filter string, param interface{}) ([]models.Loan, error)
 	var loans []models.Loan
 	for rows.Next() {
 		var loan models.Loan
+		var productID sql.NullString
 		err := rows.Scan(
 			&loan.ID,
 			&loan.UserID,
 			&loan.AccountID,
 			&loan.Amount,
+			&loan.Currency,
 			&loan.InterestRate,
 			&loan.TermMonths,
 			&loan.StartDate,
 			&loan.RemainingAmount,
 			&loan.StartDate, // используем StartDate для created_at
+			&loan.RateType,
+			&loan.RateMargin,
+			&loan.RateResetMonths,
+			&loan.NextRateResetDate,
+			&productID,
+			&loan.Amortization,
+			&loan.PenaltyPercent,
+			&loan.PenaltyDueDays,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("ошибка при сканировании данных кредита: %w", err)
 		}
+		loan.ProductID = productID.String
 
 		// Получаем график платежей для этого кредита
 		paymentQuery := `
-			SELECT due_date, amount, principal_part, interest_part, paid
+			SELECT id, due_date, amount, principal_part, interest_part, paid
 			FROM payment_schedules
 			WHERE credit_id = $1
 			ORDER BY due_date
 		`
-		paymentRows, err := db.DB.Query(paymentQuery, loan.ID)
+		paymentRows, err := s.DB.Query(paymentQuery, loan.ID)
 		if err != nil {
 			return nil, fmt.Errorf("ошибка при получении графика платежей: %w", err)
 		}
@@ -279,6 +373,7 @@ func getLoansWithFilter(filter string, param interface{}) ([]models.Loan, error)
 		for paymentRows.Next() {
 			var payment models.Payment
 			err := paymentRows.Scan(
+				&payment.ID,
 				&payment.DueDate,
 				&payment.Amount,
 				&payment.PrincipalPart,
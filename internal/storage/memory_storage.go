@@ -0,0 +1,1848 @@
+package storage
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/models"
+	"bankapp/pkg/utils"
+)
+
+// MemoryStorage представляет хранилище данных в памяти процесса
+// Используется для запуска API без PostgreSQL; данные теряются при перезапуске
+type MemoryStorage struct {
+	mu sync.RWMutex
+
+	users         map[string]models.User
+	accounts      map[string]models.Account
+	cards         map[string]models.Card
+	merchantRules map[string][]models.MerchantRule // cardID -> правила в порядке добавления
+	holds         map[string]models.Hold
+	disputes      map[string]models.Dispute
+	transactions  []models.Transaction
+	entries       []models.JournalEntry
+	loans         map[string]models.Loan
+	loanProducts  map[string]models.LoanProduct
+	applications  map[string]models.LoanApplication
+	idempotency   map[string]models.IdempotencyRecord
+	exchangeRates map[string]models.ExchangeRate
+	currencyRates map[string]map[string]models.CurrencyRate // дата -> код валюты -> курс
+	keyRates      map[string]models.KeyRate                 // дата начала действия -> ставка
+
+	refreshTokens    map[string]models.RefreshToken // по хешу токена
+	revokedTokens    map[string]time.Time           // jti -> время истечения
+	tokensValidAfter map[string]time.Time           // userID -> граница выхода на всех устройствах
+
+	mfa           map[string]models.UserMFA
+	recoveryCodes map[string]map[string]bool // userID -> хеш кода -> использован ли код
+
+	nextEntryID   int64
+	nextPaymentID int64
+}
+
+// NewMemoryStorage создает пустое хранилище в памяти с кредитными продуктами по умолчанию
+func NewMemoryStorage() *MemoryStorage {
+	m := &MemoryStorage{
+		users:         make(map[string]models.User),
+		accounts:      make(map[string]models.Account),
+		cards:         make(map[string]models.Card),
+		merchantRules: make(map[string][]models.MerchantRule),
+		holds:         make(map[string]models.Hold),
+		disputes:      make(map[string]models.Dispute),
+		loans:         make(map[string]models.Loan),
+		loanProducts:  make(map[string]models.LoanProduct),
+		applications:  make(map[string]models.LoanApplication),
+		idempotency:   make(map[string]models.IdempotencyRecord),
+		exchangeRates: make(map[string]models.ExchangeRate),
+		currencyRates: make(map[string]map[string]models.CurrencyRate),
+		keyRates:      make(map[string]models.KeyRate),
+
+		refreshTokens:    make(map[string]models.RefreshToken),
+		revokedTokens:    make(map[string]time.Time),
+		tokensValidAfter: make(map[string]time.Time),
+
+		mfa:           make(map[string]models.UserMFA),
+		recoveryCodes: make(map[string]map[string]bool),
+	}
+	for _, product := range DefaultLoanProducts(time.Now()) {
+		m.loanProducts[product.ID] = product
+	}
+	return m
+}
+
+// Close ничего не делает: хранилищу в памяти нечего закрывать
+func (m *MemoryStorage) Close() error {
+	return nil
+}
+
+// RegisterNewUser добавляет нового пользователя
+// Возвращает ошибку, если имя пользователя или электронная почта уже заняты
+func (m *MemoryStorage) RegisterNewUser(user models.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.users {
+		if existing.Username == user.Username {
+			return fmt.Errorf("username '%s' is already taken", user.Username)
+		}
+		if existing.Email == user.Email {
+			return fmt.Errorf("email '%s' is already registered", user.Email)
+		}
+	}
+
+	m.users[user.ID] = user
+	log.Printf("Пользователь %s (ID: %s) успешно зарегистрирован в памяти", user.Username, user.ID)
+	return nil
+}
+
+// GetUserByUsername получает пользователя по имени пользователя
+func (m *MemoryStorage) GetUserByUsername(username string) (models.User, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, user := range m.users {
+		if user.Username == username {
+			return user, true
+		}
+	}
+	return models.User{}, false
+}
+
+// GetUserByID получает пользователя по его ID
+func (m *MemoryStorage) GetUserByID(userID string) (models.User, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[userID]
+	return user, ok
+}
+
+// GetAllUsers получает пользователей, удовлетворяющих фильтру, упорядоченных по дате регистрации
+func (m *MemoryStorage) GetAllUsers(filter models.UserFilter) ([]models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := make([]models.User, 0, len(m.users))
+	for _, user := range m.users {
+		if filter.Role != "" && user.Role != filter.Role {
+			continue
+		}
+		if filter.Username != "" && !strings.Contains(strings.ToLower(user.Username), strings.ToLower(filter.Username)) {
+			continue
+		}
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].CreatedAt.Before(users[j].CreatedAt)
+	})
+	return users, nil
+}
+
+// UpdateUserRole изменяет роль пользователя
+// Возвращает ErrLastAdmin, если это единственный администратор, которого лишают роли администратора
+func (m *MemoryStorage) UpdateUserRole(userID, role string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[userID]
+	if !ok {
+		return fmt.Errorf("user %s not found", userID)
+	}
+	if user.Role == models.RoleAdmin && role != models.RoleAdmin {
+		admins := 0
+		for _, other := range m.users {
+			if other.Role == models.RoleAdmin {
+				admins++
+			}
+		}
+		if admins == 1 {
+			return ErrLastAdmin
+		}
+	}
+	user.Role = role
+	m.users[userID] = user
+	log.Printf("Роль пользователя %s изменена на %s", userID, role)
+	return nil
+}
+
+// CreateBankAccount создает новый счет для существующего пользователя
+func (m *MemoryStorage) CreateBankAccount(account models.Account) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[account.UserID]; !ok {
+		return fmt.Errorf("user with ID %s not found", account.UserID)
+	}
+	for _, existing := range m.accounts {
+		if existing.Number == account.Number {
+			return fmt.Errorf("%w: %s", ErrAccountNumberTaken, account.Number)
+		}
+	}
+
+	m.accounts[account.ID] = account
+	log.Printf("Счет %s создан для пользователя %s", account.ID, account.UserID)
+	return nil
+}
+
+// GetAccount получает счет по его ID
+func (m *MemoryStorage) GetAccount(accountID string) (models.Account, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	account, ok := m.accounts[accountID]
+	account.AvailableBalance = account.Available()
+	return account, ok
+}
+
+// GetUserAccounts получает все счета пользователя, упорядоченные по дате создания
+func (m *MemoryStorage) GetUserAccounts(userID string) []models.Account {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var accounts []models.Account
+	for _, account := range m.accounts {
+		if account.UserID == userID {
+			account.AvailableBalance = account.Available()
+			accounts = append(accounts, account)
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].CreatedAt.Before(accounts[j].CreatedAt)
+	})
+	return accounts
+}
+
+// UpdateAccountStatus изменяет статус счета
+func (m *MemoryStorage) UpdateAccountStatus(accountID, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	account, ok := m.accounts[accountID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAccountNotFound, accountID)
+	}
+	account.Status = status
+	m.accounts[accountID] = account
+	log.Printf("Статус счета %s изменен на %s", accountID, status)
+	return nil
+}
+
+// AddCard добавляет новую карту к существующему счету
+func (m *MemoryStorage) AddCard(card models.Card) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.accounts[card.AccountID]; !ok {
+		return fmt.Errorf("account %s not found", card.AccountID)
+	}
+	if m.cardNumberTakenLocked(card.NumberHMAC) {
+		return ErrCardNumberTaken
+	}
+
+	// Как и в БД, открытый номер и CVV не хранятся
+	card.Number = ""
+	card.CVV = ""
+	m.cards[card.ID] = card
+	log.Printf("Карта %s добавлена для счета %s", card.ID, card.AccountID)
+	return nil
+}
+
+// GetAccountCards получает все карты счета, упорядоченные по дате выпуска
+func (m *MemoryStorage) GetAccountCards(accountID string) []models.Card {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var cards []models.Card
+	for _, card := range m.cards {
+		if card.AccountID == accountID {
+			cards = append(cards, card)
+		}
+	}
+	sort.Slice(cards, func(i, j int) bool {
+		return cards[i].CreatedAt.Before(cards[j].CreatedAt)
+	})
+	return cards
+}
+
+// GetCardByNumber получает карту по ее номеру, сравнивая HMAC и расшифрованный номер
+func (m *MemoryStorage) GetCardByNumber(number string) (models.Card, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	numberHMAC := utils.GenerateHMAC(number)
+	for _, card := range m.cards {
+		if card.NumberHMAC != numberHMAC {
+			continue
+		}
+		decryptedNumber, err := utils.DecryptField(card.EncryptedNumber, card.EncryptionKeyID, card.ID)
+		if err == nil && decryptedNumber == number {
+			card.Number = decryptedNumber
+			return card, true
+		}
+	}
+	return models.Card{}, false
+}
+
+// GetCard получает карту по ее ID
+func (m *MemoryStorage) GetCard(cardID string) (models.Card, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	card, ok := m.cards[cardID]
+	return card, ok
+}
+
+// RecordCardVerificationFailure увеличивает счетчик неудачных проверок CVV и срока действия
+// и блокирует карту, когда счетчик достигает maxAttempts
+// Возвращает новое значение счетчика и признак блокировки карты
+func (m *MemoryStorage) RecordCardVerificationFailure(cardID string, maxAttempts int) (int, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	card, ok := m.cards[cardID]
+	if !ok {
+		return 0, false, fmt.Errorf("%w: %s", ErrCardNotFound, cardID)
+	}
+	card.FailedAttempts++
+	if card.FailedAttempts >= maxAttempts {
+		card.Status = models.CardStatusBlocked
+		log.Printf("Карта %s заблокирована после %d неудачных проверок", cardID, card.FailedAttempts)
+	}
+	m.cards[cardID] = card
+	return card.FailedAttempts, card.Status == models.CardStatusBlocked, nil
+}
+
+// ResetCardVerificationFailures сбрасывает счетчик неудачных проверок после успешной проверки
+func (m *MemoryStorage) ResetCardVerificationFailures(cardID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if card, ok := m.cards[cardID]; ok {
+		card.FailedAttempts = 0
+		m.cards[cardID] = card
+	}
+	return nil
+}
+
+// UpdateCardStatus переводит карту из статуса fromStatus в статус toStatus
+// Возвращает ErrCardStatusConflict, если статус карты уже не равен fromStatus
+func (m *MemoryStorage) UpdateCardStatus(cardID, fromStatus, toStatus string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	card, ok := m.cards[cardID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrCardNotFound, cardID)
+	}
+	if card.Status != fromStatus {
+		return fmt.Errorf("%w: card %s is no longer %s", ErrCardStatusConflict, cardID, fromStatus)
+	}
+
+	card.Status = toStatus
+	if toStatus == models.CardStatusActive {
+		card.FailedAttempts = 0
+	}
+	m.cards[cardID] = card
+	log.Printf("Статус карты %s изменен: %s -> %s", cardID, fromStatus, toStatus)
+	return nil
+}
+
+// ReissueCard выпускает карту newCard взамен карты oldCardID и закрывает старую карту
+func (m *MemoryStorage) ReissueCard(oldCardID string, newCard models.Card) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, ok := m.cards[oldCardID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrCardNotFound, oldCardID)
+	}
+	if old.Status == models.CardStatusClosed {
+		return fmt.Errorf("%w: card %s is already closed", ErrCardStatusConflict, oldCardID)
+	}
+	if m.cardNumberTakenLocked(newCard.NumberHMAC) {
+		return ErrCardNumberTaken
+	}
+
+	newCard.Number = ""
+	newCard.CVV = ""
+	m.cards[newCard.ID] = newCard
+
+	old.Status = models.CardStatusClosed
+	old.ReplacedBy = newCard.ID
+	m.cards[oldCardID] = old
+	log.Printf("Карта %s перевыпущена, новая карта %s", oldCardID, newCard.ID)
+	return nil
+}
+
+// RevealCard отмечает реквизиты виртуальной карты показанными и удаляет ее зашифрованный CVV
+// Возвращает карту с шифртекстами, прочитанными до удаления, или ErrCardAlreadyRevealed
+func (m *MemoryStorage) RevealCard(cardID string, at time.Time) (models.Card, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	card, ok := m.cards[cardID]
+	if !ok {
+		return models.Card{}, fmt.Errorf("%w: %s", ErrCardNotFound, cardID)
+	}
+	if card.EncryptedCVV == "" {
+		return models.Card{}, fmt.Errorf("%w: %s", ErrCardAlreadyRevealed, cardID)
+	}
+
+	revealed := card
+	card.EncryptedCVV = ""
+	card.RevealedAt = &at
+	m.cards[cardID] = card
+	log.Printf("Реквизиты карты %s показаны владельцу", cardID)
+	return revealed, nil
+}
+
+// UpdateCardLimits заменяет лимиты расходов по карте
+func (m *MemoryStorage) UpdateCardLimits(cardID string, limits models.CardLimits) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	card, ok := m.cards[cardID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrCardNotFound, cardID)
+	}
+	card.Limits = limits
+	m.cards[cardID] = card
+	log.Printf("Лимиты карты %s изменены", cardID)
+	return nil
+}
+
+// ListCardMerchantRules возвращает правила карты по получателям платежей в порядке добавления
+func (m *MemoryStorage) ListCardMerchantRules(cardID string) ([]models.MerchantRule, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rules := append([]models.MerchantRule{}, m.merchantRules[cardID]...)
+	return rules, nil
+}
+
+// AddCardMerchantRule добавляет правило карты по получателям платежей
+// Возвращает ErrMerchantRuleExists, если такое же правило уже есть
+func (m *MemoryStorage) AddCardMerchantRule(rule models.MerchantRule) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, existing := range m.merchantRules[rule.CardID] {
+		if existing.List == rule.List && existing.Kind == rule.Kind && strings.EqualFold(existing.Value, rule.Value) {
+			return ErrMerchantRuleExists
+		}
+	}
+	m.merchantRules[rule.CardID] = append(m.merchantRules[rule.CardID], rule)
+	log.Printf("Для карты %s добавлено правило %s %s=%s", rule.CardID, rule.List, rule.Kind, rule.Value)
+	return nil
+}
+
+// DeleteCardMerchantRule удаляет правило карты по получателям платежей
+func (m *MemoryStorage) DeleteCardMerchantRule(cardID, ruleID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rules := m.merchantRules[cardID]
+	for i, rule := range rules {
+		if rule.ID == ruleID {
+			m.merchantRules[cardID] = append(rules[:i:i], rules[i+1:]...)
+			return nil
+		}
+	}
+	return ErrMerchantRuleNotFound
+}
+
+// PostCardPayment проводит платеж по карте с проверкой ее лимитов расходов
+func (m *MemoryStorage) PostCardPayment(posting models.Posting) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cardID := posting.Transaction.CardID
+	card, ok := m.cards[cardID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrCardNotFound, cardID)
+	}
+
+	if err := m.checkSingleUseLocked(card); err != nil {
+		return err
+	}
+	daySpent, monthSpent := m.cardSpendingLocked(cardID, posting.Transaction.Timestamp)
+	if err := checkCardLimits(card.Limits, posting.Transaction.Amount, daySpent, monthSpent); err != nil {
+		return err
+	}
+	if err := m.postTransactionLocked(posting); err != nil {
+		return err
+	}
+	m.closeSingleUseCardLocked(cardID)
+
+	log.Printf("Платеж %s по карте %s проведен, сумма: %s", posting.Transaction.ID, cardID, posting.Transaction.Amount.String())
+	return nil
+}
+
+// checkSingleUseLocked проверяет, что одноразовая карта еще не использована:
+// не закрыта после платежа и не имеет действующего удержания
+// Вызывающий код должен удерживать блокировку
+func (m *MemoryStorage) checkSingleUseLocked(card models.Card) error {
+	if !card.SingleUse {
+		return nil
+	}
+	if card.Status == models.CardStatusClosed {
+		return fmt.Errorf("%w: %s", ErrSingleUseCardUsed, card.ID)
+	}
+	for _, hold := range m.holds {
+		if hold.CardID == card.ID && hold.Status == models.HoldStatusAuthorized {
+			return fmt.Errorf("%w: %s", ErrSingleUseCardUsed, card.ID)
+		}
+	}
+	return nil
+}
+
+// closeSingleUseCardLocked закрывает одноразовую карту после проведенного по ней платежа
+// Вызывающий код должен удерживать блокировку
+func (m *MemoryStorage) closeSingleUseCardLocked(cardID string) {
+	card, ok := m.cards[cardID]
+	if !ok || !card.SingleUse || card.Status == models.CardStatusClosed {
+		return
+	}
+	card.Status = models.CardStatusClosed
+	m.cards[cardID] = card
+	log.Printf("Одноразовая карта %s закрыта после платежа", cardID)
+}
+
+// cardSpendingLocked считает платежи и действующие удержания по карте за сутки и месяц, в которые попадает at
+// Вызывающий код должен удерживать блокировку
+func (m *MemoryStorage) cardSpendingLocked(cardID string, at time.Time) (decimal.Decimal, decimal.Decimal) {
+	dayStart, monthStart := spendingPeriods(at)
+	daySpent, monthSpent := decimal.Zero, decimal.Zero
+	add := func(amount decimal.Decimal, spentAt time.Time) {
+		if spentAt.Before(monthStart) {
+			return
+		}
+		monthSpent = monthSpent.Add(amount)
+		if !spentAt.Before(dayStart) {
+			daySpent = daySpent.Add(amount)
+		}
+	}
+
+	for _, tx := range m.transactions {
+		if tx.CardID == cardID && tx.TransactionType == "payment" {
+			add(tx.Amount, tx.Timestamp)
+		}
+	}
+	for _, hold := range m.holds {
+		if hold.CardID == cardID && hold.Status == models.HoldStatusAuthorized {
+			add(hold.Amount, hold.CreatedAt)
+		}
+	}
+	return daySpent, monthSpent
+}
+
+// AuthorizeHold удерживает сумму на счете карты с проверкой лимитов карты и доступного баланса
+func (m *MemoryStorage) AuthorizeHold(hold models.Hold) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	card, ok := m.cards[hold.CardID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrCardNotFound, hold.CardID)
+	}
+	if err := m.checkSingleUseLocked(card); err != nil {
+		return err
+	}
+	daySpent, monthSpent := m.cardSpendingLocked(hold.CardID, hold.CreatedAt)
+	if err := checkCardLimits(card.Limits, hold.Amount, daySpent, monthSpent); err != nil {
+		return err
+	}
+
+	account, ok := m.accounts[hold.AccountID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrAccountNotFound, hold.AccountID)
+	}
+	if account.Status == models.AccountStatusFrozen {
+		return fmt.Errorf("%w: %s", ErrAccountFrozen, hold.AccountID)
+	}
+	if account.Available().LessThan(hold.Amount) {
+		return fmt.Errorf("%w: account %s", ErrInsufficientFunds, hold.AccountID)
+	}
+
+	account.HeldAmount = account.HeldAmount.Add(hold.Amount)
+	m.accounts[hold.AccountID] = account
+	hold.CapturedAmount = decimal.Zero
+	m.holds[hold.ID] = hold
+
+	log.Printf("Удержание %s на сумму %s по карте %s создано", hold.ID, hold.Amount.String(), hold.CardID)
+	return nil
+}
+
+// GetHold получает удержание по его ID
+func (m *MemoryStorage) GetHold(holdID string) (models.Hold, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	hold, ok := m.holds[holdID]
+	return hold, ok
+}
+
+// ListCardHolds возвращает удержания по карте, начиная с самых новых
+func (m *MemoryStorage) ListCardHolds(cardID string) ([]models.Hold, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	holds := []models.Hold{}
+	for _, hold := range m.holds {
+		if hold.CardID == cardID {
+			holds = append(holds, hold)
+		}
+	}
+	sort.Slice(holds, func(i, j int) bool {
+		return holds[i].CreatedAt.After(holds[j].CreatedAt)
+	})
+	return holds, nil
+}
+
+// CaptureHold списывает удержание и проводит платеж posting
+// Удержание с истекшим сроком снимается, и возвращается ErrHoldExpired
+func (m *MemoryStorage) CaptureHold(holdID string, posting models.Posting) (models.Hold, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hold, err := m.authorizedHoldLocked(holdID)
+	if err != nil {
+		return models.Hold{}, err
+	}
+
+	now := posting.Transaction.Timestamp
+	if !hold.ExpiresAt.After(now) {
+		m.releaseHoldLocked(hold, models.HoldStatusExpired, now)
+		log.Printf("Удержание %s истекло до списания и снято", holdID)
+		return models.Hold{}, ErrHoldExpired
+	}
+
+	amount := posting.Transaction.Amount
+	if amount.GreaterThan(hold.Amount) {
+		return models.Hold{}, fmt.Errorf("%w: captured %s, held %s", ErrCaptureExceedsHold, amount.String(), hold.Amount.String())
+	}
+
+	// Снимаем удержание до проведения, чтобы списание проверялось по освобожденному балансу;
+	// при ошибке проведения возвращаем удержание обратно
+	account := m.accounts[hold.AccountID]
+	account.HeldAmount = account.HeldAmount.Sub(hold.Amount)
+	m.accounts[hold.AccountID] = account
+	if err := m.postTransactionLocked(posting); err != nil {
+		account = m.accounts[hold.AccountID]
+		account.HeldAmount = account.HeldAmount.Add(hold.Amount)
+		m.accounts[hold.AccountID] = account
+		return models.Hold{}, err
+	}
+	m.closeSingleUseCardLocked(hold.CardID)
+
+	hold.Status = models.HoldStatusCaptured
+	hold.CapturedAmount = amount
+	hold.TransactionID = posting.Transaction.ID
+	hold.CompletedAt = &now
+	m.holds[holdID] = hold
+	log.Printf("Удержание %s списано на сумму %s", holdID, amount.String())
+	return hold, nil
+}
+
+// VoidHold отменяет удержание и возвращает сумму в доступный баланс счета
+func (m *MemoryStorage) VoidHold(holdID string) (models.Hold, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hold, err := m.authorizedHoldLocked(holdID)
+	if err != nil {
+		return models.Hold{}, err
+	}
+	hold = m.releaseHoldLocked(hold, models.HoldStatusVoided, time.Now())
+	log.Printf("Удержание %s отменено", holdID)
+	return hold, nil
+}
+
+// ExpireHolds снимает удержания, срок которых истек к моменту now
+func (m *MemoryStorage) ExpireHolds(now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, hold := range m.holds {
+		if hold.Status == models.HoldStatusAuthorized && !hold.ExpiresAt.After(now) {
+			m.releaseHoldLocked(hold, models.HoldStatusExpired, now)
+			count++
+		}
+	}
+	return count, nil
+}
+
+// authorizedHoldLocked возвращает удержание, если оно еще действует
+// Вызывающий код должен удерживать блокировку
+func (m *MemoryStorage) authorizedHoldLocked(holdID string) (models.Hold, error) {
+	hold, ok := m.holds[holdID]
+	if !ok {
+		return models.Hold{}, fmt.Errorf("%w: %s", ErrHoldNotFound, holdID)
+	}
+	if hold.Status != models.HoldStatusAuthorized {
+		return models.Hold{}, fmt.Errorf("%w: hold %s is %s", ErrHoldNotAuthorized, holdID, hold.Status)
+	}
+	return hold, nil
+}
+
+// releaseHoldLocked завершает удержание со статусом status и возвращает его сумму в доступный баланс
+// Вызывающий код должен удерживать блокировку на запись
+func (m *MemoryStorage) releaseHoldLocked(hold models.Hold, status string, at time.Time) models.Hold {
+	account := m.accounts[hold.AccountID]
+	account.HeldAmount = account.HeldAmount.Sub(hold.Amount)
+	m.accounts[hold.AccountID] = account
+
+	hold.Status = status
+	hold.CompletedAt = &at
+	m.holds[hold.ID] = hold
+	return hold
+}
+
+// GetRefundedAmount возвращает сумму возвратов и компенсаций, уже проведенных по платежу
+func (m *MemoryStorage) GetRefundedAmount(transactionID string) (decimal.Decimal, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.refundedAmountLocked(transactionID), nil
+}
+
+// RefundPayment проводит возврат posting по платежу, на который ссылается RelatedTransactionID
+func (m *MemoryStorage) RefundPayment(posting models.Posting) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkRefundableLocked(posting.Transaction.RelatedTransactionID, posting.Transaction.Amount); err != nil {
+		return err
+	}
+	if err := m.postTransactionLocked(posting); err != nil {
+		return err
+	}
+
+	log.Printf("Возврат %s по платежу %s проведен, сумма: %s",
+		posting.Transaction.ID, posting.Transaction.RelatedTransactionID, posting.Transaction.Amount.String())
+	return nil
+}
+
+// OpenDispute открывает спор по платежу, если по нему нет нерешенного спора
+func (m *MemoryStorage) OpenDispute(dispute models.Dispute) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkRefundableLocked(dispute.TransactionID, dispute.Amount); err != nil {
+		return err
+	}
+	for _, existing := range m.disputes {
+		if existing.TransactionID == dispute.TransactionID && models.IsActiveDisputeStatus(existing.Status) {
+			return fmt.Errorf("%w: %s", ErrDisputeExists, dispute.TransactionID)
+		}
+	}
+	m.disputes[dispute.ID] = dispute
+
+	log.Printf("Открыт спор %s по платежу %s на сумму %s", dispute.ID, dispute.TransactionID, dispute.Amount.String())
+	return nil
+}
+
+// GetDispute получает спор по его ID
+func (m *MemoryStorage) GetDispute(disputeID string) (models.Dispute, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	dispute, ok := m.disputes[disputeID]
+	return dispute, ok
+}
+
+// ListDisputes возвращает споры, удовлетворяющие фильтру, начиная с самых новых
+func (m *MemoryStorage) ListDisputes(filter models.DisputeFilter) ([]models.Dispute, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	disputes := []models.Dispute{}
+	for _, dispute := range m.disputes {
+		if filter.AccountID != "" && dispute.AccountID != filter.AccountID {
+			continue
+		}
+		if filter.Status != "" && dispute.Status != filter.Status {
+			continue
+		}
+		disputes = append(disputes, dispute)
+	}
+	sort.Slice(disputes, func(i, j int) bool {
+		return disputes[i].CreatedAt.After(disputes[j].CreatedAt)
+	})
+	return disputes, nil
+}
+
+// UpdateDisputeStatus переводит спор в статус status; при решении в пользу клиента
+// вместе со сменой статуса проводится компенсация chargeback
+func (m *MemoryStorage) UpdateDisputeStatus(disputeID, status, resolution string, chargeback *models.Posting) (models.Dispute, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dispute, ok := m.disputes[disputeID]
+	if !ok {
+		return models.Dispute{}, fmt.Errorf("%w: %s", ErrDisputeNotFound, disputeID)
+	}
+	if !models.CanTransitionDisputeStatus(dispute.Status, status) {
+		return models.Dispute{}, fmt.Errorf("%w: dispute %s is %s", ErrDisputeStatusConflict, disputeID, dispute.Status)
+	}
+
+	now := time.Now()
+	if status == models.DisputeStatusWon {
+		if err := m.checkRefundableLocked(dispute.TransactionID, chargeback.Transaction.Amount); err != nil {
+			return models.Dispute{}, err
+		}
+		if err := m.postTransactionLocked(*chargeback); err != nil {
+			return models.Dispute{}, err
+		}
+		dispute.ChargebackTransactionID = chargeback.Transaction.ID
+		now = chargeback.Transaction.Timestamp
+	}
+
+	dispute.Status = status
+	dispute.Resolution = resolution
+	dispute.UpdatedAt = now
+	if !models.IsActiveDisputeStatus(status) {
+		dispute.ResolvedAt = &now
+	}
+	m.disputes[disputeID] = dispute
+
+	log.Printf("Спор %s переведен в статус %s", disputeID, status)
+	return dispute, nil
+}
+
+// transactionLocked ищет транзакцию по ID; вызывающий код должен удерживать блокировку
+func (m *MemoryStorage) transactionLocked(transactionID string) (models.Transaction, bool) {
+	for _, tx := range m.transactions {
+		if tx.ID == transactionID {
+			return tx, true
+		}
+	}
+	return models.Transaction{}, false
+}
+
+// refundedAmountLocked считает сумму возвратов и компенсаций по платежу
+// Вызывающий код должен удерживать блокировку
+func (m *MemoryStorage) refundedAmountLocked(transactionID string) decimal.Decimal {
+	refunded := decimal.Zero
+	for _, tx := range m.transactions {
+		if tx.RelatedTransactionID == transactionID &&
+			(tx.TransactionType == models.TransactionTypeRefund || tx.TransactionType == models.TransactionTypeChargeback) {
+			refunded = refunded.Add(tx.Amount)
+		}
+	}
+	return refunded
+}
+
+// checkRefundableLocked проверяет, что сумма amount укладывается в невозвращенный остаток платежа по карте
+// Вызывающий код должен удерживать блокировку
+func (m *MemoryStorage) checkRefundableLocked(transactionID string, amount decimal.Decimal) error {
+	payment, ok := m.transactionLocked(transactionID)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTransactionNotFound, transactionID)
+	}
+	if payment.TransactionType != "payment" {
+		return fmt.Errorf("%w: %s is %s", ErrNotCardPayment, transactionID, payment.TransactionType)
+	}
+	return checkRefundable(payment.Amount, m.refundedAmountLocked(transactionID), amount)
+}
+
+// withDisputeStatusLocked заполняет статус последнего спора по каждой из транзакций
+// Вызывающий код должен удерживать блокировку
+func (m *MemoryStorage) withDisputeStatusLocked(transactions []models.Transaction) {
+	latest := make(map[string]models.Dispute)
+	for _, dispute := range m.disputes {
+		if current, ok := latest[dispute.TransactionID]; !ok || dispute.CreatedAt.After(current.CreatedAt) {
+			latest[dispute.TransactionID] = dispute
+		}
+	}
+	for i := range transactions {
+		transactions[i].DisputeStatus = latest[transactions[i].ID].Status
+	}
+}
+
+// cardNumberTakenLocked сообщает, выпущена ли уже карта с таким HMAC номера
+// Вызывающий код должен удерживать блокировку
+func (m *MemoryStorage) cardNumberTakenLocked(numberHMAC string) bool {
+	for _, card := range m.cards {
+		if card.NumberHMAC == numberHMAC {
+			return true
+		}
+	}
+	return false
+}
+
+// ListCardsForReencryption возвращает карты, номера которых зашифрованы не ключом keyID
+// Карты упорядочены по ID; afterID задает позицию продолжения для постраничного обхода
+func (m *MemoryStorage) ListCardsForReencryption(keyID, afterID string, limit int) ([]models.Card, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var cards []models.Card
+	for _, card := range m.cards {
+		if card.EncryptionKeyID != keyID && card.ID > afterID {
+			cards = append(cards, card)
+		}
+	}
+	sort.Slice(cards, func(i, j int) bool {
+		return cards[i].ID < cards[j].ID
+	})
+	if len(cards) > limit {
+		cards = cards[:limit]
+	}
+	return cards, nil
+}
+
+// UpdateCardEncryption заменяет шифртексты номера и еще не показанного CVV карты,
+// если они все еще зашифрованы ключом oldKeyID
+// Возвращает false, если карту за это время уже перешифровал другой процесс
+func (m *MemoryStorage) UpdateCardEncryption(cardID, oldKeyID, encryptedNumber, encryptedCVV, newKeyID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	card, ok := m.cards[cardID]
+	if !ok || card.EncryptionKeyID != oldKeyID {
+		return false, nil
+	}
+	card.EncryptedNumber = encryptedNumber
+	if card.EncryptedCVV != "" {
+		card.EncryptedCVV = encryptedCVV
+	}
+	card.EncryptionKeyID = newKeyID
+	m.cards[cardID] = card
+	return true, nil
+}
+
+// PostTransaction атомарно проводит операцию по главной книге в памяти
+func (m *MemoryStorage) PostTransaction(posting models.Posting) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.postTransactionLocked(posting); err != nil {
+		return err
+	}
+
+	log.Printf("Транзакция %s проведена. Тип: %s, Сумма: %s, проводок: %d",
+		posting.Transaction.ID, posting.Transaction.TransactionType, posting.Transaction.Amount.String(), len(posting.Entries))
+	return nil
+}
+
+// GetAccountTransactions получает все транзакции, где счет является источником или получателем
+func (m *MemoryStorage) GetAccountTransactions(accountID string) []models.Transaction {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var transactions []models.Transaction
+	for _, tx := range m.transactions {
+		if tx.FromAccountID == accountID || tx.ToAccountID == accountID {
+			transactions = append(transactions, tx)
+		}
+	}
+	m.withDisputeStatusLocked(transactions)
+	sortTransactionsDesc(transactions)
+	return transactions
+}
+
+// GetTransaction получает транзакцию по ее ID
+func (m *MemoryStorage) GetTransaction(transactionID string) (models.Transaction, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tx, ok := m.transactionLocked(transactionID)
+	if !ok {
+		return models.Transaction{}, false
+	}
+	transactions := []models.Transaction{tx}
+	m.withDisputeStatusLocked(transactions)
+	return transactions[0], true
+}
+
+// GetAllTransactions получает транзакции, удовлетворяющие фильтру, начиная с самых новых
+func (m *MemoryStorage) GetAllTransactions(filter models.TransactionFilter) ([]models.Transaction, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var transactions []models.Transaction
+	for _, tx := range m.transactions {
+		if filter.AccountID != "" && tx.FromAccountID != filter.AccountID && tx.ToAccountID != filter.AccountID {
+			continue
+		}
+		if filter.TransactionType != "" && tx.TransactionType != filter.TransactionType {
+			continue
+		}
+		if !filter.From.IsZero() && tx.Timestamp.Before(filter.From) {
+			continue
+		}
+		if !filter.To.IsZero() && !tx.Timestamp.Before(filter.To) {
+			continue
+		}
+		transactions = append(transactions, tx)
+	}
+	m.withDisputeStatusLocked(transactions)
+	sortTransactionsDesc(transactions)
+	if filter.Limit > 0 && len(transactions) > filter.Limit {
+		transactions = transactions[:filter.Limit]
+	}
+	return transactions, nil
+}
+
+// ReconcileBalances сверяет балансы счетов с суммой проводок главной книги
+func (m *MemoryStorage) ReconcileBalances() ([]models.BalanceDiscrepancy, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ledgerBalances := make(map[string]decimal.Decimal)
+	for _, entry := range m.entries {
+		ledgerBalances[entry.LedgerAccount] = ledgerBalances[entry.LedgerAccount].Add(entry.Credit).Sub(entry.Debit)
+	}
+
+	var discrepancies []models.BalanceDiscrepancy
+	for _, account := range m.accounts {
+		if !account.Balance.Equal(ledgerBalances[account.ID]) {
+			discrepancies = append(discrepancies, models.BalanceDiscrepancy{
+				AccountID:     account.ID,
+				StoredBalance: account.Balance,
+				LedgerBalance: ledgerBalances[account.ID],
+			})
+		}
+	}
+	sort.Slice(discrepancies, func(i, j int) bool {
+		return discrepancies[i].AccountID < discrepancies[j].AccountID
+	})
+	return discrepancies, nil
+}
+
+// AddLoan сохраняет кредит и проводит его выдачу
+func (m *MemoryStorage) AddLoan(loan models.Loan, disbursement models.Posting) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[loan.UserID]; !ok {
+		return fmt.Errorf("user %s not found", loan.UserID)
+	}
+	if _, ok := m.accounts[loan.AccountID]; !ok {
+		return fmt.Errorf("account %s not found", loan.AccountID)
+	}
+	if _, ok := m.loanProducts[loan.ProductID]; loan.ProductID != "" && !ok {
+		return fmt.Errorf("%w: %s", ErrLoanProductNotFound, loan.ProductID)
+	}
+
+	if err := m.postTransactionLocked(disbursement); err != nil {
+		return err
+	}
+
+	m.loans[loan.ID] = m.withPaymentIDs(loan)
+	log.Printf("Кредит %s добавлен для пользователя %s на сумму %s", loan.ID, loan.UserID, loan.Amount.String())
+	return nil
+}
+
+// PayLoanInstallment отмечает платеж оплаченным, уменьшает остаток долга и проводит списание
+func (m *MemoryStorage) PayLoanInstallment(loanID string, payment models.Payment, repayment models.Posting) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	loan, ok := m.loans[loanID]
+	if !ok {
+		return fmt.Errorf("loan %s not found", loanID)
+	}
+
+	index := -1
+	for i, p := range loan.PaymentSchedule {
+		if p.ID == payment.ID && !p.Paid {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("payment %d of loan %s not found or already paid", payment.ID, loanID)
+	}
+
+	if err := m.postTransactionLocked(repayment); err != nil {
+		return err
+	}
+
+	schedule := make([]models.Payment, len(loan.PaymentSchedule))
+	copy(schedule, loan.PaymentSchedule)
+	schedule[index].Paid = true
+	loan.PaymentSchedule = schedule
+	loan.RemainingAmount = loan.RemainingAmount.Sub(payment.PrincipalPart)
+	m.loans[loanID] = loan
+
+	log.Printf("Платеж %s по кредиту %s проведен", payment.Amount.String(), loanID)
+	return nil
+}
+
+// GetUserLoans получает все кредиты пользователя
+func (m *MemoryStorage) GetUserLoans(userID string) []models.Loan {
+	return m.filterLoans(func(loan models.Loan) bool { return loan.UserID == userID })
+}
+
+// GetLoan получает кредит по его ID
+func (m *MemoryStorage) GetLoan(loanID string) (models.Loan, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	loan, ok := m.loans[loanID]
+	return copyLoan(loan), ok
+}
+
+// GetAccountLoans получает все кредиты, связанные со счетом
+func (m *MemoryStorage) GetAccountLoans(accountID string) []models.Loan {
+	return m.filterLoans(func(loan models.Loan) bool { return loan.AccountID == accountID })
+}
+
+// GetAllLoans получает кредиты, удовлетворяющие фильтру
+func (m *MemoryStorage) GetAllLoans(filter models.LoanFilter) []models.Loan {
+	return m.filterLoans(func(loan models.Loan) bool {
+		if filter.UserID != "" && loan.UserID != filter.UserID {
+			return false
+		}
+		if filter.AccountID != "" && loan.AccountID != filter.AccountID {
+			return false
+		}
+		return !filter.ActiveOnly || loan.RemainingAmount.IsPositive()
+	})
+}
+
+// UpdateLoan заменяет данные кредита и его график платежей
+func (m *MemoryStorage) UpdateLoan(loan models.Loan) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.loans[loan.ID]; !ok {
+		return fmt.Errorf("loan %s not found", loan.ID)
+	}
+
+	m.loans[loan.ID] = m.withPaymentIDs(loan)
+	log.Printf("Кредит %s обновлен. Оставшаяся сумма: %s", loan.ID, loan.RemainingAmount.String())
+	return nil
+}
+
+// CreateLoanProduct добавляет кредитный продукт
+func (m *MemoryStorage) CreateLoanProduct(product models.LoanProduct) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.loanProducts[product.ID]; ok || m.loanProductNameTakenLocked(product) {
+		return fmt.Errorf("%w: %s", ErrLoanProductExists, product.Name)
+	}
+	m.loanProducts[product.ID] = product
+	log.Printf("Создан кредитный продукт %s (%s)", product.ID, product.Name)
+	return nil
+}
+
+// GetLoanProduct возвращает кредитный продукт по ID
+func (m *MemoryStorage) GetLoanProduct(productID string) (models.LoanProduct, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	product, ok := m.loanProducts[productID]
+	return product, ok
+}
+
+// ListLoanProducts возвращает кредитные продукты по названию; activeOnly - только доступные для новых кредитов
+func (m *MemoryStorage) ListLoanProducts(activeOnly bool) ([]models.LoanProduct, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	products := []models.LoanProduct{}
+	for _, product := range m.loanProducts {
+		if activeOnly && !product.Active {
+			continue
+		}
+		products = append(products, product)
+	}
+	sort.Slice(products, func(i, j int) bool {
+		return products[i].Name < products[j].Name
+	})
+	return products, nil
+}
+
+// UpdateLoanProduct заменяет условия кредитного продукта
+func (m *MemoryStorage) UpdateLoanProduct(product models.LoanProduct) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.loanProducts[product.ID]; !ok {
+		return fmt.Errorf("%w: %s", ErrLoanProductNotFound, product.ID)
+	}
+	if m.loanProductNameTakenLocked(product) {
+		return fmt.Errorf("%w: %s", ErrLoanProductExists, product.Name)
+	}
+	m.loanProducts[product.ID] = product
+	log.Printf("Кредитный продукт %s изменен", product.ID)
+	return nil
+}
+
+// DeleteLoanProduct удаляет кредитный продукт, по которому нет кредитов и заявок
+func (m *MemoryStorage) DeleteLoanProduct(productID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.loanProducts[productID]; !ok {
+		return fmt.Errorf("%w: %s", ErrLoanProductNotFound, productID)
+	}
+	for _, loan := range m.loans {
+		if loan.ProductID == productID {
+			return fmt.Errorf("%w: %s", ErrLoanProductInUse, productID)
+		}
+	}
+	for _, application := range m.applications {
+		if application.ProductID == productID {
+			return fmt.Errorf("%w: %s", ErrLoanProductInUse, productID)
+		}
+	}
+	delete(m.loanProducts, productID)
+	log.Printf("Кредитный продукт %s удален", productID)
+	return nil
+}
+
+// loanProductNameTakenLocked сообщает, занято ли название продукта другим продуктом
+func (m *MemoryStorage) loanProductNameTakenLocked(product models.LoanProduct) bool {
+	for _, existing := range m.loanProducts {
+		if existing.ID != product.ID && existing.Name == product.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateLoanApplication сохраняет новую заявку на кредит
+func (m *MemoryStorage) CreateLoanApplication(application models.LoanApplication) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[application.UserID]; !ok {
+		return fmt.Errorf("user %s not found", application.UserID)
+	}
+	if _, ok := m.accounts[application.AccountID]; !ok {
+		return fmt.Errorf("account %s not found", application.AccountID)
+	}
+	if _, ok := m.loanProducts[application.ProductID]; !ok {
+		return fmt.Errorf("%w: %s", ErrLoanProductNotFound, application.ProductID)
+	}
+	m.applications[application.ID] = application
+
+	log.Printf("Принята заявка на кредит %s пользователя %s на сумму %s", application.ID, application.UserID, application.Amount.String())
+	return nil
+}
+
+// GetLoanApplication получает заявку на кредит по ее ID
+func (m *MemoryStorage) GetLoanApplication(applicationID string) (models.LoanApplication, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	application, ok := m.applications[applicationID]
+	return application, ok
+}
+
+// ListLoanApplications возвращает заявки на кредит, удовлетворяющие фильтру, начиная с самых новых
+func (m *MemoryStorage) ListLoanApplications(filter models.LoanApplicationFilter) ([]models.LoanApplication, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	applications := []models.LoanApplication{}
+	for _, application := range m.applications {
+		if filter.UserID != "" && application.UserID != filter.UserID {
+			continue
+		}
+		if filter.Status != "" && application.Status != filter.Status {
+			continue
+		}
+		applications = append(applications, application)
+	}
+	sort.Slice(applications, func(i, j int) bool {
+		return applications[i].CreatedAt.After(applications[j].CreatedAt)
+	})
+	return applications, nil
+}
+
+// UpdateLoanApplication переводит заявку из статуса fromStatus в статус application.Status
+// и сохраняет результат скоринга и решение операциониста; выдача кредита проводится DisburseLoanApplication
+func (m *MemoryStorage) UpdateLoanApplication(application models.LoanApplication, fromStatus string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.applications[application.ID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrLoanApplicationNotFound, application.ID)
+	}
+	if application.Status == models.LoanApplicationDisbursed || !models.CanTransitionLoanApplication(fromStatus, application.Status) {
+		return fmt.Errorf("%w: %s -> %s", ErrLoanApplicationStatusConflict, fromStatus, application.Status)
+	}
+	if existing.Status != fromStatus {
+		return fmt.Errorf("%w: application %s is no longer %s", ErrLoanApplicationStatusConflict, application.ID, fromStatus)
+	}
+
+	existing.Status = application.Status
+	existing.Scoring = application.Scoring
+	existing.ReviewerID = application.ReviewerID
+	existing.ReviewComment = application.ReviewComment
+	existing.UpdatedAt = application.UpdatedAt
+	existing.DecidedAt = application.DecidedAt
+	m.applications[application.ID] = existing
+
+	log.Printf("Заявка на кредит %s переведена из статуса %s в статус %s", application.ID, fromStatus, application.Status)
+	return nil
+}
+
+// DisburseLoanApplication выдает кредит loan по одобренной заявке и переводит ее в статус disbursed
+func (m *MemoryStorage) DisburseLoanApplication(applicationID, disbursedBy string, loan models.Loan, disbursement models.Posting) (models.LoanApplication, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	application, ok := m.applications[applicationID]
+	if !ok {
+		return models.LoanApplication{}, fmt.Errorf("%w: %s", ErrLoanApplicationNotFound, applicationID)
+	}
+	if application.Status != models.LoanApplicationApproved {
+		return models.LoanApplication{}, fmt.Errorf("%w: application %s is %s", ErrLoanApplicationStatusConflict, applicationID, application.Status)
+	}
+
+	if err := m.postTransactionLocked(disbursement); err != nil {
+		return models.LoanApplication{}, err
+	}
+	m.loans[loan.ID] = m.withPaymentIDs(loan)
+
+	application.Status = models.LoanApplicationDisbursed
+	application.LoanID = loan.ID
+	application.DisbursedBy = disbursedBy
+	application.UpdatedAt = disbursement.Transaction.Timestamp
+	m.applications[applicationID] = application
+
+	log.Printf("По заявке %s выдан кредит %s на сумму %s", applicationID, loan.ID, loan.Amount.String())
+	return application, nil
+}
+
+// ReserveIdempotencyKey резервирует ключ идемпотентности за пользователем
+// Заново резервируется только истекший ключ: незавершенный ключ остается за исходным запросом
+// до истечения срока хранения, так как операция могла быть проведена
+// Если ключ занят, возвращает сохраненную запись и false
+func (m *MemoryStorage) ReserveIdempotencyKey(record models.IdempotencyRecord) (models.IdempotencyRecord, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := idempotencyID(record.UserID, record.Key)
+	if existing, ok := m.idempotency[id]; ok && existing.ExpiresAt.After(record.ReservedAt) {
+		return existing, false, nil
+	}
+	m.idempotency[id] = record
+	return record, true, nil
+}
+
+// CompleteIdempotencyKey сохраняет ответ на запрос для последующего воспроизведения
+// Если ключ с тех пор истек и зарезервирован другим запросом, возвращает ErrIdempotencyKeyNotReserved
+func (m *MemoryStorage) CompleteIdempotencyKey(userID, key string, reservedAt time.Time, statusCode int, responseBody []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := idempotencyID(userID, key)
+	record, ok := m.idempotency[id]
+	if !ok || !record.ReservedAt.Equal(reservedAt) {
+		return ErrIdempotencyKeyNotReserved
+	}
+	record.StatusCode = statusCode
+	record.ResponseBody = append([]byte(nil), responseBody...)
+	record.Completed = true
+	m.idempotency[id] = record
+	return nil
+}
+
+// ReleaseIdempotencyKey освобождает зарезервированный ключ, чтобы запрос можно было повторить
+func (m *MemoryStorage) ReleaseIdempotencyKey(userID, key string, reservedAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := idempotencyID(userID, key)
+	if record, ok := m.idempotency[id]; ok && !record.Completed && record.ReservedAt.Equal(reservedAt) {
+		delete(m.idempotency, id)
+	}
+	return nil
+}
+
+// PurgeExpiredIdempotencyKeys удаляет ключи идемпотентности, срок хранения которых истек до момента before
+// Возвращает количество удаленных ключей
+func (m *MemoryStorage) PurgeExpiredIdempotencyKeys(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged int64
+	for id, record := range m.idempotency {
+		if record.ExpiresAt.Before(before) {
+			delete(m.idempotency, id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// SaveRefreshToken сохраняет новый токен обновления
+func (m *MemoryStorage) SaveRefreshToken(token models.RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.refreshTokens[token.TokenHash] = token
+	return nil
+}
+
+// RotateRefreshToken заменяет предъявленный токен обновления новым
+// Новый токен наследует пользователя и цепочку старого; возвращается заполненная запись нового токена
+// При повторном использовании уже замененного токена отзывает всю цепочку и возвращает ErrRefreshTokenReused
+func (m *MemoryStorage) RotateRefreshToken(tokenHash string, next models.RefreshToken) (models.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.refreshTokens[tokenHash]
+	if !ok {
+		return models.RefreshToken{}, ErrRefreshTokenNotFound
+	}
+
+	if current.RevokedAt != nil {
+		if current.ReplacedBy == "" {
+			return models.RefreshToken{}, ErrRefreshTokenRevoked
+		}
+
+		now := time.Now()
+		for hash, token := range m.refreshTokens {
+			if token.FamilyID == current.FamilyID && token.RevokedAt == nil {
+				token.RevokedAt = &now
+				m.refreshTokens[hash] = token
+			}
+		}
+		log.Printf("Повторное использование токена обновления пользователя %s, цепочка %s отозвана", current.UserID, current.FamilyID)
+		return models.RefreshToken{}, ErrRefreshTokenReused
+	}
+
+	if !current.ExpiresAt.After(time.Now()) {
+		return models.RefreshToken{}, ErrRefreshTokenExpired
+	}
+
+	next.UserID = current.UserID
+	next.FamilyID = current.FamilyID
+
+	revokedAt := next.CreatedAt
+	current.RevokedAt = &revokedAt
+	current.ReplacedBy = next.ID
+	m.refreshTokens[tokenHash] = current
+	m.refreshTokens[next.TokenHash] = next
+
+	return next, nil
+}
+
+// RevokeRefreshToken отзывает токен обновления пользователя
+// Возвращает ErrRefreshTokenNotFound, если токен не найден или принадлежит другому пользователю
+func (m *MemoryStorage) RevokeRefreshToken(userID, tokenHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.refreshTokens[tokenHash]
+	if !ok || token.UserID != userID {
+		return ErrRefreshTokenNotFound
+	}
+	if token.RevokedAt == nil {
+		now := time.Now()
+		token.RevokedAt = &now
+		m.refreshTokens[tokenHash] = token
+	}
+	return nil
+}
+
+// RevokeAccessToken заносит токен доступа в список отозванных до истечения его срока действия
+func (m *MemoryStorage) RevokeAccessToken(jti, userID string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.revokedTokens[jti] = expiresAt
+	return nil
+}
+
+// IsAccessTokenRevoked проверяет, отозван ли токен доступа по jti
+// или выпущен ли он до выхода пользователя на всех устройствах
+func (m *MemoryStorage) IsAccessTokenRevoked(jti, userID string, issuedAt time.Time) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, ok := m.revokedTokens[jti]; ok {
+		return true, nil
+	}
+	if cutoff, ok := m.tokensValidAfter[userID]; ok && cutoff.After(issuedAt) {
+		return true, nil
+	}
+	return false, nil
+}
+
+// RevokeAllUserSessions отзывает все токены обновления пользователя
+// и делает недействительными токены доступа, выпущенные до момента at
+func (m *MemoryStorage) RevokeAllUserSessions(userID string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for hash, token := range m.refreshTokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			revokedAt := at
+			token.RevokedAt = &revokedAt
+			m.refreshTokens[hash] = token
+		}
+	}
+	m.tokensValidAfter[userID] = at
+
+	log.Printf("Все сессии пользователя %s завершены", userID)
+	return nil
+}
+
+// PurgeExpiredTokens удаляет токены обновления и записи об отозванных токенах доступа,
+// срок действия которых истек до момента before
+// Возвращает количество удаленных записей
+func (m *MemoryStorage) PurgeExpiredTokens(before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged int64
+	for hash, token := range m.refreshTokens {
+		if token.ExpiresAt.Before(before) {
+			delete(m.refreshTokens, hash)
+			purged++
+		}
+	}
+	for jti, expiresAt := range m.revokedTokens {
+		if expiresAt.Before(before) {
+			delete(m.revokedTokens, jti)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+// GetUserMFA возвращает настройки двухфакторной аутентификации пользователя
+// Возвращает false, если пользователь не начинал настройку
+func (m *MemoryStorage) GetUserMFA(userID string) (models.UserMFA, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	mfa, ok := m.mfa[userID]
+	return mfa, ok
+}
+
+// SaveMFASecret сохраняет новый неподтвержденный секрет TOTP
+// Уже включенную двухфакторную аутентификацию не перезаписывает
+func (m *MemoryStorage) SaveMFASecret(userID, secret string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.mfa[userID]; ok && existing.Enabled {
+		return nil
+	}
+	m.mfa[userID] = models.UserMFA{UserID: userID, Secret: secret, CreatedAt: time.Now()}
+	return nil
+}
+
+// EnableMFA включает двухфакторную аутентификацию после подтверждения кодом
+// и сохраняет хеши кодов восстановления
+func (m *MemoryStorage) EnableMFA(userID string, counter int64, recoveryCodeHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mfa, ok := m.mfa[userID]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	mfa.Enabled = true
+	mfa.LastCounter = counter
+	mfa.ConfirmedAt = &now
+	m.mfa[userID] = mfa
+	m.replaceRecoveryCodesLocked(userID, recoveryCodeHashes)
+
+	log.Printf("Двухфакторная аутентификация включена для пользователя %s", userID)
+	return nil
+}
+
+// DisableMFA отключает двухфакторную аутентификацию и удаляет коды восстановления
+func (m *MemoryStorage) DisableMFA(userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.mfa, userID)
+	delete(m.recoveryCodes, userID)
+
+	log.Printf("Двухфакторная аутентификация отключена для пользователя %s", userID)
+	return nil
+}
+
+// RecordMFAFailure увеличивает счетчик неверных кодов второго фактора подряд и, начиная
+// с maxAttempts-го неверного кода, блокирует проверку кодов
+// Возвращает число неверных кодов подряд и время окончания блокировки (nil, если блокировки нет)
+func (m *MemoryStorage) RecordMFAFailure(userID string, maxAttempts int, lockout time.Duration) (int, *time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mfa, ok := m.mfa[userID]
+	if !ok {
+		return 0, nil, nil
+	}
+	mfa.FailedAttempts++
+	lockedUntil := mfaLockedUntil(mfa.FailedAttempts, maxAttempts, lockout, time.Now())
+	if lockedUntil != nil {
+		mfa.LockedUntil = lockedUntil
+		log.Printf("Проверка кодов 2FA пользователя %s заблокирована до %s после %d неверных кодов",
+			userID, lockedUntil.Format(time.RFC3339), mfa.FailedAttempts)
+	}
+	m.mfa[userID] = mfa
+	return mfa.FailedAttempts, lockedUntil, nil
+}
+
+// ResetMFAFailures сбрасывает счетчик неверных кодов и блокировку после принятого кода
+func (m *MemoryStorage) ResetMFAFailures(userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if mfa, ok := m.mfa[userID]; ok {
+		mfa.FailedAttempts = 0
+		mfa.LockedUntil = nil
+		m.mfa[userID] = mfa
+	}
+	return nil
+}
+
+// UseTOTPCounter отмечает временной шаг TOTP как использованный
+// Возвращает false, если код этого или более позднего шага уже был принят (повтор кода)
+func (m *MemoryStorage) UseTOTPCounter(userID string, counter int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mfa, ok := m.mfa[userID]
+	if !ok || mfa.LastCounter >= counter {
+		return false, nil
+	}
+	mfa.LastCounter = counter
+	m.mfa[userID] = mfa
+	return true, nil
+}
+
+// UseRecoveryCode погашает код восстановления
+// Возвращает false, если код не найден или уже использован
+func (m *MemoryStorage) UseRecoveryCode(userID, codeHash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	used, ok := m.recoveryCodes[userID][codeHash]
+	if !ok || used {
+		return false, nil
+	}
+	m.recoveryCodes[userID][codeHash] = true
+	return true, nil
+}
+
+// ReplaceRecoveryCodes заменяет все коды восстановления пользователя новыми
+func (m *MemoryStorage) ReplaceRecoveryCodes(userID string, recoveryCodeHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.replaceRecoveryCodesLocked(userID, recoveryCodeHashes)
+	return nil
+}
+
+// replaceRecoveryCodesLocked заменяет коды восстановления; вызывающий код должен удерживать блокировку на запись
+func (m *MemoryStorage) replaceRecoveryCodesLocked(userID string, recoveryCodeHashes []string) {
+	codes := make(map[string]bool, len(recoveryCodeHashes))
+	for _, hash := range recoveryCodeHashes {
+		codes[hash] = false
+	}
+	m.recoveryCodes[userID] = codes
+}
+
+// SetExchangeRate сохраняет курс валюты к рублю, заменяя прежнее значение
+func (m *MemoryStorage) SetExchangeRate(rate models.ExchangeRate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.exchangeRates[rate.Currency] = rate
+	return nil
+}
+
+// GetExchangeRate получает курс валюты к рублю
+func (m *MemoryStorage) GetExchangeRate(currency string) (models.ExchangeRate, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rate, ok := m.exchangeRates[currency]
+	return rate, ok
+}
+
+// ListExchangeRates возвращает все установленные курсы валют в алфавитном порядке кодов
+func (m *MemoryStorage) ListExchangeRates() ([]models.ExchangeRate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	rates := make([]models.ExchangeRate, 0, len(m.exchangeRates))
+	for _, rate := range m.exchangeRates {
+		rates = append(rates, rate)
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		return rates[i].Currency < rates[j].Currency
+	})
+	return rates, nil
+}
+
+// SaveCurrencyRates сохраняет официальные курсы валют в историю, заменяя курсы на ту же дату
+func (m *MemoryStorage) SaveCurrencyRates(rates []models.CurrencyRate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, rate := range rates {
+		day := rate.Date.Format("2006-01-02")
+		if m.currencyRates[day] == nil {
+			m.currencyRates[day] = make(map[string]models.CurrencyRate)
+		}
+		m.currencyRates[day][rate.Currency] = rate
+	}
+	return nil
+}
+
+// GetCurrencyRates возвращает официальные курсы валют, сохраненные на дату date, в алфавитном порядке кодов
+func (m *MemoryStorage) GetCurrencyRates(date time.Time) ([]models.CurrencyRate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	byCurrency := m.currencyRates[date.Format("2006-01-02")]
+	rates := make([]models.CurrencyRate, 0, len(byCurrency))
+	for _, rate := range byCurrency {
+		rates = append(rates, rate)
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		return rates[i].Currency < rates[j].Currency
+	})
+	return rates, nil
+}
+
+// SaveKeyRates сохраняет ключевые ставки в историю, заменяя ставки на ту же дату
+func (m *MemoryStorage) SaveKeyRates(rates []models.KeyRate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, rate := range rates {
+		m.keyRates[rate.Date.Format("2006-01-02")] = rate
+	}
+	return nil
+}
+
+// GetKeyRate возвращает последнюю сохраненную ключевую ставку с датой начала действия не позже date
+func (m *MemoryStorage) GetKeyRate(date time.Time) (models.KeyRate, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	// Даты в формате YYYY-MM-DD сравниваются как строки в хронологическом порядке
+	day := date.Format("2006-01-02")
+	var found models.KeyRate
+	var foundDay string
+	for effective, rate := range m.keyRates {
+		if effective <= day && effective > foundDay {
+			found, foundDay = rate, effective
+		}
+	}
+	return found, foundDay != ""
+}
+
+// postTransactionLocked проводит операцию; вызывающий код должен удерживать блокировку на запись
+func (m *MemoryStorage) postTransactionLocked(posting models.Posting) error {
+	if err := validatePosting(posting); err != nil {
+		return err
+	}
+
+	deltas := make(map[string]decimal.Decimal)
+	for _, entry := range posting.Entries {
+		if IsSystemLedgerAccount(entry.LedgerAccount) {
+			continue
+		}
+		deltas[entry.LedgerAccount] = deltas[entry.LedgerAccount].Add(entry.Credit).Sub(entry.Debit)
+	}
+
+	// Проверяем все счета до внесения изменений, чтобы операция была атомарной
+	for accountID, delta := range deltas {
+		account, ok := m.accounts[accountID]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrAccountNotFound, accountID)
+		}
+		if expected := postingCurrency(posting.Transaction, accountID); account.Currency != expected {
+			return fmt.Errorf("%w: account %s is in %s, posting is in %s", ErrCurrencyMismatch, accountID, account.Currency, expected)
+		}
+		if delta.IsNegative() && account.Status == models.AccountStatusFrozen {
+			return fmt.Errorf("%w: %s", ErrAccountFrozen, accountID)
+		}
+		if delta.IsNegative() && account.Available().Add(delta).IsNegative() {
+			return fmt.Errorf("%w: account %s", ErrInsufficientFunds, accountID)
+		}
+	}
+
+	for accountID, delta := range deltas {
+		account := m.accounts[accountID]
+		account.Balance = account.Balance.Add(delta)
+		m.accounts[accountID] = account
+	}
+
+	m.transactions = append(m.transactions, posting.Transaction)
+	for _, entry := range posting.Entries {
+		m.nextEntryID++
+		entry.ID = m.nextEntryID
+		entry.TransactionID = posting.Transaction.ID
+		entry.CreatedAt = posting.Transaction.Timestamp
+		m.entries = append(m.entries, entry)
+	}
+	return nil
+}
+
+// withPaymentIDs присваивает идентификаторы строкам графика платежей, как это делает SERIAL в PostgreSQL
+func (m *MemoryStorage) withPaymentIDs(loan models.Loan) models.Loan {
+	loan = copyLoan(loan)
+	for i := range loan.PaymentSchedule {
+		m.nextPaymentID++
+		loan.PaymentSchedule[i].ID = m.nextPaymentID
+	}
+	return loan
+}
+
+// filterLoans возвращает копии кредитов, удовлетворяющих условию, начиная с самых новых
+func (m *MemoryStorage) filterLoans(match func(models.Loan) bool) []models.Loan {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var loans []models.Loan
+	for _, loan := range m.loans {
+		if match(loan) {
+			loans = append(loans, copyLoan(loan))
+		}
+	}
+	sort.Slice(loans, func(i, j int) bool {
+		return loans[i].StartDate.After(loans[j].StartDate)
+	})
+	return loans
+}
+
+// copyLoan создает копию кредита с собственным графиком платежей,
+// чтобы вызывающий код не мог изменить данные хранилища
+func copyLoan(loan models.Loan) models.Loan {
+	if loan.PaymentSchedule != nil {
+		schedule := make([]models.Payment, len(loan.PaymentSchedule))
+		copy(schedule, loan.PaymentSchedule)
+		loan.PaymentSchedule = schedule
+	}
+	return loan
+}
+
+// idempotencyID формирует ключ карты ключей идемпотентности
+func idempotencyID(userID, key string) string {
+	return userID + "\x00" + key
+}
+
+// sortTransactionsDesc упорядочивает транзакции от новых к старым
+func sortTransactionsDesc(transactions []models.Transaction) {
+	sort.Slice(transactions, func(i, j int) bool {
+		return transactions[i].Timestamp.After(transactions[j].Timestamp)
+	})
+}
@@ -0,0 +1,289 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/models"
+)
+
+// cardFixture - хранилище в памяти со счетом клиента и картой к нему
+type cardFixture struct {
+	store   *MemoryStorage
+	account models.Account
+	card    models.Card
+}
+
+// newCardFixture создает клиента, счет с балансом balance и карту к счету
+func newCardFixture(t *testing.T, balance int64) cardFixture {
+	t.Helper()
+	store := NewMemoryStorage()
+	now := time.Now()
+
+	user := models.User{ID: uuid.NewString(), Username: "client", Email: "client@example.com", Role: models.RoleCustomer, CreatedAt: now}
+	if err := store.RegisterNewUser(user); err != nil {
+		t.Fatalf("RegisterNewUser: %v", err)
+	}
+	account := models.Account{
+		ID:        uuid.NewString(),
+		UserID:    user.ID,
+		Number:    "40817810000000000001",
+		Type:      "current",
+		Currency:  "RUB",
+		Status:    models.AccountStatusActive,
+		CreatedAt: now,
+	}
+	if err := store.CreateBankAccount(account); err != nil {
+		t.Fatalf("CreateBankAccount: %v", err)
+	}
+	card := models.Card{ID: uuid.NewString(), AccountID: account.ID, NumberHMAC: "hmac", Status: "active", CreatedAt: now}
+	if err := store.AddCard(card); err != nil {
+		t.Fatalf("AddCard: %v", err)
+	}
+
+	amount := decimal.NewFromInt(balance)
+	deposit := models.Posting{
+		Transaction: models.Transaction{
+			ID:              uuid.NewString(),
+			ToAccountID:     account.ID,
+			Amount:          amount,
+			Currency:        account.Currency,
+			Timestamp:       now,
+			TransactionType: "deposit",
+		},
+		Entries: []models.JournalEntry{DebitLeg(LedgerCash, amount), CreditLeg(account.ID, amount)},
+	}
+	if err := store.PostTransaction(deposit); err != nil {
+		t.Fatalf("PostTransaction: %v", err)
+	}
+	return cardFixture{store: store, account: account, card: card}
+}
+
+// paymentPosting формирует проводку платежа по карте на сумму amount в момент at
+func (f cardFixture) paymentPosting(amount int64, at time.Time) models.Posting {
+	value := decimal.NewFromInt(amount)
+	return models.Posting{
+		Transaction: models.Transaction{
+			ID:              uuid.NewString(),
+			FromAccountID:   f.account.ID,
+			Amount:          value,
+			Currency:        f.account.Currency,
+			Timestamp:       at,
+			TransactionType: "payment",
+			CardID:          f.card.ID,
+			Merchant:        "Shop",
+		},
+		Entries: []models.JournalEntry{DebitLeg(f.account.ID, value), CreditLeg(LedgerCardSettlement, value)},
+	}
+}
+
+// authorizeHold удерживает amount по карте на срок ttl
+func (f cardFixture) authorizeHold(t *testing.T, amount int64, ttl time.Duration) models.Hold {
+	t.Helper()
+	now := time.Now()
+	hold := models.Hold{
+		ID:        uuid.NewString(),
+		CardID:    f.card.ID,
+		AccountID: f.account.ID,
+		Amount:    decimal.NewFromInt(amount),
+		Merchant:  "Shop",
+		Status:    models.HoldStatusAuthorized,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if err := f.store.AuthorizeHold(hold); err != nil {
+		t.Fatalf("AuthorizeHold: %v", err)
+	}
+	return hold
+}
+
+// checkBalances сверяет учетный баланс и сумму удержаний счета
+func (f cardFixture) checkBalances(t *testing.T, balance, held int64) {
+	t.Helper()
+	account, _ := f.store.GetAccount(f.account.ID)
+	if !account.Balance.Equal(decimal.NewFromInt(balance)) || !account.HeldAmount.Equal(decimal.NewFromInt(held)) {
+		t.Errorf("баланс %s, удержано %s, ожидалось %d и %d", account.Balance, account.HeldAmount, balance, held)
+	}
+}
+
+func TestCaptureHoldPartialReleasesRemainder(t *testing.T) {
+	f := newCardFixture(t, 1000)
+	hold := f.authorizeHold(t, 600, time.Hour)
+	f.checkBalances(t, 1000, 600)
+
+	captured, err := f.store.CaptureHold(hold.ID, f.paymentPosting(450, time.Now()))
+	if err != nil {
+		t.Fatalf("CaptureHold: %v", err)
+	}
+	if captured.Status != models.HoldStatusCaptured || !captured.CapturedAmount.Equal(decimal.NewFromInt(450)) {
+		t.Errorf("удержание %s, списано %s", captured.Status, captured.CapturedAmount)
+	}
+	// Списана только сумма списания, не списанный остаток удержания возвращен в доступный баланс
+	f.checkBalances(t, 550, 0)
+
+	// Завершенное удержание нельзя списать повторно
+	if _, err := f.store.CaptureHold(hold.ID, f.paymentPosting(150, time.Now())); !errors.Is(err, ErrHoldNotAuthorized) {
+		t.Errorf("повторное списание: %v, ожидалась ErrHoldNotAuthorized", err)
+	}
+	f.checkBalances(t, 550, 0)
+}
+
+func TestCaptureHoldExceedingAmount(t *testing.T) {
+	f := newCardFixture(t, 1000)
+	hold := f.authorizeHold(t, 300, time.Hour)
+
+	if _, err := f.store.CaptureHold(hold.ID, f.paymentPosting(301, time.Now())); !errors.Is(err, ErrCaptureExceedsHold) {
+		t.Fatalf("списание больше удержания: %v, ожидалась ErrCaptureExceedsHold", err)
+	}
+	// Удержание продолжает действовать
+	f.checkBalances(t, 1000, 300)
+	if current, _ := f.store.GetHold(hold.ID); current.Status != models.HoldStatusAuthorized {
+		t.Errorf("статус удержания %s, ожидался %s", current.Status, models.HoldStatusAuthorized)
+	}
+}
+
+func TestCaptureExpiredHoldReleasesFunds(t *testing.T) {
+	f := newCardFixture(t, 1000)
+	hold := f.authorizeHold(t, 600, time.Hour)
+
+	// Списание поступило после истечения срока удержания
+	_, err := f.store.CaptureHold(hold.ID, f.paymentPosting(600, hold.ExpiresAt.Add(time.Minute)))
+	if !errors.Is(err, ErrHoldExpired) {
+		t.Fatalf("CaptureHold: %v, ожидалась ErrHoldExpired", err)
+	}
+	if current, _ := f.store.GetHold(hold.ID); current.Status != models.HoldStatusExpired {
+		t.Errorf("статус удержания %s, ожидался %s", current.Status, models.HoldStatusExpired)
+	}
+	// Платеж не проведен, удержанная сумма снова доступна
+	f.checkBalances(t, 1000, 0)
+	if transactions := f.store.GetAccountTransactions(f.account.ID); len(transactions) != 1 {
+		t.Errorf("по счету %d операций, ожидалось только пополнение", len(transactions))
+	}
+}
+
+// pay проводит платеж по карте на сумму amount
+func (f cardFixture) pay(t *testing.T, amount int64) models.Transaction {
+	t.Helper()
+	posting := f.paymentPosting(amount, time.Now())
+	if err := f.store.PostCardPayment(posting); err != nil {
+		t.Fatalf("PostCardPayment: %v", err)
+	}
+	return posting.Transaction
+}
+
+// returnPosting формирует проводку возврата или компенсации по платежу payment на сумму amount
+func returnPosting(payment models.Transaction, amount int64, transactionType string) models.Posting {
+	value := decimal.NewFromInt(amount)
+	return models.Posting{
+		Transaction: models.Transaction{
+			ID:                   uuid.NewString(),
+			ToAccountID:          payment.FromAccountID,
+			Amount:               value,
+			Currency:             payment.Currency,
+			Timestamp:            time.Now(),
+			TransactionType:      transactionType,
+			CardID:               payment.CardID,
+			RelatedTransactionID: payment.ID,
+		},
+		Entries: []models.JournalEntry{DebitLeg(LedgerCardSettlement, value), CreditLeg(payment.FromAccountID, value)},
+	}
+}
+
+// openDispute открывает спор по платежу payment на сумму amount
+func (f cardFixture) openDispute(payment models.Transaction, amount int64) (models.Dispute, error) {
+	now := time.Now()
+	dispute := models.Dispute{
+		ID:            uuid.NewString(),
+		TransactionID: payment.ID,
+		AccountID:     payment.FromAccountID,
+		CardID:        payment.CardID,
+		Amount:        decimal.NewFromInt(amount),
+		Reason:        "Товар не получен",
+		Status:        models.DisputeStatusOpen,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	return dispute, f.store.OpenDispute(dispute)
+}
+
+func TestRefundAndChargebackNotExceedPayment(t *testing.T) {
+	f := newCardFixture(t, 1000)
+	payment := f.pay(t, 500)
+
+	// Частичный возврат от получателя платежа
+	if err := f.store.RefundPayment(returnPosting(payment, 200, models.TransactionTypeRefund)); err != nil {
+		t.Fatalf("RefundPayment: %v", err)
+	}
+
+	// Спор на сумму больше невозвращенного остатка не открывается
+	if _, err := f.openDispute(payment, 400); !errors.Is(err, ErrRefundExceedsPayment) {
+		t.Fatalf("спор сверх остатка: %v, ожидалась ErrRefundExceedsPayment", err)
+	}
+	dispute, err := f.openDispute(payment, 300)
+	if err != nil {
+		t.Fatalf("OpenDispute: %v", err)
+	}
+
+	// Пока спор рассматривается, получатель возвращает еще часть платежа, и компенсация
+	// по спору превысила бы сумму платежа
+	if err := f.store.RefundPayment(returnPosting(payment, 100, models.TransactionTypeRefund)); err != nil {
+		t.Fatalf("RefundPayment: %v", err)
+	}
+	chargeback := returnPosting(payment, 300, models.TransactionTypeChargeback)
+	if _, err := f.store.UpdateDisputeStatus(dispute.ID, models.DisputeStatusWon, "", &chargeback); !errors.Is(err, ErrRefundExceedsPayment) {
+		t.Fatalf("компенсация сверх остатка: %v, ожидалась ErrRefundExceedsPayment", err)
+	}
+	if current, _ := f.store.GetDispute(dispute.ID); current.Status != models.DisputeStatusOpen {
+		t.Errorf("статус спора %s после отклоненной компенсации, ожидался %s", current.Status, models.DisputeStatusOpen)
+	}
+
+	// Компенсация в пределах остатка закрывает платеж полностью
+	chargeback = returnPosting(payment, 200, models.TransactionTypeChargeback)
+	if _, err := f.store.UpdateDisputeStatus(dispute.ID, models.DisputeStatusWon, "", &chargeback); err != nil {
+		t.Fatalf("UpdateDisputeStatus: %v", err)
+	}
+	if err := f.store.RefundPayment(returnPosting(payment, 1, models.TransactionTypeRefund)); !errors.Is(err, ErrRefundExceedsPayment) {
+		t.Errorf("возврат по полностью возвращенному платежу: %v, ожидалась ErrRefundExceedsPayment", err)
+	}
+
+	refunded, err := f.store.GetRefundedAmount(payment.ID)
+	if err != nil {
+		t.Fatalf("GetRefundedAmount: %v", err)
+	}
+	if !refunded.Equal(payment.Amount) {
+		t.Errorf("возвращено %s, ожидалось %s", refunded, payment.Amount)
+	}
+	f.checkBalances(t, 1000, 0)
+}
+
+func TestOpenDisputeRejectsSecondActive(t *testing.T) {
+	f := newCardFixture(t, 1000)
+	payment := f.pay(t, 500)
+
+	first, err := f.openDispute(payment, 100)
+	if err != nil {
+		t.Fatalf("OpenDispute: %v", err)
+	}
+	if _, err := f.openDispute(payment, 100); !errors.Is(err, ErrDisputeExists) {
+		t.Fatalf("второй спор при открытом: %v, ожидалась ErrDisputeExists", err)
+	}
+
+	if _, err := f.store.UpdateDisputeStatus(first.ID, models.DisputeStatusUnderReview, "", nil); err != nil {
+		t.Fatalf("UpdateDisputeStatus: %v", err)
+	}
+	if _, err := f.openDispute(payment, 100); !errors.Is(err, ErrDisputeExists) {
+		t.Fatalf("второй спор при рассматриваемом: %v, ожидалась ErrDisputeExists", err)
+	}
+
+	// После отказа по спору можно открыть новый
+	if _, err := f.store.UpdateDisputeStatus(first.ID, models.DisputeStatusLost, "Товар доставлен", nil); err != nil {
+		t.Fatalf("UpdateDisputeStatus: %v", err)
+	}
+	if _, err := f.openDispute(payment, 100); err != nil {
+		t.Errorf("спор после решенного: %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"bankapp/internal/models"
+)
+
+// GetUserMFA возвращает настройки двухфакторной аутентификации пользователя
+// Возвращает false, если пользователь не начинал настройку
+func (s *DBStorage) GetUserMFA(userID string) (models.UserMFA, bool) {
+	var mfa models.UserMFA
+	var confirmedAt, lockedUntil sql.NullTime
+	err := s.DB.QueryRow(`
+		SELECT user_id, secret, enabled, last_counter, created_at, confirmed_at, failed_attempts, locked_until
+		FROM user_mfa
+		WHERE user_id = $1
+	`, userID).Scan(&mfa.UserID, &mfa.Secret, &mfa.Enabled, &mfa.LastCounter, &mfa.CreatedAt, &confirmedAt,
+		&mfa.FailedAttempts, &lockedUntil)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Ошибка при получении настроек 2FA пользователя %s: %v", userID, err)
+		}
+		return models.UserMFA{}, false
+	}
+	if confirmedAt.Valid {
+		mfa.ConfirmedAt = &confirmedAt.Time
+	}
+	if lockedUntil.Valid {
+		mfa.LockedUntil = &lockedUntil.Time
+	}
+	return mfa, true
+}
+
+// SaveMFASecret сохраняет новый неподтвержденный секрет TOTP
+// Уже включенную двухфакторную аутентификацию не перезаписывает
+func (s *DBStorage) SaveMFASecret(userID, secret string) error {
+	_, err := s.DB.Exec(`
+		INSERT INTO user_mfa (user_id, secret, enabled, last_counter, created_at)
+		VALUES ($1, $2, FALSE, 0, $3)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_counter = 0, created_at = EXCLUDED.created_at
+		WHERE user_mfa.enabled = FALSE
+	`, userID, secret, time.Now())
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении секрета 2FA: %w", err)
+	}
+	return nil
+}
+
+// EnableMFA включает двухфакторную аутентификацию после подтверждения кодом
+// и сохраняет хеши кодов восстановления
+func (s *DBStorage) EnableMFA(userID string, counter int64, recoveryCodeHashes []string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.Exec("UPDATE user_mfa SET enabled = TRUE, last_counter = $2, confirmed_at = $3 WHERE user_id = $1",
+		userID, counter, time.Now())
+	if err != nil {
+		return fmt.Errorf("ошибка при включении 2FA: %w", err)
+	}
+
+	if err = replaceRecoveryCodesTx(tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+
+	log.Printf("Двухфакторная аутентификация включена для пользователя %s", userID)
+	return nil
+}
+
+// DisableMFA отключает двухфакторную аутентификацию и удаляет коды восстановления
+func (s *DBStorage) DisableMFA(userID string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("ошибка при удалении кодов восстановления: %w", err)
+	}
+	if _, err = tx.Exec("DELETE FROM user_mfa WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("ошибка при отключении 2FA: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+
+	log.Printf("Двухфакторная аутентификация отключена для пользователя %s", userID)
+	return nil
+}
+
+// RecordMFAFailure увеличивает счетчик неверных кодов второго фактора подряд и, начиная
+// с maxAttempts-го неверного кода, блокирует проверку кодов (см. mfaLockedUntil)
+// Возвращает число неверных кодов подряд и время окончания блокировки (nil, если блокировки нет)
+func (s *DBStorage) RecordMFAFailure(userID string, maxAttempts int, lockout time.Duration) (int, *time.Time, error) {
+	var attempts int
+	err := s.DB.QueryRow(`
+		UPDATE user_mfa SET failed_attempts = failed_attempts + 1
+		WHERE user_id = $1
+		RETURNING failed_attempts
+	`, userID).Scan(&attempts)
+	if err == sql.ErrNoRows {
+		return 0, nil, nil
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("ошибка при учете неверного кода 2FA: %w", err)
+	}
+
+	lockedUntil := mfaLockedUntil(attempts, maxAttempts, lockout, time.Now())
+	if lockedUntil == nil {
+		return attempts, nil, nil
+	}
+	_, err = s.DB.Exec("UPDATE user_mfa SET locked_until = GREATEST(COALESCE(locked_until, $2), $2) WHERE user_id = $1",
+		userID, *lockedUntil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("ошибка при блокировке проверки кодов 2FA: %w", err)
+	}
+
+	log.Printf("Проверка кодов 2FA пользователя %s заблокирована до %s после %d неверных кодов",
+		userID, lockedUntil.Format(time.RFC3339), attempts)
+	return attempts, lockedUntil, nil
+}
+
+// ResetMFAFailures сбрасывает счетчик неверных кодов и блокировку после принятого кода
+func (s *DBStorage) ResetMFAFailures(userID string) error {
+	_, err := s.DB.Exec("UPDATE user_mfa SET failed_attempts = 0, locked_until = NULL WHERE user_id = $1", userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при сбросе счетчика неверных кодов 2FA: %w", err)
+	}
+	return nil
+}
+
+// maxMFALockout ограничивает длительность блокировки проверки кодов второго фактора
+const maxMFALockout = 24 * time.Hour
+
+// mfaLockedUntil возвращает время окончания блокировки проверки кодов после attempts неверных кодов подряд
+// Блокировка начинается с maxAttempts-го неверного кода, длится lockout и удваивается с каждым
+// следующим неверным кодом, но не дольше maxMFALockout; nil - блокировки нет
+func mfaLockedUntil(attempts, maxAttempts int, lockout time.Duration, now time.Time) *time.Time {
+	if attempts < maxAttempts {
+		return nil
+	}
+	duration := lockout
+	for i := maxAttempts; i < attempts && duration < maxMFALockout; i++ {
+		duration *= 2
+	}
+	if duration > maxMFALockout {
+		duration = maxMFALockout
+	}
+	until := now.Add(duration)
+	return &until
+}
+
+// UseTOTPCounter отмечает временной шаг TOTP как использованный
+// Возвращает false, если код этого или более позднего шага уже был принят (повтор кода)
+func (s *DBStorage) UseTOTPCounter(userID string, counter int64) (bool, error) {
+	result, err := s.DB.Exec("UPDATE user_mfa SET last_counter = $2 WHERE user_id = $1 AND last_counter < $2",
+		userID, counter)
+	if err != nil {
+		return false, fmt.Errorf("ошибка при сохранении шага TOTP: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка при сохранении шага TOTP: %w", err)
+	}
+	return affected == 1, nil
+}
+
+// UseRecoveryCode погашает код восстановления
+// Возвращает false, если код не найден или уже использован
+func (s *DBStorage) UseRecoveryCode(userID, codeHash string) (bool, error) {
+	result, err := s.DB.Exec(`
+		UPDATE mfa_recovery_codes SET used_at = $3
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, codeHash, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("ошибка при использовании кода восстановления: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка при использовании кода восстановления: %w", err)
+	}
+	return affected == 1, nil
+}
+
+// ReplaceRecoveryCodes заменяет все коды восстановления пользователя новыми
+func (s *DBStorage) ReplaceRecoveryCodes(userID string, recoveryCodeHashes []string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = replaceRecoveryCodesTx(tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+	return nil
+}
+
+// replaceRecoveryCodesTx заменяет коды восстановления внутри открытой транзакции
+func replaceRecoveryCodesTx(tx *sql.Tx, userID string, recoveryCodeHashes []string) error {
+	if _, err := tx.Exec("DELETE FROM mfa_recovery_codes WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("ошибка при удалении кодов восстановления: %w", err)
+	}
+	for _, hash := range recoveryCodeHashes {
+		_, err := tx.Exec("INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, hash)
+		if err != nil {
+			return fmt.Errorf("ошибка при сохранении кода восстановления: %w", err)
+		}
+	}
+	return nil
+}
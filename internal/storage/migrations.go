@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles содержит SQL-файлы миграций, встроенные в бинарный файл
+// Имя файла имеет вид NNNN_описание.up.sql или NNNN_описание.down.sql
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// Migration представляет одну версию схемы базы данных
+type Migration struct {
+	Version int    // Номер версии схемы
+	Name    string // Краткое описание изменения
+	Up      string // SQL для перехода на эту версию
+	Down    string // SQL для отката этой версии
+}
+
+// MigrationState описывает состояние миграции в конкретной базе данных
+type MigrationState struct {
+	Migration
+	Applied   bool      // Применена ли миграция
+	AppliedAt time.Time // Время применения
+}
+
+// loadMigrations читает встроенные миграции и упорядочивает их по версии
+// Возвращает ошибку, если у версии нет пары up/down или нумерация имеет пропуски
+func loadMigrations() ([]Migration, error) {
+	files, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("не удалось прочитать список миграций: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		base := path.Base(file)
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			return nil, fmt.Errorf("некорректное имя файла миграции %s", base)
+		}
+
+		name := strings.TrimSuffix(base, "."+direction+".sql")
+		versionPart, description, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("некорректное имя файла миграции %s", base)
+		}
+		version, err := strconv.Atoi(versionPart)
+		if err != nil {
+			return nil, fmt.Errorf("некорректный номер версии в файле %s: %w", base, err)
+		}
+
+		content, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("не удалось прочитать миграцию %s: %w", base, err)
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: description}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("у миграции %04d нет пары up/down", m.Version)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("пропущена миграция %04d", i+1)
+		}
+	}
+
+	return migrations, nil
+}
+
+// LatestSchemaVersion возвращает версию схемы, которую ожидает приложение
+func LatestSchemaVersion() (int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	return len(migrations), nil
+}
+
+// MigrateUp применяет все неприменённые миграции по порядку
+// Каждая миграция выполняется в собственной транзакции
+// Возвращает список примененных миграций
+func (s *DBStorage) MigrateUp() ([]Migration, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if current > len(migrations) {
+		return nil, fmt.Errorf("версия схемы %d новее последней известной миграции %d", current, len(migrations))
+	}
+
+	var applied []Migration
+	for _, m := range migrations[current:] {
+		if err := s.applyMigration(m, true); err != nil {
+			return applied, err
+		}
+		applied = append(applied, m)
+		log.Printf("Применена миграция %04d_%s", m.Version, m.Name)
+	}
+	return applied, nil
+}
+
+// MigrateDown откатывает последнюю примененную миграцию
+// Возвращает откаченную миграцию и false, если откатывать нечего
+func (s *DBStorage) MigrateDown() (Migration, bool, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return Migration{}, false, err
+	}
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return Migration{}, false, err
+	}
+	if current == 0 {
+		return Migration{}, false, nil
+	}
+	if current > len(migrations) {
+		return Migration{}, false, fmt.Errorf("миграция %04d неизвестна этой версии приложения", current)
+	}
+
+	m := migrations[current-1]
+	if err := s.applyMigration(m, false); err != nil {
+		return Migration{}, false, err
+	}
+	log.Printf("Откачена миграция %04d_%s", m.Version, m.Name)
+	return m, true, nil
+}
+
+// MigrationStatus возвращает состояние всех известных миграций в базе данных
+func (s *DBStorage) MigrationStatus() ([]MigrationState, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	appliedAt := make(map[int]time.Time)
+	rows, err := s.DB.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении примененных миграций: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании данных миграции: %w", err)
+		}
+		appliedAt[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при итерации по результатам запроса: %w", err)
+	}
+
+	states := make([]MigrationState, 0, len(migrations))
+	for _, m := range migrations {
+		at, ok := appliedAt[m.Version]
+		states = append(states, MigrationState{Migration: m, Applied: ok, AppliedAt: at})
+	}
+	return states, nil
+}
+
+// SchemaVersion возвращает номер последней примененной миграции (0 для пустой базы)
+func (s *DBStorage) SchemaVersion() (int, error) {
+	if err := s.ensureMigrationsTable(); err != nil {
+		return 0, err
+	}
+
+	var version int
+	err := s.DB.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при получении версии схемы: %w", err)
+	}
+	return version, nil
+}
+
+// checkSchemaVersion сравнивает версию схемы базы данных с версией, ожидаемой приложением
+func (s *DBStorage) checkSchemaVersion() error {
+	latest, err := LatestSchemaVersion()
+	if err != nil {
+		return err
+	}
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case current < latest:
+		return fmt.Errorf("схема базы данных устарела (версия %d, требуется %d): выполните `bankapp migrate up`", current, latest)
+	case current > latest:
+		return fmt.Errorf("схема базы данных (версия %d) новее приложения (версия %d): обновите приложение или выполните `bankapp migrate down`", current, latest)
+	}
+	return nil
+}
+
+// ensureMigrationsTable создает таблицу учета миграций, если она не существует
+func (s *DBStorage) ensureMigrationsTable() error {
+	_, err := s.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("ошибка при создании таблицы миграций: %w", err)
+	}
+	return nil
+}
+
+// applyMigration выполняет SQL миграции и обновляет таблицу учета в одной транзакции
+func (s *DBStorage) applyMigration(m Migration, up bool) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if up {
+		if _, err = tx.Exec(m.Up); err != nil {
+			return fmt.Errorf("ошибка при применении миграции %04d_%s: %w", m.Version, m.Name, err)
+		}
+		_, err = tx.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)",
+			m.Version, m.Name, time.Now())
+	} else {
+		if _, err = tx.Exec(m.Down); err != nil {
+			return fmt.Errorf("ошибка при откате миграции %04d_%s: %w", m.Version, m.Name, err)
+		}
+		_, err = tx.Exec("DELETE FROM schema_migrations WHERE version = $1", m.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении таблицы миграций: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS journal_entries;
+DROP TABLE IF EXISTS payment_schedules;
+DROP TABLE IF EXISTS credits;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS cards;
+DROP TABLE IF EXISTS accounts;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,81 @@
+-- Исходная схема банковского приложения.
+-- Использует IF NOT EXISTS, чтобы принять базы, созданные до появления миграций.
+
+-- Таблица пользователей
+CREATE TABLE IF NOT EXISTS users (
+	id VARCHAR(36) PRIMARY KEY,
+	username VARCHAR(50) UNIQUE NOT NULL,
+	email VARCHAR(100) UNIQUE NOT NULL,
+	password_hash VARCHAR(100) NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Таблица счетов
+CREATE TABLE IF NOT EXISTS accounts (
+	id VARCHAR(36) PRIMARY KEY,
+	user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	number VARCHAR(20) UNIQUE NOT NULL,
+	balance DECIMAL(15, 2) NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Таблица карт
+CREATE TABLE IF NOT EXISTS cards (
+	id VARCHAR(36) PRIMARY KEY,
+	account_id VARCHAR(36) NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+	number VARCHAR(16) NOT NULL,
+	encrypted_number TEXT NOT NULL,
+	number_hmac TEXT NOT NULL,
+	expiry_month INTEGER NOT NULL,
+	expiry_year INTEGER NOT NULL,
+	cvv_hash TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Таблица транзакций
+CREATE TABLE IF NOT EXISTS transactions (
+	id VARCHAR(36) PRIMARY KEY,
+	from_account_id VARCHAR(36) REFERENCES accounts(id),
+	to_account_id VARCHAR(36) REFERENCES accounts(id),
+	amount DECIMAL(15, 2) NOT NULL,
+	timestamp TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	transaction_type VARCHAR(50) NOT NULL,
+	description TEXT
+);
+
+-- Таблица кредитов
+CREATE TABLE IF NOT EXISTS credits (
+	id VARCHAR(36) PRIMARY KEY,
+	user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	account_id VARCHAR(36) NOT NULL REFERENCES accounts(id),
+	amount DECIMAL(15, 2) NOT NULL,
+	interest_rate DECIMAL(5, 2) NOT NULL,
+	term_months INTEGER NOT NULL,
+	start_date TIMESTAMP NOT NULL,
+	remaining_amount DECIMAL(15, 2) NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Таблица графиков платежей
+CREATE TABLE IF NOT EXISTS payment_schedules (
+	id SERIAL PRIMARY KEY,
+	credit_id VARCHAR(36) NOT NULL REFERENCES credits(id) ON DELETE CASCADE,
+	due_date TIMESTAMP NOT NULL,
+	amount DECIMAL(15, 2) NOT NULL,
+	principal_part DECIMAL(15, 2) NOT NULL,
+	interest_part DECIMAL(15, 2) NOT NULL,
+	paid BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+-- Таблица проводок главной книги (двойная запись)
+CREATE TABLE IF NOT EXISTS journal_entries (
+	id BIGSERIAL PRIMARY KEY,
+	transaction_id VARCHAR(36) NOT NULL REFERENCES transactions(id),
+	ledger_account VARCHAR(64) NOT NULL,
+	debit DECIMAL(15, 2) NOT NULL DEFAULT 0,
+	credit DECIMAL(15, 2) NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CHECK (debit >= 0 AND credit >= 0 AND (debit = 0) <> (credit = 0))
+);
+CREATE INDEX IF NOT EXISTS idx_journal_entries_ledger_account ON journal_entries(ledger_account);
+CREATE INDEX IF NOT EXISTS idx_journal_entries_transaction_id ON journal_entries(transaction_id);
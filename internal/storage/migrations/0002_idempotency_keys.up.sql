@@ -0,0 +1,13 @@
+-- Ключи идемпотентности для POST-запросов, перемещающих деньги
+CREATE TABLE idempotency_keys (
+	user_id VARCHAR(36) NOT NULL,
+	idempotency_key VARCHAR(255) NOT NULL,
+	method VARCHAR(10) NOT NULL,
+	path TEXT NOT NULL,
+	fingerprint CHAR(64) NOT NULL,
+	status_code INTEGER,
+	response_body BYTEA,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	completed_at TIMESTAMP,
+	PRIMARY KEY (user_id, idempotency_key)
+);
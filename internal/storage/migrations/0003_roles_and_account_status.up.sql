@@ -0,0 +1,6 @@
+-- Роли пользователей и статус счетов для административного API
+ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'customer'
+	CHECK (role IN ('customer', 'operator', 'admin'));
+
+ALTER TABLE accounts ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'active'
+	CHECK (status IN ('active', 'frozen'));
@@ -0,0 +1,25 @@
+-- Токены обновления с ротацией и отзыв токенов доступа
+CREATE TABLE refresh_tokens (
+	id VARCHAR(36) PRIMARY KEY,
+	user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	family_id VARCHAR(36) NOT NULL,
+	token_hash CHAR(64) NOT NULL UNIQUE,
+	expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP,
+	replaced_by VARCHAR(36)
+);
+
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens(family_id);
+
+-- Отозванные токены доступа; хранятся до истечения срока действия токена
+CREATE TABLE revoked_tokens (
+	jti VARCHAR(36) PRIMARY KEY,
+	user_id VARCHAR(36) NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Токены доступа, выпущенные раньше этого момента, недействительны («выйти на всех устройствах»)
+ALTER TABLE users ADD COLUMN tokens_valid_after TIMESTAMP;
@@ -0,0 +1,16 @@
+-- Двухфакторная аутентификация (TOTP) и коды восстановления
+CREATE TABLE user_mfa (
+	user_id VARCHAR(36) PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	secret VARCHAR(64) NOT NULL,
+	enabled BOOLEAN NOT NULL DEFAULT FALSE,
+	last_counter BIGINT NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	confirmed_at TIMESTAMP
+);
+
+CREATE TABLE mfa_recovery_codes (
+	user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	code_hash CHAR(64) NOT NULL,
+	used_at TIMESTAMP,
+	PRIMARY KEY (user_id, code_hash)
+);
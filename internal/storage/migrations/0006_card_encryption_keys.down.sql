@@ -0,0 +1,6 @@
+-- Открытые номера карт не восстанавливаются: после отката столбец number остается пустым
+DROP INDEX IF EXISTS idx_cards_number_hmac;
+DROP INDEX IF EXISTS idx_cards_encryption_key_id;
+ALTER TABLE cards ADD COLUMN number VARCHAR(16) NOT NULL DEFAULT '';
+ALTER TABLE cards DROP COLUMN IF EXISTS last_four;
+ALTER TABLE cards DROP COLUMN IF EXISTS encryption_key_id;
@@ -0,0 +1,13 @@
+-- Номера карт хранятся только в зашифрованном виде с идентификатором ключа шифрования
+-- Существующие записи зашифрованы прежней XOR-схемой и перешифровываются командой reencrypt-cards
+ALTER TABLE cards ADD COLUMN encryption_key_id VARCHAR(64) NOT NULL DEFAULT 'legacy-xor';
+ALTER TABLE cards ALTER COLUMN encryption_key_id DROP DEFAULT;
+
+ALTER TABLE cards ADD COLUMN last_four CHAR(4);
+UPDATE cards SET last_four = RIGHT(number, 4);
+ALTER TABLE cards ALTER COLUMN last_four SET NOT NULL;
+
+ALTER TABLE cards DROP COLUMN number;
+
+CREATE INDEX idx_cards_encryption_key_id ON cards(encryption_key_id);
+CREATE INDEX idx_cards_number_hmac ON cards(number_hmac);
@@ -0,0 +1,2 @@
+ALTER TABLE cards DROP COLUMN IF EXISTS failed_attempts;
+ALTER TABLE cards DROP COLUMN IF EXISTS status;
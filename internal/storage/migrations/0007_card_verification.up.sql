@@ -0,0 +1,4 @@
+-- Статус карты и счетчик неудачных проверок CVV и срока действия
+ALTER TABLE cards ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'active'
+	CHECK (status IN ('active', 'blocked'));
+ALTER TABLE cards ADD COLUMN failed_attempts INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+ALTER TABLE cards DROP COLUMN IF EXISTS replaced_by;
+
+-- Прежняя схема знает только активные и заблокированные карты
+UPDATE cards SET status = 'blocked' WHERE status NOT IN ('active', 'blocked');
+ALTER TABLE cards DROP CONSTRAINT IF EXISTS cards_status_check;
+ALTER TABLE cards ADD CONSTRAINT cards_status_check CHECK (status IN ('active', 'blocked'));
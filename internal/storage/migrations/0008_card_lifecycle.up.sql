@@ -0,0 +1,7 @@
+-- Жизненный цикл карты: заморозка, закрытие, истечение срока и перевыпуск
+ALTER TABLE cards DROP CONSTRAINT IF EXISTS cards_status_check;
+ALTER TABLE cards ADD CONSTRAINT cards_status_check
+	CHECK (status IN ('active', 'frozen', 'blocked', 'closed', 'expired'));
+
+-- Карта, выпущенная взамен закрытой при перевыпуске
+ALTER TABLE cards ADD COLUMN replaced_by VARCHAR(36) REFERENCES cards(id);
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS card_merchant_rules;
+
+DROP INDEX IF EXISTS idx_transactions_card_id_timestamp;
+ALTER TABLE transactions DROP COLUMN IF EXISTS merchant_category;
+ALTER TABLE transactions DROP COLUMN IF EXISTS merchant;
+ALTER TABLE transactions DROP COLUMN IF EXISTS card_id;
+
+ALTER TABLE cards DROP COLUMN IF EXISTS monthly_limit;
+ALTER TABLE cards DROP COLUMN IF EXISTS daily_limit;
+ALTER TABLE cards DROP COLUMN IF EXISTS per_transaction_limit;
@@ -0,0 +1,23 @@
+-- Лимиты расходов по карте; NULL означает отсутствие лимита
+ALTER TABLE cards ADD COLUMN per_transaction_limit DECIMAL(15, 2);
+ALTER TABLE cards ADD COLUMN daily_limit DECIMAL(15, 2);
+ALTER TABLE cards ADD COLUMN monthly_limit DECIMAL(15, 2);
+
+-- Карта и получатель платежа, по которым считаются расходы по лимитам
+ALTER TABLE transactions ADD COLUMN card_id VARCHAR(36) REFERENCES cards(id);
+ALTER TABLE transactions ADD COLUMN merchant VARCHAR(255);
+ALTER TABLE transactions ADD COLUMN merchant_category VARCHAR(100);
+CREATE INDEX IF NOT EXISTS idx_transactions_card_id_timestamp ON transactions(card_id, timestamp)
+	WHERE card_id IS NOT NULL;
+
+-- Списки разрешенных и запрещенных получателей платежей по карте
+CREATE TABLE IF NOT EXISTS card_merchant_rules (
+	id VARCHAR(36) PRIMARY KEY,
+	card_id VARCHAR(36) NOT NULL REFERENCES cards(id) ON DELETE CASCADE,
+	list VARCHAR(10) NOT NULL CHECK (list IN ('allow', 'deny')),
+	kind VARCHAR(10) NOT NULL CHECK (kind IN ('merchant', 'category')),
+	value VARCHAR(255) NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_card_merchant_rules_unique
+	ON card_merchant_rules(card_id, list, kind, LOWER(value));
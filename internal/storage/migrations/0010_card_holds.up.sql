@@ -0,0 +1,21 @@
+-- Сумма действующих удержаний по картам; доступный баланс счета равен balance - held_amount
+ALTER TABLE accounts ADD COLUMN held_amount DECIMAL(15, 2) NOT NULL DEFAULT 0 CHECK (held_amount >= 0);
+
+-- Удержания при двухфазных платежах по карте: авторизация, затем списание или отмена
+CREATE TABLE IF NOT EXISTS card_holds (
+	id VARCHAR(36) PRIMARY KEY,
+	card_id VARCHAR(36) NOT NULL REFERENCES cards(id),
+	account_id VARCHAR(36) NOT NULL REFERENCES accounts(id),
+	amount DECIMAL(15, 2) NOT NULL CHECK (amount > 0),
+	captured_amount DECIMAL(15, 2) NOT NULL DEFAULT 0,
+	merchant VARCHAR(255),
+	merchant_category VARCHAR(100),
+	status VARCHAR(20) NOT NULL CHECK (status IN ('authorized', 'captured', 'voided', 'expired')),
+	transaction_id VARCHAR(36) REFERENCES transactions(id),
+	expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	completed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_card_holds_card_id ON card_holds(card_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_card_holds_expires_at ON card_holds(expires_at) WHERE status = 'authorized';
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS card_disputes;
+
+DROP INDEX IF EXISTS idx_transactions_related_transaction_id;
+ALTER TABLE transactions DROP COLUMN IF EXISTS related_transaction_id;
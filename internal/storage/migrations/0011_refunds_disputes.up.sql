@@ -0,0 +1,25 @@
+-- Возвраты и компенсации ссылаются на исходный платеж по карте
+ALTER TABLE transactions ADD COLUMN related_transaction_id VARCHAR(36) REFERENCES transactions(id);
+CREATE INDEX IF NOT EXISTS idx_transactions_related_transaction_id ON transactions(related_transaction_id)
+	WHERE related_transaction_id IS NOT NULL;
+
+-- Споры клиентов по платежам; решение в пользу клиента проводится операцией chargeback
+CREATE TABLE IF NOT EXISTS card_disputes (
+	id VARCHAR(36) PRIMARY KEY,
+	transaction_id VARCHAR(36) NOT NULL REFERENCES transactions(id),
+	account_id VARCHAR(36) NOT NULL REFERENCES accounts(id),
+	card_id VARCHAR(36) REFERENCES cards(id),
+	amount DECIMAL(15, 2) NOT NULL CHECK (amount > 0),
+	reason TEXT NOT NULL,
+	status VARCHAR(20) NOT NULL CHECK (status IN ('open', 'under_review', 'won', 'lost')),
+	resolution TEXT,
+	chargeback_transaction_id VARCHAR(36) REFERENCES transactions(id),
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	resolved_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_card_disputes_account_id ON card_disputes(account_id, created_at);
+-- По платежу может быть только один нерешенный спор
+CREATE UNIQUE INDEX IF NOT EXISTS idx_card_disputes_active ON card_disputes(transaction_id)
+	WHERE status IN ('open', 'under_review');
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_cards_number_hmac;
+CREATE INDEX IF NOT EXISTS idx_cards_number_hmac ON cards(number_hmac);
+
+ALTER TABLE cards DROP COLUMN IF EXISTS product;
@@ -0,0 +1,6 @@
+-- Карточный продукт определяет BIN, под которым выпускается номер карты
+ALTER TABLE cards ADD COLUMN product VARCHAR(30) NOT NULL DEFAULT 'debit';
+
+-- Номер карты должен быть уникальным: при совпадении HMAC выпуск повторяется с новым номером
+DROP INDEX IF EXISTS idx_cards_number_hmac;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cards_number_hmac ON cards(number_hmac);
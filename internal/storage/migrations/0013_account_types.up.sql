@@ -0,0 +1,3 @@
+-- Тип счета определяет балансовый счет второго порядка в его номере
+ALTER TABLE accounts ADD COLUMN account_type VARCHAR(20) NOT NULL DEFAULT 'current'
+	CHECK (account_type IN ('current', 'savings'));
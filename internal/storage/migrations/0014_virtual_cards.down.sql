@@ -0,0 +1,5 @@
+ALTER TABLE cards DROP COLUMN IF EXISTS revealed_at;
+ALTER TABLE cards DROP COLUMN IF EXISTS encrypted_cvv;
+ALTER TABLE cards DROP COLUMN IF EXISTS locked_merchant;
+ALTER TABLE cards DROP COLUMN IF EXISTS single_use;
+ALTER TABLE cards DROP COLUMN IF EXISTS card_type;
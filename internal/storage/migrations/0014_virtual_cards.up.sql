@@ -0,0 +1,10 @@
+-- Виртуальные карты действуют сразу после выпуска; их номер и CVV показываются владельцу один раз
+ALTER TABLE cards ADD COLUMN card_type VARCHAR(20) NOT NULL DEFAULT 'physical'
+	CHECK (card_type IN ('physical', 'virtual'));
+-- Одноразовая карта закрывается после первого успешного платежа
+ALTER TABLE cards ADD COLUMN single_use BOOLEAN NOT NULL DEFAULT FALSE;
+-- Карта, привязанная к получателю, оплачивает только его
+ALTER TABLE cards ADD COLUMN locked_merchant VARCHAR(255);
+-- CVV виртуальной карты хранится зашифрованным до показа владельцу, после показа остается только хеш
+ALTER TABLE cards ADD COLUMN encrypted_cvv TEXT;
+ALTER TABLE cards ADD COLUMN revealed_at TIMESTAMP;
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS exchange_rates;
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS conversion_spread;
+ALTER TABLE transactions DROP COLUMN IF EXISTS conversion_rate;
+ALTER TABLE transactions DROP COLUMN IF EXISTS conversion_mid_rate;
+ALTER TABLE transactions DROP COLUMN IF EXISTS converted_amount;
+ALTER TABLE transactions DROP COLUMN IF EXISTS conversion_currency;
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS currency;
+ALTER TABLE credits DROP COLUMN IF EXISTS currency;
+ALTER TABLE accounts DROP COLUMN IF EXISTS currency;
@@ -0,0 +1,19 @@
+-- Валюта (ISO 4217) счетов, кредитов и операций; существующие записи рублевые
+ALTER TABLE accounts ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'RUB';
+ALTER TABLE credits ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'RUB';
+ALTER TABLE transactions ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'RUB';
+
+-- Конвертация при переводе между счетами в разных валютах: валюта и сумма зачисления,
+-- кросс-курс, примененный курс и спред банка
+ALTER TABLE transactions ADD COLUMN conversion_currency CHAR(3);
+ALTER TABLE transactions ADD COLUMN converted_amount DECIMAL(15, 2);
+ALTER TABLE transactions ADD COLUMN conversion_mid_rate DECIMAL(18, 6);
+ALTER TABLE transactions ADD COLUMN conversion_rate DECIMAL(18, 6);
+ALTER TABLE transactions ADD COLUMN conversion_spread DECIMAL(7, 4);
+
+-- Курсы валют к рублю, по которым проводятся конвертации
+CREATE TABLE IF NOT EXISTS exchange_rates (
+	currency CHAR(3) PRIMARY KEY,
+	rate DECIMAL(18, 6) NOT NULL CHECK (rate > 0),
+	updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,12 @@
+-- История официальных курсов валют Банка России по датам установления
+CREATE TABLE IF NOT EXISTS currency_rates (
+	rate_date DATE NOT NULL,
+	currency CHAR(3) NOT NULL,
+	numeric_code CHAR(3) NOT NULL,
+	name VARCHAR(100) NOT NULL,
+	nominal INTEGER NOT NULL CHECK (nominal > 0),
+	value DECIMAL(18, 4) NOT NULL CHECK (value > 0),
+	rate DECIMAL(18, 6) NOT NULL CHECK (rate > 0),
+	fetched_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (rate_date, currency)
+);
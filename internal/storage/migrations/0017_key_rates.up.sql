@@ -0,0 +1,7 @@
+-- История ключевой ставки: ставка, действующая с даты effective_date, и источник, от которого она получена
+CREATE TABLE IF NOT EXISTS key_rates (
+	effective_date DATE PRIMARY KEY,
+	rate DECIMAL(7, 4) NOT NULL CHECK (rate >= 0),
+	source VARCHAR(20) NOT NULL,
+	fetched_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_credits_next_rate_reset;
+ALTER TABLE credits DROP COLUMN IF EXISTS next_rate_reset_date;
+ALTER TABLE credits DROP COLUMN IF EXISTS rate_reset_months;
+ALTER TABLE credits DROP COLUMN IF EXISTS rate_margin;
+ALTER TABLE credits DROP COLUMN IF EXISTS rate_type;
@@ -0,0 +1,12 @@
+-- Вид ставки по кредиту: фиксированная или плавающая (ключевая ставка плюс маржа)
+-- Существующие кредиты выданы по фиксированной ставке: ключевая ставка плюс 5 процентных пунктов
+ALTER TABLE credits ADD COLUMN rate_type VARCHAR(10) NOT NULL DEFAULT 'fixed'
+	CHECK (rate_type IN ('fixed', 'floating'));
+ALTER TABLE credits ADD COLUMN rate_margin DECIMAL(7, 4) NOT NULL DEFAULT 5;
+
+-- Период и дата следующего пересмотра плавающей ставки
+ALTER TABLE credits ADD COLUMN rate_reset_months INT NOT NULL DEFAULT 0;
+ALTER TABLE credits ADD COLUMN next_rate_reset_date TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_credits_next_rate_reset ON credits (next_rate_reset_date)
+	WHERE rate_type = 'floating';
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_credits_product_id;
+ALTER TABLE credits DROP COLUMN IF EXISTS penalty_due_days;
+ALTER TABLE credits DROP COLUMN IF EXISTS penalty_percent;
+ALTER TABLE credits DROP COLUMN IF EXISTS amortization;
+ALTER TABLE credits DROP COLUMN IF EXISTS product_id;
+DROP TABLE IF EXISTS loan_products;
@@ -0,0 +1,41 @@
+-- Кредитные продукты: ограничения суммы и срока, расчет ставки, штрафы и способ погашения
+CREATE TABLE IF NOT EXISTS loan_products (
+	id VARCHAR(64) PRIMARY KEY,
+	name VARCHAR(100) NOT NULL UNIQUE,
+	currency CHAR(3) NOT NULL DEFAULT 'RUB',
+	min_amount DECIMAL(15, 2) NOT NULL CHECK (min_amount > 0),
+	max_amount DECIMAL(15, 2) NOT NULL CHECK (max_amount >= min_amount),
+	min_term_months INT NOT NULL CHECK (min_term_months > 0),
+	max_term_months INT NOT NULL CHECK (max_term_months >= min_term_months),
+	pricing VARCHAR(20) NOT NULL CHECK (pricing IN ('key_rate_margin', 'fixed_rate')),
+	rate_margin DECIMAL(7, 4) NOT NULL DEFAULT 0,
+	fixed_rate DECIMAL(7, 4) NOT NULL DEFAULT 0,
+	rate_type VARCHAR(10) NOT NULL DEFAULT 'fixed' CHECK (rate_type IN ('fixed', 'floating')),
+	rate_reset_months INT NOT NULL DEFAULT 0,
+	penalty_percent DECIMAL(7, 4) NOT NULL DEFAULT 10 CHECK (penalty_percent >= 0),
+	penalty_due_days INT NOT NULL DEFAULT 7 CHECK (penalty_due_days > 0),
+	amortization VARCHAR(20) NOT NULL DEFAULT 'annuity' CHECK (amortization IN ('annuity', 'differentiated')),
+	active BOOLEAN NOT NULL DEFAULT TRUE,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
+
+-- Продукты по умолчанию повторяют прежние условия выдачи; хранилище в памяти создает такие же
+INSERT INTO loan_products (id, name, currency, min_amount, max_amount, min_term_months, max_term_months,
+	pricing, rate_margin, rate_type, rate_reset_months, created_at, updated_at)
+VALUES
+	('consumer-fixed', 'Потребительский кредит', 'RUB', 10000, 5000000, 3, 60,
+		'key_rate_margin', 5, 'fixed', 0, NOW(), NOW()),
+	('consumer-floating', 'Потребительский кредит с плавающей ставкой', 'RUB', 10000, 5000000, 3, 60,
+		'key_rate_margin', 4, 'floating', 3, NOW(), NOW())
+ON CONFLICT (id) DO NOTHING;
+
+-- Условия продукта копируются в кредит при выдаче; существующие кредиты погашаются аннуитетом
+-- со штрафом 10% от просроченного платежа и сроком его оплаты 7 дней
+ALTER TABLE credits ADD COLUMN product_id VARCHAR(64) REFERENCES loan_products(id);
+ALTER TABLE credits ADD COLUMN amortization VARCHAR(20) NOT NULL DEFAULT 'annuity'
+	CHECK (amortization IN ('annuity', 'differentiated'));
+ALTER TABLE credits ADD COLUMN penalty_percent DECIMAL(7, 4) NOT NULL DEFAULT 10;
+ALTER TABLE credits ADD COLUMN penalty_due_days INT NOT NULL DEFAULT 7;
+
+CREATE INDEX IF NOT EXISTS idx_credits_product_id ON credits (product_id);
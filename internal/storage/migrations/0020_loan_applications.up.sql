@@ -0,0 +1,25 @@
+-- Заявки на кредит: скоринг, рассмотрение операционистом и выдача одобренного кредита
+CREATE TABLE IF NOT EXISTS loan_applications (
+	id VARCHAR(36) PRIMARY KEY,
+	user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	account_id VARCHAR(36) NOT NULL REFERENCES accounts(id),
+	product_id VARCHAR(64) NOT NULL REFERENCES loan_products(id),
+	amount DECIMAL(15, 2) NOT NULL CHECK (amount > 0),
+	currency CHAR(3) NOT NULL,
+	term_months INT NOT NULL CHECK (term_months > 0),
+	status VARCHAR(20) NOT NULL
+		CHECK (status IN ('submitted', 'scoring', 'manual_review', 'approved', 'rejected', 'disbursed')),
+	-- Результат скоринга: решение, причины и сведения о заемщике, на которых оно основано
+	scoring JSONB,
+	reviewer_id VARCHAR(36) REFERENCES users(id),
+	review_comment TEXT,
+	loan_id VARCHAR(36) REFERENCES credits(id),
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	decided_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_loan_applications_user_id ON loan_applications(user_id, created_at);
+-- Очередь операциониста и одобренные, но не выданные заявки
+CREATE INDEX IF NOT EXISTS idx_loan_applications_pending ON loan_applications(status, created_at)
+	WHERE status IN ('manual_review', 'approved');
@@ -0,0 +1,3 @@
+-- Балансы счетов входящими остатками не менялись, поэтому удаляются только сами операции
+DELETE FROM journal_entries WHERE transaction_id IN (SELECT id FROM transactions WHERE transaction_type = 'opening_balance');
+DELETE FROM transactions WHERE transaction_type = 'opening_balance';
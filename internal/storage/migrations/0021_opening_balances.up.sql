@@ -0,0 +1,34 @@
+-- Входящие остатки счетов, открытых до ведения главной книги.
+-- У таких счетов есть баланс, но нет проводок, и сверка с главной книгой сообщала бы
+-- о расхождении по каждому из них. Для каждого счета без проводок с ненулевым балансом
+-- проводится операция opening_balance против системного счета system:opening,
+-- после чего сверка начинается с согласованного состояния.
+-- ID операции выводится из ID счета, чтобы повторный запуск не создал дубликатов.
+INSERT INTO transactions (id, from_account_id, to_account_id, amount, currency, timestamp, transaction_type, description)
+SELECT md5('opening_balance:' || a.id)::uuid::text,
+	CASE WHEN a.balance < 0 THEN a.id END,
+	CASE WHEN a.balance > 0 THEN a.id END,
+	ABS(a.balance), a.currency, CURRENT_TIMESTAMP, 'opening_balance',
+	'Входящий остаток счета на начало ведения главной книги'
+FROM accounts a
+WHERE a.balance <> 0
+	AND NOT EXISTS (SELECT 1 FROM journal_entries e WHERE e.ledger_account = a.id)
+	AND NOT EXISTS (SELECT 1 FROM transactions t WHERE t.id = md5('opening_balance:' || a.id)::uuid::text);
+
+-- Положительный остаток: дебет system:opening, кредит клиентского счета; отрицательный - наоборот
+INSERT INTO journal_entries (transaction_id, ledger_account, debit, credit, created_at)
+SELECT t.id, COALESCE(t.to_account_id, t.from_account_id),
+	CASE WHEN t.from_account_id IS NOT NULL THEN t.amount ELSE 0 END,
+	CASE WHEN t.to_account_id IS NOT NULL THEN t.amount ELSE 0 END,
+	t.timestamp
+FROM transactions t
+WHERE t.transaction_type = 'opening_balance'
+	AND NOT EXISTS (SELECT 1 FROM journal_entries e WHERE e.transaction_id = t.id)
+UNION ALL
+SELECT t.id, 'system:opening',
+	CASE WHEN t.to_account_id IS NOT NULL THEN t.amount ELSE 0 END,
+	CASE WHEN t.from_account_id IS NOT NULL THEN t.amount ELSE 0 END,
+	t.timestamp
+FROM transactions t
+WHERE t.transaction_type = 'opening_balance'
+	AND NOT EXISTS (SELECT 1 FROM journal_entries e WHERE e.transaction_id = t.id);
@@ -0,0 +1,9 @@
+-- Время резервирования и срок хранения ключей идемпотентности.
+-- Время резервирования отличает запрос, владеющий ключом,
+-- а истекшие ключи удаляются планировщиком
+ALTER TABLE idempotency_keys ADD COLUMN reserved_at TIMESTAMP;
+ALTER TABLE idempotency_keys ADD COLUMN expires_at TIMESTAMP;
+UPDATE idempotency_keys SET reserved_at = created_at, expires_at = created_at + INTERVAL '24 hours';
+ALTER TABLE idempotency_keys ALTER COLUMN reserved_at SET NOT NULL;
+ALTER TABLE idempotency_keys ALTER COLUMN expires_at SET NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
@@ -0,0 +1,3 @@
+-- Неверные коды второго фактора подряд и блокировка их проверки для защиты от перебора
+ALTER TABLE user_mfa ADD COLUMN failed_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE user_mfa ADD COLUMN locked_until TIMESTAMP;
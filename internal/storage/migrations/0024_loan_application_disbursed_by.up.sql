@@ -0,0 +1,2 @@
+-- Операционист, выдавший кредит по заявке; пусто при автоматической выдаче после скоринга
+ALTER TABLE loan_applications ADD COLUMN disbursed_by VARCHAR(36) REFERENCES users(id);
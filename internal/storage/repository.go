@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+
+	"bankapp/internal/models"
+)
+
+// UserRepository описывает операции хранения пользователей
+type UserRepository interface {
+	RegisterNewUser(user models.User) error
+	GetUserByUsername(username string) (models.User, bool)
+	GetUserByID(userID string) (models.User, bool)
+	GetAllUsers(filter models.UserFilter) ([]models.User, error)
+	UpdateUserRole(userID, role string) error
+}
+
+// AccountRepository описывает операции хранения банковских счетов
+type AccountRepository interface {
+	CreateBankAccount(account models.Account) error
+	GetAccount(accountID string) (models.Account, bool)
+	GetUserAccounts(userID string) []models.Account
+	UpdateAccountStatus(accountID, status string) error
+}
+
+// CardRepository описывает операции хранения платежных карт
+type CardRepository interface {
+	AddCard(card models.Card) error
+	GetAccountCards(accountID string) []models.Card
+	GetCardByNumber(number string) (models.Card, bool)
+	GetCard(cardID string) (models.Card, bool)
+	RecordCardVerificationFailure(cardID string, maxAttempts int) (int, bool, error)
+	ResetCardVerificationFailures(cardID string) error
+	UpdateCardStatus(cardID, fromStatus, toStatus string) error
+	ReissueCard(oldCardID string, newCard models.Card) error
+	UpdateCardLimits(cardID string, limits models.CardLimits) error
+	ListCardMerchantRules(cardID string) ([]models.MerchantRule, error)
+	AddCardMerchantRule(rule models.MerchantRule) error
+	DeleteCardMerchantRule(cardID, ruleID string) error
+	ListCardsForReencryption(keyID, afterID string, limit int) ([]models.Card, error)
+	UpdateCardEncryption(cardID, oldKeyID, encryptedNumber, encryptedCVV, newKeyID string) (bool, error)
+	RevealCard(cardID string, at time.Time) (models.Card, error)
+}
+
+// TransactionRepository описывает проведение операций по главной книге и чтение истории транзакций
+type TransactionRepository interface {
+	PostTransaction(posting models.Posting) error
+	PostCardPayment(posting models.Posting) error
+	GetTransaction(transactionID string) (models.Transaction, bool)
+	GetAccountTransactions(accountID string) []models.Transaction
+	GetAllTransactions(filter models.TransactionFilter) ([]models.Transaction, error)
+	ReconcileBalances() ([]models.BalanceDiscrepancy, error)
+}
+
+// LoanRepository описывает операции хранения кредитов и их графиков платежей
+type LoanRepository interface {
+	AddLoan(loan models.Loan, disbursement models.Posting) error
+	PayLoanInstallment(loanID string, payment models.Payment, repayment models.Posting) error
+	GetUserLoans(userID string) []models.Loan
+	GetLoan(loanID string) (models.Loan, bool)
+	GetAccountLoans(accountID string) []models.Loan
+	GetAllLoans(filter models.LoanFilter) []models.Loan
+	UpdateLoan(loan models.Loan) error
+}
+
+// LoanProductRepository описывает операции хранения кредитных продуктов
+type LoanProductRepository interface {
+	CreateLoanProduct(product models.LoanProduct) error
+	GetLoanProduct(productID string) (models.LoanProduct, bool)
+	ListLoanProducts(activeOnly bool) ([]models.LoanProduct, error)
+	UpdateLoanProduct(product models.LoanProduct) error
+	DeleteLoanProduct(productID string) error
+}
+
+// LoanApplicationRepository описывает хранение заявок на кредит и выдачу кредитов по одобренным заявкам
+type LoanApplicationRepository interface {
+	CreateLoanApplication(application models.LoanApplication) error
+	GetLoanApplication(applicationID string) (models.LoanApplication, bool)
+	ListLoanApplications(filter models.LoanApplicationFilter) ([]models.LoanApplication, error)
+	UpdateLoanApplication(application models.LoanApplication, fromStatus string) error
+	DisburseLoanApplication(applicationID, disbursedBy string, loan models.Loan, disbursement models.Posting) (models.LoanApplication, error)
+}
+
+// IdempotencyRepository описывает хранение ключей идемпотентности и исходных ответов
+type IdempotencyRepository interface {
+	ReserveIdempotencyKey(record models.IdempotencyRecord) (models.IdempotencyRecord, bool, error)
+	CompleteIdempotencyKey(userID, key string, reservedAt time.Time, statusCode int, responseBody []byte) error
+	ReleaseIdempotencyKey(userID, key string, reservedAt time.Time) error
+	PurgeExpiredIdempotencyKeys(before time.Time) (int64, error)
+}
+
+// TokenRepository описывает хранение токенов обновления и список отозванных токенов доступа
+type TokenRepository interface {
+	SaveRefreshToken(token models.RefreshToken) error
+	RotateRefreshToken(tokenHash string, next models.RefreshToken) (models.RefreshToken, error)
+	RevokeRefreshToken(userID, tokenHash string) error
+	RevokeAccessToken(jti, userID string, expiresAt time.Time) error
+	IsAccessTokenRevoked(jti, userID string, issuedAt time.Time) (bool, error)
+	RevokeAllUserSessions(userID string, at time.Time) error
+	PurgeExpiredTokens(before time.Time) (int64, error)
+}
+
+// MFARepository описывает хранение настроек двухфакторной аутентификации и кодов восстановления
+type MFARepository interface {
+	GetUserMFA(userID string) (models.UserMFA, bool)
+	SaveMFASecret(userID, secret string) error
+	EnableMFA(userID string, counter int64, recoveryCodeHashes []string) error
+	DisableMFA(userID string) error
+	RecordMFAFailure(userID string, maxAttempts int, lockout time.Duration) (int, *time.Time, error)
+	ResetMFAFailures(userID string) error
+	UseTOTPCounter(userID string, counter int64) (bool, error)
+	UseRecoveryCode(userID, codeHash string) (bool, error)
+	ReplaceRecoveryCodes(userID string, recoveryCodeHashes []string) error
+}
+
+// HoldRepository описывает хранение удержаний при двухфазных платежах по картам
+type HoldRepository interface {
+	AuthorizeHold(hold models.Hold) error
+	GetHold(holdID string) (models.Hold, bool)
+	ListCardHolds(cardID string) ([]models.Hold, error)
+	CaptureHold(holdID string, posting models.Posting) (models.Hold, error)
+	VoidHold(holdID string) (models.Hold, error)
+	ExpireHolds(now time.Time) (int, error)
+}
+
+// DisputeRepository описывает возвраты по платежам по картам и споры клиентов
+type DisputeRepository interface {
+	GetRefundedAmount(transactionID string) (decimal.Decimal, error)
+	RefundPayment(posting models.Posting) error
+	OpenDispute(dispute models.Dispute) error
+	GetDispute(disputeID string) (models.Dispute, bool)
+	ListDisputes(filter models.DisputeFilter) ([]models.Dispute, error)
+	UpdateDisputeStatus(disputeID, status, resolution string, chargeback *models.Posting) (models.Dispute, error)
+}
+
+// ExchangeRateRepository описывает хранение курсов валют к рублю
+type ExchangeRateRepository interface {
+	SetExchangeRate(rate models.ExchangeRate) error
+	GetExchangeRate(currency string) (models.ExchangeRate, bool)
+	ListExchangeRates() ([]models.ExchangeRate, error)
+}
+
+// CurrencyRateRepository описывает хранение истории официальных курсов валют
+type CurrencyRateRepository interface {
+	SaveCurrencyRates(rates []models.CurrencyRate) error
+	GetCurrencyRates(date time.Time) ([]models.CurrencyRate, error)
+}
+
+// KeyRateRepository описывает хранение истории ключевой ставки
+type KeyRateRepository interface {
+	SaveKeyRates(rates []models.KeyRate) error
+	GetKeyRate(date time.Time) (models.KeyRate, bool)
+}
+
+// Storage объединяет все репозитории, реализуемые одним хранилищем
+type Storage interface {
+	UserRepository
+	AccountRepository
+	CardRepository
+	TransactionRepository
+	LoanRepository
+	LoanProductRepository
+	LoanApplicationRepository
+	IdempotencyRepository
+	TokenRepository
+	MFARepository
+	HoldRepository
+	DisputeRepository
+	ExchangeRateRepository
+	CurrencyRateRepository
+	KeyRateRepository
+	Close() error
+}
+
+// Проверяем на этапе компиляции, что хранилища реализуют все репозитории
+var (
+	_ Storage = (*DBStorage)(nil)
+	_ Storage = (*MemoryStorage)(nil)
+)
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"bankapp/internal/models"
+)
+
+var (
+	// ErrRefreshTokenNotFound возвращается, если токен обновления неизвестен
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	// ErrRefreshTokenExpired возвращается, если срок действия токена обновления истек
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+	// ErrRefreshTokenRevoked возвращается, если токен обновления был отозван при выходе из системы
+	ErrRefreshTokenRevoked = errors.New("refresh token revoked")
+	// ErrRefreshTokenReused возвращается при повторном предъявлении уже замененного токена;
+	// вся цепочка токенов при этом отзывается
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// SaveRefreshToken сохраняет новый токен обновления
+func (s *DBStorage) SaveRefreshToken(token models.RefreshToken) error {
+	_, err := s.DB.Exec(`
+		INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, token.ID, token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt, token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("ошибка при сохранении токена обновления: %w", err)
+	}
+	return nil
+}
+
+// RotateRefreshToken заменяет предъявленный токен обновления новым
+// Новый токен наследует пользователя и цепочку старого; возвращается заполненная запись нового токена
+// При повторном использовании уже замененного токена отзывает всю цепочку и возвращает ErrRefreshTokenReused
+func (s *DBStorage) RotateRefreshToken(tokenHash string, next models.RefreshToken) (models.RefreshToken, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return models.RefreshToken{}, fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var current models.RefreshToken
+	var revokedAt sql.NullTime
+	var replacedBy sql.NullString
+	err = tx.QueryRow(`
+		SELECT id, user_id, family_id, expires_at, revoked_at, replaced_by
+		FROM refresh_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`, tokenHash).Scan(&current.ID, &current.UserID, &current.FamilyID, &current.ExpiresAt, &revokedAt, &replacedBy)
+	if err == sql.ErrNoRows {
+		err = ErrRefreshTokenNotFound
+		return models.RefreshToken{}, err
+	}
+	if err != nil {
+		return models.RefreshToken{}, fmt.Errorf("ошибка при получении токена обновления: %w", err)
+	}
+
+	if revokedAt.Valid {
+		if !replacedBy.Valid {
+			err = ErrRefreshTokenRevoked
+			return models.RefreshToken{}, err
+		}
+
+		// Замененный токен предъявлен повторно: считаем цепочку скомпрометированной
+		_, err = tx.Exec("UPDATE refresh_tokens SET revoked_at = $2 WHERE family_id = $1 AND revoked_at IS NULL",
+			current.FamilyID, time.Now())
+		if err != nil {
+			return models.RefreshToken{}, fmt.Errorf("ошибка при отзыве цепочки токенов: %w", err)
+		}
+		if err = tx.Commit(); err != nil {
+			return models.RefreshToken{}, fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+		}
+
+		log.Printf("Повторное использование токена обновления пользователя %s, цепочка %s отозвана", current.UserID, current.FamilyID)
+		return models.RefreshToken{}, ErrRefreshTokenReused
+	}
+
+	if !current.ExpiresAt.After(time.Now()) {
+		err = ErrRefreshTokenExpired
+		return models.RefreshToken{}, err
+	}
+
+	next.UserID = current.UserID
+	next.FamilyID = current.FamilyID
+
+	_, err = tx.Exec("UPDATE refresh_tokens SET revoked_at = $2, replaced_by = $3 WHERE id = $1",
+		current.ID, next.CreatedAt, next.ID)
+	if err != nil {
+		return models.RefreshToken{}, fmt.Errorf("ошибка при ротации токена обновления: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, next.ID, next.UserID, next.FamilyID, next.TokenHash, next.ExpiresAt, next.CreatedAt)
+	if err != nil {
+		return models.RefreshToken{}, fmt.Errorf("ошибка при сохранении токена обновления: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return models.RefreshToken{}, fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+
+	return next, nil
+}
+
+// RevokeRefreshToken отзывает токен обновления пользователя
+// Возвращает ErrRefreshTokenNotFound, если токен не найден или принадлежит другому пользователю
+func (s *DBStorage) RevokeRefreshToken(userID, tokenHash string) error {
+	result, err := s.DB.Exec(`
+		UPDATE refresh_tokens SET revoked_at = COALESCE(revoked_at, $3)
+		WHERE token_hash = $1 AND user_id = $2
+	`, tokenHash, userID, time.Now())
+	if err != nil {
+		return fmt.Errorf("ошибка при отзыве токена обновления: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при отзыве токена обновления: %w", err)
+	}
+	if affected == 0 {
+		return ErrRefreshTokenNotFound
+	}
+	return nil
+}
+
+// RevokeAccessToken заносит токен доступа в список отозванных до истечения его срока действия
+func (s *DBStorage) RevokeAccessToken(jti, userID string, expiresAt time.Time) error {
+	_, err := s.DB.Exec(`
+		INSERT INTO revoked_tokens (jti, user_id, expires_at, revoked_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (jti) DO NOTHING
+	`, jti, userID, expiresAt, time.Now())
+	if err != nil {
+		return fmt.Errorf("ошибка при отзыве токена доступа: %w", err)
+	}
+	return nil
+}
+
+// IsAccessTokenRevoked проверяет, отозван ли токен доступа по jti
+// или выпущен ли он до выхода пользователя на всех устройствах
+func (s *DBStorage) IsAccessTokenRevoked(jti, userID string, issuedAt time.Time) (bool, error) {
+	var revoked bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)
+			OR EXISTS (SELECT 1 FROM users WHERE id = $2 AND tokens_valid_after > $3)
+	`, jti, userID, issuedAt).Scan(&revoked)
+	if err != nil {
+		return false, fmt.Errorf("ошибка при проверке отзыва токена: %w", err)
+	}
+	return revoked, nil
+}
+
+// RevokeAllUserSessions отзывает все токены обновления пользователя
+// и делает недействительными токены доступа, выпущенные до момента at
+func (s *DBStorage) RevokeAllUserSessions(userID string, at time.Time) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.Exec("UPDATE refresh_tokens SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL", userID, at)
+	if err != nil {
+		return fmt.Errorf("ошибка при отзыве токенов обновления: %w", err)
+	}
+
+	_, err = tx.Exec("UPDATE users SET tokens_valid_after = $2 WHERE id = $1", userID, at)
+	if err != nil {
+		return fmt.Errorf("ошибка при обновлении времени действия токенов: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+
+	log.Printf("Все сессии пользователя %s завершены", userID)
+	return nil
+}
+
+// PurgeExpiredTokens удаляет токены обновления и записи об отозванных токенах доступа,
+// срок действия которых истек до момента before
+// Возвращает количество удаленных записей
+func (s *DBStorage) PurgeExpiredTokens(before time.Time) (int64, error) {
+	refresh, err := s.DB.Exec("DELETE FROM refresh_tokens WHERE expires_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при удалении истекших токенов обновления: %w", err)
+	}
+	revoked, err := s.DB.Exec("DELETE FROM revoked_tokens WHERE expires_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при удалении истекших отозванных токенов: %w", err)
+	}
+
+	refreshCount, _ := refresh.RowsAffected()
+	revokedCount, _ := revoked.RowsAffected()
+	return refreshCount + revokedCount, nil
+}
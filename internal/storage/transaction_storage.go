@@ -1,46 +1,78 @@
 package storage
 
 import (
+	"database/sql"
 	"fmt"
 	"log"
 
+	"github.com/shopspring/decimal"
+
 	"bankapp/internal/models"
 	"bankapp/pkg/utils"
 )
 
-// AddTransaction Добавляет новую транзакцию в базу данных
-func AddTransaction(tx models.Transaction) error {
+// transactionColumns - столбцы таблицы transactions в порядке сканирования scanTransaction
+// NULL в необязательных столбцах читается как пустая строка; статус спора берется из последнего спора по операции
+const transactionColumns = `id, COALESCE(from_account_id, ''), COALESCE(to_account_id, ''), amount, currency, timestamp,
+		transaction_type, COALESCE(description, ''), COALESCE(card_id, ''), COALESCE(merchant, ''),
+		COALESCE(merchant_category, ''), COALESCE(related_transaction_id, ''),
+		conversion_currency, converted_amount, conversion_mid_rate, conversion_rate, conversion_spread,
+		COALESCE((SELECT d.status FROM card_disputes d WHERE d.transaction_id = transactions.id
+			ORDER BY d.created_at DESC LIMIT 1), '')`
+
+// insertTransaction добавляет запись о транзакции в рамках транзакции базы данных
+// Пустые ID счетов и карты сохраняются как NULL (операции с внешним миром),
+// столбцы конвертации заполняются только для операций обмена валюты
+func insertTransaction(dbTx *sql.Tx, tx models.Transaction) error {
+	var conversion models.Conversion
+	if tx.Conversion != nil {
+		conversion = *tx.Conversion
+	}
+	hasConversion := tx.Conversion != nil
+
 	query := `
-		INSERT INTO transactions (id, from_account_id, to_account_id, amount, timestamp, transaction_type, description)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO transactions (id, from_account_id, to_account_id, amount, currency, timestamp, transaction_type,
+			description, card_id, merchant, merchant_category, related_transaction_id,
+			conversion_currency, converted_amount, conversion_mid_rate, conversion_rate, conversion_spread)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6, $7, $8, NULLIF($9, ''), NULLIF($10, ''), NULLIF($11, ''),
+			NULLIF($12, ''), $13, $14, $15, $16, $17)
 	`
-	_, err := db.DB.Exec(query,
+	_, err := dbTx.Exec(query,
 		tx.ID,
 		tx.FromAccountID,
 		tx.ToAccountID,
 		tx.Amount,
+		tx.Currency,
 		tx.Timestamp,
 		tx.TransactionType,
-		tx.Description)
+		tx.Description,
+		tx.CardID,
+		tx.Merchant,
+		tx.MerchantCategory,
+		tx.RelatedTransactionID,
+		sql.NullString{String: conversion.ToCurrency, Valid: hasConversion},
+		decimal.NullDecimal{Decimal: conversion.ConvertedAmount, Valid: hasConversion},
+		decimal.NullDecimal{Decimal: conversion.MidRate, Valid: hasConversion},
+		decimal.NullDecimal{Decimal: conversion.Rate, Valid: hasConversion},
+		decimal.NullDecimal{Decimal: conversion.SpreadPercent, Valid: hasConversion})
 
 	if err != nil {
 		return fmt.Errorf("ошибка при добавлении транзакции: %w", err)
 	}
 
-	log.Printf("Транзакция %s добавлена. Тип: %s, Сумма: %s", tx.ID, tx.TransactionType, tx.Amount.String())
 	return nil
 }
 
 // GetAccountTransactions Получает все транзакции для счета
 // Возвращает срез транзакций, где счет является либо источником, либо получателем
-func GetAccountTransactions(accountID string) []models.Transaction {
+func (s *DBStorage) GetAccountTransactions(accountID string) []models.Transaction {
 	query := `
-		SELECT id, from_account_id, to_account_id, amount, timestamp, transaction_type, description
+		SELECT ` + transactionColumns + `
 		FROM transactions
 		WHERE from_account_id = $1 OR to_account_id = $1
 		ORDER BY timestamp DESC
 	`
-	rows, err := db.DB.Query(query, accountID)
+	rows, err := s.DB.Query(query, accountID)
 	if err != nil {
 		log.Printf("Ошибка при получении транзакций для счета: %v", err)
 		return []models.Transaction{}
@@ -49,16 +81,7 @@ func GetAccountTransactions(accountID string) []models.Transaction {
 
 	var transactions []models.Transaction
 	for rows.Next() {
-		var tx models.Transaction
-		err := rows.Scan(
-			&tx.ID,
-			&tx.FromAccountID,
-			&tx.ToAccountID,
-			&tx.Amount,
-			&tx.Timestamp,
-			&tx.TransactionType,
-			&tx.Description,
-		)
+		tx, err := scanTransaction(rows)
 		if err != nil {
 			log.Printf("Ошибка при сканировании данных транзакции: %v", err)
 			continue
@@ -73,15 +96,38 @@ func GetAccountTransactions(accountID string) []models.Transaction {
 	return transactions
 }
 
-// GetAllTransactions Получает все транзакции из базы данных
-// Возвращает срез всех транзакций
-func GetAllTransactions() ([]models.Transaction, error) {
+// GetAllTransactions Получает транзакции из базы данных, удовлетворяющие фильтру
+// Возвращает срез транзакций, начиная с самых новых
+func (s *DBStorage) GetAllTransactions(filter models.TransactionFilter) ([]models.Transaction, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.AccountID != "" {
+		args = append(args, filter.AccountID)
+		conditions = append(conditions, fmt.Sprintf("(from_account_id = $%d OR to_account_id = $%d)", len(args), len(args)))
+	}
+	if filter.TransactionType != "" {
+		args = append(args, filter.TransactionType)
+		conditions = append(conditions, fmt.Sprintf("transaction_type = $%d", len(args)))
+	}
+	if !filter.From.IsZero() {
+		args = append(args, filter.From)
+		conditions = append(conditions, fmt.Sprintf("timestamp >= $%d", len(args)))
+	}
+	if !filter.To.IsZero() {
+		args = append(args, filter.To)
+		conditions = append(conditions, fmt.Sprintf("timestamp < $%d", len(args)))
+	}
+
 	query := `
-		SELECT id, from_account_id, to_account_id, amount, timestamp, transaction_type, description
+		SELECT ` + transactionColumns + `
 		FROM transactions
+	` + whereClause(conditions) + `
 		ORDER BY timestamp DESC
 	`
-	rows, err := db.DB.Query(query)
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+	rows, err := s.DB.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при получении всех транзакций: %w", err)
 	}
@@ -89,16 +135,7 @@ func GetAllTransactions() ([]models.Transaction, error) {
 
 	var transactions []models.Transaction
 	for rows.Next() {
-		var tx models.Transaction
-		err := rows.Scan(
-			&tx.ID,
-			&tx.FromAccountID,
-			&tx.ToAccountID,
-			&tx.Amount,
-			&tx.Timestamp,
-			&tx.TransactionType,
-			&tx.Description,
-		)
+		tx, err := scanTransaction(rows)
 		if err != nil {
 			return nil, fmt.Errorf("ошибка при сканировании данных транзакции: %w", err)
 		}
@@ -112,6 +149,56 @@ func GetAllTransactions() ([]models.Transaction, error) {
 	return transactions, nil
 }
 
+// GetTransaction получает транзакцию по ее ID
+// Возвращает транзакцию и булево значение, указывающее, найдена ли она
+func (s *DBStorage) GetTransaction(transactionID string) (models.Transaction, bool) {
+	tx, err := scanTransaction(s.DB.QueryRow("SELECT "+transactionColumns+" FROM transactions WHERE id = $1", transactionID))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Ошибка при получении транзакции: %v", err)
+		}
+		return models.Transaction{}, false
+	}
+	return tx, true
+}
+
+// scanTransaction читает строку таблицы transactions, выбранную со столбцами transactionColumns
+func scanTransaction(row interface{ Scan(...interface{}) error }) (models.Transaction, error) {
+	var tx models.Transaction
+	var toCurrency sql.NullString
+	var convertedAmount, midRate, rate, spread decimal.NullDecimal
+	err := row.Scan(
+		&tx.ID,
+		&tx.FromAccountID,
+		&tx.ToAccountID,
+		&tx.Amount,
+		&tx.Currency,
+		&tx.Timestamp,
+		&tx.TransactionType,
+		&tx.Description,
+		&tx.CardID,
+		&tx.Merchant,
+		&tx.MerchantCategory,
+		&tx.RelatedTransactionID,
+		&toCurrency,
+		&convertedAmount,
+		&midRate,
+		&rate,
+		&spread,
+		&tx.DisputeStatus,
+	)
+	if err == nil && toCurrency.Valid {
+		tx.Conversion = &models.Conversion{
+			ToCurrency:      toCurrency.String,
+			ConvertedAmount: convertedAmount.Decimal,
+			MidRate:         midRate.Decimal,
+			Rate:            rate.Decimal,
+			SpreadPercent:   spread.Decimal,
+		}
+	}
+	return tx, err
+}
+
 // GenerateTransactionID генерирует уникальный ID для транзакции
 // Использует функцию CreateUniqueIdentifier из пакета utils
 func GenerateTransactionID() string {
@@ -2,19 +2,23 @@ package storage
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 
 	"bankapp/internal/models"
 )
 
+// ErrLastAdmin возвращается при попытке лишить роли администратора единственного администратора
+var ErrLastAdmin = errors.New("cannot demote the last admin")
+
 // RegisterNewUser Добавляет нового пользователя в базу данных
 // Проверяет уникальность имени пользователя и электронной почты
 // Возвращает ошибку, если пользователь с таким же именем или электронной почтой уже существует
-func RegisterNewUser(user models.User) error {
+func (s *DBStorage) RegisterNewUser(user models.User) error {
 	// Проверяем, занято ли уже имя пользователя
 	var exists bool
-	err := db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)", user.Username).Scan(&exists)
+	err := s.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE username = $1)", user.Username).Scan(&exists)
 	if err != nil {
 		return fmt.Errorf("ошибка при проверке имени пользователя: %w", err)
 	}
@@ -23,7 +27,7 @@ func RegisterNewUser(user models.User) error {
 	}
 
 	// Проверяем, зарегистрирована ли уже электронная почта
-	err = db.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)", user.Email).Scan(&exists)
+	err = s.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE email = $1)", user.Email).Scan(&exists)
 	if err != nil {
 		return fmt.Errorf("ошибка при проверке электронной почты: %w", err)
 	}
@@ -33,10 +37,10 @@ func RegisterNewUser(user models.User) error {
 
 	// Сохраняем пользователя в базу данных
 	query := `
-		INSERT INTO users (id, username, email, password_hash, created_at)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO users (id, username, email, password_hash, role, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
 	`
-	_, err = db.DB.Exec(query, user.ID, user.Username, user.Email, user.PasswordHash, user.CreatedAt)
+	_, err = s.DB.Exec(query, user.ID, user.Username, user.Email, user.PasswordHash, user.Role, user.CreatedAt)
 	if err != nil {
 		return fmt.Errorf("ошибка при сохранении пользователя: %w", err)
 	}
@@ -47,18 +51,19 @@ func RegisterNewUser(user models.User) error {
 
 // GetUserByUsername Получает пользователя по его имени пользователя
 // Возвращает пользователя и булево значение, указывающее, найден ли пользователь
-func GetUserByUsername(username string) (models.User, bool) {
+func (s *DBStorage) GetUserByUsername(username string) (models.User, bool) {
 	var user models.User
 	query := `
-		SELECT id, username, email, password_hash, created_at
+		SELECT id, username, email, password_hash, role, created_at
 		FROM users
 		WHERE username = $1
 	`
-	err := db.DB.QueryRow(query, username).Scan(
+	err := s.DB.QueryRow(query, username).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
 		&user.PasswordHash,
+		&user.Role,
 		&user.CreatedAt,
 	)
 
@@ -75,18 +80,19 @@ func GetUserByUsername(username string) (models.User, bool) {
 
 // GetUserByID Получает пользователя по его ID
 // Возвращает пользователя и булево значение, указывающее, найден ли пользователь
-func GetUserByID(userID string) (models.User, bool) {
+func (s *DBStorage) GetUserByID(userID string) (models.User, bool) {
 	var user models.User
 	query := `
-		SELECT id, username, email, password_hash, created_at
+		SELECT id, username, email, password_hash, role, created_at
 		FROM users
 		WHERE id = $1
 	`
-	err := db.DB.QueryRow(query, userID).Scan(
+	err := s.DB.QueryRow(query, userID).Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
 		&user.PasswordHash,
+		&user.Role,
 		&user.CreatedAt,
 	)
 
@@ -101,15 +107,27 @@ func GetUserByID(userID string) (models.User, bool) {
 	return user, true
 }
 
-// GetAllUsers Получает всех пользователей из базы данных
+// GetAllUsers Получает пользователей из базы данных, удовлетворяющих фильтру
 // Возвращает список пользователей
-func GetAllUsers() ([]models.User, error) {
+func (s *DBStorage) GetAllUsers(filter models.UserFilter) ([]models.User, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.Role != "" {
+		args = append(args, filter.Role)
+		conditions = append(conditions, fmt.Sprintf("role = $%d", len(args)))
+	}
+	if filter.Username != "" {
+		args = append(args, "%"+filter.Username+"%")
+		conditions = append(conditions, fmt.Sprintf("username ILIKE $%d", len(args)))
+	}
+
 	query := `
-		SELECT id, username, email, password_hash, created_at
+		SELECT id, username, email, password_hash, role, created_at
 		FROM users
+	` + whereClause(conditions) + `
 		ORDER BY created_at
 	`
-	rows, err := db.DB.Query(query)
+	rows, err := s.DB.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("ошибка при получении списка пользователей: %w", err)
 	}
@@ -123,6 +141,7 @@ func GetAllUsers() ([]models.User, error) {
 			&user.Username,
 			&user.Email,
 			&user.PasswordHash,
+			&user.Role,
 			&user.CreatedAt,
 		)
 		if err != nil {
@@ -137,3 +156,53 @@ func GetAllUsers() ([]models.User, error) {
 
 	return users, nil
 }
+
+// UpdateUserRole Изменяет роль пользователя
+// Возвращает ошибку, если пользователь не найден, и ErrLastAdmin, если это единственный администратор,
+// которого лишают роли администратора
+func (s *DBStorage) UpdateUserRole(userID, role string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка при начале транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// Строки администраторов блокируются, чтобы параллельные запросы не лишили роли всех администраторов
+	var admins int
+	var isAdmin bool
+	err = tx.QueryRow(`
+		SELECT COUNT(*), COALESCE(BOOL_OR(id = $1), FALSE)
+		FROM (SELECT id FROM users WHERE role = $2 FOR UPDATE) admins
+	`, userID, models.RoleAdmin).Scan(&admins, &isAdmin)
+	if err != nil {
+		return fmt.Errorf("ошибка при проверке администраторов: %w", err)
+	}
+	if isAdmin && role != models.RoleAdmin && admins == 1 {
+		err = ErrLastAdmin
+		return err
+	}
+
+	result, err := tx.Exec("UPDATE users SET role = $1 WHERE id = $2", role, userID)
+	if err != nil {
+		return fmt.Errorf("ошибка при изменении роли пользователя: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка при изменении роли пользователя: %w", err)
+	}
+	if affected == 0 {
+		err = fmt.Errorf("user %s not found", userID)
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("ошибка при фиксации транзакции: %w", err)
+	}
+
+	log.Printf("Роль пользователя %s изменена на %s", userID, role)
+	return nil
+}
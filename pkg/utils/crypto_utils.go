@@ -11,7 +11,7 @@ import (
 	"os"
 )
 
-// Ключ шифрования для PGP
+// Ключ прежней XOR-схемы шифрования; нужен только для расшифровки старых записей
 var encryptionKey = []byte(getEncryptionKey())
 
 // Секрет HMAC для проверки целостности данных
@@ -37,26 +37,9 @@ func getHMACSecret() string {
 	return secret
 }
 
-// EncryptData шифрует данные с использованием простого XOR-шифра (имитация PGP )
-func EncryptData(data string) (string, error) {
-	if data == "" {
-		return "", nil
-	}
-
-	dataBytes := []byte(data)
-
-	result := make([]byte, len(dataBytes))
-
-	for i := 0; i < len(dataBytes); i++ {
-		result[i] = dataBytes[i] ^ encryptionKey[i%len(encryptionKey)]
-	}
-
-	// Кодируем результат в base64
-	return base64.StdEncoding.EncodeToString(result), nil
-}
-
-// DecryptData расшифровывает данные, зашифрованные с помощью EncryptData
-func DecryptData(encryptedData string) (string, error) {
+// decryptLegacyXOR расшифровывает данные, зашифрованные прежней схемой: XOR с ключом ENCRYPTION_KEY
+// Используется только для чтения старых записей до их перешифрования (см. DecryptField)
+func decryptLegacyXOR(encryptedData string) (string, error) {
 	if encryptedData == "" {
 		return "", nil
 	}
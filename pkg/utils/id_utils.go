@@ -16,23 +16,122 @@ func CreateUniqueIdentifier() string {
 	return uuid.NewString()
 }
 
-// GenerateBankAccountNumber Создает номер банковского счета в формате 20-значным
-func GenerateBankAccountNumber() string {
-	// Генерируем случайное число для последних 10 цифр номера счета
-	randomPart, _ := rand.Int(rand.Reader, big.NewInt(9000000000))
-
-	// Формируем номер счета: 40817810 (фиксированный префикс) + 10 случайных цифр
-	// 40817810 - код для рублевых счетов физических лиц
-	return fmt.Sprintf("40817810%010d", randomPart.Int64()+1000000000)
-}
-
-// GenerateCardNumber Создает случайный номер карты в допустимом формате 16 чисел
-func GenerateCardNumber() string {
-	n1, _ := rand.Int(rand.Reader, big.NewInt(900))
-	n2, _ := rand.Int(rand.Reader, big.NewInt(10000))
-	n3, _ := rand.Int(rand.Reader, big.NewInt(10000))
-	n4, _ := rand.Int(rand.Reader, big.NewInt(10000))
-	return fmt.Sprintf("4%03d%04d%04d%04d", n1.Int64()+100, n2.Int64(), n3.Int64(), n4.Int64())
+// GenerateBankAccountNumber Создает 20-значный номер счета в банке с БИК bic:
+// балансовый счет второго порядка (5 цифр), цифровой код валюты (3 цифры),
+// контрольный ключ, код подразделения 0000 и случайный порядковый номер (7 цифр)
+func GenerateBankAccountNumber(balanceAccount, currencyCode, bic string) (string, error) {
+	if !isDigits(balanceAccount) || len(balanceAccount) != 5 {
+		return "", fmt.Errorf("некорректный балансовый счет %q: ожидается 5 цифр", balanceAccount)
+	}
+	if !isDigits(currencyCode) || len(currencyCode) != 3 {
+		return "", fmt.Errorf("некорректный код валюты %q: ожидается 3 цифры", currencyCode)
+	}
+	if !isDigits(bic) || len(bic) != 9 {
+		return "", fmt.Errorf("некорректный БИК %q: ожидается 9 цифр", bic)
+	}
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(10000000))
+	if err != nil {
+		return "", fmt.Errorf("не удалось сгенерировать номер счета: %w", err)
+	}
+
+	// Контрольный ключ рассчитывается по номеру, в котором на его месте стоит 0
+	number := []byte(fmt.Sprintf("%s%s0%s%07d", balanceAccount, currencyCode, "0000", serial.Int64()))
+	number[8] = '0' + byte(accountChecksum(bic, string(number))*3%10)
+	return string(number), nil
+}
+
+// ValidateBankAccountNumber Проверяет номер счета в банке с БИК bic:
+// 20 цифр и верный контрольный ключ по алгоритму Банка России
+func ValidateBankAccountNumber(number, bic string) error {
+	if !isDigits(number) || len(number) != 20 {
+		return fmt.Errorf("номер счета должен состоять из 20 цифр")
+	}
+	if !isDigits(bic) || len(bic) != 9 {
+		return fmt.Errorf("некорректный БИК %q: ожидается 9 цифр", bic)
+	}
+	if accountChecksum(bic, number) != 0 {
+		return fmt.Errorf("неверный контрольный ключ номера счета %s", number)
+	}
+	return nil
+}
+
+// accountChecksum вычисляет контрольную сумму номера счета по алгоритму Банка России:
+// к номеру слева приписываются три цифры, определяемые БИК, цифры умножаются на весовые
+// коэффициенты 7, 1, 3, и складываются младшие разряды произведений
+// Для номера с верным ключом результат равен 0
+func accountChecksum(bic, number string) int {
+	// Для счетов в кредитной организации берутся последние три цифры БИК,
+	// для счетов в подразделениях Банка России - "0" и 5-6 цифры БИК
+	prefix := bic[6:9]
+	if prefix == "000" || prefix == "001" || prefix == "002" {
+		prefix = "0" + bic[4:6]
+	}
+
+	weights := [3]int{7, 1, 3}
+	sum := 0
+	for i, c := range prefix + number {
+		sum += int(c-'0') * weights[i%3] % 10
+	}
+	return sum % 10
+}
+
+// GenerateCardNumber Создает 16-значный номер карты с префиксом эмитента bin
+// Последняя цифра - контрольная цифра по алгоритму Луна
+func GenerateCardNumber(bin string) (string, error) {
+	if !isDigits(bin) || len(bin) < 6 || len(bin) > 8 {
+		return "", fmt.Errorf("некорректный BIN %q: ожидается от 6 до 8 цифр", bin)
+	}
+
+	// Заполняем номер случайными цифрами до 15 знаков и дописываем контрольную цифру
+	digits := []byte(bin)
+	for len(digits) < 15 {
+		n, err := rand.Int(rand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", fmt.Errorf("не удалось сгенерировать номер карты: %w", err)
+		}
+		digits = append(digits, byte('0'+n.Int64()))
+	}
+	return string(digits) + string('0'+luhnCheckDigit(string(digits))), nil
+}
+
+// IsValidCardNumber Проверяет, что номер карты состоит из 13-19 цифр и его контрольная цифра
+// верна по алгоритму Луна
+func IsValidCardNumber(number string) bool {
+	if !isDigits(number) || len(number) < 13 || len(number) > 19 {
+		return false
+	}
+	return luhnCheckDigit(number[:len(number)-1]) == number[len(number)-1]-'0'
+}
+
+// luhnCheckDigit вычисляет контрольную цифру по алгоритму Луна для номера без нее
+func luhnCheckDigit(payload string) byte {
+	sum := 0
+	// Удваиваем каждую вторую цифру, начиная с последней цифры номера без контрольной
+	for i := len(payload) - 1; i >= 0; i -= 2 {
+		d := int(payload[i]-'0') * 2
+		if d > 9 {
+			d -= 9
+		}
+		sum += d
+		if i > 0 {
+			sum += int(payload[i-1] - '0')
+		}
+	}
+	return byte((10 - sum%10) % 10)
+}
+
+// isDigits сообщает, что строка не пуста и состоит только из цифр
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
 }
 
 // GenerateCVV Создает случайный CVV-код для карты
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+// flipDigit заменяет цифру номера в позиции i на следующую по модулю 10
+func flipDigit(number string, i int) string {
+	digits := []byte(number)
+	digits[i] = '0' + (digits[i]-'0'+1)%10
+	return string(digits)
+}
+
+func TestIsValidCardNumber(t *testing.T) {
+	tests := []struct {
+		number string
+		want   bool
+	}{
+		// Тестовые номера платежных систем
+		{"4111111111111111", true},
+		{"4012888888881881", true},
+		{"5555555555554444", true},
+		{"2200000000000004", true},
+		{"6011111111111117", true},
+		{"378282246310005", true},
+		// Изменена одна цифра
+		{"4111111111111112", false},
+		{"4111111111111211", false},
+		{"5555555555554443", false},
+		// Не номер карты
+		{"411111111111", false},
+		{"41111111111111111111", false},
+		{"4111 1111 1111 1111", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsValidCardNumber(tt.number); got != tt.want {
+			t.Errorf("IsValidCardNumber(%q) = %v, ожидалось %v", tt.number, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateCardNumber(t *testing.T) {
+	for _, bin := range []string{"220220", "4276380", "55369100"} {
+		for i := 0; i < 100; i++ {
+			number, err := GenerateCardNumber(bin)
+			if err != nil {
+				t.Fatalf("GenerateCardNumber(%q): %v", bin, err)
+			}
+			if len(number) != 16 || !strings.HasPrefix(number, bin) {
+				t.Fatalf("GenerateCardNumber(%q) = %s: ожидалось 16 цифр с префиксом BIN", bin, number)
+			}
+			if !IsValidCardNumber(number) {
+				t.Fatalf("GenerateCardNumber(%q) = %s: неверная контрольная цифра", bin, number)
+			}
+			// Ошибка в любой одной цифре обнаруживается контрольной цифрой
+			for pos := range number {
+				if flipped := flipDigit(number, pos); IsValidCardNumber(flipped) {
+					t.Fatalf("номер %s с измененной цифрой %d признан верным", flipped, pos+1)
+				}
+			}
+		}
+	}
+
+	for _, bin := range []string{"", "22022", "220220001", "22022a"} {
+		if _, err := GenerateCardNumber(bin); err == nil {
+			t.Errorf("GenerateCardNumber(%q): ожидалась ошибка", bin)
+		}
+	}
+}
+
+func TestValidateBankAccountNumber(t *testing.T) {
+	tests := []struct {
+		number string
+		bic    string
+		valid  bool
+	}{
+		// Счета в кредитной организации: ключ по последним трем цифрам БИК
+		{"40702810038000017240", "044525225", true},
+		{"40702810638050105324", "044525225", true},
+		// Счета в подразделении Банка России: ключ по 5-6 цифрам БИК
+		{"40101810045250010041", "044525000", true},
+		{"40102810545370000003", "044525000", true},
+		// Изменена одна цифра
+		{"40702810038000017241", "044525225", false},
+		{"40702810138000017240", "044525225", false},
+		{"40101810045250010042", "044525000", false},
+		// Тот же номер в другом банке
+		{"40702810038000017240", "044525974", false},
+		// Не номер счета
+		{"4070281003800001724", "044525225", false},
+		{"4070281003800001724a", "044525225", false},
+		{"40702810038000017240", "04452522", false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateBankAccountNumber(tt.number, tt.bic)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateBankAccountNumber(%q, %q) = %v, ожидался верный номер: %v", tt.number, tt.bic, err, tt.valid)
+		}
+	}
+}
+
+func TestGenerateBankAccountNumber(t *testing.T) {
+	for _, bic := range []string{"044525225", "044525974", "044525000"} {
+		for i := 0; i < 100; i++ {
+			number, err := GenerateBankAccountNumber("40817", "810", bic)
+			if err != nil {
+				t.Fatalf("GenerateBankAccountNumber(%q): %v", bic, err)
+			}
+			if len(number) != 20 || !strings.HasPrefix(number, "40817810") {
+				t.Fatalf("GenerateBankAccountNumber(%q) = %s: ожидалось 20 цифр с балансовым счетом и кодом валюты", bic, number)
+			}
+			if err := ValidateBankAccountNumber(number, bic); err != nil {
+				t.Fatalf("GenerateBankAccountNumber(%q) = %s: %v", bic, number, err)
+			}
+			// Ошибка в любой одной цифре обнаруживается контрольным ключом
+			for pos := range number {
+				if flipped := flipDigit(number, pos); ValidateBankAccountNumber(flipped, bic) == nil {
+					t.Fatalf("номер %s с измененной цифрой %d признан верным", flipped, pos+1)
+				}
+			}
+		}
+	}
+
+	for _, tt := range []struct{ balance, currency, bic string }{
+		{"4081", "810", "044525225"},
+		{"40817", "81", "044525225"},
+		{"40817", "810", "04452522"},
+		{"4081a", "810", "044525225"},
+	} {
+		if _, err := GenerateBankAccountNumber(tt.balance, tt.currency, tt.bic); err == nil {
+			t.Errorf("GenerateBankAccountNumber(%q, %q, %q): ожидалась ошибка", tt.balance, tt.currency, tt.bic)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// LegacyKeyID обозначает записи, зашифрованные прежней XOR-схемой
+// Такие записи можно только расшифровать; новые данные шифруются AES-256-GCM
+const LegacyKeyID = "legacy-xor"
+
+// devKeyID - идентификатор ключа разработки, если ENCRYPTION_KEYS не задан
+const devKeyID = "dev"
+
+// keyring хранит ключи AES-256 по идентификаторам и выбранный для шифрования ключ
+type keyring struct {
+	keys   map[string][]byte
+	active string
+}
+
+var (
+	defaultKeyring     *keyring
+	defaultKeyringErr  error
+	defaultKeyringOnce sync.Once
+)
+
+// InitKeyring загружает ключи шифрования данных из окружения
+// Вызывается при старте, чтобы ошибки конфигурации обнаруживались сразу
+//
+// Переменные окружения:
+//   - ENCRYPTION_KEYS - список ключей "id:base64,id:base64", каждый ключ - 32 байта
+//   - ENCRYPTION_ACTIVE_KEY_ID - ключ для шифрования новых данных; по умолчанию последний в списке
+func InitKeyring() error {
+	_, err := loadKeyring()
+	return err
+}
+
+// ActiveKeyID возвращает идентификатор ключа, которым шифруются новые данные
+func ActiveKeyID() (string, error) {
+	kr, err := loadKeyring()
+	if err != nil {
+		return "", err
+	}
+	return kr.active, nil
+}
+
+// EncryptField шифрует значение активным ключом (AES-256-GCM)
+// aad связывает шифртекст с записью (например, с ID карты), чтобы его нельзя было
+// перенести в другую запись; то же значение нужно передать при расшифровке
+// Возвращает шифртекст в base64 (nonce || ciphertext) и идентификатор ключа
+func EncryptField(plaintext, aad string) (string, string, error) {
+	kr, err := loadKeyring()
+	if err != nil {
+		return "", "", err
+	}
+
+	gcm, err := newGCM(kr.keys[kr.active])
+	if err != nil {
+		return "", "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", fmt.Errorf("не удалось сгенерировать nonce: %w", err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), []byte(aad))
+	return base64.StdEncoding.EncodeToString(sealed), kr.active, nil
+}
+
+// DecryptField расшифровывает значение ключом keyID
+// Для LegacyKeyID используется прежняя XOR-схема, aad при этом не проверяется
+func DecryptField(ciphertext, keyID, aad string) (string, error) {
+	if keyID == LegacyKeyID {
+		return decryptLegacyXOR(ciphertext)
+	}
+
+	kr, err := loadKeyring()
+	if err != nil {
+		return "", err
+	}
+	key, ok := kr.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("ключ шифрования %q не найден", keyID)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("не удалось декодировать base64: %w", err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("шифртекст слишком короткий")
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], []byte(aad))
+	if err != nil {
+		return "", fmt.Errorf("не удалось расшифровать данные ключом %q: %w", keyID, err)
+	}
+	return string(plaintext), nil
+}
+
+// CVVAssociatedData возвращает aad для шифрования CVV карты cardID
+// Оно отличается от aad номера (ID карты), чтобы шифртексты номера и CVV нельзя было поменять местами
+func CVVAssociatedData(cardID string) string {
+	return cardID + ":cvv"
+}
+
+// GenerateEncryptionKey создает случайный ключ AES-256 в base64 для ENCRYPTION_KEYS
+func GenerateEncryptionKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// loadKeyring возвращает набор ключей процесса, загружая его при первом обращении
+func loadKeyring() (*keyring, error) {
+	defaultKeyringOnce.Do(func() {
+		defaultKeyring, defaultKeyringErr = parseKeyring(os.Getenv("ENCRYPTION_KEYS"), os.Getenv("ENCRYPTION_ACTIVE_KEY_ID"))
+	})
+	return defaultKeyring, defaultKeyringErr
+}
+
+// parseKeyring разбирает список ключей "id:base64,id:base64"
+func parseKeyring(spec, activeID string) (*keyring, error) {
+	kr := &keyring{keys: make(map[string][]byte)}
+
+	if strings.TrimSpace(spec) == "" {
+		// Ключ для разработки выводится из ENCRYPTION_KEY - в продакшене должен быть задан ENCRYPTION_KEYS
+		log.Printf("ENCRYPTION_KEYS не задан, используется ключ разработки %q", devKeyID)
+		sum := sha256.Sum256(encryptionKey)
+		kr.keys[devKeyID] = sum[:]
+		kr.active = devKeyID
+		return kr, nil
+	}
+
+	var lastID string
+	for _, item := range strings.Split(spec, ",") {
+		id, encoded, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("некорректный элемент ENCRYPTION_KEYS %q: ожидается id:base64", item)
+		}
+		if id == LegacyKeyID {
+			return nil, fmt.Errorf("идентификатор ключа %q зарезервирован", LegacyKeyID)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("ключ %q: не удалось декодировать base64: %w", id, err)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("ключ %q: ожидается 32 байта, получено %d", id, len(key))
+		}
+		if _, exists := kr.keys[id]; exists {
+			return nil, fmt.Errorf("ключ %q указан дважды", id)
+		}
+		kr.keys[id] = key
+		lastID = id
+	}
+
+	kr.active = lastID
+	if activeID != "" {
+		kr.active = activeID
+	}
+	if _, ok := kr.keys[kr.active]; !ok {
+		return nil, fmt.Errorf("активный ключ шифрования %q не найден в ENCRYPTION_KEYS", kr.active)
+	}
+	return kr, nil
+}
+
+// newGCM создает AES-GCM для ключа
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось создать шифр AES: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -69,3 +69,48 @@ func GeneratePaymentSchedule(loanAmount decimal.Decimal, annualRate decimal.Deci
 	}
 	return schedule
 }
+
+// GenerateDifferentiatedSchedule генерирует график платежей с дифференцированным погашением:
+// основной долг гасится равными долями, проценты начисляются на остаток, поэтому платежи убывают
+func GenerateDifferentiatedSchedule(loanAmount decimal.Decimal, annualRate decimal.Decimal, termMonths int, startDate time.Time) []models.Payment {
+	schedule := make([]models.Payment, 0, termMonths)
+	if termMonths <= 0 {
+		return schedule
+	}
+	remainingPrincipal := loanAmount
+	monthlyRate := annualRate.Div(decimal.NewFromInt(12)).Div(decimal.NewFromInt(100))
+	principalShare := loanAmount.Div(decimal.NewFromInt(int64(termMonths))).RoundBank(2)
+
+	for i := 0; i < termMonths; i++ {
+		interestPart := remainingPrincipal.Mul(monthlyRate).RoundBank(2)
+		principalPart := principalShare
+		// Последний платеж гасит остаток, накопившийся из-за округления долей
+		if i == termMonths-1 || principalPart.GreaterThan(remainingPrincipal) {
+			principalPart = remainingPrincipal
+		}
+
+		schedule = append(schedule, models.Payment{
+			DueDate:       startDate.AddDate(0, i+1, 0),
+			Amount:        principalPart.Add(interestPart),
+			PrincipalPart: principalPart,
+			InterestPart:  interestPart,
+			Paid:          false,
+		})
+
+		remainingPrincipal = remainingPrincipal.Sub(principalPart)
+		if remainingPrincipal.LessThanOrEqual(decimal.Zero) {
+			break
+		}
+	}
+	return schedule
+}
+
+// GenerateLoanSchedule генерирует график платежей способом погашения amortization:
+// аннуитетными платежами (по умолчанию) или дифференцированными
+func GenerateLoanSchedule(amortization string, loanAmount decimal.Decimal, annualRate decimal.Decimal, termMonths int, startDate time.Time) []models.Payment {
+	if amortization == models.AmortizationDifferentiated {
+		return GenerateDifferentiatedSchedule(loanAmount, annualRate, termMonths, startDate)
+	}
+	monthlyPayment := CalculateMonthlyPayment(loanAmount, annualRate, termMonths)
+	return GeneratePaymentSchedule(loanAmount, annualRate, termMonths, startDate, monthlyPayment)
+}